@@ -2,70 +2,100 @@ package auth
 
 import (
 	pb "auth/genproto/users"
-	"github.com/dgrijalva/jwt-go"
-	"log"
+	"errors"
 	"time"
 )
 
 const (
-	signingkey = "visca barsa"
+	// PasswordChangeScope marks a restricted access token, which only lets
+	// its user change their password.
+	PasswordChangeScope = "password_change"
 )
 
-func GeneratedAccessJWTToken(req *pb.UserInfo, tok *pb.Tokens) error {
+// GeneratedAccessToken issues the access token of a user, with the extra
+// claims of the claim mappers. A non-empty jkt binds it to the key of a
+// DPoP proof.
+func (t *Tokens) GeneratedAccessToken(req *pb.UserInfo, tok *pb.Tokens, jkt string, extra map[string]interface{}) error {
+	claims := Claims{}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	claims["user_id"] = req.Id
+	claims["role"] = req.Role
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(t.lifetimes.Access).Unix()
+	bind(claims, tok, jkt)
+
+	newToken, err := t.Issue(KindAccess, claims)
+	if err != nil {
+		return err
+	}
 
-	token := *jwt.New(jwt.SigningMethodHS256)
+	tok.Accestoken = newToken
+	return nil
+}
 
-	//payload
-	claims := token.Claims.(jwt.MapClaims)
+// GeneratedPasswordChangeToken issues the short-lived restricted access
+// token of a user who has to change their password. It has no role, so no
+// role check passes with it.
+func (t *Tokens) GeneratedPasswordChangeToken(req *pb.UserInfo, tok *pb.Tokens, jkt string) error {
+	claims := Claims{}
 	claims["user_id"] = req.Id
+	claims["scope"] = PasswordChangeScope
 	claims["iat"] = time.Now().Unix()
-	claims["exp"] = time.Now().Add(30 * time.Minute).Unix()
+	claims["exp"] = time.Now().Add(t.lifetimes.PasswordChange).Unix()
+	bind(claims, tok, jkt)
 
-	newToken, err := token.SignedString([]byte(signingkey))
+	newToken, err := t.Issue(KindAccess, claims)
 	if err != nil {
-		log.Println(err)
 		return err
 	}
 
 	tok.Accestoken = newToken
+	tok.PasswordChangeRequired = true
 	return nil
 }
 
-func ValidateAccessToken(tokenStr string) (bool, error) {
-	_, err := ExtractAccessClaim(tokenStr)
-	if err != nil {
-		return false, err
+// bind adds the cnf claim of RFC 9449 for a token bound to a DPoP key.
+func bind(claims Claims, tok *pb.Tokens, jkt string) {
+	if jkt == "" {
+		return
+	}
+	claims["cnf"] = map[string]interface{}{"jkt": jkt}
+	if tok != nil {
+		tok.TokenType = "DPoP"
 	}
-	return true, nil
 }
 
-func ExtractAccessClaim(tokenStr string) (*jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-		return []byte(signingkey), nil
-	})
+// Confirmation returns the thumbprint of the DPoP key a token is bound to,
+// or "" for a bearer token.
+func Confirmation(claims Claims) string {
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	jkt, _ := cnf["jkt"].(string)
+	return jkt
+}
 
+func (t *Tokens) ValidateAccessToken(tokenStr string) (bool, error) {
+	_, err := t.ExtractAccessClaim(tokenStr)
 	if err != nil {
-		return nil, err
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !(ok && token.Valid) {
-		return nil, err
+		return false, err
 	}
+	return true, nil
+}
 
-	return &claims, nil
+// ExtractAccessClaim verifies an access token in any accepted format.
+func (t *Tokens) ExtractAccessClaim(tokenStr string) (Claims, error) {
+	return t.Verify(KindAccess, tokenStr)
 }
 
-func GetUserIdFromAccessToken(accessTokenString string) (string, error) {
-	refreshToken, err := jwt.Parse(accessTokenString, func(token *jwt.Token) (interface{}, error) { return []byte(signingkey), nil })
-	if err != nil || !refreshToken.Valid {
+func (t *Tokens) GetUserIdFromAccessToken(accessTokenString string) (string, error) {
+	claims, err := t.ExtractAccessClaim(accessTokenString)
+	if err != nil {
 		return "", err
 	}
-	claims, ok := refreshToken.Claims.(jwt.MapClaims)
+	userID, ok := claims["user_id"].(string)
 	if !ok {
-		return "", err
+		return "", errors.New("access token has no user_id")
 	}
-	userID := claims["user_id"].(string)
-
 	return userID, nil
 }
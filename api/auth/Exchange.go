@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"auth/pkg/exchange"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExchangeSubject reads the access token a service presents for token
+// exchange. Restricted password change tokens cannot be exchanged.
+func (t *Tokens) ExchangeSubject(tokenStr string) (exchange.Subject, error) {
+	claims, err := t.ExtractAccessClaim(tokenStr)
+	if err != nil {
+		return exchange.Subject{}, err
+	}
+	if claims == nil {
+		return exchange.Subject{}, errors.New("invalid access token")
+	}
+	userID, _ := claims["user_id"].(string)
+	scope, _ := claims["scope"].(string)
+	if userID == "" || scope == PasswordChangeScope {
+		return exchange.Subject{}, errors.New("token cannot be exchanged")
+	}
+	subject := exchange.Subject{UserID: userID, Scope: scope, Audience: Audience(claims)}
+	subject.Act, _ = claims["act"].(map[string]interface{})
+	if exp, ok := claims["exp"].(float64); ok {
+		subject.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	return subject, nil
+}
+
+// Audience returns the aud claim, which may be a string or a list.
+func Audience(claims Claims) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		var res []string
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// GeneratedExchangeToken issues the token granted by a token exchange.
+// It is meant for the audience service alone and names the chain of
+// services acting for the user in act, next to the extra claims mapped for
+// that audience. A non-empty jkt binds it to the key of the DPoP proof of
+// the client.
+func (t *Tokens) GeneratedExchangeToken(g *exchange.Grant, jkt string, extra map[string]interface{}, now time.Time) (string, error) {
+	claims := Claims{}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	claims["user_id"] = g.UserID
+	claims["sub"] = g.UserID
+	claims["aud"] = g.Audience
+	claims["client_id"] = g.ClientID
+	claims["act"] = g.Act
+	if g.Scope != "" {
+		claims["scope"] = g.Scope
+	}
+	claims["jti"] = uuid.NewString()
+	claims["iat"] = now.Unix()
+	claims["exp"] = g.ExpiresAt.Unix()
+	bind(claims, nil, jkt)
+
+	return t.Issue(KindAccess, claims)
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"auth/config"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Kinds of tokens. Each kind is signed so that a token of one kind is never
+// accepted as another.
+const (
+	KindAccess  = "access"
+	KindRefresh = "refresh"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown or disabled token format")
+	ErrExpired       = errors.New("token is expired")
+)
+
+// Claims are the claims of a token, whatever its format. Times are Unix
+// seconds as float64, the way JWTs decode them.
+type Claims map[string]interface{}
+
+// Issuer signs claims into a token.
+type Issuer interface {
+	Issue(kind string, claims Claims) (string, error)
+}
+
+// Verifier checks the signature and the lifetime of a token and returns its
+// claims.
+type Verifier interface {
+	Verify(kind string, token string) (Claims, error)
+}
+
+// Format is a token format.
+type Format interface {
+	Issuer
+	Verifier
+	Name() string
+	// Recognizes tells whether token is of this format, without checking
+	// it.
+	Recognizes(token string) bool
+}
+
+// Tokens issues tokens in one format and accepts several, so that tokens
+// issued before a switch of formats stay good until they expire. The
+// tokens it issues at login and refresh are good for its lifetimes.
+type Tokens struct {
+	issuer    Format
+	accepted  []Format
+	lifetimes Lifetimes
+}
+
+func NewTokens(lifetimes Lifetimes, issuer Format, accepted ...Format) *Tokens {
+	return &Tokens{issuer: issuer, accepted: append([]Format{issuer}, accepted...), lifetimes: lifetimes}
+}
+
+func (t *Tokens) Issue(kind string, claims Claims) (string, error) {
+	return t.issuer.Issue(kind, claims)
+}
+
+func (t *Tokens) Verify(kind string, token string) (Claims, error) {
+	for _, f := range t.accepted {
+		if f.Recognizes(token) {
+			return f.Verify(kind, token)
+		}
+	}
+	return nil, ErrUnknownFormat
+}
+
+// Lifetimes are the lifetimes of the tokens issued at login and refresh.
+type Lifetimes struct {
+	Access         time.Duration
+	PasswordChange time.Duration
+	Refresh        time.Duration
+}
+
+func (t *Tokens) Lifetimes() Lifetimes {
+	return t.lifetimes
+}
+
+// FromConfig sets up the keys and lifetimes of tokens and picks the format
+// of new tokens and the formats accepted.
+func FromConfig(cfg config.TokenConfig) (*Tokens, error) {
+	formats := map[string]Format{"jwt": NewJWT(cfg.JWT_ACCESS_SECRET, cfg.JWT_REFRESH_SECRET)}
+	if cfg.PASETO_SECRET_KEY != "" {
+		p, err := NewPASETO(cfg.PASETO_SECRET_KEY)
+		if err != nil {
+			return nil, err
+		}
+		formats["paseto"] = p
+	}
+	issuer, ok := formats[cfg.TOKEN_FORMAT]
+	if !ok {
+		return nil, fmt.Errorf("token format %q is unknown or has no key", cfg.TOKEN_FORMAT)
+	}
+	var accepted []Format
+	for _, name := range cfg.TOKEN_ACCEPT_FORMATS {
+		f, ok := formats[name]
+		if !ok {
+			return nil, fmt.Errorf("token format %q is unknown or has no key", name)
+		}
+		if f != issuer {
+			accepted = append(accepted, f)
+		}
+	}
+	return NewTokens(Lifetimes{
+		Access:         cfg.ACCESS_TOKEN_TTL,
+		PasswordChange: cfg.PASSWORD_CHANGE_TOKEN_TTL,
+		Refresh:        cfg.REFRESH_TOKEN_TTL,
+	}, issuer, accepted...), nil
+}
+
+// numericTime reads a time claim set by this package or decoded from JSON.
+func numericTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case int64:
+		return time.Unix(t, 0), true
+	case int:
+		return time.Unix(int64(t), 0), true
+	case float64:
+		sec, frac := math.Modf(t)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e6))*1e3), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"auth/config"
+	pb "auth/genproto/users"
+	"auth/pkg/paseto"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testTokenConfig(format string, accept ...string) config.TokenConfig {
+	return config.TokenConfig{
+		TOKEN_FORMAT:              format,
+		TOKEN_ACCEPT_FORMATS:      accept,
+		PASETO_SECRET_KEY:         strings.Repeat("ab", 32),
+		JWT_ACCESS_SECRET:         "access secret",
+		JWT_REFRESH_SECRET:        "refresh secret",
+		ACCESS_TOKEN_TTL:          time.Minute,
+		PASSWORD_CHANGE_TOKEN_TTL: time.Minute,
+		REFRESH_TOKEN_TTL:         time.Hour,
+	}
+}
+
+func fromConfig(t *testing.T, cfg config.TokenConfig) *Tokens {
+	t.Helper()
+	tokens, err := FromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func issue(t *testing.T, tokens *Tokens) *pb.Tokens {
+	t.Helper()
+	var tok pb.Tokens
+	user := &pb.UserInfo{Id: "u1", Role: "user"}
+	if err := tokens.GeneratedAccessToken(user, &tok, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tokens.GeneratedRefreshToken(user, &tok, ""); err != nil {
+		t.Fatal(err)
+	}
+	return &tok
+}
+
+func TestFromConfigMigration(t *testing.T) {
+	old := issue(t, fromConfig(t, testTokenConfig("jwt")))
+	if strings.HasPrefix(old.Accestoken, paseto.Header) {
+		t.Fatalf("jwt issued %q", old.Accestoken)
+	}
+
+	// Halfway through the switch new tokens are PASETOs and the JWTs
+	// issued before keep working until they expire.
+	tokens := fromConfig(t, testTokenConfig("paseto", "jwt"))
+	current := issue(t, tokens)
+	if !strings.HasPrefix(current.Accestoken, paseto.Header) || !strings.HasPrefix(current.Refreshtoken, paseto.Header) {
+		t.Fatalf("paseto issued %q and %q", current.Accestoken, current.Refreshtoken)
+	}
+	for name, tok := range map[string]*pb.Tokens{"jwt": old, "paseto": current} {
+		if claims, err := tokens.ExtractAccessClaim(tok.Accestoken); err != nil || claims["user_id"] != "u1" {
+			t.Errorf("%s access token: %v, %v", name, claims, err)
+		}
+		if claims, err := tokens.ExtractRefreshClaim(tok.Refreshtoken); err != nil || claims["user_id"] != "u1" {
+			t.Errorf("%s refresh token: %v, %v", name, claims, err)
+		}
+		// Each kind is signed apart, so one never passes for the other.
+		if _, err := tokens.ExtractAccessClaim(tok.Refreshtoken); err == nil {
+			t.Errorf("%s refresh token accepted as an access token", name)
+		}
+		if _, err := tokens.ExtractRefreshClaim(tok.Accestoken); err == nil {
+			t.Errorf("%s access token accepted as a refresh token", name)
+		}
+	}
+
+	// Once the JWTs have expired they are no longer accepted.
+	tokens = fromConfig(t, testTokenConfig("paseto"))
+	if _, err := tokens.ExtractAccessClaim(old.Accestoken); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("jwt after the switch = %v, want ErrUnknownFormat", err)
+	}
+	if _, err := tokens.ExtractAccessClaim(current.Accestoken); err != nil {
+		t.Errorf("paseto after the switch = %v", err)
+	}
+}
+
+func TestFromConfigUnknownFormat(t *testing.T) {
+	noKey := testTokenConfig("paseto")
+	noKey.PASETO_SECRET_KEY = ""
+	acceptNoKey := testTokenConfig("jwt", "paseto")
+	acceptNoKey.PASETO_SECRET_KEY = ""
+	for name, cfg := range map[string]config.TokenConfig{
+		"unknown format":          testTokenConfig("xml"),
+		"unknown accepted format": testTokenConfig("jwt", "xml"),
+		"format without key":      noKey,
+		"accepted without key":    acceptNoKey,
+	} {
+		if _, err := FromConfig(cfg); err == nil {
+			t.Errorf("%s: FromConfig succeeded", name)
+		}
+	}
+
+	tokens := fromConfig(t, testTokenConfig("jwt"))
+	if _, err := tokens.ExtractAccessClaim("v3.local.whatever"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("token of an unknown format = %v, want ErrUnknownFormat", err)
+	}
+}
+
+// TestIssuedAt checks that refresh tokens of both formats tell their issue
+// time to the microsecond.
+func TestIssuedAt(t *testing.T) {
+	for _, format := range []string{"jwt", "paseto"} {
+		tokens := fromConfig(t, testTokenConfig(format))
+		before := time.Now().Truncate(time.Microsecond)
+		tok := issue(t, tokens)
+		after := time.Now()
+		claims, err := tokens.ExtractRefreshClaim(tok.Refreshtoken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if iat := IssuedAt(claims); iat.Before(before) || iat.After(after) {
+			t.Errorf("%s: issued at %v, want between %v and %v", format, iat, before, after)
+		}
+	}
+}
@@ -2,23 +2,23 @@ package auth
 
 import (
 	pb "auth/genproto/users"
-	"github.com/dgrijalva/jwt-go"
+	"errors"
 	"time"
 )
 
-const (
-	newsigningkey = "visca barsa visca kataluniya"
-)
-
-func GeneratedRefreshJWTToken(req *pb.UserInfo, tok *pb.Tokens) error {
-	token := *jwt.New(jwt.SigningMethodHS256)
-	//payload
-	claims := token.Claims.(jwt.MapClaims)
+// GeneratedRefreshToken issues the refresh token of a user. A non-empty jkt
+// binds it to the key of a DPoP proof.
+func (t *Tokens) GeneratedRefreshToken(req *pb.UserInfo, tok *pb.Tokens, jkt string) error {
+	now := time.Now()
+	claims := Claims{}
 	claims["user_id"] = req.Id
-	claims["iat"] = time.Now().Unix()
-	claims["exp"] = time.Now().Add(24 * time.Hour).Unix()
+	// Revocations are kept to the microsecond, and so is the issue time:
+	// whole seconds would tie with a revocation in the same second.
+	claims["iat"] = float64(now.UnixMicro()) / 1e6
+	claims["exp"] = now.Add(t.lifetimes.Refresh).Unix()
+	bind(claims, tok, jkt)
 
-	newToken, err := token.SignedString([]byte(newsigningkey))
+	newToken, err := t.Issue(KindRefresh, claims)
 	if err != nil {
 		return err
 	}
@@ -27,41 +27,34 @@ func GeneratedRefreshJWTToken(req *pb.UserInfo, tok *pb.Tokens) error {
 	return nil
 }
 
-func ValidateRefreshToken(tokenStr string) (bool, error) {
-	_, err := ExtractRefreshClaim(tokenStr)
+// IssuedAt returns when a token was issued, or the zero time if it does not
+// say.
+func IssuedAt(claims Claims) time.Time {
+	iat, _ := numericTime(claims["iat"])
+	return iat
+}
+
+func (t *Tokens) ValidateRefreshToken(tokenStr string) (bool, error) {
+	_, err := t.ExtractRefreshClaim(tokenStr)
 	if err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-func ExtractRefreshClaim(tokenStr string) (*jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-		return []byte(newsigningkey), nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !(ok && token.Valid) {
-		return nil, err
-	}
-
-	return &claims, nil
+// ExtractRefreshClaim verifies a refresh token in any accepted format.
+func (t *Tokens) ExtractRefreshClaim(tokenStr string) (Claims, error) {
+	return t.Verify(KindRefresh, tokenStr)
 }
 
-func GetUserIdFromRefreshToken(accessTokenString string) (string, error) {
-	refreshToken, err := jwt.Parse(accessTokenString, func(token *jwt.Token) (interface{}, error) { return []byte(newsigningkey), nil })
-	if err != nil || !refreshToken.Valid {
+func (t *Tokens) GetUserIdFromRefreshToken(refreshTokenString string) (string, error) {
+	claims, err := t.ExtractRefreshClaim(refreshTokenString)
+	if err != nil {
 		return "", err
 	}
-	claims, ok := refreshToken.Claims.(jwt.MapClaims)
+	userID, ok := claims["user_id"].(string)
 	if !ok {
-		return "", err
+		return "", errors.New("refresh token has no user_id")
 	}
-	userID := claims["user_id"].(string)
-
 	return userID, nil
 }
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// Cookies of a browser session. The access and refresh tokens are HttpOnly;
+// the CSRF token is readable by the frontend, which repeats it in
+// CSRFHeader on every state-changing request.
+const (
+	AccessCookie  = "access_token"
+	RefreshCookie = "refresh_token"
+	CSRFCookie    = "csrf_token"
+	CSRFHeader    = "X-CSRF-Token"
+	// RefreshCookiePath keeps the refresh token away from every route but
+	// refresh and logout.
+	RefreshCookiePath = "/api/v1/auth"
+)
+
+// LogoutMetadata carries the access or refresh token of a user logging out
+// to the User service, which ends the sessions of its owner.
+const LogoutMetadata = "x-logout-token"
+
+// NewCSRFToken returns a random token for the double submit check.
+func NewCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -15,56 +15,98 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/v1/auth/login": {
-            "post": {
-                "description": "it generates new access and refresh tokens",
+        "/api/v1/admin/audit-events": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "security events such as logins, password changes, token refreshes and revocations, role changes, deletions and admin actions, newest first",
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "auth"
+                    "admin"
                 ],
-                "summary": "login user",
+                "summary": "list audit events",
                 "parameters": [
                     {
-                        "description": "username and password",
-                        "name": "userinfo",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/users.LoginRequest"
-                        }
+                        "type": "string",
+                        "description": "event, e.g. auth.login",
+                        "name": "event",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "success or failure",
+                        "name": "outcome",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "who acted: a user id, or scim:\u003corganization id\u003e",
+                        "name": "actor_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "what was acted on",
+                        "name": "target_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "address of the client",
+                        "name": "ip",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, inclusive",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, exclusive",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size, 50 by default and 500 at most",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "number of events to skip",
+                        "name": "offset",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/users.Tokens"
+                            "$ref": "#/definitions/users.AuditEventList"
                         }
                     },
                     "400": {
-                        "description": "Invalid date",
+                        "description": "Invalid data",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "500": {
-                        "description": "error while reading from server",
+                    "403": {
+                        "description": "Permission denied",
                         "schema": {
                             "type": "string"
                         }
-                    }
-                }
-            }
-        },
-        "/api/v1/auth/logout": {
-            "post": {
-                "description": "you log out",
-                "tags": [
-                    "auth"
-                ],
-                "summary": "Logout user",
-                "responses": {
-                    "200": {
-                        "description": "OK",
+                    },
+                    "500": {
+                        "description": "error while reading from server",
                         "schema": {
                             "type": "string"
                         }
@@ -72,21 +114,36 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/auth/refresh": {
-            "post": {
-                "description": "it changes your access token",
+        "/api/v1/admin/organizations/{slug}/password-expiry": {
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "sets how many days passwords of the members of an organization are good for; 0 turns expiry off",
+                "consumes": [
+                    "application/json"
+                ],
                 "tags": [
-                    "auth"
+                    "admin"
                 ],
-                "summary": "Refresh token",
+                "summary": "set password expiry",
                 "parameters": [
                     {
-                        "description": "token",
-                        "name": "userinfo",
+                        "type": "string",
+                        "description": "organization slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "max_age_days",
+                        "name": "expiry",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/users.CheckRefreshTokenRequest"
+                            "$ref": "#/definitions/users.PasswordExpiryRequest"
                         }
                     }
                 ],
@@ -94,17 +151,23 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/users.Tokens"
+                            "type": "string"
                         }
                     },
                     "400": {
-                        "description": "Invalid date",
+                        "description": "Invalid data",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "401": {
-                        "description": "Invalid token",
+                    "403": {
+                        "description": "Permission denied",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Organization not found",
                         "schema": {
                             "type": "string"
                         }
@@ -118,29 +181,46 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/auth/register": {
+        "/api/v1/admin/organizations/{slug}/scim-tokens": {
             "post": {
-                "description": "create new users",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "issues a bearer token a partner agency provisions its staff with; the token is only shown once",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "auth"
+                    "admin"
                 ],
-                "summary": "Register user",
+                "summary": "create SCIM token",
                 "parameters": [
                     {
-                        "description": "User info",
-                        "name": "info",
+                        "type": "string",
+                        "description": "organization slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "{\\",
+                        "name": "description",
                         "in": "body",
-                        "required": true,
                         "schema": {
-                            "$ref": "#/definitions/users.RegisterRequest"
+                            "type": "object"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/users.RegisterResponse"
+                            "$ref": "#/definitions/users.ScimTokenResponse"
                         }
                     },
                     "400": {
@@ -149,8 +229,14 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "Permission denied",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
-                        "description": "Server error",
+                        "description": "error while reading from server",
                         "schema": {
                             "type": "string"
                         }
@@ -158,27 +244,24 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/auth/reset-password": {
-            "post": {
+        "/api/v1/admin/scim-tokens/{token_id}": {
+            "delete": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "it changes your password to new one",
                 "tags": [
-                    "userAuth"
+                    "admin"
                 ],
-                "summary": "ResetPass user",
+                "summary": "revoke SCIM token",
                 "parameters": [
                     {
-                        "description": "passwords",
-                        "name": "userinfo",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/users.EmailRecoveryRequest"
-                        }
+                        "type": "string",
+                        "description": "token id",
+                        "name": "token_id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -189,19 +272,19 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid date",
+                        "description": "Invalid data",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "401": {
-                        "description": "Invalid token",
+                    "403": {
+                        "description": "Permission denied",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "500": {
-                        "description": "error while reading from server",
+                    "404": {
+                        "description": "Unknown token",
                         "schema": {
                             "type": "string"
                         }
@@ -209,37 +292,32 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/users": {
-            "get": {
+        "/api/v1/admin/users/{user_id}/force-password-change": {
+            "post": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "you can see all users",
+                "description": "makes the user change their password at the next login, e.g. after a credential leak; their sessions end",
                 "tags": [
-                    "users"
+                    "admin"
                 ],
-                "summary": "all users",
+                "summary": "force password change",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Number of users to fetch",
-                        "name": "limit",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "Number of users to omit",
-                        "name": "offset",
-                        "in": "query"
+                        "description": "user_id",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/users.GetUsersResponse"
+                            "type": "string"
                         }
                     },
                     "400": {
@@ -248,6 +326,18 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "Permission denied",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "error while reading from server",
                         "schema": {
@@ -257,27 +347,42 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/users/profile": {
-            "get": {
+        "/api/v1/admin/users/{user_id}/unlock": {
+            "post": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "you can see your profile",
+                "description": "lifts the lockouts of the account and of the addresses that recently signed in to it",
                 "tags": [
-                    "users"
+                    "admin"
+                ],
+                "summary": "unlock user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user_id",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "get user",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/users.GetProfileResponse"
+                            "type": "string"
                         }
                     },
-                    "401": {
-                        "description": "Invalid token",
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Permission denied",
                         "schema": {
                             "type": "string"
                         }
@@ -289,38 +394,77 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "put": {
-                "security": [
-                    {
-                        "ApiKeyAuth": []
-                    }
-                ],
-                "description": "you can update your profile",
+            }
+        },
+        "/api/v1/auth/login": {
+            "post": {
+                "description": "it generates new access and refresh tokens. Users who have to change their password only get a restricted access token, marked by password_change_required, that is good for reset-password alone. With session=cookie the tokens are set as HttpOnly cookies instead and the response carries the csrf_token to send in X-CSRF-Token",
                 "tags": [
-                    "users"
+                    "auth"
                 ],
-                "summary": "ResetPass user",
+                "summary": "login user",
                 "parameters": [
                     {
-                        "description": "info",
+                        "description": "login (username or email) and password",
                         "name": "userinfo",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/users.UpdateProfileRequest"
+                            "$ref": "#/definitions/users.LoginRequest"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "cookie to keep the tokens in cookies",
+                        "name": "session",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "token of the challenge returned with 428",
+                        "name": "X-Challenge-Token",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "solution of the challenge",
+                        "name": "X-Challenge-Answer",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof, binds the issued tokens to its key",
+                        "name": "DPoP",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/users.UpdateProfileResponse"
+                            "$ref": "#/definitions/users.Tokens"
                         }
                     },
                     "400": {
-                        "description": "Invalid data",
+                        "description": "Invalid date",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid login or password",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "428": {
+                        "description": "Challenge required",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
                         "schema": {
                             "type": "string"
                         }
@@ -334,36 +478,120 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/users/{user_id}": {
-            "delete": {
+        "/api/v1/auth/logout": {
+            "post": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "you can delete your profile",
+                "description": "you log out; every refresh token of yours issued so far is revoked and the cookies of a browser session are cleared. Access tokens run out on their own.",
                 "tags": [
-                    "users"
+                    "auth"
                 ],
-                "summary": "delete user",
+                "summary": "Logout user",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "user_id",
-                        "name": "user_id",
-                        "in": "path",
+                        "description": "CSRF token of a cookie session",
+                        "name": "X-CSRF-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid CSRF token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/auth/qr": {
+            "post": {
+                "description": "creates a pending login session for this browser to show as a QR code",
+                "tags": [
+                    "auth"
+                ],
+                "summary": "start QR login",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.QRLoginSession"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/auth/qr/tokens": {
+            "get": {
+                "description": "long-polls until the phone approves; with Accept text/event-stream the tokens arrive as a server-sent \"tokens\" event",
+                "tags": [
+                    "auth"
+                ],
+                "summary": "wait for QR login",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "poll token of the session",
+                        "name": "poll_token",
+                        "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof, binds the issued tokens to its key",
+                        "name": "DPoP",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/users.Tokens"
+                        }
+                    },
+                    "202": {
+                        "description": "Still pending, poll again",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "400": {
-                        "description": "Invalid data",
+                        "description": "access_denied or expired_token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
                         "schema": {
                             "type": "string"
                         }
@@ -377,23 +605,23 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/users/{user_id}/activity": {
+        "/api/v1/auth/qr/{session_id}": {
             "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "you can see your profile activity",
+                "description": "shows the phone where the pending login comes from before approving it",
                 "tags": [
-                    "users"
+                    "auth"
                 ],
-                "summary": "Activities user",
+                "summary": "inspect QR login",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "user_id",
-                        "name": "user_id",
+                        "description": "session id from the QR code",
+                        "name": "session_id",
                         "in": "path",
                         "required": true
                     }
@@ -402,11 +630,11 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/users.ActivityResponse"
+                            "$ref": "#/definitions/users.DeviceAuthorizationInfo"
                         }
                     },
-                    "400": {
-                        "description": "Invalid data",
+                    "404": {
+                        "description": "Unknown or expired session",
                         "schema": {
                             "type": "string"
                         }
@@ -420,106 +648,2068 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/users/{user_id}/follow": {
+        "/api/v1/auth/qr/{session_id}/approve": {
             "post": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "you can follow another user",
+                "description": "signs the browser showing the QR code in as you",
                 "tags": [
-                    "users"
+                    "auth"
                 ],
-                "summary": "follow user",
+                "summary": "approve QR login",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "user_id",
-                        "name": "user_id",
+                        "description": "session id from the QR code",
+                        "name": "session_id",
                         "in": "path",
                         "required": true
                     }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/users.FollowResponse"
-                        }
-                    },
-                    "400": {
-                        "description": "Invalid data",
-                        "schema": {
-                            "type": "string"
-                        }
-                    },
-                    "500": {
-                        "description": "error while reading from server",
-                        "schema": {
-                            "type": "string"
-                        }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown or expired session",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/auth/refresh": {
+            "post": {
+                "description": "it changes your access token. Browser sessions send no body; the refresh_token cookie is used and the new tokens are set as cookies",
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Refresh token",
+                "parameters": [
+                    {
+                        "description": "token",
+                        "name": "userinfo",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/users.CheckRefreshTokenRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "CSRF token of a cookie session",
+                        "name": "X-CSRF-Token",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof, binds the issued tokens to its key",
+                        "name": "DPoP",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/users.Tokens"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid date",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid CSRF token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Password change required, log in again",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/auth/register": {
+            "post": {
+                "description": "create new users",
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Register user",
+                "parameters": [
+                    {
+                        "description": "User info",
+                        "name": "info",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/users.RegisterRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "token of the challenge returned with 428",
+                        "name": "X-Challenge-Token",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "solution of the challenge",
+                        "name": "X-Challenge-Answer",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/users.RegisterResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data or password rejected by the policy, see fields",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Username or email is taken",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "428": {
+                        "description": "Challenge required",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/auth/reset-password": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "it changes your password to new one; restricted tokens issued for a required password change are accepted here",
+                "tags": [
+                    "userAuth"
+                ],
+                "summary": "ResetPass user",
+                "parameters": [
+                    {
+                        "description": "passwords",
+                        "name": "userinfo",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/users.EmailRecoveryRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data or password rejected by the policy, see fields",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/oauth/device": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "approves or denies the device showing the user code",
+                "tags": [
+                    "oauth"
+                ],
+                "summary": "approve device login",
+                "parameters": [
+                    {
+                        "description": "user code and decision",
+                        "name": "info",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/users.DeviceVerificationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown or expired code",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "you can see all users",
+                "tags": [
+                    "users"
+                ],
+                "summary": "all users",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Number of users to fetch",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Number of users to omit",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/users.GetUsersResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/by-username/{username}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "old usernames within their reservation period redirect to the current one",
+                "tags": [
+                    "users"
+                ],
+                "summary": "find user by username",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/users.Users"
+                        }
+                    },
+                    "301": {
+                        "description": "the username has changed, see Location",
+                        "schema": {
+                            "$ref": "#/definitions/users.Users"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/email": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "sends a confirmation link to the new address and a cancel link to the current one",
+                "tags": [
+                    "users"
+                ],
+                "summary": "change email",
+                "parameters": [
+                    {
+                        "description": "current password and new email",
+                        "name": "info",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/users.EmailChangeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Password is incorrect",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/email/cancel": {
+            "get": {
+                "description": "the page the cancel link opens; it changes nothing and posts the token to cancel",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "cancel email change page",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token from the cancel link",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "withdraws a pending email change",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "cancel email change",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token from the cancel link",
+                        "name": "token",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown or finished change",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/email/confirm": {
+            "get": {
+                "description": "the page the confirmation link opens; it changes nothing and posts the token to confirm",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "confirm email change page",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token from the confirmation link",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "swaps the email and signs the user out of all sessions",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "confirm email change",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token from the confirmation link",
+                        "name": "token",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown or expired link",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/profile": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "you can see your profile",
+                "tags": [
+                    "users"
+                ],
+                "summary": "get user",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/users.GetProfileResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "you can update your profile",
+                "tags": [
+                    "users"
+                ],
+                "summary": "ResetPass user",
+                "parameters": [
+                    {
+                        "description": "info",
+                        "name": "userinfo",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/users.UpdateProfileRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/users.UpdateProfileResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/username": {
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "renames you; the old username keeps pointing at your account for a while",
+                "tags": [
+                    "users"
+                ],
+                "summary": "change username",
+                "parameters": [
+                    {
+                        "description": "new username",
+                        "name": "info",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/users.ChangeUsernameRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/users.ChangeUsernameResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid username",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Username is taken",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Changed too recently",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{user_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "you can delete your profile",
+                "tags": [
+                    "users"
+                ],
+                "summary": "delete user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user_id",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{user_id}/activity": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "you can see your profile activity",
+                "tags": [
+                    "users"
+                ],
+                "summary": "Activities user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user_id",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/users.ActivityResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{user_id}/follow": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "you can follow another user",
+                "tags": [
+                    "users"
+                ],
+                "summary": "follow user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user_id",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/users.FollowResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{user_id}/followers": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "you can see your followers",
+                "tags": [
+                    "users"
+                ],
+                "summary": "get followers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user_id",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Number of users to fetch",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Number of users to omit",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/users.FollowersResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz": {
+            "get": {
+                "description": "Answers as long as the process serves HTTP. It does not check the dependencies, so that an outage of the database does not get every instance restarted",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "liveness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/probe.Result"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth/device_authorization": {
+            "post": {
+                "description": "OAuth 2.0 device authorization request (RFC 8628) for TVs and kiosks",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "tags": [
+                    "oauth"
+                ],
+                "summary": "start device login",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "registered device client",
+                        "name": "client_id",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "requested scope",
+                        "name": "scope",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/users.DeviceAuthorizationResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_client",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth/token": {
+            "post": {
+                "description": "polled by devices with grant_type urn:ietf:params:oauth:grant-type:device_code. Services exchange a user's access token for one meant for another service with grant_type urn:ietf:params:oauth:grant-type:token-exchange (RFC 8693), authenticating with HTTP Basic or client_secret",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "tags": [
+                    "oauth"
+                ],
+                "summary": "OAuth token endpoint",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "grant type",
+                        "name": "grant_type",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "device code of the device grant",
+                        "name": "device_code",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "client id",
+                        "name": "client_id",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "secret of a token exchange client",
+                        "name": "client_secret",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "access token of the user, for token exchange",
+                        "name": "subject_token",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "urn:ietf:params:oauth:token-type:access_token",
+                        "name": "subject_token_type",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "service the exchanged token is for",
+                        "name": "audience",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "scope of the exchanged token; defaults to the scope of the subject token the client may request",
+                        "name": "scope",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof, binds the issued tokens to its key",
+                        "name": "DPoP",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/users.Tokens"
+                        }
+                    },
+                    "400": {
+                        "description": "authorization_pending, slow_down, access_denied, expired_token, invalid_grant, invalid_target, invalid_scope or unsupported_grant_type",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "invalid_client",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Checks the database and the gRPC backend and reports each of them; 503 while one is down or the process is shutting down",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "readiness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/probe.Result"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/probe.Result"
+                        }
+                    }
+                }
+            }
+        },
+        "/saml/{idp}/acs": {
+            "post": {
+                "description": "the identity provider posts its response here; a valid response signs the user in",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "tags": [
+                    "sso"
+                ],
+                "summary": "SAML assertion consumer service",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "identity provider id",
+                        "name": "idp",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "base64 encoded SAML response",
+                        "name": "SAMLResponse",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/users.Tokens"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid SAML response",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown identity provider",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Email belongs to another account",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error while reading from server",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/saml/{idp}/login": {
+            "get": {
+                "description": "redirects to the identity provider of the agency with an AuthnRequest",
+                "tags": [
+                    "sso"
+                ],
+                "summary": "start agency SSO",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "identity provider id",
+                        "name": "idp",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "302": {
+                        "description": "Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown identity provider",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/saml/{idp}/metadata": {
+            "get": {
+                "description": "metadata to register us with the identity provider of an agency",
+                "produces": [
+                    "text/xml"
+                ],
+                "tags": [
+                    "sso"
+                ],
+                "summary": "SAML service provider metadata",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "identity provider id",
+                        "name": "idp",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown identity provider",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/scim/v2/Groups": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "SCIM 2.0 query of the groups of the partner organization",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "scim"
+                ],
+                "summary": "list groups",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "SCIM filter, e.g. displayName eq \\",
+                        "name": "filter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "1-based index of the first result",
+                        "name": "startIndex",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size",
+                        "name": "count",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scim.ListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid filter",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "scim"
+                ],
+                "summary": "create group",
+                "parameters": [
+                    {
+                        "description": "group",
+                        "name": "group",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/scim.Group"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Group"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid group or members",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    },
+                    "409": {
+                        "description": "displayName already taken",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/scim/v2/Groups/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "scim"
+                ],
+                "summary": "get group",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "group id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Group"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown group",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "scim"
+                ],
+                "summary": "replace group",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "group id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "version of the group",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "group",
+                        "name": "group",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/scim.Group"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Group"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown group",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    },
+                    "412": {
+                        "description": "Group was modified",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "tags": [
+                    "scim"
+                ],
+                "summary": "delete group",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "group id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Unknown group",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "applies SCIM PATCH operations, typically adding or removing members",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "scim"
+                ],
+                "summary": "patch group",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "group id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "version of the group",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "operations",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/scim.PatchRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Group"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid operation",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown group",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    },
+                    "412": {
+                        "description": "Group was modified",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/scim/v2/Users": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "SCIM 2.0 query of the users of the partner organization",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "scim"
+                ],
+                "summary": "list provisioned users",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "SCIM filter, e.g. userName eq \\",
+                        "name": "filter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "1-based index of the first result",
+                        "name": "startIndex",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size",
+                        "name": "count",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scim.ListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid filter",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid token",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "creates an account for a member of staff of the partner, or brings back one deprovisioned earlier",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "scim"
+                ],
+                "summary": "provision user",
+                "parameters": [
+                    {
+                        "description": "user",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/scim.User"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/scim.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid user",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    },
+                    "409": {
+                        "description": "userName or email already taken",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/scim/v2/Users/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "scim"
+                ],
+                "summary": "get provisioned user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scim.User"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown user",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "overwrites the user; active=false deprovisions it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "scim"
+                ],
+                "summary": "replace provisioned user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "version of the user",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "user",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/scim.User"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scim.User"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown user",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    },
+                    "412": {
+                        "description": "User was modified",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "deactivates the account and removes it from all groups",
+                "tags": [
+                    "scim"
+                ],
+                "summary": "deprovision user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Unknown user",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "applies SCIM PATCH operations; replacing active with false deprovisions the user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "scim"
+                ],
+                "summary": "patch provisioned user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "version of the user",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "operations",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/scim.PatchRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scim.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid operation",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown user",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    },
+                    "412": {
+                        "description": "User was modified",
+                        "schema": {
+                            "$ref": "#/definitions/scim.Error"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "handler.QRLoginSession": {
+            "type": "object",
+            "properties": {
+                "expires_in": {
+                    "type": "integer"
+                },
+                "poll_token": {
+                    "description": "PollToken is kept secret by the browser and used to collect the\ntokens once the phone has approved.",
+                    "type": "string"
+                },
+                "qr_payload": {
+                    "type": "string"
+                },
+                "session_id": {
+                    "description": "SessionID is shown to the phone, encoded in QRPayload.",
+                    "type": "string"
+                }
+            }
+        },
+        "probe.CheckResult": {
+            "type": "object",
+            "properties": {
+                "duration": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "probe.Result": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/probe.CheckResult"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "scim.Email": {
+            "type": "object",
+            "properties": {
+                "primary": {
+                    "type": "boolean"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "scim.Error": {
+            "type": "object",
+            "properties": {
+                "detail": {
+                    "type": "string"
+                },
+                "scimType": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                }
+            }
+        },
+        "scim.Group": {
+            "type": "object",
+            "properties": {
+                "displayName": {
+                    "type": "string"
+                },
+                "externalId": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "members": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/scim.Member"
+                    }
+                },
+                "meta": {
+                    "$ref": "#/definitions/scim.Meta"
+                },
+                "schemas": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "scim.ListResponse": {
+            "type": "object",
+            "properties": {
+                "Resources": {},
+                "itemsPerPage": {
+                    "type": "integer"
+                },
+                "schemas": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "startIndex": {
+                    "type": "integer"
+                },
+                "totalResults": {
+                    "type": "integer"
+                }
+            }
+        },
+        "scim.Member": {
+            "type": "object",
+            "properties": {
+                "$ref": {
+                    "type": "string"
+                },
+                "display": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "scim.Meta": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "string"
+                },
+                "lastModified": {
+                    "type": "string"
+                },
+                "location": {
+                    "type": "string"
+                },
+                "resourceType": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "scim.Name": {
+            "type": "object",
+            "properties": {
+                "familyName": {
+                    "type": "string"
+                },
+                "formatted": {
+                    "type": "string"
+                },
+                "givenName": {
+                    "type": "string"
+                }
+            }
+        },
+        "scim.PatchOperation": {
+            "type": "object",
+            "properties": {
+                "op": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "value": {}
+            }
+        },
+        "scim.PatchRequest": {
+            "type": "object",
+            "properties": {
+                "Operations": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/scim.PatchOperation"
+                    }
+                },
+                "schemas": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
                     }
                 }
             }
         },
-        "/api/v1/users/{user_id}/followers": {
-            "get": {
-                "security": [
-                    {
-                        "ApiKeyAuth": []
+        "scim.User": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "description": "Active is true unless set; an inactive user is deprovisioned.",
+                    "type": "boolean"
+                },
+                "displayName": {
+                    "type": "string"
+                },
+                "emails": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/scim.Email"
                     }
-                ],
-                "description": "you can see your followers",
-                "tags": [
-                    "users"
-                ],
-                "summary": "get followers",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "user_id",
-                        "name": "user_id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Number of users to fetch",
-                        "name": "limit",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "Number of users to omit",
-                        "name": "offset",
-                        "in": "query"
+                },
+                "externalId": {
+                    "type": "string"
+                },
+                "groups": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/scim.Member"
                     }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/users.FollowersResponse"
-                        }
-                    },
-                    "400": {
-                        "description": "Invalid data",
-                        "schema": {
-                            "type": "string"
-                        }
-                    },
-                    "500": {
-                        "description": "error while reading from server",
-                        "schema": {
-                            "type": "string"
-                        }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "meta": {
+                    "$ref": "#/definitions/scim.Meta"
+                },
+                "name": {
+                    "$ref": "#/definitions/scim.Name"
+                },
+                "schemas": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
                     }
+                },
+                "userName": {
+                    "type": "string"
                 }
             }
-        }
-    },
-    "definitions": {
+        },
         "users.ActivityResponse": {
             "type": "object",
             "properties": {
@@ -543,14 +2733,178 @@ const docTemplate = `{
                 }
             }
         },
+        "users.AuditEvent": {
+            "type": "object",
+            "properties": {
+                "actor_id": {
+                    "type": "string"
+                },
+                "details": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "event": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "occurred_at": {
+                    "type": "string"
+                },
+                "outcome": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "target_id": {
+                    "type": "string"
+                },
+                "target_type": {
+                    "type": "string"
+                },
+                "user_agent": {
+                    "type": "string"
+                }
+            }
+        },
+        "users.AuditEventList": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/users.AuditEvent"
+                    }
+                },
+                "limit": {
+                    "type": "integer"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "users.ChangeUsernameRequest": {
+            "type": "object",
+            "properties": {
+                "new_username": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "users.ChangeUsernameResponse": {
+            "type": "object",
+            "properties": {
+                "next_change_at": {
+                    "type": "string"
+                },
+                "previous_username": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
         "users.CheckRefreshTokenRequest": {
             "type": "object",
             "properties": {
+                "dpop_jkt": {
+                    "description": "dpop_jkt is the thumbprint of the key of the DPoP proof sent with the\nrequest, if any. A bound refresh token needs a proof with the same key.",
+                    "type": "string"
+                },
                 "refresh_token": {
                     "type": "string"
                 }
             }
         },
+        "users.DeviceAuthorizationInfo": {
+            "type": "object",
+            "properties": {
+                "client_id": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "user_agent": {
+                    "type": "string"
+                }
+            }
+        },
+        "users.DeviceAuthorizationResponse": {
+            "type": "object",
+            "properties": {
+                "device_code": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "type": "integer"
+                },
+                "interval": {
+                    "type": "integer"
+                },
+                "user_code": {
+                    "type": "string"
+                },
+                "verification_uri": {
+                    "type": "string"
+                },
+                "verification_uri_complete": {
+                    "type": "string"
+                }
+            }
+        },
+        "users.DeviceVerificationRequest": {
+            "type": "object",
+            "properties": {
+                "approve": {
+                    "type": "boolean"
+                },
+                "user_code": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "users.EmailChangeRequest": {
+            "type": "object",
+            "properties": {
+                "current_password": {
+                    "type": "string"
+                },
+                "new_email": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
         "users.EmailRecoveryRequest": {
             "type": "object",
             "properties": {
@@ -668,11 +3022,29 @@ const docTemplate = `{
                 "email": {
                     "type": "string"
                 },
+                "ip": {
+                    "type": "string"
+                },
+                "login": {
+                    "type": "string"
+                },
                 "password": {
                     "type": "string"
                 }
             }
         },
+        "users.PasswordExpiryRequest": {
+            "type": "object",
+            "properties": {
+                "max_age_days": {
+                    "description": "max_age_days of 0 turns expiry off for the organization.",
+                    "type": "integer"
+                },
+                "organization": {
+                    "type": "string"
+                }
+            }
+        },
         "users.RegisterRequest": {
             "type": "object",
             "properties": {
@@ -710,14 +3082,36 @@ const docTemplate = `{
                 }
             }
         },
+        "users.ScimTokenResponse": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "organization": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
         "users.Tokens": {
             "type": "object",
             "properties": {
                 "accestoken": {
                     "type": "string"
                 },
+                "password_change_required": {
+                    "description": "password_change_required marks a restricted access token that is only\ngood for changing the password.",
+                    "type": "boolean"
+                },
                 "refreshtoken": {
                     "type": "string"
+                },
+                "token_type": {
+                    "description": "token_type is DPoP for tokens bound to the key of a DPoP proof.",
+                    "type": "string"
                 }
             }
         },
@@ -735,6 +3129,10 @@ const docTemplate = `{
                 },
                 "id": {
                     "type": "string"
+                },
+                "locale": {
+                    "description": "locale is a BCP 47 language tag such as en-GB.",
+                    "type": "string"
                 }
             }
         },
@@ -756,6 +3154,9 @@ const docTemplate = `{
                 "id": {
                     "type": "string"
                 },
+                "locale": {
+                    "type": "string"
+                },
                 "updated_at": {
                     "type": "string"
                 },
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	pb "auth/genproto/users"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/status"
+)
+
+// UnlockAccount godoc
+// @Security ApiKeyAuth
+// @Summary unlock user
+// @Description lifts the lockouts of the account and of the addresses that recently signed in to it
+// @Tags admin
+// @Param user_id path string true "user_id"
+// @Success 200 {object} string
+// @Failure 400 {object} string "Invalid data"
+// @Failure 403 {object} string "Permission denied"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/admin/users/{user_id}/unlock [post]
+func (h Handler) UnlockAccount(c *gin.Context) {
+	h.log(c).Info("UnlockAccount is working")
+	id := c.Param("user_id")
+	_, err := uuid.Parse(id)
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user id is incorrect"})
+		return
+	}
+
+	_, err = h.User.UnlockAccount(c, &pb.UserId{Id: id})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "account unlocked"})
+	h.log(c).Info("UnlockAccount ended")
+}
+
+// ForcePasswordChange godoc
+// @Security ApiKeyAuth
+// @Summary force password change
+// @Description makes the user change their password at the next login, e.g. after a credential leak; their sessions end
+// @Tags admin
+// @Param user_id path string true "user_id"
+// @Success 200 {object} string
+// @Failure 400 {object} string "Invalid data"
+// @Failure 403 {object} string "Permission denied"
+// @Failure 404 {object} string "User not found"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/admin/users/{user_id}/force-password-change [post]
+func (h Handler) ForcePasswordChange(c *gin.Context) {
+	h.log(c).Info("ForcePasswordChange is working")
+	id := c.Param("user_id")
+	if _, err := uuid.Parse(id); err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user id is incorrect"})
+		return
+	}
+
+	_, err := h.User.ForcePasswordChange(c, &pb.UserId{Id: id})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "password change required at next login"})
+	h.log(c).Info("ForcePasswordChange ended")
+}
+
+// SetPasswordExpiry godoc
+// @Security ApiKeyAuth
+// @Summary set password expiry
+// @Description sets how many days passwords of the members of an organization are good for; 0 turns expiry off
+// @Tags admin
+// @Accept json
+// @Param slug path string true "organization slug"
+// @Param expiry body users.PasswordExpiryRequest true "max_age_days"
+// @Success 200 {object} string
+// @Failure 400 {object} string "Invalid data"
+// @Failure 403 {object} string "Permission denied"
+// @Failure 404 {object} string "Organization not found"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/admin/organizations/{slug}/password-expiry [put]
+func (h Handler) SetPasswordExpiry(c *gin.Context) {
+	h.log(c).Info("SetPasswordExpiry is working")
+	req := pb.PasswordExpiryRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Organization = c.Param("slug")
+
+	_, err := h.User.SetPasswordExpiry(c, &req)
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "password expiry updated"})
+	h.log(c).Info("SetPasswordExpiry ended")
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	pb "auth/genproto/users"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/status"
+)
+
+// ListAuditEvents godoc
+// @Security ApiKeyAuth
+// @Summary list audit events
+// @Description security events such as logins, password changes, token refreshes and revocations, role changes, deletions and admin actions, newest first
+// @Tags admin
+// @Produce json
+// @Param event query string false "event, e.g. auth.login"
+// @Param outcome query string false "success or failure"
+// @Param actor_id query string false "who acted: a user id, or scim:<organization id>"
+// @Param target_id query string false "what was acted on"
+// @Param ip query string false "address of the client"
+// @Param from query string false "RFC 3339 time, inclusive"
+// @Param to query string false "RFC 3339 time, exclusive"
+// @Param limit query int false "page size, 50 by default and 500 at most"
+// @Param offset query int false "number of events to skip"
+// @Success 200 {object} users.AuditEventList
+// @Failure 400 {object} string "Invalid data"
+// @Failure 403 {object} string "Permission denied"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/admin/audit-events [get]
+func (h Handler) ListAuditEvents(c *gin.Context) {
+	h.log(c).Info("ListAuditEvents is working")
+	req := pb.AuditEventFilter{
+		Event:    c.Query("event"),
+		Outcome:  c.Query("outcome"),
+		ActorId:  c.Query("actor_id"),
+		TargetId: c.Query("target_id"),
+		Ip:       c.Query("ip"),
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+	}
+	for name, value := range map[string]*int64{"limit": &req.Limit, "offset": &req.Offset} {
+		s := c.Query(name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			h.log(c).Error(err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a number"})
+			return
+		}
+		*value = n
+	}
+
+	res, err := h.User.ListAuditEvents(c, &req)
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+	h.log(c).Info("ListAuditEvents ended")
+}
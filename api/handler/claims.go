@@ -0,0 +1,12 @@
+package handler
+
+import (
+	pb "auth/genproto/users"
+	"context"
+)
+
+// tokenProfile fetches what the claim mappers may put into the access
+// tokens of a user, for claims.Enricher.Load.
+func (h Handler) tokenProfile(ctx context.Context, userID string) (*pb.TokenProfile, error) {
+	return h.User.GetTokenProfile(ctx, &pb.UserId{Id: userID})
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"auth/pkg/dpop"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dpopKey verifies the DPoP proof sent to a token endpoint and returns the
+// thumbprint of its key, or "" for a client that does not use DPoP. When
+// the request has to stop, it has answered it already and ok is false.
+func (h Handler) dpopKey(c *gin.Context) (jkt string, ok bool) {
+	proofs := c.Request.Header.Values(dpop.Header)
+	if h.DPoP == nil {
+		return "", true
+	}
+	if len(proofs) == 0 {
+		if h.DPoP.Required {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_dpop_proof", "error_description": "DPoP proof required"})
+			return "", false
+		}
+		return "", true
+	}
+	if len(proofs) > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_dpop_proof", "error_description": "only one DPoP proof may be sent"})
+		return "", false
+	}
+	jkt, err := h.DPoP.Verify(c, proofs[0], c.Request.Method, c.Request.URL.Path, "")
+	if err != nil {
+		h.log(c).Error(err.Error())
+		if errors.Is(err, dpop.ErrInvalidProof) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_dpop_proof", "error_description": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while checking the DPoP proof"})
+		}
+		return "", false
+	}
+	return jkt, true
+}
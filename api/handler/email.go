@@ -0,0 +1,148 @@
+package handler
+
+import (
+	pb "auth/genproto/users"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/status"
+)
+
+// ChangeEmail godoc
+// @Security ApiKeyAuth
+// @Summary change email
+// @Description sends a confirmation link to the new address and a cancel link to the current one
+// @Tags users
+// @Param info body users.EmailChangeRequest true "current password and new email"
+// @Success 200 {object} string
+// @Failure 400 {object} string "Invalid data"
+// @Failure 403 {object} string "Password is incorrect"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/users/email [post]
+func (h Handler) ChangeEmail(c *gin.Context) {
+	h.log(c).Info("ChangeEmail is working")
+	id, err := h.Tokens.GetUserIdFromAccessToken(c.GetHeader("Authorization"))
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	req := pb.EmailChangeRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserId = id
+
+	_, err = h.User.RequestEmailChange(c, &req)
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "confirmation link sent to the new email"})
+	h.log(c).Info("ChangeEmail ended")
+}
+
+// emailLinkPage is what the links in the emails open. Mail scanners and
+// link previews fetch links on their own, so the page only asks the user
+// to post the token back.
+var emailLinkPage = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>{{.Title}}</title></head>
+<body>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<p>{{.Title}}?</p>
+<button type="submit">{{.Button}}</button>
+</form>
+</body>
+</html>
+`))
+
+// ConfirmEmailPage godoc
+// @Summary confirm email change page
+// @Description the page the confirmation link opens; it changes nothing and posts the token to confirm
+// @Tags users
+// @Produce html
+// @Param token query string true "token from the confirmation link"
+// @Success 200 {object} string
+// @Router /api/v1/users/email/confirm [get]
+func (h Handler) ConfirmEmailPage(c *gin.Context) {
+	h.emailLinkPage(c, "Use this email address for your account", "Confirm")
+}
+
+// CancelEmailPage godoc
+// @Summary cancel email change page
+// @Description the page the cancel link opens; it changes nothing and posts the token to cancel
+// @Tags users
+// @Produce html
+// @Param token query string true "token from the cancel link"
+// @Success 200 {object} string
+// @Router /api/v1/users/email/cancel [get]
+func (h Handler) CancelEmailPage(c *gin.Context) {
+	h.emailLinkPage(c, "Cancel the change of your email address", "Cancel the change")
+}
+
+func (h Handler) emailLinkPage(c *gin.Context, title, button string) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	err := emailLinkPage.Execute(c.Writer, map[string]string{
+		"Title":  title,
+		"Button": button,
+		"Action": c.Request.URL.Path,
+		"Token":  c.Query("token"),
+	})
+	if err != nil {
+		h.log(c).Error(err.Error())
+	}
+}
+
+// ConfirmEmail godoc
+// @Summary confirm email change
+// @Description swaps the email and signs the user out of all sessions
+// @Tags users
+// @Accept x-www-form-urlencoded
+// @Param token formData string true "token from the confirmation link"
+// @Success 200 {object} string
+// @Failure 404 {object} string "Unknown or expired link"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/users/email/confirm [post]
+func (h Handler) ConfirmEmail(c *gin.Context) {
+	h.log(c).Info("ConfirmEmail is working")
+	_, err := h.User.ConfirmEmailChange(c, &pb.EmailChangeToken{Token: c.PostForm("token")})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "email changed, please log in again"})
+	h.log(c).Info("ConfirmEmail ended")
+}
+
+// CancelEmail godoc
+// @Summary cancel email change
+// @Description withdraws a pending email change
+// @Tags users
+// @Accept x-www-form-urlencoded
+// @Param token formData string true "token from the cancel link"
+// @Success 200 {object} string
+// @Failure 404 {object} string "Unknown or finished change"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/users/email/cancel [post]
+func (h Handler) CancelEmail(c *gin.Context) {
+	h.log(c).Info("CancelEmail is working")
+	_, err := h.User.CancelEmailChange(c, &pb.EmailChangeToken{Token: c.PostForm("token")})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "email change cancelled"})
+	h.log(c).Info("CancelEmail ended")
+}
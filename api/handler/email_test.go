@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEmailLinks(t *testing.T) {
+	user := &fakeUser{}
+	h := newTestHandler(user)
+	router := gin.New()
+	router.GET("/confirm", h.ConfirmEmailPage)
+	router.POST("/confirm", h.ConfirmEmail)
+	router.GET("/cancel", h.CancelEmailPage)
+	router.POST("/cancel", h.CancelEmail)
+
+	// Opening a link, as a mail scanner would, changes nothing.
+	for _, path := range []string{"/confirm", "/cancel"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?token=a%22b%3Cc", nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `method="post" action="`+path+`"`) {
+			t.Errorf("GET %s = %d %s", path, w.Code, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), `value="a&#34;b&lt;c"`) {
+			t.Errorf("GET %s does not carry the escaped token: %s", path, w.Body)
+		}
+	}
+	if len(user.confirmed) > 0 || len(user.cancelled) > 0 {
+		t.Fatalf("GET changed state: confirmed %v, cancelled %v", user.confirmed, user.cancelled)
+	}
+
+	for _, path := range []string{"/confirm", "/cancel"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(url.Values{"token": {"t1"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("POST %s = %d %s", path, w.Code, w.Body)
+		}
+	}
+	if len(user.confirmed) != 1 || user.confirmed[0] != "t1" || len(user.cancelled) != 1 || user.cancelled[0] != "t1" {
+		t.Errorf("POST: confirmed %v, cancelled %v", user.confirmed, user.cancelled)
+	}
+}
@@ -1,11 +1,110 @@
 package handler
 
 import (
+	"auth/api/auth"
+	"auth/config"
 	"auth/genproto/users"
+	"auth/pkg/claims"
+	"auth/pkg/dpop"
+	"auth/pkg/exchange"
+	"auth/pkg/logger"
+	"auth/pkg/metrics"
+	"auth/pkg/probe"
+	"auth/pkg/saml"
+	"context"
 	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type Handler struct {
 	User users.UserClient
 	Log  *slog.Logger
+	SAML *saml.ServiceProvider
+	// PublicURL is where clients reach the gateway, for links in responses.
+	PublicURL string
+	// Sessions configures the cookies of browser sessions.
+	Sessions config.SessionConfig
+	// Exchange decides which services may exchange user tokens.
+	Exchange *exchange.Policy
+	// DPoP verifies the proofs of clients with sender-constrained tokens;
+	// nil while DPoP is off.
+	DPoP *dpop.Verifier
+	// Claims adds profile fields to the access tokens; nil adds none.
+	Claims *claims.Enricher
+	// Tokens issues and verifies the tokens; the session cookies last as
+	// long as the tokens inside.
+	Tokens *auth.Tokens
+	CORS   config.CORSConfig
+	// Probe checks the dependencies for the readiness probe.
+	Probe *probe.Probe
+	// Metrics counts the requests; nil while metrics are off.
+	Metrics *metrics.Metrics
+}
+
+// log is the logger of the request, carrying its ID, route and user.
+func (h Handler) log(ctx context.Context) *slog.Logger {
+	return logger.FromContext(ctx, h.Log)
+}
+
+// httpStatus maps the status of a failed User RPC onto an HTTP status code.
+func httpStatus(err error) int {
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// FieldError is a problem with one field of a request.
+type FieldError struct {
+	Field       string `json:"field"`
+	Reason      string `json:"reason,omitempty"`
+	Description string `json:"description"`
+}
+
+// errorBody is the JSON body for a failed User RPC. Field violations the
+// service attached are listed under "fields", paired with the reasons of
+// the ErrorInfo details that follow them.
+func errorBody(err error) gin.H {
+	st := status.Convert(err)
+	body := gin.H{"error": st.Message()}
+	var fields []FieldError
+	var reasons []string
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.BadRequest:
+			for _, v := range d.FieldViolations {
+				fields = append(fields, FieldError{Field: v.Field, Description: v.Description})
+			}
+		case *errdetails.ErrorInfo:
+			reasons = append(reasons, d.Reason)
+		}
+	}
+	for i := range fields {
+		if i < len(reasons) {
+			fields[i].Reason = reasons[i]
+		}
+	}
+	if len(fields) > 0 {
+		body["fields"] = fields
+	}
+	return body
 }
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"auth/api/auth"
+	pb "auth/genproto/users"
+	"context"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeUser answers the User RPCs the tests make and records the calls
+// that change state. UserClient is embedded so that an unexpected call
+// panics.
+type fakeUser struct {
+	pb.UserClient
+	confirmed, cancelled []string
+	// clients maps the pending user codes onto the clients that asked for
+	// them; approved lists the codes approved.
+	clients  map[string]string
+	approved []string
+	// loggedOut lists the tokens Logout was called with.
+	loggedOut []string
+}
+
+func (f *fakeUser) ConfirmEmailChange(ctx context.Context, in *pb.EmailChangeToken, opts ...grpc.CallOption) (*pb.BoolResponse, error) {
+	f.confirmed = append(f.confirmed, in.Token)
+	return &pb.BoolResponse{Success: true}, nil
+}
+
+func (f *fakeUser) CancelEmailChange(ctx context.Context, in *pb.EmailChangeToken, opts ...grpc.CallOption) (*pb.BoolResponse, error) {
+	f.cancelled = append(f.cancelled, in.Token)
+	return &pb.BoolResponse{Success: true}, nil
+}
+
+func (f *fakeUser) DescribeDeviceCode(ctx context.Context, in *pb.DeviceVerificationRequest, opts ...grpc.CallOption) (*pb.DeviceAuthorizationInfo, error) {
+	client, ok := f.clients[in.UserCode]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "device code not found")
+	}
+	return &pb.DeviceAuthorizationInfo{ClientId: client}, nil
+}
+
+func (f *fakeUser) VerifyDeviceCode(ctx context.Context, in *pb.DeviceVerificationRequest, opts ...grpc.CallOption) (*pb.BoolResponse, error) {
+	if _, ok := f.clients[in.UserCode]; !ok {
+		return nil, status.Error(codes.NotFound, "device code not found")
+	}
+	f.approved = append(f.approved, in.UserCode)
+	return &pb.BoolResponse{Success: true}, nil
+}
+
+func (f *fakeUser) Logout(ctx context.Context, in *pb.Void, opts ...grpc.CallOption) (*pb.BoolResponse, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	f.loggedOut = append(f.loggedOut, md.Get(auth.LogoutMetadata)...)
+	return &pb.BoolResponse{Success: true}, nil
+}
+
+func newTestHandler(user pb.UserClient) Handler {
+	gin.SetMode(gin.TestMode)
+	return Handler{
+		User:   user,
+		Log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Tokens: auth.NewTokens(auth.Lifetimes{Access: time.Minute, PasswordChange: time.Minute, Refresh: time.Hour}, auth.NewJWT("access", "refresh")),
+	}
+}
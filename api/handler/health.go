@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"auth/pkg/probe"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Healthz godoc
+// @Summary liveness probe
+// @Description Answers as long as the process serves HTTP. It does not check the dependencies, so that an outage of the database does not get every instance restarted
+// @Tags health
+// @Produce json
+// @Success 200 {object} probe.Result
+// @Router /healthz [get]
+func (h Handler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, probe.Result{Status: probe.StatusOK})
+}
+
+// Readyz godoc
+// @Summary readiness probe
+// @Description Checks the database and the gRPC backend and reports each of them; 503 while one is down or the process is shutting down
+// @Tags health
+// @Produce json
+// @Success 200 {object} probe.Result
+// @Failure 503 {object} probe.Result
+// @Router /readyz [get]
+func (h Handler) Readyz(c *gin.Context) {
+	res := h.Probe.Run(c.Request.Context())
+	if !res.OK() {
+		c.JSON(http.StatusServiceUnavailable, res)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,253 @@
+package handler
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/exchange"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const grantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// DeviceAuthorization godoc
+// @Summary start device login
+// @Description OAuth 2.0 device authorization request (RFC 8628) for TVs and kiosks
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Param client_id formData string true "registered device client"
+// @Param scope formData string false "requested scope"
+// @Success 200 {object} users.DeviceAuthorizationResponse
+// @Failure 400 {object} string "invalid_client"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /oauth/device_authorization [post]
+func (h Handler) DeviceAuthorization(c *gin.Context) {
+	h.log(c).Info("DeviceAuthorization is working")
+	res, err := h.User.CreateDeviceAuthorization(c, &pb.DeviceAuthorizationRequest{
+		ClientId:  c.PostForm("client_id"),
+		Scope:     c.PostForm("scope"),
+		Ip:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+	h.log(c).Info("DeviceAuthorization ended")
+}
+
+// Token godoc
+// @Summary OAuth token endpoint
+// @Description polled by devices with grant_type urn:ietf:params:oauth:grant-type:device_code. Services exchange a user's access token for one meant for another service with grant_type urn:ietf:params:oauth:grant-type:token-exchange (RFC 8693), authenticating with HTTP Basic or client_secret
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Param grant_type formData string true "grant type"
+// @Param device_code formData string false "device code of the device grant"
+// @Param client_id formData string true "client id"
+// @Param client_secret formData string false "secret of a token exchange client"
+// @Param subject_token formData string false "access token of the user, for token exchange"
+// @Param subject_token_type formData string false "urn:ietf:params:oauth:token-type:access_token"
+// @Param audience formData string false "service the exchanged token is for"
+// @Param scope formData string false "scope of the exchanged token; defaults to the scope of the subject token the client may request"
+// @Param DPoP header string false "DPoP proof, binds the issued tokens to its key"
+// @Success 200 {object} users.Tokens
+// @Failure 400 {object} string "authorization_pending, slow_down, access_denied, expired_token, invalid_grant, invalid_target, invalid_scope or unsupported_grant_type"
+// @Failure 401 {object} string "invalid_client"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /oauth/token [post]
+func (h Handler) Token(c *gin.Context) {
+	h.log(c).Info("Token is working")
+	switch c.PostForm("grant_type") {
+	case grantTypeDeviceCode:
+		h.deviceToken(c)
+	case exchange.GrantType:
+		h.tokenExchange(c)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
+	}
+	h.log(c).Info("Token ended")
+}
+
+func (h Handler) deviceToken(c *gin.Context) {
+	jkt, ok := h.dpopKey(c)
+	if !ok {
+		return
+	}
+	res, err := h.User.PollDeviceToken(c, &pb.DeviceTokenRequest{
+		DeviceCode: c.PostForm("device_code"),
+		ClientId:   c.PostForm("client_id"),
+	})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.FailedPrecondition, codes.ResourceExhausted, codes.PermissionDenied, codes.DeadlineExceeded:
+			c.JSON(http.StatusBadRequest, gin.H{"error": status.Convert(err).Message()})
+		default:
+			h.log(c).Error(err.Error())
+			c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		}
+		return
+	}
+
+	token, err := h.issueTokens(c, res, jkt)
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, token)
+}
+
+// tokenExchange answers an RFC 8693 token exchange request.
+func (h Handler) tokenExchange(c *gin.Context) {
+	if h.Exchange == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
+		return
+	}
+	clientID, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		clientID, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+	client, err := h.Exchange.Authenticate(clientID, secret)
+	if err != nil {
+		h.exchangeError(c, err)
+		return
+	}
+
+	switch c.PostForm("subject_token_type") {
+	case exchange.TokenTypeAccessToken, exchange.TokenTypeJWT:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "unsupported subject_token_type"})
+		return
+	}
+	if c.PostForm("actor_token") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "actor_token is not supported, the client is the actor"})
+		return
+	}
+	if t := c.PostForm("requested_token_type"); t != "" && t != exchange.TokenTypeAccessToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "only access tokens can be requested"})
+		return
+	}
+	jkt, ok := h.dpopKey(c)
+	if !ok {
+		return
+	}
+	subject, err := h.Tokens.ExchangeSubject(c.PostForm("subject_token"))
+	if err != nil {
+		h.log(c).Error(err.Error(), "client_id", client.ID)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant", "error_description": "invalid subject_token"})
+		return
+	}
+
+	// Several audience parameters would ask for a token good for more than
+	// one service, which is what token exchange is meant to avoid.
+	audiences := c.PostFormArray("audience")
+	if len(audiences) > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_target", "error_description": "only one audience may be requested"})
+		return
+	}
+	audience := ""
+	if len(audiences) == 1 {
+		audience = audiences[0]
+	}
+	now := time.Now()
+	grant, err := h.Exchange.Exchange(client, subject, audience, c.PostForm("scope"), now)
+	if err != nil {
+		h.exchangeError(c, err)
+		return
+	}
+	extra, err := h.Claims.Load(c, h.log(c), grant.UserID, grant.Audience, h.tokenProfile)
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	token, err := h.Tokens.GeneratedExchangeToken(grant, jkt, extra, now)
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	h.log(c).Info("token exchanged", "client_id", client.ID, "user_id", grant.UserID, "audience", grant.Audience)
+
+	res := gin.H{
+		"access_token":      token,
+		"issued_token_type": exchange.TokenTypeAccessToken,
+		"token_type":        tokenType(jkt),
+		"expires_in":        int(grant.ExpiresAt.Sub(now) / time.Second),
+	}
+	if grant.Scope != "" {
+		res["scope"] = grant.Scope
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, res)
+}
+
+func tokenType(jkt string) string {
+	if jkt != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
+
+func (h Handler) exchangeError(c *gin.Context, err error) {
+	h.log(c).Error(err.Error())
+	var e *exchange.Error
+	if !errors.As(err, &e) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	code := http.StatusBadRequest
+	if e.Code == "invalid_client" {
+		c.Header("WWW-Authenticate", `Basic realm="token"`)
+		code = http.StatusUnauthorized
+	}
+	c.JSON(code, gin.H{"error": e.Code, "error_description": e.Description})
+}
+
+// VerifyDevice godoc
+// @Security ApiKeyAuth
+// @Summary approve device login
+// @Description approves or denies the device showing the user code
+// @Tags oauth
+// @Param info body users.DeviceVerificationRequest true "user code and decision"
+// @Success 200 {object} string
+// @Failure 400 {object} string "Invalid data"
+// @Failure 404 {object} string "Unknown or expired code"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/oauth/device [post]
+func (h Handler) VerifyDevice(c *gin.Context) {
+	h.log(c).Info("VerifyDevice is working")
+	id, err := h.Tokens.GetUserIdFromAccessToken(c.GetHeader("Authorization"))
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	req := pb.DeviceVerificationRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserId = id
+
+	_, err = h.User.VerifyDeviceCode(c, &req)
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	if req.Approve {
+		c.JSON(http.StatusOK, gin.H{"message": "device approved"})
+	} else {
+		c.JSON(http.StatusOK, gin.H{"message": "device denied"})
+	}
+	h.log(c).Info("VerifyDevice ended")
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	pb "auth/genproto/users"
+	"auth/service"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// qrWait bounds one long-poll or event stream; browsers reconnect
+	// afterwards until the session expires.
+	qrWait = 30 * time.Second
+	// The wait between two polls of the database starts at qrPollInterval
+	// and doubles up to qrMaxPollInterval.
+	qrPollInterval    = time.Second
+	qrMaxPollInterval = 8 * time.Second
+)
+
+// QRLoginSession is handed to the browser that wants to be signed in.
+type QRLoginSession struct {
+	// SessionID is shown to the phone, encoded in QRPayload.
+	SessionID string `json:"session_id"`
+	QRPayload string `json:"qr_payload"`
+	// PollToken is kept secret by the browser and used to collect the
+	// tokens once the phone has approved.
+	PollToken string `json:"poll_token"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// StartQRLogin godoc
+// @Summary start QR login
+// @Description creates a pending login session for this browser to show as a QR code
+// @Tags auth
+// @Success 200 {object} handler.QRLoginSession
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/auth/qr [post]
+func (h Handler) StartQRLogin(c *gin.Context) {
+	h.log(c).Info("StartQRLogin is working")
+	res, err := h.User.CreateDeviceAuthorization(c, &pb.DeviceAuthorizationRequest{
+		ClientId:  service.QRLoginClient,
+		Ip:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	c.JSON(http.StatusOK, QRLoginSession{
+		SessionID: res.UserCode,
+		QRPayload: res.VerificationUriComplete,
+		PollToken: res.DeviceCode,
+		ExpiresIn: res.ExpiresIn,
+	})
+	h.log(c).Info("StartQRLogin ended")
+}
+
+// DescribeQRLogin godoc
+// @Security ApiKeyAuth
+// @Summary inspect QR login
+// @Description shows the phone where the pending login comes from before approving it
+// @Tags auth
+// @Param session_id path string true "session id from the QR code"
+// @Success 200 {object} users.DeviceAuthorizationInfo
+// @Failure 404 {object} string "Unknown or expired session"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/auth/qr/{session_id} [get]
+func (h Handler) DescribeQRLogin(c *gin.Context) {
+	h.log(c).Info("DescribeQRLogin is working")
+	res, err := h.User.DescribeDeviceCode(c, &pb.DeviceVerificationRequest{UserCode: c.Param("session_id")})
+	if err == nil && res.ClientId != service.QRLoginClient {
+		err = status.Error(codes.NotFound, "session not found")
+	}
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+	h.log(c).Info("DescribeQRLogin ended")
+}
+
+// ApproveQRLogin godoc
+// @Security ApiKeyAuth
+// @Summary approve QR login
+// @Description signs the browser showing the QR code in as you
+// @Tags auth
+// @Param session_id path string true "session id from the QR code"
+// @Success 200 {object} string
+// @Failure 404 {object} string "Unknown or expired session"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/auth/qr/{session_id}/approve [post]
+func (h Handler) ApproveQRLogin(c *gin.Context) {
+	h.log(c).Info("ApproveQRLogin is working")
+	id, err := h.Tokens.GetUserIdFromAccessToken(c.GetHeader("Authorization"))
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// The code of a TV waiting for the device grant is no QR session;
+	// approving it here would skip the page that shows the device.
+	info, err := h.User.DescribeDeviceCode(c, &pb.DeviceVerificationRequest{UserCode: c.Param("session_id")})
+	if err == nil && info.ClientId != service.QRLoginClient {
+		err = status.Error(codes.NotFound, "session not found")
+	}
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	_, err = h.User.VerifyDeviceCode(c, &pb.DeviceVerificationRequest{
+		UserCode: c.Param("session_id"),
+		UserId:   id,
+		Approve:  true,
+	})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "login approved"})
+	h.log(c).Info("ApproveQRLogin ended")
+}
+
+// QRLoginTokens godoc
+// @Summary wait for QR login
+// @Description long-polls until the phone approves; with Accept text/event-stream the tokens arrive as a server-sent "tokens" event
+// @Tags auth
+// @Param poll_token query string true "poll token of the session"
+// @Success 200 {object} users.Tokens
+// @Param DPoP header string false "DPoP proof, binds the issued tokens to its key"
+// @Success 202 {object} string "Still pending, poll again"
+// @Failure 400 {object} string "access_denied or expired_token"
+// @Failure 429 {object} string "Too many requests"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/auth/qr/tokens [get]
+func (h Handler) QRLoginTokens(c *gin.Context) {
+	h.log(c).Info("QRLoginTokens is working")
+	jkt, ok := h.dpopKey(c)
+	if !ok {
+		return
+	}
+	stream := c.GetHeader("Accept") == "text/event-stream"
+	if stream {
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Content-Type", "text/event-stream")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+	}
+
+	timeout := time.NewTimer(qrWait)
+	defer timeout.Stop()
+	interval := qrPollInterval
+	wait := time.NewTimer(interval)
+	defer wait.Stop()
+
+	for {
+		res, err := h.User.PollDeviceToken(c, &pb.DeviceTokenRequest{
+			DeviceCode: c.Query("poll_token"),
+			ClientId:   service.QRLoginClient,
+		})
+		if err == nil {
+			token, err := h.issueTokens(c, res, jkt)
+			if err != nil {
+				h.log(c).Error(err.Error())
+				h.qrReply(c, stream, 500, "error", gin.H{"error": err.Error()})
+				return
+			}
+			h.qrReply(c, stream, http.StatusOK, "tokens", token)
+			h.log(c).Info("QRLoginTokens ended")
+			return
+		}
+		if status.Code(err) != codes.FailedPrecondition {
+			h.log(c).Error(err.Error())
+			code := httpStatus(err)
+			if status.Code(err) == codes.PermissionDenied || status.Code(err) == codes.DeadlineExceeded {
+				code = http.StatusBadRequest
+			}
+			h.qrReply(c, stream, code, "error", gin.H{"error": status.Convert(err).Message()})
+			return
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-timeout.C:
+			h.qrReply(c, stream, http.StatusAccepted, "pending", gin.H{"error": "authorization_pending"})
+			return
+		case <-wait.C:
+			interval = min(2*interval, qrMaxPollInterval)
+			wait.Reset(interval)
+		}
+	}
+}
+
+// qrReply answers a long-poll with JSON or sends a single event on a stream.
+func (h Handler) qrReply(c *gin.Context, stream bool, code int, event string, body interface{}) {
+	if stream {
+		c.SSEvent(event, body)
+		c.Writer.Flush()
+		return
+	}
+	c.JSON(code, body)
+}
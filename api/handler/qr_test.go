@@ -0,0 +1,40 @@
+package handler
+
+import (
+	pb "auth/genproto/users"
+	"auth/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestApproveQRLoginOnlyApprovesQRSessions(t *testing.T) {
+	user := &fakeUser{clients: map[string]string{"QRSESSION": service.QRLoginClient, "TVCODE": "tv-app"}}
+	h := newTestHandler(user)
+	router := gin.New()
+	router.POST("/qr/:session_id/approve", h.ApproveQRLogin)
+
+	var token pb.Tokens
+	if err := h.Tokens.GeneratedAccessToken(&pb.UserInfo{Id: "u1"}, &token, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	approve := func(code string) int {
+		req := httptest.NewRequest(http.MethodPost, "/qr/"+code+"/approve", nil)
+		req.Header.Set("Authorization", token.Accestoken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := approve("TVCODE"); code != http.StatusNotFound {
+		t.Errorf("approving the code of a TV = %d, want 404", code)
+	}
+	if code := approve("QRSESSION"); code != http.StatusOK {
+		t.Errorf("approving a QR session = %d", code)
+	}
+	if len(user.approved) != 1 || user.approved[0] != "QRSESSION" {
+		t.Errorf("approved %v", user.approved)
+	}
+}
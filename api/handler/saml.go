@@ -0,0 +1,141 @@
+package handler
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/saml"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/status"
+)
+
+// samlRequestCookie remembers the id of the AuthnRequest the browser was
+// sent off with, so the response can be matched to it.
+const samlRequestCookie = "saml_request"
+
+// SAMLMetadata godoc
+// @Summary SAML service provider metadata
+// @Description metadata to register us with the identity provider of an agency
+// @Tags sso
+// @Produce xml
+// @Param idp path string true "identity provider id"
+// @Success 200 {object} string
+// @Failure 404 {object} string "Unknown identity provider"
+// @Router /saml/{idp}/metadata [get]
+func (h Handler) SAMLMetadata(c *gin.Context) {
+	h.log(c).Info("SAMLMetadata is working")
+	p, err := h.SAML.Provider(c.Param("idp"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	md, err := h.SAML.Metadata(p)
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error while building metadata"})
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", md)
+	h.log(c).Info("SAMLMetadata ended")
+}
+
+// SAMLLogin godoc
+// @Summary start agency SSO
+// @Description redirects to the identity provider of the agency with an AuthnRequest
+// @Tags sso
+// @Param idp path string true "identity provider id"
+// @Success 302 {object} string
+// @Failure 404 {object} string "Unknown identity provider"
+// @Router /saml/{idp}/login [get]
+func (h Handler) SAMLLogin(c *gin.Context) {
+	h.log(c).Info("SAMLLogin is working")
+	p, err := h.SAML.Provider(c.Param("idp"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	location, requestID, err := h.SAML.AuthnRequest(p, "")
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error while starting sign in"})
+		return
+	}
+	h.setSAMLCookie(c, p, requestID, 600)
+	c.Redirect(http.StatusFound, location)
+	h.log(c).Info("SAMLLogin ended")
+}
+
+// SAMLACS godoc
+// @Summary SAML assertion consumer service
+// @Description the identity provider posts its response here; a valid response signs the user in
+// @Tags sso
+// @Accept x-www-form-urlencoded
+// @Param idp path string true "identity provider id"
+// @Param SAMLResponse formData string true "base64 encoded SAML response"
+// @Success 200 {object} users.Tokens
+// @Failure 401 {object} string "Invalid SAML response"
+// @Failure 404 {object} string "Unknown identity provider"
+// @Failure 409 {object} string "Email belongs to another account"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /saml/{idp}/acs [post]
+func (h Handler) SAMLACS(c *gin.Context) {
+	h.log(c).Info("SAMLACS is working")
+	p, err := h.SAML.Provider(c.Param("idp"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	requestID, _ := c.Cookie(samlRequestCookie)
+	h.setSAMLCookie(c, p, "", -1)
+
+	assertion, err := h.SAML.ParseResponse(c, p, c.PostForm("SAMLResponse"), requestID)
+	if err != nil {
+		h.log(c).Error(err.Error(), "idp", p.ID)
+		if !errors.Is(err, saml.ErrInvalidResponse) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while reading from server"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": saml.ErrInvalidResponse.Error()})
+		return
+	}
+	identity := p.Identity(assertion)
+
+	user, err := h.User.SSOLogin(c, &pb.SSOLoginRequest{
+		Provider: p.ID,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		Username: identity.Username,
+		FullName: identity.FullName,
+	})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+
+	// Browsers post the assertion as a form and cannot send a DPoP proof,
+	// so SSO sign-ins get bearer tokens.
+	token, err := h.issueTokens(c, user, "")
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error while generating tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, token)
+	h.log(c).Info("SAMLACS ended")
+}
+
+// setSAMLCookie scopes the cookie to the provider. The IdP posts back
+// cross-site, which browsers only send cookies along for with SameSite=None
+// over HTTPS.
+func (h Handler) setSAMLCookie(c *gin.Context, p *saml.Provider, value string, maxAge int) {
+	secure := strings.HasPrefix(h.SAML.BaseURL, "https://")
+	if secure {
+		c.SetSameSite(http.SameSiteNoneMode)
+	} else {
+		c.SetSameSite(http.SameSiteLaxMode)
+	}
+	c.SetCookie(samlRequestCookie, value, maxAge, "/saml/"+p.ID, "", secure, true)
+}
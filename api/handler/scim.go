@@ -0,0 +1,738 @@
+package handler
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/scim"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// scimOrganization is the context key ScimAuth stores the partner under.
+const scimOrganization = "scim_organization"
+
+// scimPatchAttempts bounds how often a PATCH is retried when the resource
+// changes between reading and writing it back.
+const scimPatchAttempts = 3
+
+// ScimAuth authenticates a SCIM partner by its bearer token.
+func (h Handler) ScimAuth(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+		scimAbort(c, scim.Errorf(http.StatusUnauthorized, "", "a bearer token is required"))
+		return
+	}
+	partner, err := h.User.AuthenticateScimToken(c, &pb.ScimToken{Token: token})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		h.scimFail(c, err)
+		c.Abort()
+		return
+	}
+	c.Set(scimOrganization, partner.OrganizationId)
+	c.Next()
+}
+
+// ScimListUsers godoc
+// @Security ApiKeyAuth
+// @Summary list provisioned users
+// @Description SCIM 2.0 query of the users of the partner organization
+// @Tags scim
+// @Produce json
+// @Param filter query string false "SCIM filter, e.g. userName eq \"jdoe\""
+// @Param startIndex query int false "1-based index of the first result"
+// @Param count query int false "page size"
+// @Success 200 {object} scim.ListResponse
+// @Failure 400 {object} scim.Error "Invalid filter"
+// @Failure 401 {object} scim.Error "Invalid token"
+// @Router /scim/v2/Users [get]
+func (h Handler) ScimListUsers(c *gin.Context) {
+	h.log(c).Info("ScimListUsers is working")
+	req, ok := scimListRequest(c)
+	if !ok {
+		return
+	}
+	res, err := h.User.ScimListUsers(c, req)
+	if st := status.Convert(err); st.Code() == codes.InvalidArgument {
+		// The filter parses but names an attribute we can't filter on.
+		scimAbort(c, scim.Errorf(http.StatusBadRequest, "invalidFilter", "%s", st.Message()))
+		return
+	}
+	if err != nil {
+		h.log(c).Error(err.Error())
+		h.scimFail(c, err)
+		return
+	}
+	resources := make([]scim.User, 0, len(res.Resources))
+	for _, u := range res.Resources {
+		resources = append(resources, h.scimUser(u))
+	}
+	scimJSON(c, http.StatusOK, scim.ListResponse{
+		Schemas:      []string{scim.ListSchema},
+		TotalResults: res.TotalResults,
+		StartIndex:   req.StartIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+	h.log(c).Info("ScimListUsers ended")
+}
+
+// ScimGetUser godoc
+// @Security ApiKeyAuth
+// @Summary get provisioned user
+// @Tags scim
+// @Produce json
+// @Param id path string true "user id"
+// @Success 200 {object} scim.User
+// @Failure 404 {object} scim.Error "Unknown user"
+// @Router /scim/v2/Users/{id} [get]
+func (h Handler) ScimGetUser(c *gin.Context) {
+	h.log(c).Info("ScimGetUser is working")
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	res, err := h.User.ScimGetUser(c, &pb.ScimResourceId{OrganizationId: c.GetString(scimOrganization), Id: id})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		h.scimFail(c, err)
+		return
+	}
+	h.scimUserResponse(c, http.StatusOK, res)
+	h.log(c).Info("ScimGetUser ended")
+}
+
+// ScimCreateUser godoc
+// @Security ApiKeyAuth
+// @Summary provision user
+// @Description creates an account for a member of staff of the partner, or brings back one deprovisioned earlier
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Param user body scim.User true "user"
+// @Success 201 {object} scim.User
+// @Failure 400 {object} scim.Error "Invalid user"
+// @Failure 409 {object} scim.Error "userName or email already taken"
+// @Router /scim/v2/Users [post]
+func (h Handler) ScimCreateUser(c *gin.Context) {
+	h.log(c).Info("ScimCreateUser is working")
+	var user scim.User
+	if !scimBind(c, &user) {
+		return
+	}
+	res, err := h.User.ScimCreateUser(c, &pb.ScimUserRequest{
+		OrganizationId: c.GetString(scimOrganization),
+		User:           pbScimUser("", &user),
+	})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		h.scimFail(c, err)
+		return
+	}
+	h.scimUserResponse(c, http.StatusCreated, res)
+	h.log(c).Info("ScimCreateUser ended")
+}
+
+// ScimReplaceUser godoc
+// @Security ApiKeyAuth
+// @Summary replace provisioned user
+// @Description overwrites the user; active=false deprovisions it
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Param id path string true "user id"
+// @Param If-Match header string false "version of the user"
+// @Param user body scim.User true "user"
+// @Success 200 {object} scim.User
+// @Failure 404 {object} scim.Error "Unknown user"
+// @Failure 412 {object} scim.Error "User was modified"
+// @Router /scim/v2/Users/{id} [put]
+func (h Handler) ScimReplaceUser(c *gin.Context) {
+	h.log(c).Info("ScimReplaceUser is working")
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var user scim.User
+	if !scimBind(c, &user) {
+		return
+	}
+	res, err := h.User.ScimReplaceUser(c, &pb.ScimUserRequest{
+		OrganizationId: c.GetString(scimOrganization),
+		User:           pbScimUser(id, &user),
+		IfMatch:        scim.ParseVersion(c.GetHeader("If-Match")),
+	})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		h.scimFail(c, err)
+		return
+	}
+	h.scimUserResponse(c, http.StatusOK, res)
+	h.log(c).Info("ScimReplaceUser ended")
+}
+
+// ScimPatchUser godoc
+// @Security ApiKeyAuth
+// @Summary patch provisioned user
+// @Description applies SCIM PATCH operations; replacing active with false deprovisions the user
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Param id path string true "user id"
+// @Param If-Match header string false "version of the user"
+// @Param patch body scim.PatchRequest true "operations"
+// @Success 200 {object} scim.User
+// @Failure 400 {object} scim.Error "Invalid operation"
+// @Failure 404 {object} scim.Error "Unknown user"
+// @Failure 412 {object} scim.Error "User was modified"
+// @Router /scim/v2/Users/{id} [patch]
+func (h Handler) ScimPatchUser(c *gin.Context) {
+	h.log(c).Info("ScimPatchUser is working")
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var patch scim.PatchRequest
+	if !scimBind(c, &patch) {
+		return
+	}
+	org := c.GetString(scimOrganization)
+	ifMatch := scim.ParseVersion(c.GetHeader("If-Match"))
+
+	var res *pb.ScimUser
+	var err error
+	for i := 0; i < scimPatchAttempts; i++ {
+		var current *pb.ScimUser
+		current, err = h.User.ScimGetUser(c, &pb.ScimResourceId{OrganizationId: org, Id: id})
+		if err != nil {
+			break
+		}
+		if ifMatch != "" && ifMatch != current.LastModified {
+			err = status.Error(codes.Aborted, "resource was modified since it was read")
+			break
+		}
+		user := h.scimUser(current)
+		if err = scimPatch(&user, patch.Operations); err != nil {
+			break
+		}
+		res, err = h.User.ScimReplaceUser(c, &pb.ScimUserRequest{
+			OrganizationId: org,
+			User:           pbScimUser(id, &user),
+			IfMatch:        current.LastModified,
+		})
+		// Someone else changed the user meanwhile; patch the new version
+		// unless the client asked for a specific one.
+		if status.Code(err) != codes.Aborted || ifMatch != "" {
+			break
+		}
+	}
+	if err != nil {
+		h.log(c).Error(err.Error())
+		h.scimFail(c, err)
+		return
+	}
+	h.scimUserResponse(c, http.StatusOK, res)
+	h.log(c).Info("ScimPatchUser ended")
+}
+
+// ScimDeleteUser godoc
+// @Security ApiKeyAuth
+// @Summary deprovision user
+// @Description deactivates the account and removes it from all groups
+// @Tags scim
+// @Param id path string true "user id"
+// @Success 204
+// @Failure 404 {object} scim.Error "Unknown user"
+// @Router /scim/v2/Users/{id} [delete]
+func (h Handler) ScimDeleteUser(c *gin.Context) {
+	h.log(c).Info("ScimDeleteUser is working")
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	_, err := h.User.ScimDeleteUser(c, &pb.ScimResourceId{OrganizationId: c.GetString(scimOrganization), Id: id})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		h.scimFail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+	h.log(c).Info("ScimDeleteUser ended")
+}
+
+// ScimListGroups godoc
+// @Security ApiKeyAuth
+// @Summary list groups
+// @Description SCIM 2.0 query of the groups of the partner organization
+// @Tags scim
+// @Produce json
+// @Param filter query string false "SCIM filter, e.g. displayName eq \"Agents\""
+// @Param startIndex query int false "1-based index of the first result"
+// @Param count query int false "page size"
+// @Success 200 {object} scim.ListResponse
+// @Failure 400 {object} scim.Error "Invalid filter"
+// @Failure 401 {object} scim.Error "Invalid token"
+// @Router /scim/v2/Groups [get]
+func (h Handler) ScimListGroups(c *gin.Context) {
+	h.log(c).Info("ScimListGroups is working")
+	req, ok := scimListRequest(c)
+	if !ok {
+		return
+	}
+	res, err := h.User.ScimListGroups(c, req)
+	if st := status.Convert(err); st.Code() == codes.InvalidArgument {
+		// The filter parses but names an attribute we can't filter on.
+		scimAbort(c, scim.Errorf(http.StatusBadRequest, "invalidFilter", "%s", st.Message()))
+		return
+	}
+	if err != nil {
+		h.log(c).Error(err.Error())
+		h.scimFail(c, err)
+		return
+	}
+	resources := make([]scim.Group, 0, len(res.Resources))
+	for _, g := range res.Resources {
+		resources = append(resources, h.scimGroup(g))
+	}
+	scimJSON(c, http.StatusOK, scim.ListResponse{
+		Schemas:      []string{scim.ListSchema},
+		TotalResults: res.TotalResults,
+		StartIndex:   req.StartIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+	h.log(c).Info("ScimListGroups ended")
+}
+
+// ScimGetGroup godoc
+// @Security ApiKeyAuth
+// @Summary get group
+// @Tags scim
+// @Produce json
+// @Param id path string true "group id"
+// @Success 200 {object} scim.Group
+// @Failure 404 {object} scim.Error "Unknown group"
+// @Router /scim/v2/Groups/{id} [get]
+func (h Handler) ScimGetGroup(c *gin.Context) {
+	h.log(c).Info("ScimGetGroup is working")
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	res, err := h.User.ScimGetGroup(c, &pb.ScimResourceId{OrganizationId: c.GetString(scimOrganization), Id: id})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		h.scimFail(c, err)
+		return
+	}
+	h.scimGroupResponse(c, http.StatusOK, res)
+	h.log(c).Info("ScimGetGroup ended")
+}
+
+// ScimCreateGroup godoc
+// @Security ApiKeyAuth
+// @Summary create group
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Param group body scim.Group true "group"
+// @Success 201 {object} scim.Group
+// @Failure 400 {object} scim.Error "Invalid group or members"
+// @Failure 409 {object} scim.Error "displayName already taken"
+// @Router /scim/v2/Groups [post]
+func (h Handler) ScimCreateGroup(c *gin.Context) {
+	h.log(c).Info("ScimCreateGroup is working")
+	var group scim.Group
+	if !scimBind(c, &group) {
+		return
+	}
+	res, err := h.User.ScimCreateGroup(c, &pb.ScimGroupRequest{
+		OrganizationId: c.GetString(scimOrganization),
+		Group:          pbScimGroup("", &group),
+	})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		h.scimFail(c, err)
+		return
+	}
+	h.scimGroupResponse(c, http.StatusCreated, res)
+	h.log(c).Info("ScimCreateGroup ended")
+}
+
+// ScimReplaceGroup godoc
+// @Security ApiKeyAuth
+// @Summary replace group
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Param id path string true "group id"
+// @Param If-Match header string false "version of the group"
+// @Param group body scim.Group true "group"
+// @Success 200 {object} scim.Group
+// @Failure 404 {object} scim.Error "Unknown group"
+// @Failure 412 {object} scim.Error "Group was modified"
+// @Router /scim/v2/Groups/{id} [put]
+func (h Handler) ScimReplaceGroup(c *gin.Context) {
+	h.log(c).Info("ScimReplaceGroup is working")
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var group scim.Group
+	if !scimBind(c, &group) {
+		return
+	}
+	res, err := h.User.ScimReplaceGroup(c, &pb.ScimGroupRequest{
+		OrganizationId: c.GetString(scimOrganization),
+		Group:          pbScimGroup(id, &group),
+		IfMatch:        scim.ParseVersion(c.GetHeader("If-Match")),
+	})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		h.scimFail(c, err)
+		return
+	}
+	h.scimGroupResponse(c, http.StatusOK, res)
+	h.log(c).Info("ScimReplaceGroup ended")
+}
+
+// ScimPatchGroup godoc
+// @Security ApiKeyAuth
+// @Summary patch group
+// @Description applies SCIM PATCH operations, typically adding or removing members
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Param id path string true "group id"
+// @Param If-Match header string false "version of the group"
+// @Param patch body scim.PatchRequest true "operations"
+// @Success 200 {object} scim.Group
+// @Failure 400 {object} scim.Error "Invalid operation"
+// @Failure 404 {object} scim.Error "Unknown group"
+// @Failure 412 {object} scim.Error "Group was modified"
+// @Router /scim/v2/Groups/{id} [patch]
+func (h Handler) ScimPatchGroup(c *gin.Context) {
+	h.log(c).Info("ScimPatchGroup is working")
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var patch scim.PatchRequest
+	if !scimBind(c, &patch) {
+		return
+	}
+	org := c.GetString(scimOrganization)
+	ifMatch := scim.ParseVersion(c.GetHeader("If-Match"))
+
+	var res *pb.ScimGroup
+	var err error
+	for i := 0; i < scimPatchAttempts; i++ {
+		var current *pb.ScimGroup
+		current, err = h.User.ScimGetGroup(c, &pb.ScimResourceId{OrganizationId: org, Id: id})
+		if err != nil {
+			break
+		}
+		if ifMatch != "" && ifMatch != current.LastModified {
+			err = status.Error(codes.Aborted, "resource was modified since it was read")
+			break
+		}
+		group := h.scimGroup(current)
+		if err = scimPatch(&group, patch.Operations); err != nil {
+			break
+		}
+		res, err = h.User.ScimReplaceGroup(c, &pb.ScimGroupRequest{
+			OrganizationId: org,
+			Group:          pbScimGroup(id, &group),
+			IfMatch:        current.LastModified,
+		})
+		if status.Code(err) != codes.Aborted || ifMatch != "" {
+			break
+		}
+	}
+	if err != nil {
+		h.log(c).Error(err.Error())
+		h.scimFail(c, err)
+		return
+	}
+	h.scimGroupResponse(c, http.StatusOK, res)
+	h.log(c).Info("ScimPatchGroup ended")
+}
+
+// ScimDeleteGroup godoc
+// @Security ApiKeyAuth
+// @Summary delete group
+// @Tags scim
+// @Param id path string true "group id"
+// @Success 204
+// @Failure 404 {object} scim.Error "Unknown group"
+// @Router /scim/v2/Groups/{id} [delete]
+func (h Handler) ScimDeleteGroup(c *gin.Context) {
+	h.log(c).Info("ScimDeleteGroup is working")
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	_, err := h.User.ScimDeleteGroup(c, &pb.ScimResourceId{OrganizationId: c.GetString(scimOrganization), Id: id})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		h.scimFail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+	h.log(c).Info("ScimDeleteGroup ended")
+}
+
+// CreateScimToken godoc
+// @Security ApiKeyAuth
+// @Summary create SCIM token
+// @Description issues a bearer token a partner agency provisions its staff with; the token is only shown once
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param slug path string true "organization slug"
+// @Param description body object false "{\"description\": \"Okta\"}"
+// @Success 201 {object} users.ScimTokenResponse
+// @Failure 400 {object} string "Invalid data"
+// @Failure 403 {object} string "Permission denied"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/admin/organizations/{slug}/scim-tokens [post]
+func (h Handler) CreateScimToken(c *gin.Context) {
+	h.log(c).Info("CreateScimToken is working")
+	var req struct {
+		Description string `json:"description"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&req); err != nil {
+			h.log(c).Error(err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	res, err := h.User.CreateScimToken(c, &pb.ScimTokenRequest{Organization: c.Param("slug"), Description: req.Description})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+	h.log(c).Info("CreateScimToken ended")
+}
+
+// RevokeScimToken godoc
+// @Security ApiKeyAuth
+// @Summary revoke SCIM token
+// @Tags admin
+// @Param token_id path string true "token id"
+// @Success 200 {object} string
+// @Failure 400 {object} string "Invalid data"
+// @Failure 403 {object} string "Permission denied"
+// @Failure 404 {object} string "Unknown token"
+// @Router /api/v1/admin/scim-tokens/{token_id} [delete]
+func (h Handler) RevokeScimToken(c *gin.Context) {
+	h.log(c).Info("RevokeScimToken is working")
+	id := c.Param("token_id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token id is incorrect"})
+		return
+	}
+	_, err := h.User.RevokeScimToken(c, &pb.ScimResourceId{Id: id})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "token revoked"})
+	h.log(c).Info("RevokeScimToken ended")
+}
+
+func (h Handler) scimUser(u *pb.ScimUser) scim.User {
+	user := scim.User{
+		Schemas:     []string{scim.UserSchema},
+		ID:          u.Id,
+		ExternalID:  u.ExternalId,
+		UserName:    u.UserName,
+		Name:        &scim.Name{Formatted: u.FullName},
+		DisplayName: u.FullName,
+		Emails:      []scim.Email{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      &u.Active,
+		Meta:        h.scimMeta("User", "/scim/v2/Users/"+u.Id, u.Created, u.LastModified),
+	}
+	for _, g := range u.Groups {
+		user.Groups = append(user.Groups, scim.Member{Value: g.Value, Display: g.Display, Ref: h.PublicURL + "/scim/v2/Groups/" + g.Value})
+	}
+	return user
+}
+
+func pbScimUser(id string, u *scim.User) *pb.ScimUser {
+	return &pb.ScimUser{
+		Id:         id,
+		ExternalId: u.ExternalID,
+		UserName:   u.UserName,
+		FullName:   u.FullName(),
+		Email:      u.Email(),
+		Active:     u.IsActive(),
+	}
+}
+
+func (h Handler) scimGroup(g *pb.ScimGroup) scim.Group {
+	group := scim.Group{
+		Schemas:     []string{scim.GroupSchema},
+		ID:          g.Id,
+		ExternalID:  g.ExternalId,
+		DisplayName: g.DisplayName,
+		Meta:        h.scimMeta("Group", "/scim/v2/Groups/"+g.Id, g.Created, g.LastModified),
+	}
+	for _, m := range g.Members {
+		group.Members = append(group.Members, scim.Member{Value: m.Value, Display: m.Display, Ref: h.PublicURL + "/scim/v2/Users/" + m.Value})
+	}
+	return group
+}
+
+func pbScimGroup(id string, g *scim.Group) *pb.ScimGroup {
+	group := &pb.ScimGroup{Id: id, ExternalId: g.ExternalID, DisplayName: g.DisplayName}
+	for _, m := range g.Members {
+		group.Members = append(group.Members, &pb.ScimMember{Value: m.Value})
+	}
+	return group
+}
+
+func (h Handler) scimMeta(resourceType, path, created, lastModified string) *scim.Meta {
+	meta := &scim.Meta{
+		ResourceType: resourceType,
+		Created:      created,
+		LastModified: lastModified,
+		Location:     h.PublicURL + path,
+	}
+	if lastModified != "" {
+		meta.Version = scim.Version(lastModified)
+	}
+	return meta
+}
+
+func (h Handler) scimUserResponse(c *gin.Context, code int, u *pb.ScimUser) {
+	user := h.scimUser(u)
+	if user.Meta.Version != "" {
+		c.Header("ETag", user.Meta.Version)
+	}
+	if code == http.StatusCreated {
+		c.Header("Location", user.Meta.Location)
+	}
+	scimJSON(c, code, user)
+}
+
+func (h Handler) scimGroupResponse(c *gin.Context, code int, g *pb.ScimGroup) {
+	group := h.scimGroup(g)
+	if group.Meta.Version != "" {
+		c.Header("ETag", group.Meta.Version)
+	}
+	if code == http.StatusCreated {
+		c.Header("Location", group.Meta.Location)
+	}
+	scimJSON(c, code, group)
+}
+
+// scimPatch applies PATCH operations to a resource through its JSON
+// representation.
+func scimPatch(resource interface{}, ops []scim.PatchOperation) error {
+	if len(ops) == 0 {
+		return scim.Errorf(http.StatusBadRequest, "invalidValue", "no operations")
+	}
+	doc, err := scim.Encode(resource)
+	if err != nil {
+		return err
+	}
+	if err := scim.Apply(doc, ops); err != nil {
+		return err
+	}
+	return scim.Decode(doc, resource)
+}
+
+func scimListRequest(c *gin.Context) (*pb.ScimListRequest, bool) {
+	req := &pb.ScimListRequest{OrganizationId: c.GetString(scimOrganization), Filter: c.Query("filter")}
+	if req.Filter != "" {
+		if _, err := scim.ParseFilter(req.Filter); err != nil {
+			scimAbort(c, err)
+			return nil, false
+		}
+	}
+	var err error
+	if v := c.Query("startIndex"); v != "" {
+		if req.StartIndex, err = strconv.ParseInt(v, 10, 64); err != nil {
+			scimAbort(c, scim.Errorf(http.StatusBadRequest, "invalidValue", "startIndex must be a number"))
+			return nil, false
+		}
+	}
+	if v := c.Query("count"); v != "" {
+		if req.Count, err = strconv.ParseInt(v, 10, 64); err != nil {
+			scimAbort(c, scim.Errorf(http.StatusBadRequest, "invalidValue", "count must be a number"))
+			return nil, false
+		}
+	}
+	if req.StartIndex < 1 {
+		req.StartIndex = 1
+	}
+	return req, true
+}
+
+func scimID(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		scimAbort(c, scim.Errorf(http.StatusNotFound, "", "resource %s not found", id))
+		return "", false
+	}
+	return id, true
+}
+
+func scimBind(c *gin.Context, v interface{}) bool {
+	if err := json.NewDecoder(c.Request.Body).Decode(v); err != nil {
+		scimAbort(c, scim.Errorf(http.StatusBadRequest, "invalidSyntax", "%v", err))
+		return false
+	}
+	return true
+}
+
+func scimJSON(c *gin.Context, code int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(code, scim.MediaType, body)
+}
+
+// scimAbort answers with a SCIM error. Errors of other kinds are internal.
+func scimAbort(c *gin.Context, err error) {
+	e, ok := err.(*scim.Error)
+	if !ok {
+		e = scim.Errorf(http.StatusInternalServerError, "", "error while reading from server")
+	}
+	scimJSON(c, e.Status, e)
+}
+
+// scimFail turns the status of a failed SCIM RPC into a SCIM error.
+func (h Handler) scimFail(c *gin.Context, err error) {
+	if e, ok := err.(*scim.Error); ok {
+		scimAbort(c, e)
+		return
+	}
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.InvalidArgument:
+		scimAbort(c, scim.Errorf(http.StatusBadRequest, "invalidValue", "%s", st.Message()))
+	case codes.AlreadyExists:
+		scimAbort(c, scim.Errorf(http.StatusConflict, "uniqueness", "%s", st.Message()))
+	case codes.Aborted:
+		scimAbort(c, scim.Errorf(http.StatusPreconditionFailed, "", "%s", st.Message()))
+	case codes.Unauthenticated, codes.NotFound, codes.ResourceExhausted:
+		scimAbort(c, scim.Errorf(httpStatus(err), "", "%s", st.Message()))
+	default:
+		scimAbort(c, err)
+	}
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"auth/api/auth"
+	pb "auth/genproto/users"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wantsSessionCookies tells whether the client asked for a cookie session.
+func (h Handler) wantsSessionCookies(c *gin.Context) bool {
+	return c.Query("session") == "cookie"
+}
+
+// setSessionCookies stores the tokens in HttpOnly cookies and returns the
+// CSRF token the frontend has to send back. An existing CSRF token is kept
+// so that open tabs keep working after a refresh.
+func (h Handler) setSessionCookies(c *gin.Context, token *pb.Tokens) (string, error) {
+	csrf, _ := c.Cookie(auth.CSRFCookie)
+	if csrf == "" {
+		var err error
+		if csrf, err = auth.NewCSRFToken(); err != nil {
+			return "", err
+		}
+	}
+	// The cookies live as long as the tokens inside.
+	lifetimes := h.Tokens.Lifetimes()
+	accessAge, refreshAge := lifetimes.Access, lifetimes.Refresh
+	if token.PasswordChangeRequired {
+		accessAge = lifetimes.PasswordChange
+	}
+	h.setSessionCookie(c, auth.AccessCookie, token.Accestoken, "/", accessAge, true)
+	if token.Refreshtoken != "" {
+		h.setSessionCookie(c, auth.RefreshCookie, token.Refreshtoken, auth.RefreshCookiePath, refreshAge, true)
+	} else {
+		h.setSessionCookie(c, auth.RefreshCookie, "", auth.RefreshCookiePath, -1, true)
+	}
+	h.setSessionCookie(c, auth.CSRFCookie, csrf, "/", refreshAge, false)
+	return csrf, nil
+}
+
+// clearSessionCookies ends a cookie session in the browser.
+func (h Handler) clearSessionCookies(c *gin.Context) {
+	h.setSessionCookie(c, auth.AccessCookie, "", "/", -1, true)
+	h.setSessionCookie(c, auth.RefreshCookie, "", auth.RefreshCookiePath, -1, true)
+	h.setSessionCookie(c, auth.CSRFCookie, "", "/", -1, false)
+}
+
+func (h Handler) setSessionCookie(c *gin.Context, name, value, path string, age time.Duration, httpOnly bool) {
+	maxAge := -1
+	if age > 0 {
+		maxAge = int(age / time.Second)
+	}
+	switch strings.ToLower(h.Sessions.SESSION_COOKIE_SAMESITE) {
+	case "strict":
+		c.SetSameSite(http.SameSiteStrictMode)
+	case "none":
+		c.SetSameSite(http.SameSiteNoneMode)
+	default:
+		c.SetSameSite(http.SameSiteLaxMode)
+	}
+	c.SetCookie(name, value, maxAge, path, h.Sessions.SESSION_COOKIE_DOMAIN, h.Sessions.SESSION_COOKIE_SECURE, httpOnly)
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"auth/api/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLogout(t *testing.T) {
+	user := &fakeUser{}
+	h := newTestHandler(user)
+	h.Sessions.SESSION_COOKIES = true
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.POST("/logout", h.Logout)
+
+	logout := func(setup func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+		setup(req)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := logout(func(r *http.Request) { r.Header.Set("Authorization", "Bearer a1") })
+	if w.Code != http.StatusOK {
+		t.Errorf("bearer logout = %d %s", w.Code, w.Body)
+	}
+	w = logout(func(r *http.Request) {
+		r.AddCookie(&http.Cookie{Name: auth.AccessCookie, Value: "a2"})
+		r.AddCookie(&http.Cookie{Name: auth.RefreshCookie, Value: "r2"})
+	})
+	if w.Code != http.StatusOK {
+		t.Errorf("cookie logout = %d %s", w.Code, w.Body)
+	}
+	cleared := 0
+	for _, c := range w.Result().Cookies() {
+		if c.MaxAge < 0 {
+			cleared++
+		}
+	}
+	if cleared != 3 {
+		t.Errorf("cookie logout cleared %d cookies, want 3", cleared)
+	}
+	if len(user.loggedOut) != 2 || user.loggedOut[0] != "a1" || user.loggedOut[1] != "r2" {
+		t.Errorf("tokens revoked = %v, want [a1 r2]", user.loggedOut)
+	}
+
+	if w := logout(func(*http.Request) {}); w.Code != http.StatusUnauthorized {
+		t.Errorf("logout without a token = %d", w.Code)
+	}
+}
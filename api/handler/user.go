@@ -3,11 +3,15 @@ package handler
 import (
 	"auth/api/auth"
 	pb "auth/genproto/users"
+	"context"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // Register godoc
@@ -15,156 +19,262 @@ import (
 // @Description create new users
 // @Tags auth
 // @Param info body users.RegisterRequest true "User info"
+// @Param X-Challenge-Token header string false "token of the challenge returned with 428"
+// @Param X-Challenge-Answer header string false "solution of the challenge"
 // @Success 200 {object} users.RegisterResponse
-// @Failure 400 {object} string "Invalid data"
+// @Failure 400 {object} string "Invalid data or password rejected by the policy, see fields"
+// @Failure 409 {object} string "Username or email is taken"
+// @Failure 428 {object} string "Challenge required"
+// @Failure 429 {object} string "Too many requests"
 // @Failure 500 {object} string "Server error"
 // @Router /api/v1/auth/register [post]
 func (h Handler) Register(c *gin.Context) {
-	h.Log.Info("Register is starting")
+	h.log(c).Info("Register is starting")
 	req := pb.RegisterRequest{}
 	if err := c.BindJSON(&req); err != nil {
-		h.Log.Error(err.Error())
+		h.log(c).Error(err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 	res, err := h.User.Register(c, &req)
 	if err != nil {
-		h.Log.Error(err.Error())
-		c.JSON(500, gin.H{"error": err.Error()})
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), errorBody(err))
 		return
 	}
-	h.Log.Info("Register ended")
+	h.log(c).Info("Register ended")
 	c.JSON(http.StatusOK, res)
 }
 
 // Login godoc
 // @Summary login user
-// @Description it generates new access and refresh tokens
+// @Description it generates new access and refresh tokens. Users who have to change their password only get a restricted access token, marked by password_change_required, that is good for reset-password alone. With session=cookie the tokens are set as HttpOnly cookies instead and the response carries the csrf_token to send in X-CSRF-Token
 // @Tags auth
-// @Param userinfo body users.LoginRequest true "username and password"
+// @Param userinfo body users.LoginRequest true "login (username or email) and password"
+// @Param session query string false "cookie to keep the tokens in cookies"
+// @Param X-Challenge-Token header string false "token of the challenge returned with 428"
+// @Param X-Challenge-Answer header string false "solution of the challenge"
+// @Param DPoP header string false "DPoP proof, binds the issued tokens to its key"
 // @Success 200 {object} users.Tokens
 // @Failure 400 {object} string "Invalid date"
+// @Failure 401 {object} string "Invalid login or password"
+// @Failure 428 {object} string "Challenge required"
+// @Failure 429 {object} string "Too many requests"
 // @Failure 500 {object} string "error while reading from server"
 // @Router /api/v1/auth/login [post]
 func (h Handler) Login(c *gin.Context) {
-	h.Log.Info("Login is working")
+	h.log(c).Info("Login is working")
 	req := pb.LoginRequest{}
 
 	if err := c.BindJSON(&req); err != nil {
-		h.Log.Error(err.Error())
+		h.log(c).Error(err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"error1": err.Error()})
+		return
+	}
+	req.Ip = c.ClientIP()
+	cookies := h.wantsSessionCookies(c)
+	if cookies && !h.Sessions.SESSION_COOKIES {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cookie sessions are disabled"})
+		return
+	}
+	jkt, ok := h.dpopKey(c)
+	if !ok {
+		return
 	}
 
 	res, err := h.User.Login(c, &req)
 	if err != nil {
-		h.Log.Error(err.Error())
-		c.JSON(500, gin.H{"error2": err.Error()})
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
 		return
 	}
-	var token pb.Tokens
-	err = auth.GeneratedAccessJWTToken(res, &token)
-
+	token, err := h.issueTokens(c, res, jkt)
 	if err != nil {
-		h.Log.Error(err.Error())
+		h.log(c).Error(err.Error())
 		c.JSON(500, gin.H{"error3": err.Error()})
+		return
 	}
-	err = auth.GeneratedRefreshJWTToken(res, &token)
-	if err != nil {
-		h.Log.Error(err.Error())
-		c.JSON(500, gin.H{"error4": err.Error()})
+	if cookies {
+		csrf, err := h.setSessionCookies(c, token)
+		if err != nil {
+			h.log(c).Error(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"csrf_token": csrf, "password_change_required": token.PasswordChangeRequired})
+		h.log(c).Info("login is succesfully ended")
+		return
 	}
 
-	c.JSON(http.StatusOK, &token)
-	h.Log.Info("login is succesfully ended")
+	c.JSON(http.StatusOK, token)
+	h.log(c).Info("login is succesfully ended")
+
+}
 
+// issueTokens creates the access and refresh tokens of a signed in user,
+// bound to the DPoP key jkt if it is not empty. A user who has to change
+// their password only gets a restricted access token, without the claims
+// of the claim mappers.
+func (h Handler) issueTokens(ctx context.Context, user *pb.UserInfo, jkt string) (*pb.Tokens, error) {
+	var token pb.Tokens
+	if user.PasswordChangeReason != "" {
+		if err := h.Tokens.GeneratedPasswordChangeToken(user, &token, jkt); err != nil {
+			return nil, err
+		}
+		return &token, nil
+	}
+	extra, err := h.Claims.Load(ctx, h.log(ctx), user.Id, "", h.tokenProfile)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.Tokens.GeneratedAccessToken(user, &token, jkt, extra); err != nil {
+		return nil, err
+	}
+	if err := h.Tokens.GeneratedRefreshToken(user, &token, jkt); err != nil {
+		return nil, err
+	}
+	return &token, nil
 }
 
 // ResetPassword godoc
 // @Security ApiKeyAuth
 // @Summary ResetPass user
-// @Description it changes your password to new one
+// @Description it changes your password to new one; restricted tokens issued for a required password change are accepted here
 // @Tags userAuth
 // @Param userinfo body users.EmailRecoveryRequest true "passwords"
 // @Success 200 {object} string
-// @Failure 400 {object} string "Invalid date"
+// @Failure 400 {object} string "Invalid data or password rejected by the policy, see fields"
 // @Failure 401 {object} string "Invalid token"
 // @Failure 500 {object} string "error while reading from server"
 // @Router /api/v1/auth/reset-password [post]
 func (h Handler) ResetPassword(c *gin.Context) {
-	h.Log.Info("ResetPassword is working")
+	h.log(c).Info("ResetPassword is working")
 
 	accessToken := c.GetHeader("Authorization")
-	id, err := auth.GetUserIdFromAccessToken(accessToken)
+	id, err := h.Tokens.GetUserIdFromAccessToken(accessToken)
 	req := pb.EmailRecoveryRequest{UserId: id}
 	if err != nil {
-		h.Log.Error(err.Error())
+		h.log(c).Error(err.Error())
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
 	if err := c.BindJSON(&req); err != nil {
-		h.Log.Error(err.Error())
+		h.log(c).Error(err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"error1": err.Error()})
 		return
 	}
 	_, err = h.User.EmailRecovery(c, &req)
 	if err != nil {
-		h.Log.Error(err.Error())
-		c.JSON(500, gin.H{"error": err.Error()})
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), errorBody(err))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "password successfully reset"})
 
-	h.Log.Info("ResetPassword ended")
+	h.log(c).Info("ResetPassword ended")
 }
 
 // Refresh godoc
 // @Summary Refresh token
-// @Description it changes your access token
+// @Description it changes your access token. Browser sessions send no body; the refresh_token cookie is used and the new tokens are set as cookies
 // @Tags auth
-// @Param userinfo body users.CheckRefreshTokenRequest true "token"
+// @Param userinfo body users.CheckRefreshTokenRequest false "token"
+// @Param X-CSRF-Token header string false "CSRF token of a cookie session"
+// @Param DPoP header string false "DPoP proof, binds the issued tokens to its key"
 // @Success 200 {object} users.Tokens
 // @Failure 400 {object} string "Invalid date"
 // @Failure 401 {object} string "Invalid token"
+// @Failure 403 {object} string "Invalid CSRF token"
+// @Failure 412 {object} string "Password change required, log in again"
 // @Failure 500 {object} string "error while reading from server"
 // @Router /api/v1/auth/refresh [post]
 func (h Handler) Refresh(c *gin.Context) {
-	h.Log.Info("Refresh is working")
+	h.log(c).Info("Refresh is working")
 	req := pb.CheckRefreshTokenRequest{}
-	if err := c.BindJSON(&req); err != nil {
-		h.Log.Error(err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&req); err != nil {
+			h.log(c).Error(err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 	}
-	_, err := auth.ValidateRefreshToken(req.RefreshToken)
-	if err != nil {
-		h.Log.Error(err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	cookies := false
+	if req.RefreshToken == "" && h.Sessions.SESSION_COOKIES {
+		req.RefreshToken, _ = c.Cookie(auth.RefreshCookie)
+		cookies = req.RefreshToken != ""
 	}
-	id, err := auth.GetUserIdFromRefreshToken(req.RefreshToken)
-	if err != nil {
-		h.Log.Error(err.Error())
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	if req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
+		return
 	}
-	res := pb.Tokens{Refreshtoken: req.RefreshToken}
-
-	err = auth.GeneratedAccessJWTToken(&pb.UserInfo{Id: id}, &res)
+	jkt, ok := h.dpopKey(c)
+	if !ok {
+		return
+	}
+	req.DpopJkt = jkt
+	res, err := h.User.CheckRefreshToken(c, &req)
 	if err != nil {
-		h.Log.Error(err.Error())
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
 	}
-	c.JSON(http.StatusOK, &res)
+	token := &pb.Tokens{Accestoken: res.AccessToken, Refreshtoken: res.RefreshToken}
+	if jkt != "" {
+		token.TokenType = "DPoP"
+	}
+	if cookies {
+		csrf, err := h.setSessionCookies(c, token)
+		if err != nil {
+			h.log(c).Error(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"csrf_token": csrf})
+		return
+	}
+	c.JSON(http.StatusOK, token)
 }
 
 // Logout godoc
+// @Security ApiKeyAuth
 // @Summary Logout user
-// @Description you log out
+// @Description you log out; every refresh token of yours issued so far is revoked and the cookies of a browser session are cleared. Access tokens run out on their own.
 // @Tags auth
+// @Param X-CSRF-Token header string false "CSRF token of a cookie session"
 // @Success 200 {object} string
+// @Failure 401 {object} string "Invalid token"
+// @Failure 403 {object} string "Invalid CSRF token"
+// @Failure 500 {object} string "error while reading from server"
 // @Router /api/v1/auth/logout [post]
 func (h Handler) Logout(c *gin.Context) {
-	h.Log.Info("Logout is working")
+	h.log(c).Info("Logout is working")
+	token := c.GetHeader("Authorization")
+	if i := strings.IndexByte(token, ' '); i > 0 {
+		token = strings.TrimSpace(token[i+1:])
+	}
+	if token == "" && h.Sessions.SESSION_COOKIES {
+		// The refresh token outlives the access token of the session.
+		if token, _ = c.Cookie(auth.RefreshCookie); token == "" {
+			token, _ = c.Cookie(auth.AccessCookie)
+		}
+	}
+	h.clearSessionCookies(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization is required"})
+		return
+	}
+
+	ctx := metadata.AppendToOutgoingContext(c.Request.Context(), auth.LogoutMetadata, token)
+	c.Request = c.Request.WithContext(ctx)
+	if _, err := h.User.Logout(c, &pb.Void{}); err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
-	h.Log.Info("Logout ended")
+	h.log(c).Info("Logout ended")
 }
 
 // Profile godoc
@@ -177,20 +287,20 @@ func (h Handler) Logout(c *gin.Context) {
 // @Failure 500 {object} string "error while reading from server"
 // @Router /api/v1/users/profile [get]
 func (h Handler) Profile(c *gin.Context) {
-	h.Log.Info("Profile is working")
+	h.log(c).Info("Profile is working")
 	accessToken := c.GetHeader("Authorization")
-	id, err := auth.GetUserIdFromAccessToken(accessToken)
+	id, err := h.Tokens.GetUserIdFromAccessToken(accessToken)
 	if err != nil {
-		h.Log.Error(err.Error())
+		h.log(c).Error(err.Error())
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 	}
 	res, err := h.User.GetProfile(c, &pb.UserId{Id: id})
 	if err != nil {
-		h.Log.Error(err.Error())
-		c.JSON(500, gin.H{"error1": err.Error()})
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error1": err.Error()})
 	}
 	c.JSON(http.StatusOK, res)
-	h.Log.Info("Profile ended")
+	h.log(c).Info("Profile ended")
 }
 
 // UserProfileUpdate godoc
@@ -204,25 +314,25 @@ func (h Handler) Profile(c *gin.Context) {
 // @Failure 500 {object} string "error while reading from server"
 // @Router /api/v1/users/profile [put]
 func (h Handler) UserProfileUpdate(c *gin.Context) {
-	h.Log.Info("UserProfileUpdate is working")
+	h.log(c).Info("UserProfileUpdate is working")
 	accessToken := c.GetHeader("Authorization")
-	id, err := auth.GetUserIdFromAccessToken(accessToken)
+	id, err := h.Tokens.GetUserIdFromAccessToken(accessToken)
 	if err != nil {
-		h.Log.Error(err.Error())
+		h.log(c).Error(err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 	}
 	req := pb.UpdateProfileRequest{Id: id}
 	if err := c.BindJSON(&req); err != nil {
-		h.Log.Error(err.Error())
+		h.log(c).Error(err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 	}
 	res, err := h.User.UpdateProfile(c, &req)
 	if err != nil {
-		h.Log.Error(err.Error())
-		c.JSON(500, gin.H{"error": err.Error()})
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": err.Error()})
 	}
 	c.JSON(http.StatusOK, res)
-	h.Log.Info("UserProfileUpdate ended")
+	h.log(c).Info("UserProfileUpdate ended")
 }
 
 // GetAllUsers godoc
@@ -237,7 +347,7 @@ func (h Handler) UserProfileUpdate(c *gin.Context) {
 // @Failure 500 {object} string "error while reading from server"
 // @Router /api/v1/users [get]
 func (h Handler) GetAllUsers(c *gin.Context) {
-	h.Log.Info("GetAllUsers is working")
+	h.log(c).Info("GetAllUsers is working")
 	req := pb.GetUsersRequest{}
 	limitStr := c.Query("limit")
 	offsetStr := c.Query("offset")
@@ -247,7 +357,7 @@ func (h Handler) GetAllUsers(c *gin.Context) {
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest,
 				gin.H{"error": err.Error()})
-			h.Log.Error(err.Error())
+			h.log(c).Error(err.Error())
 			return
 		}
 		req.Limit = int64(limit)
@@ -260,7 +370,7 @@ func (h Handler) GetAllUsers(c *gin.Context) {
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest,
 				gin.H{"error": err.Error()})
-			h.Log.Error(err.Error())
+			h.log(c).Error(err.Error())
 			return
 		}
 		req.Offset = int64(offset)
@@ -270,11 +380,11 @@ func (h Handler) GetAllUsers(c *gin.Context) {
 
 	res, err := h.User.GetUsers(c, &req)
 	if err != nil {
-		h.Log.Error(err.Error())
-		c.JSON(500, gin.H{"error": err.Error()})
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": err.Error()})
 	}
 	c.JSON(http.StatusOK, res)
-	h.Log.Info("GetAllUsers ended")
+	h.log(c).Info("GetAllUsers ended")
 }
 
 // Delete godoc
@@ -288,22 +398,22 @@ func (h Handler) GetAllUsers(c *gin.Context) {
 // @Failure 500 {object} string "error while reading from server"
 // @Router /api/v1/users/{user_id} [delete]
 func (h Handler) Delete(c *gin.Context) {
-	h.Log.Info("Delete is working")
+	h.log(c).Info("Delete is working")
 	id := c.Param("user_id")
 	_, err := uuid.Parse(id)
 	if err != nil {
-		h.Log.Error(err.Error())
+		h.log(c).Error(err.Error())
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "user id is incorrect"})
 		return
 	}
 
 	_, err = h.User.DeleteUser(c, &pb.UserId{Id: id})
 	if err != nil {
-		h.Log.Error(err.Error())
-		c.JSON(500, gin.H{"error": err.Error()})
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": err.Error()})
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "user deleted"})
-	h.Log.Info("Delete ended")
+	h.log(c).Info("Delete ended")
 }
 
 // ActivityOfUser godoc
@@ -317,11 +427,11 @@ func (h Handler) Delete(c *gin.Context) {
 // @Failure 500 {object} string "error while reading from server"
 // @Router /api/v1/users/{user_id}/activity [get]
 func (h Handler) ActivityOfUser(c *gin.Context) {
-	h.Log.Info("Activity is working")
+	h.log(c).Info("Activity is working")
 	id := c.Param("user_id")
 	_, err := uuid.Parse(id)
 	if err != nil {
-		h.Log.Error(err.Error())
+		h.log(c).Error(err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"error": "user id is incorrect"})
 		return
 	}
@@ -332,12 +442,12 @@ func (h Handler) ActivityOfUser(c *gin.Context) {
 	res, err := h.User.Activity(c, &req)
 
 	if err != nil {
-		h.Log.Error(err.Error())
-		c.JSON(500, gin.H{"error": err.Error()})
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": err.Error()})
 	}
 
 	c.JSON(http.StatusOK, &res)
-	h.Log.Info("Activity ended")
+	h.log(c).Info("Activity ended")
 }
 
 // Follow godoc
@@ -351,28 +461,28 @@ func (h Handler) ActivityOfUser(c *gin.Context) {
 // @Failure 500 {object} string "error while reading from server"
 // @Router /api/v1/users/{user_id}/follow [post]
 func (h Handler) Follow(c *gin.Context) {
-	h.Log.Info("Follow is working")
+	h.log(c).Info("Follow is working")
 	id := c.Param("user_id")
 	_, err := uuid.Parse(id)
 	if err != nil {
-		h.Log.Error(err.Error())
+		h.log(c).Error(err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"error": "user id is incorrect"})
 	}
 
 	accessToken := c.GetHeader("Authorization")
-	idFollower, err := auth.GetUserIdFromAccessToken(accessToken)
+	idFollower, err := h.Tokens.GetUserIdFromAccessToken(accessToken)
 	if err != nil {
-		h.Log.Error(err.Error())
+		h.log(c).Error(err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"error": "unauthorized"})
 	}
 
 	res, err := h.User.Follow(c, &pb.FollowRequest{FollowerId: idFollower, FollowingId: id})
 	if err != nil {
-		h.Log.Error(err.Error())
-		c.JSON(500, gin.H{"error": err.Error()})
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": err.Error()})
 	}
 	c.JSON(http.StatusOK, res)
-	h.Log.Info("Follow ended")
+	h.log(c).Info("Follow ended")
 }
 
 // GetFollowers godoc
@@ -388,11 +498,11 @@ func (h Handler) Follow(c *gin.Context) {
 // @Failure 500 {object} string "error while reading from server"
 // @Router /api/v1/users/{user_id}/followers [get]
 func (h Handler) GetFollowers(c *gin.Context) {
-	h.Log.Info("Followers is working")
+	h.log(c).Info("Followers is working")
 	id := c.Param("user_id")
 	_, err := uuid.Parse(id)
 	if err != nil {
-		h.Log.Error(err.Error())
+		h.log(c).Error(err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"error": "user id is incorrect"})
 	}
 	req := pb.FollowersRequest{UserId: id}
@@ -405,7 +515,7 @@ func (h Handler) GetFollowers(c *gin.Context) {
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest,
 				gin.H{"error": err.Error()})
-			h.Log.Error(err.Error())
+			h.log(c).Error(err.Error())
 			return
 		}
 		req.Limit = int64(limit)
@@ -418,7 +528,7 @@ func (h Handler) GetFollowers(c *gin.Context) {
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest,
 				gin.H{"error": err.Error()})
-			h.Log.Error(err.Error())
+			h.log(c).Error(err.Error())
 			return
 		}
 		req.Offset = int64(offset)
@@ -428,8 +538,8 @@ func (h Handler) GetFollowers(c *gin.Context) {
 
 	res, err := h.User.Followers(c, &req)
 	if err != nil {
-		h.Log.Error(err.Error())
+		h.log(c).Error(err.Error())
 	}
 	c.JSON(http.StatusOK, res)
-	h.Log.Info("Followers ended")
+	h.log(c).Info("Followers ended")
 }
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	pb "auth/genproto/users"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/status"
+)
+
+// ChangeUsername godoc
+// @Security ApiKeyAuth
+// @Summary change username
+// @Description renames you; the old username keeps pointing at your account for a while
+// @Tags users
+// @Param info body users.ChangeUsernameRequest true "new username"
+// @Success 200 {object} users.ChangeUsernameResponse
+// @Failure 400 {object} string "Invalid username"
+// @Failure 409 {object} string "Username is taken"
+// @Failure 412 {object} string "Changed too recently"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/users/username [put]
+func (h Handler) ChangeUsername(c *gin.Context) {
+	h.log(c).Info("ChangeUsername is working")
+	id, err := h.Tokens.GetUserIdFromAccessToken(c.GetHeader("Authorization"))
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	req := pb.ChangeUsernameRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserId = id
+
+	res, err := h.User.ChangeUsername(c, &req)
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+	h.log(c).Info("ChangeUsername ended")
+}
+
+// GetByUsername godoc
+// @Security ApiKeyAuth
+// @Summary find user by username
+// @Description old usernames within their reservation period redirect to the current one
+// @Tags users
+// @Param username path string true "username"
+// @Success 200 {object} users.Users
+// @Success 301 {object} users.Users "the username has changed, see Location"
+// @Failure 404 {object} string "User not found"
+// @Failure 500 {object} string "error while reading from server"
+// @Router /api/v1/users/by-username/{username} [get]
+func (h Handler) GetByUsername(c *gin.Context) {
+	h.log(c).Info("GetByUsername is working")
+	res, err := h.User.GetUserByUsername(c, &pb.UsernameLookupRequest{Username: c.Param("username")})
+	if err != nil {
+		h.log(c).Error(err.Error())
+		c.JSON(httpStatus(err), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+
+	if res.Redirected {
+		c.Header("Location", "/api/v1/users/by-username/"+url.PathEscape(res.User.Username))
+		c.JSON(http.StatusMovedPermanently, res.User)
+		return
+	}
+	c.JSON(http.StatusOK, res.User)
+	h.log(c).Info("GetByUsername ended")
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"auth/pkg/challenge"
+	"auth/pkg/logger"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Challenges asks clients that look like bots to solve a challenge before
+// their signup or login is processed.
+type Challenges struct {
+	Verifier challenge.ChallengeVerifier
+	Risk     *challenge.Risk
+}
+
+// Require guards a route of the given action. Once the client is considered
+// risky, the request has to carry the X-Challenge-Token and
+// X-Challenge-Answer headers; otherwise it is answered with 428 and a fresh
+// challenge. The outcome of the request feeds back into the risk signals.
+// Clients are told apart by the address the router trusts, so rotating
+// X-Forwarded-For does not help. Like the rate limits, store failures let
+// the request through.
+func (ch *Challenges) Require(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		required, err := ch.Risk.Required(c, action, ip)
+		if err != nil {
+			logger.FromContext(c, slog.Default()).Error("challenge risk not read", "error", err)
+		}
+		if required {
+			solution := challenge.Solution{
+				Token:    c.GetHeader("X-Challenge-Token"),
+				Answer:   c.GetHeader("X-Challenge-Answer"),
+				RemoteIP: ip,
+			}
+			if solution.Answer == "" || ch.Verifier.Verify(c, solution) != nil {
+				next, err := ch.Verifier.Issue(c)
+				if err != nil {
+					c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				c.AbortWithStatusJSON(http.StatusPreconditionRequired, gin.H{
+					"error":     "challenge required",
+					"challenge": next,
+				})
+				return
+			}
+		}
+
+		c.Next()
+
+		if suspicious(action, c.Writer.Status()) {
+			if err := ch.Risk.Record(c, action, ip); err != nil {
+				logger.FromContext(c, slog.Default()).Error("challenge risk not recorded", "error", err)
+			}
+		}
+	}
+}
+
+// suspicious tells which outcomes count towards the risk of a client: failed
+// logins, and every completed signup since bots sign up in bulk.
+func suspicious(action string, status int) bool {
+	switch action {
+	case challenge.ActionLogin:
+		return status == http.StatusUnauthorized
+	case challenge.ActionRegister:
+		return status == http.StatusOK
+	}
+	return false
+}
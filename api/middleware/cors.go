@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"auth/config"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS lets browser apps on the allowed origins call the gateway: it
+// answers their preflight requests and marks the responses they may read.
+// It does nothing while no origin is allowed.
+func CORS(cfg config.CORSConfig) gin.HandlerFunc {
+	anyOrigin := false
+	allowed := map[string]bool{}
+	for _, origin := range cfg.CORS_ALLOWED_ORIGINS {
+		if origin == "*" {
+			anyOrigin = true
+			continue
+		}
+		allowed[strings.ToLower(strings.TrimRight(origin, "/"))] = true
+	}
+	headers := strings.Join(cfg.CORS_ALLOWED_HEADERS, ", ")
+	maxAge := strconv.Itoa(int(cfg.CORS_MAX_AGE / time.Second))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || !(anyOrigin || allowed[strings.ToLower(origin)]) {
+			c.Next()
+			return
+		}
+		h := c.Writer.Header()
+		h.Add("Vary", "Origin")
+		if anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.CORS_ALLOW_CREDENTIALS {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		h.Set("Access-Control-Expose-Headers", "WWW-Authenticate, Retry-After")
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			h.Set("Access-Control-Allow-Headers", headers)
+			h.Set("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"auth/pkg/audit"
+	"auth/pkg/logger"
+	"auth/pkg/trust"
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ForwardClient is a gRPC client interceptor that passes the address of the
+// HTTP client on to the User service, so that per-caller limits there apply
+// to the end user rather than to the gateway itself. It passes the request
+// ID on as well, to tie the logs of both sides together, and the user agent
+// and the signed in user for the audit log.
+func ForwardClient(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if c, ok := ctx.(*gin.Context); ok {
+		ctx = metadata.AppendToOutgoingContext(ctx, trust.ForwardedForMetadata, c.ClientIP())
+		if ua := audit.CleanUserAgent(c.Request.UserAgent()); ua != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, audit.UserAgentMetadata, ua)
+		}
+	}
+	if id := logger.RequestID(ctx); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, logger.RequestIDMetadata, id)
+	}
+	if actor := audit.Actor(ctx); actor != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, audit.ActorMetadata, actor)
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
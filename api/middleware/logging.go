@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"auth/pkg/logger"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestLogger gives every request a logger carrying its ID, taken from
+// the X-Request-ID header or made up, and its route, then logs the status
+// and latency of the request. The ID is sent back in the response.
+func RequestLogger(log *slog.Logger) gin.HandlerFunc {
+	if log == nil {
+		log = slog.Default()
+	}
+	return func(c *gin.Context) {
+		id := c.GetHeader(logger.RequestIDHeader)
+		if !logger.ValidRequestID(id) {
+			id = logger.NewRequestID()
+		}
+		c.Header(logger.RequestIDHeader, id)
+		args := []interface{}{"method", c.Request.Method, "route", c.FullPath()}
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.HasTraceID() {
+			args = append(args, "trace_id", span.TraceID().String())
+		}
+		ctx := logger.WithRequest(c.Request.Context(), log, id, args...)
+		c.Request = c.Request.WithContext(ctx)
+
+		start := time.Now()
+		c.Next()
+
+		level := slog.LevelInfo
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		ctx = c.Request.Context()
+		logger.FromContext(ctx, log).Log(ctx, level, "request finished",
+			"status", c.Writer.Status(),
+			"latency", time.Since(start),
+			"ip", c.ClientIP(),
+		)
+	}
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"auth/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics records every request to the gateway under its route pattern;
+// requests matching no route are put together as "unmatched".
+func Metrics(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		done := m.StartHTTP()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		done(c.Request.Method, route, c.Writer.Status())
+	}
+}
@@ -2,12 +2,61 @@ package middleware
 
 import (
 	"auth/api/auth"
+	"auth/pkg/audit"
+	"auth/pkg/dpop"
+	"auth/pkg/logger"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strings"
 )
 
-func Check(c *gin.Context) {
+const dpopVerifierKey = "dpop_verifier"
+
+// DPoP hands the verifier of DPoP proofs to Check. A nil verifier means
+// DPoP is off and tokens bound to a key are refused.
+func DPoP(v *dpop.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v != nil {
+			c.Set(dpopVerifierKey, v)
+		}
+		c.Next()
+	}
+}
+
+// Check lets requests with a valid access token through. The restricted
+// token of a user who has to change their password is refused. Browser
+// sessions send the token in the access_token cookie instead of the
+// Authorization header, where SessionCookies turned them on. Tokens bound
+// to a DPoP key need a proof of it with every request, sent with the DPoP
+// scheme. Either way the bare token ends up in the Authorization header
+// for the handlers.
+func Check(t *auth.Tokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		check(c, t, false)
+	}
+}
+
+// CheckPasswordChange is Check for the password change endpoint, the one
+// place restricted tokens are good for.
+func CheckPasswordChange(t *auth.Tokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		check(c, t, true)
+	}
+}
+
+func check(c *gin.Context, t *auth.Tokens, allowRestricted bool) {
 	accessToken := c.GetHeader("Authorization")
+	scheme := ""
+	if i := strings.IndexByte(accessToken, ' '); i > 0 {
+		scheme, accessToken = accessToken[:i], strings.TrimSpace(accessToken[i+1:])
+		c.Request.Header.Set("Authorization", accessToken)
+	}
+	if accessToken == "" && c.GetBool(sessionCookiesKey) {
+		if cookie, err := c.Cookie(auth.AccessCookie); err == nil && cookie != "" {
+			accessToken = cookie
+			c.Request.Header.Set("Authorization", cookie)
+		}
+	}
 
 	if accessToken == "" {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
@@ -16,9 +65,88 @@ func Check(c *gin.Context) {
 		return
 	}
 
-	_, err := auth.ValidateAccessToken(accessToken)
+	claims, err := t.ExtractAccessClaim(accessToken)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if claims == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
+		return
+	}
+	// Tokens obtained by token exchange are for the services they name.
+	if len(auth.Audience(claims)) > 0 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "access token is meant for another service"})
+		return
+	}
+	if !checkDPoP(c, scheme, accessToken, auth.Confirmation(claims)) {
+		return
+	}
+	if id, _ := claims["user_id"].(string); id != "" {
+		ctx := logger.With(c.Request.Context(), "user_id", id)
+		c.Request = c.Request.WithContext(audit.WithActor(ctx, id))
+	}
+	if scope, _ := claims["scope"].(string); scope == auth.PasswordChangeScope && !allowRestricted {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "password change required", "password_change_required": true})
+		return
 	}
 	c.Next()
 }
+
+// checkDPoP makes sure the client holds the key a token is bound to and
+// refuses bearer tokens where DPoP is required.
+func checkDPoP(c *gin.Context, scheme, accessToken, jkt string) bool {
+	var v *dpop.Verifier
+	if value, ok := c.Get(dpopVerifierKey); ok {
+		v = value.(*dpop.Verifier)
+	}
+	fail := func(code, description string) bool {
+		c.Header("WWW-Authenticate", `DPoP error="`+code+`", error_description="`+description+`"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": description})
+		return false
+	}
+
+	switch {
+	case jkt == "" && strings.EqualFold(scheme, "DPoP"):
+		return fail("invalid_token", "access token is not bound to a DPoP key")
+	case jkt == "" && v != nil && v.Required:
+		return fail("invalid_token", "DPoP bound access token required")
+	case jkt == "":
+		return true
+	case v == nil:
+		return fail("invalid_token", "DPoP is not enabled")
+	case strings.EqualFold(scheme, "Bearer"):
+		return fail("invalid_token", "DPoP bound access token sent as a bearer token")
+	}
+
+	proofs := c.Request.Header.Values(dpop.Header)
+	if len(proofs) != 1 {
+		return fail("invalid_dpop_proof", "exactly one DPoP proof is required")
+	}
+	got, err := v.Verify(c, proofs[0], c.Request.Method, c.Request.URL.Path, accessToken)
+	if err != nil {
+		return fail("invalid_dpop_proof", "invalid DPoP proof")
+	}
+	if got != jkt {
+		return fail("invalid_dpop_proof", "DPoP proof is made with another key")
+	}
+	return true
+}
+
+// RequireRole lets the request through only when the access token carries
+// the given role. It is meant to be chained after Check.
+func RequireRole(t *auth.Tokens, role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := t.ExtractAccessClaim(c.GetHeader("Authorization"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		if r, _ := claims["role"].(string); r != role {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+			return
+		}
+		c.Next()
+	}
+}
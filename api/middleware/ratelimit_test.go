@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	pb "auth/genproto/users"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestByUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var token pb.Tokens
+	if err := testTokens.GeneratedAccessToken(&pb.UserInfo{Id: "u1"}, &token, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	key := ByUser(testTokens)
+
+	for _, header := range []string{token.Accestoken, "Bearer " + token.Accestoken, "DPoP " + token.Accestoken, "Bearer garbage", ""} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/auth/reset-password", nil)
+		c.Request.RemoteAddr = "203.0.113.9:4000"
+		c.Request.Header.Set("Authorization", header)
+
+		want := "user:u1"
+		if header == "Bearer garbage" || header == "" {
+			want = "ip:203.0.113.9"
+		}
+		if got := key(c); got != want {
+			t.Errorf("ByUser(%.20q) = %q, want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"auth/api/auth"
+	pb "auth/genproto/users"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testTokens = auth.NewTokens(auth.Lifetimes{Access: time.Minute, PasswordChange: time.Minute, Refresh: time.Hour}, auth.NewJWT("access", "refresh"))
+
+func newSessionRouter(cookies bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(SessionCookies(cookies), CSRF)
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router.GET("/profile", Check(testTokens), ok)
+	router.POST("/profile", ok)
+	return router
+}
+
+func TestCSRF(t *testing.T) {
+	session := &http.Cookie{Name: auth.AccessCookie, Value: "token"}
+	csrf := &http.Cookie{Name: auth.CSRFCookie, Value: "c1"}
+	tests := []struct {
+		name    string
+		cookies bool
+		setup   func(*http.Request)
+		want    int
+	}{
+		{"no session", true, func(r *http.Request) {}, http.StatusNoContent},
+		{"bearer token", true, func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer token")
+			r.AddCookie(session)
+		}, http.StatusNoContent},
+		{"no CSRF token", true, func(r *http.Request) {
+			r.AddCookie(session)
+			r.AddCookie(csrf)
+		}, http.StatusForbidden},
+		{"no CSRF cookie", true, func(r *http.Request) {
+			r.AddCookie(session)
+			r.Header.Set(auth.CSRFHeader, "c1")
+		}, http.StatusForbidden},
+		{"wrong CSRF token", true, func(r *http.Request) {
+			r.AddCookie(session)
+			r.AddCookie(csrf)
+			r.Header.Set(auth.CSRFHeader, "c2")
+		}, http.StatusForbidden},
+		{"matching CSRF token", true, func(r *http.Request) {
+			r.AddCookie(session)
+			r.AddCookie(csrf)
+			r.Header.Set(auth.CSRFHeader, "c1")
+		}, http.StatusNoContent},
+		// With cookie sessions off the cookie authenticates nothing, so
+		// there is nothing to forge.
+		{"sessions off", false, func(r *http.Request) { r.AddCookie(session) }, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/profile", nil)
+		tt.setup(req)
+		w := httptest.NewRecorder()
+		newSessionRouter(tt.cookies).ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: POST = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+
+}
+
+func TestCheckSessionCookie(t *testing.T) {
+	var token pb.Tokens
+	if err := testTokens.GeneratedAccessToken(&pb.UserInfo{Id: "u1"}, &token, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	// The GET passes CSRF without a token, as safe methods are not checked.
+	for _, cookies := range []bool{true, false} {
+		req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		req.AddCookie(&http.Cookie{Name: auth.AccessCookie, Value: token.Accestoken})
+		w := httptest.NewRecorder()
+		newSessionRouter(cookies).ServeHTTP(w, req)
+		want := http.StatusNoContent
+		if !cookies {
+			want = http.StatusUnauthorized
+		}
+		if w.Code != want {
+			t.Errorf("session cookies %v: GET = %d, want %d", cookies, w.Code, want)
+		}
+	}
+}
@@ -4,9 +4,14 @@ import (
 	_ "auth/api/docs"
 	"auth/api/handler"
 	"auth/api/middleware"
+	"auth/pkg/challenge"
+	"auth/pkg/ratelimit"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // Router
@@ -18,34 +23,129 @@ import (
 // @description API Gateway of Authorazation
 // @host localhost:8085
 // BasePath: /
-func Router(hand *handler.Handler) *gin.Engine {
-	router := gin.Default()
+//
+// Only the proxies listed may tell the client address in X-Forwarded-For;
+// with none, the address is that of the connection.
+func Router(hand *handler.Handler, limiter *ratelimit.Limiter, challenges *middleware.Challenges, proxies []string) (*gin.Engine, error) {
+	// gin's own request log is left out: it prints the query strings,
+	// tokens in email links included.
+	router := gin.New()
+	if len(proxies) == 0 {
+		proxies = nil
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		return nil, err
+	}
+	router.Use(gin.Recovery())
+	// Handlers pass the gin context on to the gRPC client; with the
+	// fallback it carries the span and the deadline of the request.
+	router.ContextWithFallback = true
+	router.Use(otelgin.Middleware("gateway", otelgin.WithFilter(func(r *http.Request) bool {
+		return r.URL.Path != "/healthz" && r.URL.Path != "/readyz"
+	})))
+	router.Use(middleware.RequestLogger(hand.Log), middleware.Metrics(hand.Metrics), middleware.CORS(hand.CORS))
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	router.GET("/healthz", hand.Healthz)
+	router.GET("/readyz", hand.Readyz)
+	router.Use(middleware.DPoP(hand.DPoP), middleware.SessionCookies(hand.Sessions.SESSION_COOKIES))
+
+	register := middleware.RateLimit(limiter, ratelimit.RegisterPolicy, middleware.ByIP)
+	login := middleware.RateLimit(limiter, ratelimit.LoginPolicy, middleware.ByIP)
+	poll := middleware.RateLimit(limiter, ratelimit.PollPolicy, middleware.ByIP)
+	byUser := middleware.ByUser(hand.Tokens)
+	password := middleware.RateLimit(limiter, ratelimit.PasswordPolicy, byUser)
+	read := middleware.RateLimit(limiter, ratelimit.ReadPolicy, byUser)
+	write := middleware.RateLimit(limiter, ratelimit.WritePolicy, byUser)
+	check := middleware.Check(hand.Tokens)
+
 	auth := router.Group("/api/v1/auth")
+	auth.Use(middleware.CSRF)
 	{
-		auth.POST("/register", hand.Register)
-		auth.POST("/login", hand.Login)
-		auth.POST("/refresh", hand.Refresh)
-		auth.POST("/logout", hand.Logout)
+		auth.POST("/register", register, challenges.Require(challenge.ActionRegister), hand.Register)
+		auth.POST("/login", login, challenges.Require(challenge.ActionLogin), hand.Login)
+		auth.POST("/refresh", write, hand.Refresh)
+		auth.POST("/logout", write, hand.Logout)
+		auth.POST("/reset-password", password, middleware.CheckPasswordChange(hand.Tokens), hand.ResetPassword)
+		auth.POST("/qr", login, hand.StartQRLogin)
+		auth.GET("/qr/tokens", poll, hand.QRLoginTokens)
 	}
 
 	userAuth := router.Group("/api/v1/auth")
-	userAuth.Use(middleware.Check)
+	userAuth.Use(middleware.CSRF, check)
+	{
+		userAuth.GET("/qr/:session_id", read, hand.DescribeQRLogin)
+		userAuth.POST("/qr/:session_id/approve", write, hand.ApproveQRLogin)
+	}
+
+	email := router.Group("/api/v1/users/email")
 	{
-		userAuth.POST("/reset-password", hand.ResetPassword)
+		email.GET("/confirm", read, hand.ConfirmEmailPage)
+		email.POST("/confirm", write, hand.ConfirmEmail)
+		email.GET("/cancel", read, hand.CancelEmailPage)
+		email.POST("/cancel", write, hand.CancelEmail)
 	}
 
 	user := router.Group("/api/v1/users")
-	user.Use(middleware.Check)
+	user.Use(middleware.CSRF, check)
+	{
+		user.POST("/email", password, hand.ChangeEmail)
+		user.PUT("/username", write, hand.ChangeUsername)
+		user.GET("/by-username/:username", read, hand.GetByUsername)
+		user.GET("/profile", read, hand.Profile)
+		user.PUT("/profile", write, hand.UserProfileUpdate)
+		user.GET("", read, hand.GetAllUsers)
+		user.DELETE("/:user_id", write, hand.Delete)
+		user.GET("/:user_id/activity", read, hand.ActivityOfUser)
+		user.POST("/:user_id/follow", write, hand.Follow)
+		user.GET("/:user_id/followers", read, hand.GetFollowers)
+	}
+
+	oauth := router.Group("/oauth")
+	{
+		oauth.POST("/device_authorization", login, hand.DeviceAuthorization)
+		oauth.POST("/token", write, hand.Token)
+	}
+
+	device := router.Group("/api/v1/oauth")
+	device.Use(middleware.CSRF, check)
+	{
+		device.POST("/device", write, hand.VerifyDevice)
+	}
+
+	sso := router.Group("/saml/:idp")
+	{
+		sso.GET("/metadata", read, hand.SAMLMetadata)
+		sso.GET("/login", login, hand.SAMLLogin)
+		sso.POST("/acs", login, hand.SAMLACS)
+	}
+
+	scim := router.Group("/scim/v2")
+	scim.Use(middleware.RateLimit(limiter, ratelimit.ScimPolicy, middleware.ByBearer), hand.ScimAuth)
+	{
+		scim.GET("/Users", hand.ScimListUsers)
+		scim.POST("/Users", hand.ScimCreateUser)
+		scim.GET("/Users/:id", hand.ScimGetUser)
+		scim.PUT("/Users/:id", hand.ScimReplaceUser)
+		scim.PATCH("/Users/:id", hand.ScimPatchUser)
+		scim.DELETE("/Users/:id", hand.ScimDeleteUser)
+		scim.GET("/Groups", hand.ScimListGroups)
+		scim.POST("/Groups", hand.ScimCreateGroup)
+		scim.GET("/Groups/:id", hand.ScimGetGroup)
+		scim.PUT("/Groups/:id", hand.ScimReplaceGroup)
+		scim.PATCH("/Groups/:id", hand.ScimPatchGroup)
+		scim.DELETE("/Groups/:id", hand.ScimDeleteGroup)
+	}
+
+	admin := router.Group("/api/v1/admin")
+	admin.Use(middleware.CSRF, check, middleware.RequireRole(hand.Tokens, "admin"))
 	{
-		user.GET("/profile", hand.Profile)
-		user.PUT("/profile", hand.UserProfileUpdate)
-		user.GET("", hand.GetAllUsers)
-		user.DELETE("/:user_id", hand.Delete)
-		user.GET("/:user_id/activity", hand.ActivityOfUser)
-		user.POST("/:user_id/follow", hand.Follow)
-		user.GET("/:user_id/followers", hand.GetFollowers)
+		admin.POST("/users/:user_id/unlock", write, hand.UnlockAccount)
+		admin.POST("/users/:user_id/force-password-change", write, hand.ForcePasswordChange)
+		admin.PUT("/organizations/:slug/password-expiry", write, hand.SetPasswordExpiry)
+		admin.POST("/organizations/:slug/scim-tokens", write, hand.CreateScimToken)
+		admin.DELETE("/scim-tokens/:token_id", write, hand.RevokeScimToken)
+		admin.GET("/audit-events", read, hand.ListAuditEvents)
 	}
 
-	return router
+	return router, nil
 }
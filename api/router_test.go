@@ -0,0 +1,55 @@
+package api
+
+import (
+	"auth/api/auth"
+	"auth/api/handler"
+	"auth/pkg/ratelimit"
+	"auth/pkg/saml"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestRouterForwardedFor checks that only a trusted proxy can pick the
+// bucket a request is taken from with X-Forwarded-For.
+func TestRouterForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hand := &handler.Handler{
+		Log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		SAML:   &saml.ServiceProvider{},
+		Tokens: auth.NewTokens(auth.Lifetimes{Access: time.Minute, PasswordChange: time.Minute, Refresh: time.Hour}, auth.NewJWT("access", "refresh")),
+	}
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.Policy{Name: ratelimit.ReadPolicy, Rate: 0.001, Burst: 1})
+	router, err := Router(hand, limiter, nil, []string{"10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/saml/idp/metadata", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A client rotating the header still drains its own bucket.
+	if code := get("203.0.113.9:4000", "198.51.100.1"); code == http.StatusTooManyRequests {
+		t.Fatalf("first request = %d", code)
+	}
+	if code := get("203.0.113.9:4000", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("request with another X-Forwarded-For = %d, want 429", code)
+	}
+
+	// Behind the proxy, each end user has a bucket.
+	for _, ip := range []string{"198.51.100.1", "198.51.100.2"} {
+		if code := get("10.0.0.1:4000", ip); code == http.StatusTooManyRequests {
+			t.Errorf("request of %s through the proxy = %d", ip, code)
+		}
+	}
+}
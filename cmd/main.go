@@ -2,52 +2,211 @@ package main
 
 import (
 	"auth/api"
+	"auth/api/auth"
 	"auth/api/handler"
+	"auth/api/middleware"
+	"auth/config"
 	"auth/genproto/users"
+	"auth/migrations"
+	"auth/pkg/audit"
+	"auth/pkg/challenge"
+	"auth/pkg/claims"
+	"auth/pkg/dpop"
+	"auth/pkg/exchange"
+	"auth/pkg/lifecycle"
 	"auth/pkg/logger"
+	"auth/pkg/metrics"
+	"auth/pkg/migrate"
+	"auth/pkg/probe"
+	"auth/pkg/ratelimit"
+	"auth/pkg/saml"
+	"auth/pkg/tracing"
+	"auth/pkg/trust"
 	"auth/service"
 	"auth/storage/postgres"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"log"
+	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	db, err := postgres.ConnectDB()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrateCommand(os.Args[2:]); err != nil {
+			log.Fatalf("error while migrating: %v", err)
+		}
+		return
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("error while loading configuration: %v", err)
+	}
+	logs, err := logger.NewLogger(cfg.Log)
+	if err != nil {
+		log.Fatalf("error while opening the log: %v", err)
+	}
+	traces, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("error while configuring tracing: %v", err)
+	}
+	db, err := postgres.ConnectDB(cfg.Postgres)
 	if err != nil {
 		panic(err)
 	}
-	defer db.Close()
+	if cfg.Postgres.DB_MIGRATE_ON_START {
+		// Replicas starting together take turns through the lock.
+		m, err := migrate.New(db, migrations.Auth, migrations.AuthTable, logs)
+		if err == nil {
+			err = m.Up(context.Background())
+		}
+		if err != nil {
+			log.Fatalf("error while migrating the database: %v", err)
+		}
+	}
+	tokens, err := auth.FromConfig(cfg.Token)
+	if err != nil {
+		log.Fatalf("error while configuring tokens: %v", err)
+	}
+	limiter, err := ratelimit.FromConfig(cfg.RateLimit, db, logs)
+	if err != nil {
+		log.Fatalf("error while configuring rate limits: %v", err)
+	}
+	gateways, err := trust.ParseGateways(cfg.Server.TRUSTED_GATEWAYS)
+	if err != nil {
+		log.Fatalf("error while configuring trusted gateways: %v", err)
+	}
+	verifier, err := challenge.NewVerifier(cfg.Challenge)
+	if err != nil {
+		log.Fatalf("error while configuring challenges: %v", err)
+	}
+	risk, err := challenge.RiskFromConfig(cfg.Challenge, db, logs)
+	if err != nil {
+		log.Fatalf("error while configuring challenges: %v", err)
+	}
+	challenges := &middleware.Challenges{Verifier: verifier, Risk: risk}
+	sp, err := saml.FromConfig(cfg.SAML, cfg.Account.PUBLIC_URL, db, logs)
+	if err != nil {
+		log.Fatalf("error while configuring SAML: %v", err)
+	}
+	tokenExchange, err := exchange.FromConfig(cfg.OAuth)
+	if err != nil {
+		log.Fatalf("error while configuring token exchange: %v", err)
+	}
+	proofs, err := dpop.FromConfig(cfg.DPoP, cfg.Account.PUBLIC_URL, db, logs)
+	if err != nil {
+		log.Fatalf("error while configuring DPoP: %v", err)
+	}
+	mappers, err := claims.FromConfig(cfg.Token)
+	if err != nil {
+		log.Fatalf("error while configuring token claims: %v", err)
+	}
 	fmt.Println("Starting server...")
-	lis, err := net.Listen("tcp", ":50051")
+	lis, err := net.Listen("tcp", cfg.Server.USER_PORT)
 	if err != nil {
 		log.Fatalf("error while listening: %v", err)
 	}
-	defer lis.Close()
-	userService := service.NewUserService(db)
-	server := grpc.NewServer()
+	var stats *metrics.Metrics
+	if cfg.Server.METRICS_ADDR != "" {
+		stats = metrics.New(db)
+	}
+	userService, err := service.NewUserService(db, cfg, tokens, logs, stats)
+	if err != nil {
+		log.Fatalf("error while creating the user service: %v", err)
+	}
+	server := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler(traceFilter)), grpc.ChainUnaryInterceptor(
+		logger.UnaryServerInterceptor(logs),
+		metrics.UnaryServerInterceptor(stats),
+		ratelimit.UnaryServerInterceptor(limiter, gateways),
+	))
 	users.RegisterUserServer(server, userService)
+	health := grpchealth.NewServer()
+	health.SetServingStatus(users.User_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, health)
 	log.Printf("server listening at %v", lis.Addr())
 
-	go func() {
-		err = server.Serve(lis)
-		if err != nil {
-			log.Fatalf("error while serving: %v", err)
-		}
-	}()
+	app := lifecycle.New(cfg.Server.SHUTDOWN_TIMEOUT, cfg.Server.SHUTDOWN_DRAIN_DELAY, logs)
+	app.OnDrain(health.Shutdown)
 
-	hand := NewHandler()
-	router := api.Router(hand)
-	log.Println("server is running")
-	log.Fatal(router.Run(":8085"))
+	hand, conn := NewHandler(cfg.Server.USER_SERVICE_ADDR, logs)
+	hand.SAML = sp
+	hand.PublicURL = cfg.Account.PUBLIC_URL
+	hand.Sessions = cfg.Session
+	hand.Exchange = tokenExchange
+	hand.DPoP = proofs
+	hand.Claims = mappers
+	hand.Tokens = tokens
+	hand.CORS = cfg.CORS
+	hand.Metrics = stats
+	hand.Probe = probe.New(cfg.Server.HEALTH_CHECK_TIMEOUT, app.Ready)
+	hand.Probe.Add("database", probe.Database(db))
+	hand.Probe.Add("grpc", probe.GRPC(conn, users.User_ServiceDesc.ServiceName))
+	router, err := api.Router(hand, limiter, challenges, cfg.Server.TRUSTED_GATEWAYS)
+	if err != nil {
+		log.Fatalf("error while configuring trusted proxies: %v", err)
+	}
+	gateway := &http.Server{Addr: cfg.Server.HTTP_PORT, Handler: router}
+
+	// The gateway goes first since it calls the gRPC server, and the
+	// database last.
+	app.OnShutdown("http", gateway.Shutdown)
+	app.OnShutdown("grpc", lifecycle.StopGRPC(server))
+	app.OnShutdown("grpc client", func(context.Context) error { return conn.Close() })
+	if cfg.Audit.AUDIT_RETENTION > 0 {
+		retention := audit.NewRetention(postgres.NewAuditRepository(db), cfg.Audit.AUDIT_RETENTION, cfg.Audit.AUDIT_EXPORT_DIR, cfg.Audit.AUDIT_PURGE_INTERVAL, logs)
+		app.OnShutdown("audit retention", lifecycle.Go(retention.Run))
+	}
+	app.OnShutdown("database", func(context.Context) error { return db.Close() })
+	app.OnShutdown("tracing", traces.Shutdown)
+	serve := []func() error{
+		func() error { return server.Serve(lis) },
+		lifecycle.ServeHTTP(gateway),
+	}
+	if stats != nil {
+		// Metrics stay up until the end, for the shutdown to be seen.
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", stats.Handler())
+		metricsServer := &http.Server{Addr: cfg.Server.METRICS_ADDR, Handler: mux}
+		app.OnShutdown("metrics", metricsServer.Shutdown)
+		serve = append(serve, lifecycle.ServeHTTP(metricsServer))
+	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Println("server is running")
+	err = app.Run(ctx, serve...)
+	if err != nil {
+		log.Fatalf("error while serving: %v", err)
+	}
 }
-func NewHandler() *handler.Handler {
-	conn, err := grpc.NewClient("localhost:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
+
+// traceFilter leaves the health checks of the probes out of the traces.
+var traceFilter = otelgrpc.WithFilter(filters.Not(filters.HealthCheck()))
+
+func NewHandler(addr string, logs *slog.Logger) (*handler.Handler, *grpc.ClientConn) {
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(middleware.ForwardClient),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(traceFilter)),
+	)
 	if err != nil {
 		log.Panic(err)
 	}
-	return &handler.Handler{User: users.NewUserClient(conn), Log: logger.NewLogger()}
+	return &handler.Handler{User: users.NewUserClient(conn), Log: logs}, conn
 }
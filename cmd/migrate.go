@@ -0,0 +1,135 @@
+package main
+
+import (
+	"auth/config"
+	"auth/migrations"
+	"auth/pkg/logger"
+	"auth/pkg/migrate"
+	"auth/storage/postgres"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `usage: auth migrate [flags] [foreign] command
+
+Commands:
+  up                apply the pending migrations
+  down [N]          roll back the last N migrations, 1 by default
+  to VERSION        migrate up or down to VERSION
+  status            list the migrations and whether they are applied
+  baseline VERSION  mark the migrations up to VERSION as applied without
+                    running them, for a database migrated by hand
+
+foreign works on the tables of other services, for development databases.
+The flags are those of the server, such as --db-host.`
+
+// migrateCommand runs auth migrate.
+func migrateCommand(args []string) error {
+	cfg, rest, err := config.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fsys, table := migrations.Auth, migrations.AuthTable
+	if len(rest) > 0 && rest[0] == "foreign" {
+		fsys, table = migrations.Foreign, migrations.ForeignTable
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		return errors.New(migrateUsage)
+	}
+	switch rest[0] {
+	case "up", "down", "to", "status", "baseline":
+	default:
+		return fmt.Errorf("unknown command %q\n%s", rest[0], migrateUsage)
+	}
+
+	logs, err := logger.NewLogger(cfg.Log)
+	if err != nil {
+		return err
+	}
+	db, err := postgres.ConnectDB(cfg.Postgres)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	m, err := migrate.New(db, fsys, table, logs)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	number := func(def int64) (int64, error) {
+		switch {
+		case len(rest) == 1 && def >= 0:
+			return def, nil
+		case len(rest) != 2:
+			return 0, errors.New(migrateUsage)
+		}
+		n, err := strconv.ParseInt(rest[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %q is not a number", rest[0], rest[1])
+		}
+		return n, nil
+	}
+	switch rest[0] {
+	case "up":
+		if len(rest) != 1 {
+			return errors.New(migrateUsage)
+		}
+		return m.Up(ctx)
+	case "down":
+		n, err := number(1)
+		if err != nil {
+			return err
+		}
+		return m.Down(ctx, int(n))
+	case "to":
+		v, err := number(-1)
+		if err != nil {
+			return err
+		}
+		return m.To(ctx, v)
+	case "baseline":
+		v, err := number(-1)
+		if err != nil {
+			return err
+		}
+		return m.Baseline(ctx, v)
+	case "status":
+		if len(rest) != 1 {
+			return errors.New(migrateUsage)
+		}
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied {
+				applied = s.AppliedAt.Local().Format(time.DateTime)
+			}
+			name := s.Name
+			if name == "" {
+				name = "(unknown to this binary)"
+			}
+			fmt.Fprintf(w, "%06d\t%s\t%s\n", s.Version, name, applied)
+		}
+		return w.Flush()
+	}
+	return nil
+}
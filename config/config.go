@@ -1,53 +1,477 @@
 package config
 
 import (
-	"log"
-	"os"
+	"strings"
+	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/spf13/cast"
 )
 
+// The JWT keys tokens were signed with before they became settings. They
+// are public, so Validate refuses them unless JWT_ALLOW_DEFAULT_SECRETS is
+// set for local development.
+const (
+	DefaultJWTAccessSecret  = "visca barsa"
+	DefaultJWTRefreshSecret = "visca barsa visca kataluniya"
+)
+
 type Config struct {
-	Postgres PostgresConfig
-	Server   ServerConfig
+	Postgres  PostgresConfig
+	Server    ServerConfig
+	Lockout   LockoutConfig
+	SMTP      SMTPConfig
+	RateLimit RateLimitConfig
+	Challenge ChallengeConfig
+	Account   AccountConfig
+	OAuth     OAuthConfig
+	SAML      SAMLConfig
+	Password  PasswordConfig
+	Session   SessionConfig
+	DPoP      DPoPConfig
+	Token     TokenConfig
+	CORS      CORSConfig
+	Log       LogConfig
+	Tracing   TracingConfig
+	Audit     AuditConfig
 }
 
 type PostgresConfig struct {
+	// DB_DSN, when set, is used as is instead of the other DB_ settings
+	// that make up the connection string.
+	DB_DSN      string
 	DB_HOST     string
 	DB_PORT     string
 	DB_USER     string
 	DB_NAME     string
 	DB_PASSWORD string
+	DB_SSLMODE  string
+	// Connection pool limits.
+	DB_MAX_OPEN_CONNS     int
+	DB_MAX_IDLE_CONNS     int
+	DB_CONN_MAX_LIFETIME  time.Duration
+	DB_CONN_MAX_IDLE_TIME time.Duration
+	// DB_MIGRATE_ON_START applies the pending migrations before the
+	// servers start, as auth migrate up does.
+	DB_MIGRATE_ON_START bool
 }
 
 type ServerConfig struct {
+	// USER_PORT is the address the gRPC server listens on and HTTP_PORT
+	// the one of the gateway.
 	USER_PORT string
+	HTTP_PORT string
+	// USER_SERVICE_ADDR is where the gateway reaches the gRPC server.
+	USER_SERVICE_ADDR string
+	// SHUTDOWN_DRAIN_DELAY is how long the servers keep serving after a
+	// SIGTERM while reported not ready, and SHUTDOWN_TIMEOUT how long the
+	// requests in flight then get to finish.
+	SHUTDOWN_DRAIN_DELAY time.Duration
+	SHUTDOWN_TIMEOUT     time.Duration
+	// HEALTH_CHECK_TIMEOUT bounds each dependency check of /readyz.
+	HEALTH_CHECK_TIMEOUT time.Duration
+	// METRICS_ADDR is where /metrics is served, apart from the gateway so
+	// that it is not exposed with it. It defaults to the loopback interface;
+	// a scraper on another host needs an address such as :9090. Metrics are
+	// off while it is empty.
+	METRICS_ADDR string
+	// TRUSTED_GATEWAYS lists the addresses or CIDRs of the gateways. Only
+	// their calls may say which end user, and from where, they are made
+	// for; the gRPC server trusts no other caller's metadata. The gateway
+	// likewise only believes X-Forwarded-For from the proxies listed.
+	TRUSTED_GATEWAYS []string
 }
 
-func Load() *Config {
-	if err := godotenv.Load(".env"); err != nil {
-		log.Printf("error while loading .env file: %v", err)
-	}
+type LockoutConfig struct {
+	MAX_FAILED_LOGINS        int
+	MAX_FAILED_LOGINS_PER_IP int
+	LOCKOUT_BASE_DURATION    time.Duration
+	LOCKOUT_MAX_DURATION     time.Duration
+	// A failure more than LOCKOUT_FAILURE_WINDOW after the previous one
+	// starts the count over. After LOCKOUT_DECAY without failures, the
+	// earlier lockouts no longer make the next one longer.
+	LOCKOUT_FAILURE_WINDOW time.Duration
+	LOCKOUT_DECAY          time.Duration
+	LOGIN_MIN_DURATION     time.Duration
+}
+
+// RateLimitConfig holds one "<requests>/<period>" policy per route class.
+type RateLimitConfig struct {
+	RATE_LIMIT_BACKEND  string
+	RATE_LIMIT_REGISTER string
+	RATE_LIMIT_LOGIN    string
+	RATE_LIMIT_PASSWORD string
+	RATE_LIMIT_READ     string
+	RATE_LIMIT_WRITE    string
+	RATE_LIMIT_GRPC     string
+	RATE_LIMIT_SCIM     string
+	RATE_LIMIT_POLL     string
+}
+
+// ChallengeConfig decides when signups and logins have to solve a
+// proof-of-work or CAPTCHA challenge first.
+type ChallengeConfig struct {
+	CHALLENGE_PROVIDER            string
+	CHALLENGE_SECRET              string
+	CHALLENGE_TTL                 time.Duration
+	CHALLENGE_WINDOW              time.Duration
+	CHALLENGE_AFTER_FAILED_LOGINS int
+	CHALLENGE_AFTER_REGISTRATIONS int
+	POW_DIFFICULTY                int
+	CAPTCHA_VERIFY_URL            string
+	CAPTCHA_SECRET                string
+	CAPTCHA_SITE_KEY              string
+	// CHALLENGE_RISK_BACKEND is memory or postgres; postgres is needed when
+	// more than one gateway runs.
+	CHALLENGE_RISK_BACKEND string
+}
+
+type AccountConfig struct {
+	// PUBLIC_URL is the address of the gateway as seen by users; links in
+	// emails point to it.
+	PUBLIC_URL       string
+	EMAIL_CHANGE_TTL time.Duration
+	// USERNAME_CHANGE_COOLDOWN is the minimum time between two renames and
+	// USERNAME_RESERVATION how long an old username stays reserved.
+	USERNAME_CHANGE_COOLDOWN time.Duration
+	USERNAME_RESERVATION     time.Duration
+}
+
+type OAuthConfig struct {
+	// DEVICE_CLIENTS lists the client ids allowed to use the device
+	// authorization grant.
+	DEVICE_CLIENTS       []string
+	DEVICE_CODE_TTL      time.Duration
+	DEVICE_POLL_INTERVAL time.Duration
+	// DEVICE_VERIFICATION_URI is the page where users enter the code shown
+	// on the device.
+	DEVICE_VERIFICATION_URI string
+	// QR_LOGIN_URI is encoded into login QR codes together with the session
+	// id and opened by the mobile app.
+	QR_LOGIN_URI string
+	QR_LOGIN_TTL time.Duration
+	// TOKEN_EXCHANGE_CLIENTS_FILE lists the services that may exchange
+	// user tokens and the audiences they may ask for.
+	TOKEN_EXCHANGE_CLIENTS_FILE string
+	TOKEN_EXCHANGE_TTL          time.Duration
+	// TOKEN_EXCHANGE_MAX_DEPTH is the longest chain of services acting for
+	// a user.
+	TOKEN_EXCHANGE_MAX_DEPTH int
+}
+
+// SAMLConfig lists the identity providers of partner agencies in
+// SAML_PROVIDERS_FILE. SSO is off while it is empty.
+type SAMLConfig struct {
+	SAML_PROVIDERS_FILE string
+	// SAML_ENTITY_ID defaults to PUBLIC_URL followed by /saml.
+	SAML_ENTITY_ID      string
+	SAML_MAX_CLOCK_SKEW time.Duration
+	// SAML_REPLAY_BACKEND is memory or postgres; postgres is needed when
+	// more than one gateway runs.
+	SAML_REPLAY_BACKEND string
+}
+
+// PasswordConfig is the policy new passwords are held to.
+type PasswordConfig struct {
+	PASSWORD_MIN_LENGTH int
+	PASSWORD_MAX_LENGTH int
+	// PASSWORD_MIN_SCORE is the lowest zxcvbn-style strength score, 0 to 4.
+	PASSWORD_MIN_SCORE int
+	// PASSWORD_HISTORY is how many earlier passwords may not be reused.
+	PASSWORD_HISTORY int
+	// PASSWORD_MAX_AGE_DAYS is how long a password is good for, unless the
+	// organization of the user sets its own limit. 0 means forever.
+	PASSWORD_MAX_AGE_DAYS int
+	// PASSWORD_BREACHED_FILE is a local copy of Pwned Passwords, SHA-1
+	// ordered by hash. Breach checks are off while it is empty.
+	PASSWORD_BREACHED_FILE string
+}
+
+// SessionConfig controls browser sessions, where the tokens are kept in
+// HttpOnly cookies instead of being handed to scripts.
+type SessionConfig struct {
+	// SESSION_COOKIES lets clients ask for cookies by logging in with
+	// ?session=cookie.
+	SESSION_COOKIES       bool
+	SESSION_COOKIE_DOMAIN string
+	// SESSION_COOKIE_SAMESITE is lax, strict or none.
+	SESSION_COOKIE_SAMESITE string
+	// SESSION_COOKIE_SECURE should only be turned off for local development
+	// over plain HTTP.
+	SESSION_COOKIE_SECURE bool
+}
+
+// DPoPConfig controls sender-constrained tokens. In optional mode tokens
+// are bound to a key when the token request carries a DPoP proof and plain
+// bearer tokens keep working; required mode refuses them, which also rules
+// out SAML sign-ins since browsers cannot send proofs with the assertion.
+type DPoPConfig struct {
+	// DPOP_MODE is off, optional or required.
+	DPOP_MODE          string
+	DPOP_PROOF_MAX_AGE time.Duration
+	// DPOP_REPLAY_BACKEND is memory or postgres; postgres is needed when
+	// more than one gateway runs.
+	DPOP_REPLAY_BACKEND string
+}
+
+// TokenConfig picks the format of issued tokens. To move from one format
+// to another, keep accepting the old one in TOKEN_ACCEPT_FORMATS until the
+// tokens issued in it have expired.
+type TokenConfig struct {
+	// TOKEN_FORMAT is jwt or paseto.
+	TOKEN_FORMAT         string
+	TOKEN_ACCEPT_FORMATS []string
+	// PASETO_SECRET_KEY is the hex encoded Ed25519 seed of PASETO v4.public
+	// tokens.
+	PASETO_SECRET_KEY string
+	// PASETO_SECRET_KEY_FILE holds PASETO_SECRET_KEY instead.
+	PASETO_SECRET_KEY_FILE string
+	// JWT_ACCESS_SECRET and JWT_REFRESH_SECRET are the HS256 keys of the
+	// two kinds of JWTs; the _FILE settings hold them instead.
+	JWT_ACCESS_SECRET       string
+	JWT_ACCESS_SECRET_FILE  string
+	JWT_REFRESH_SECRET      string
+	JWT_REFRESH_SECRET_FILE string
+	// JWT_ALLOW_DEFAULT_SECRETS accepts the built-in JWT keys. Anyone can
+	// sign tokens with them; only turn it on for local development.
+	JWT_ALLOW_DEFAULT_SECRETS bool
+	// Lifetimes of the tokens issued at login and refresh.
+	ACCESS_TOKEN_TTL          time.Duration
+	PASSWORD_CHANGE_TOKEN_TTL time.Duration
+	REFRESH_TOKEN_TTL         time.Duration
+	// CLAIMS_FILE maps profile fields onto access token claims, per
+	// audience. Tokens carry no such claims while it is empty.
+	CLAIMS_FILE string
+}
+
+// CORSConfig lets browser apps on other origins call the gateway. CORS is
+// off while CORS_ALLOWED_ORIGINS is empty.
+type CORSConfig struct {
+	// CORS_ALLOWED_ORIGINS lists origins such as https://app.example.com,
+	// or * for any.
+	CORS_ALLOWED_ORIGINS []string
+	CORS_ALLOWED_HEADERS []string
+	// CORS_ALLOW_CREDENTIALS lets the browser send cookies, as cookie
+	// sessions need. It cannot be combined with *.
+	CORS_ALLOW_CREDENTIALS bool
+	CORS_MAX_AGE           time.Duration
+}
+
+// TracingConfig controls OpenTelemetry tracing.
+type TracingConfig struct {
+	// TRACING_EXPORTER is none, otlp, stdout or memory; memory keeps the
+	// spans in the process, for tests.
+	TRACING_EXPORTER     string
+	TRACING_SERVICE_NAME string
+	// TRACING_SAMPLE_RATIO is the share of traces started here that are
+	// recorded; traces started by a caller follow its decision.
+	TRACING_SAMPLE_RATIO float64
+	// OTLP_ENDPOINT is the host:port of the OTLP/gRPC collector.
+	OTLP_ENDPOINT string
+	OTLP_INSECURE bool
+}
+
+// AuditConfig controls how long audit events are kept.
+type AuditConfig struct {
+	// AUDIT_RETENTION is how long events stay in the database; 0 keeps
+	// them forever. Older events are written to a file in
+	// AUDIT_EXPORT_DIR and then purged, every AUDIT_PURGE_INTERVAL.
+	AUDIT_RETENTION      time.Duration
+	AUDIT_EXPORT_DIR     string
+	AUDIT_PURGE_INTERVAL time.Duration
+}
+
+type LogConfig struct {
+	// LOG_LEVEL is debug, info, warn or error.
+	LOG_LEVEL string
+	// LOG_FORMAT is text or json.
+	LOG_FORMAT string
+	// LOG_FILE is stdout, stderr or a file, which is rotated once it
+	// reaches LOG_MAX_SIZE_MB. LOG_MAX_BACKUPS and LOG_MAX_AGE_DAYS bound
+	// the rotated files kept; 0 keeps them all.
+	LOG_FILE         string
+	LOG_MAX_SIZE_MB  int
+	LOG_MAX_BACKUPS  int
+	LOG_MAX_AGE_DAYS int
+	LOG_COMPRESS     bool
+}
 
+type SMTPConfig struct {
+	SMTP_HOST     string
+	SMTP_PORT     string
+	SMTP_USER     string
+	SMTP_PASSWORD string
+	SMTP_FROM     string
+}
+
+// build assembles the configuration, reading every setting through
+// coalesce.
+func build(coalesce func(key string, value interface{}) interface{}) *Config {
 	return &Config{
 		Postgres: PostgresConfig{
+			DB_DSN:      cast.ToString(coalesce("DB_DSN", "")),
 			DB_HOST:     cast.ToString(coalesce("DB_HOST", "localhost")),
 			DB_PORT:     cast.ToString(coalesce("DB_PORT", "5432")),
 			DB_USER:     cast.ToString(coalesce("DB_USER", "postgres")),
 			DB_NAME:     cast.ToString(coalesce("DB_NAME", "user_service")),
 			DB_PASSWORD: cast.ToString(coalesce("DB_PASSWORD", "password")),
+			DB_SSLMODE:  cast.ToString(coalesce("DB_SSLMODE", "disable")),
+
+			DB_MAX_OPEN_CONNS:     cast.ToInt(coalesce("DB_MAX_OPEN_CONNS", 25)),
+			DB_MAX_IDLE_CONNS:     cast.ToInt(coalesce("DB_MAX_IDLE_CONNS", 10)),
+			DB_CONN_MAX_LIFETIME:  cast.ToDuration(coalesce("DB_CONN_MAX_LIFETIME", "30m")),
+			DB_CONN_MAX_IDLE_TIME: cast.ToDuration(coalesce("DB_CONN_MAX_IDLE_TIME", "5m")),
+			DB_MIGRATE_ON_START:   cast.ToBool(coalesce("DB_MIGRATE_ON_START", false)),
 		},
 		Server: ServerConfig{
-			USER_PORT: cast.ToString(coalesce("USER_PORT", ":50051")),
+			USER_PORT:         cast.ToString(coalesce("USER_PORT", ":50051")),
+			HTTP_PORT:         cast.ToString(coalesce("HTTP_PORT", ":8085")),
+			USER_SERVICE_ADDR: cast.ToString(coalesce("USER_SERVICE_ADDR", "localhost:50051")),
+
+			SHUTDOWN_DRAIN_DELAY: cast.ToDuration(coalesce("SHUTDOWN_DRAIN_DELAY", "5s")),
+			SHUTDOWN_TIMEOUT:     cast.ToDuration(coalesce("SHUTDOWN_TIMEOUT", "30s")),
+			HEALTH_CHECK_TIMEOUT: cast.ToDuration(coalesce("HEALTH_CHECK_TIMEOUT", "2s")),
+			METRICS_ADDR:         cast.ToString(coalesce("METRICS_ADDR", "127.0.0.1:9090")),
+			TRUSTED_GATEWAYS:     list(coalesce("TRUSTED_GATEWAYS", "127.0.0.1,::1")),
+		},
+		Lockout: LockoutConfig{
+			MAX_FAILED_LOGINS:        cast.ToInt(coalesce("MAX_FAILED_LOGINS", 5)),
+			MAX_FAILED_LOGINS_PER_IP: cast.ToInt(coalesce("MAX_FAILED_LOGINS_PER_IP", 20)),
+			LOCKOUT_BASE_DURATION:    cast.ToDuration(coalesce("LOCKOUT_BASE_DURATION", "1m")),
+			LOCKOUT_MAX_DURATION:     cast.ToDuration(coalesce("LOCKOUT_MAX_DURATION", "24h")),
+			LOCKOUT_FAILURE_WINDOW:   cast.ToDuration(coalesce("LOCKOUT_FAILURE_WINDOW", "15m")),
+			LOCKOUT_DECAY:            cast.ToDuration(coalesce("LOCKOUT_DECAY", "168h")),
+			LOGIN_MIN_DURATION:       cast.ToDuration(coalesce("LOGIN_MIN_DURATION", "400ms")),
+		},
+		Account: AccountConfig{
+			PUBLIC_URL:               cast.ToString(coalesce("PUBLIC_URL", "http://localhost:8085")),
+			EMAIL_CHANGE_TTL:         cast.ToDuration(coalesce("EMAIL_CHANGE_TTL", "24h")),
+			USERNAME_CHANGE_COOLDOWN: cast.ToDuration(coalesce("USERNAME_CHANGE_COOLDOWN", "720h")),
+			USERNAME_RESERVATION:     cast.ToDuration(coalesce("USERNAME_RESERVATION", "2160h")),
+		},
+		OAuth: OAuthConfig{
+			DEVICE_CLIENTS:          list(coalesce("DEVICE_CLIENTS", "tv-app,kiosk")),
+			DEVICE_CODE_TTL:         cast.ToDuration(coalesce("DEVICE_CODE_TTL", "10m")),
+			DEVICE_POLL_INTERVAL:    cast.ToDuration(coalesce("DEVICE_POLL_INTERVAL", "5s")),
+			DEVICE_VERIFICATION_URI: cast.ToString(coalesce("DEVICE_VERIFICATION_URI", "http://localhost:8085/device")),
+			QR_LOGIN_URI:            cast.ToString(coalesce("QR_LOGIN_URI", "http://localhost:8085/qr-login")),
+			QR_LOGIN_TTL:            cast.ToDuration(coalesce("QR_LOGIN_TTL", "2m")),
+
+			TOKEN_EXCHANGE_CLIENTS_FILE: cast.ToString(coalesce("TOKEN_EXCHANGE_CLIENTS_FILE", "")),
+			TOKEN_EXCHANGE_TTL:          cast.ToDuration(coalesce("TOKEN_EXCHANGE_TTL", "5m")),
+			TOKEN_EXCHANGE_MAX_DEPTH:    cast.ToInt(coalesce("TOKEN_EXCHANGE_MAX_DEPTH", 3)),
+		},
+		SAML: SAMLConfig{
+			SAML_PROVIDERS_FILE: cast.ToString(coalesce("SAML_PROVIDERS_FILE", "")),
+			SAML_ENTITY_ID:      cast.ToString(coalesce("SAML_ENTITY_ID", "")),
+			SAML_MAX_CLOCK_SKEW: cast.ToDuration(coalesce("SAML_MAX_CLOCK_SKEW", "1m")),
+			SAML_REPLAY_BACKEND: cast.ToString(coalesce("SAML_REPLAY_BACKEND", "memory")),
+		},
+		Password: PasswordConfig{
+			PASSWORD_MIN_LENGTH:    cast.ToInt(coalesce("PASSWORD_MIN_LENGTH", 10)),
+			PASSWORD_MAX_LENGTH:    cast.ToInt(coalesce("PASSWORD_MAX_LENGTH", 128)),
+			PASSWORD_MIN_SCORE:     cast.ToInt(coalesce("PASSWORD_MIN_SCORE", 3)),
+			PASSWORD_HISTORY:       cast.ToInt(coalesce("PASSWORD_HISTORY", 5)),
+			PASSWORD_MAX_AGE_DAYS:  cast.ToInt(coalesce("PASSWORD_MAX_AGE_DAYS", 0)),
+			PASSWORD_BREACHED_FILE: cast.ToString(coalesce("PASSWORD_BREACHED_FILE", "")),
+		},
+		Session: SessionConfig{
+			SESSION_COOKIES:         cast.ToBool(coalesce("SESSION_COOKIES", false)),
+			SESSION_COOKIE_DOMAIN:   cast.ToString(coalesce("SESSION_COOKIE_DOMAIN", "")),
+			SESSION_COOKIE_SAMESITE: cast.ToString(coalesce("SESSION_COOKIE_SAMESITE", "lax")),
+			SESSION_COOKIE_SECURE:   cast.ToBool(coalesce("SESSION_COOKIE_SECURE", true)),
+		},
+		DPoP: DPoPConfig{
+			DPOP_MODE:           cast.ToString(coalesce("DPOP_MODE", "optional")),
+			DPOP_PROOF_MAX_AGE:  cast.ToDuration(coalesce("DPOP_PROOF_MAX_AGE", "1m")),
+			DPOP_REPLAY_BACKEND: cast.ToString(coalesce("DPOP_REPLAY_BACKEND", "memory")),
+		},
+		Token: TokenConfig{
+			TOKEN_FORMAT:         cast.ToString(coalesce("TOKEN_FORMAT", "jwt")),
+			TOKEN_ACCEPT_FORMATS: list(coalesce("TOKEN_ACCEPT_FORMATS", "jwt")),
+			PASETO_SECRET_KEY:    cast.ToString(coalesce("PASETO_SECRET_KEY", "")),
+			CLAIMS_FILE:          cast.ToString(coalesce("CLAIMS_FILE", "")),
+
+			PASETO_SECRET_KEY_FILE:  cast.ToString(coalesce("PASETO_SECRET_KEY_FILE", "")),
+			JWT_ACCESS_SECRET:       cast.ToString(coalesce("JWT_ACCESS_SECRET", DefaultJWTAccessSecret)),
+			JWT_ACCESS_SECRET_FILE:  cast.ToString(coalesce("JWT_ACCESS_SECRET_FILE", "")),
+			JWT_REFRESH_SECRET:      cast.ToString(coalesce("JWT_REFRESH_SECRET", DefaultJWTRefreshSecret)),
+			JWT_REFRESH_SECRET_FILE: cast.ToString(coalesce("JWT_REFRESH_SECRET_FILE", "")),
+
+			JWT_ALLOW_DEFAULT_SECRETS: cast.ToBool(coalesce("JWT_ALLOW_DEFAULT_SECRETS", false)),
+
+			ACCESS_TOKEN_TTL:          cast.ToDuration(coalesce("ACCESS_TOKEN_TTL", "30m")),
+			PASSWORD_CHANGE_TOKEN_TTL: cast.ToDuration(coalesce("PASSWORD_CHANGE_TOKEN_TTL", "10m")),
+			REFRESH_TOKEN_TTL:         cast.ToDuration(coalesce("REFRESH_TOKEN_TTL", "24h")),
+		},
+		CORS: CORSConfig{
+			CORS_ALLOWED_ORIGINS:   list(coalesce("CORS_ALLOWED_ORIGINS", "")),
+			CORS_ALLOWED_HEADERS:   list(coalesce("CORS_ALLOWED_HEADERS", "Authorization,Content-Type,DPoP,X-CSRF-Token,X-Challenge-Token,X-Challenge-Answer")),
+			CORS_ALLOW_CREDENTIALS: cast.ToBool(coalesce("CORS_ALLOW_CREDENTIALS", false)),
+			CORS_MAX_AGE:           cast.ToDuration(coalesce("CORS_MAX_AGE", "12h")),
+		},
+		Tracing: TracingConfig{
+			TRACING_EXPORTER:     cast.ToString(coalesce("TRACING_EXPORTER", "none")),
+			TRACING_SERVICE_NAME: cast.ToString(coalesce("TRACING_SERVICE_NAME", "auth-service")),
+			TRACING_SAMPLE_RATIO: cast.ToFloat64(coalesce("TRACING_SAMPLE_RATIO", 1.0)),
+			OTLP_ENDPOINT:        cast.ToString(coalesce("OTLP_ENDPOINT", "localhost:4317")),
+			OTLP_INSECURE:        cast.ToBool(coalesce("OTLP_INSECURE", true)),
+		},
+		Audit: AuditConfig{
+			AUDIT_RETENTION:      cast.ToDuration(coalesce("AUDIT_RETENTION", "8760h")),
+			AUDIT_EXPORT_DIR:     cast.ToString(coalesce("AUDIT_EXPORT_DIR", "audit")),
+			AUDIT_PURGE_INTERVAL: cast.ToDuration(coalesce("AUDIT_PURGE_INTERVAL", "24h")),
+		},
+		Log: LogConfig{
+			LOG_LEVEL:  cast.ToString(coalesce("LOG_LEVEL", "info")),
+			LOG_FORMAT: cast.ToString(coalesce("LOG_FORMAT", "json")),
+			LOG_FILE:   cast.ToString(coalesce("LOG_FILE", "stdout")),
+
+			LOG_MAX_SIZE_MB:  cast.ToInt(coalesce("LOG_MAX_SIZE_MB", 100)),
+			LOG_MAX_BACKUPS:  cast.ToInt(coalesce("LOG_MAX_BACKUPS", 7)),
+			LOG_MAX_AGE_DAYS: cast.ToInt(coalesce("LOG_MAX_AGE_DAYS", 28)),
+			LOG_COMPRESS:     cast.ToBool(coalesce("LOG_COMPRESS", true)),
+		},
+		SMTP: SMTPConfig{
+			SMTP_HOST:     cast.ToString(coalesce("SMTP_HOST", "")),
+			SMTP_PORT:     cast.ToString(coalesce("SMTP_PORT", "587")),
+			SMTP_USER:     cast.ToString(coalesce("SMTP_USER", "")),
+			SMTP_PASSWORD: cast.ToString(coalesce("SMTP_PASSWORD", "")),
+			SMTP_FROM:     cast.ToString(coalesce("SMTP_FROM", "no-reply@localhost")),
+		},
+		RateLimit: RateLimitConfig{
+			RATE_LIMIT_BACKEND:  cast.ToString(coalesce("RATE_LIMIT_BACKEND", "memory")),
+			RATE_LIMIT_REGISTER: cast.ToString(coalesce("RATE_LIMIT_REGISTER", "5/1h")),
+			RATE_LIMIT_LOGIN:    cast.ToString(coalesce("RATE_LIMIT_LOGIN", "10/1m")),
+			RATE_LIMIT_PASSWORD: cast.ToString(coalesce("RATE_LIMIT_PASSWORD", "5/15m")),
+			RATE_LIMIT_READ:     cast.ToString(coalesce("RATE_LIMIT_READ", "300/1m")),
+			RATE_LIMIT_WRITE:    cast.ToString(coalesce("RATE_LIMIT_WRITE", "60/1m")),
+			RATE_LIMIT_GRPC:     cast.ToString(coalesce("RATE_LIMIT_GRPC", "1000/1m")),
+			RATE_LIMIT_SCIM:     cast.ToString(coalesce("RATE_LIMIT_SCIM", "600/1m")),
+			RATE_LIMIT_POLL:     cast.ToString(coalesce("RATE_LIMIT_POLL", "60/1m")),
+		},
+		Challenge: ChallengeConfig{
+			CHALLENGE_PROVIDER:            cast.ToString(coalesce("CHALLENGE_PROVIDER", "pow")),
+			CHALLENGE_SECRET:              cast.ToString(coalesce("CHALLENGE_SECRET", "")),
+			CHALLENGE_TTL:                 cast.ToDuration(coalesce("CHALLENGE_TTL", "5m")),
+			CHALLENGE_WINDOW:              cast.ToDuration(coalesce("CHALLENGE_WINDOW", "1h")),
+			CHALLENGE_RISK_BACKEND:        cast.ToString(coalesce("CHALLENGE_RISK_BACKEND", "memory")),
+			CHALLENGE_AFTER_FAILED_LOGINS: cast.ToInt(coalesce("CHALLENGE_AFTER_FAILED_LOGINS", 3)),
+			CHALLENGE_AFTER_REGISTRATIONS: cast.ToInt(coalesce("CHALLENGE_AFTER_REGISTRATIONS", 3)),
+			POW_DIFFICULTY:                cast.ToInt(coalesce("POW_DIFFICULTY", 20)),
+			CAPTCHA_VERIFY_URL:            cast.ToString(coalesce("CAPTCHA_VERIFY_URL", "")),
+			CAPTCHA_SECRET:                cast.ToString(coalesce("CAPTCHA_SECRET", "")),
+			CAPTCHA_SITE_KEY:              cast.ToString(coalesce("CAPTCHA_SITE_KEY", "")),
 		},
 	}
 }
 
-func coalesce(key string, value interface{}) interface{} {
-	val, exist := os.LookupEnv(key)
-	if exist {
-		return val
+// list splits a comma separated value, dropping empty entries.
+func list(value interface{}) []string {
+	var res []string
+	for _, v := range strings.Split(cast.ToString(value), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
 	}
-	return value
+	return res
 }
@@ -0,0 +1,323 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v3"
+)
+
+// Load reads the configuration from, in increasing order of precedence,
+// the defaults, the YAML file named by --config or CONFIG_FILE, the
+// environment (.env included) and the command line. Every setting has a
+// flag named after it, --db-host for DB_HOST, and a key of the same name
+// in the file:
+//
+//	USER_PORT: ":50051"
+//	DB_MAX_OPEN_CONNS: 50
+//	CORS_ALLOWED_ORIGINS: [https://app.traveltales.uz]
+//
+// The configuration is validated before it is returned.
+func Load(args []string) (*Config, error) {
+	cfg, rest, err := Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", rest[0])
+	}
+	return cfg, nil
+}
+
+// Parse is Load for commands that take arguments after the flags, which
+// it returns.
+func Parse(args []string) (*Config, []string, error) {
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("error while loading .env file: %v", err)
+	}
+
+	// A first pass with the defaults alone finds out the settings there are.
+	var keys []string
+	defaults := map[string]interface{}{}
+	build(func(key string, value interface{}) interface{} {
+		keys = append(keys, key)
+		defaults[key] = value
+		return value
+	})
+
+	flags := flag.NewFlagSet("auth", flag.ContinueOnError)
+	file := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file")
+	values := map[string]*string{}
+	for _, key := range keys {
+		values[key] = flags.String(flagName(key), cast.ToString(defaults[key]), key)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	flagged := map[string]string{}
+	flags.Visit(func(f *flag.Flag) {
+		for key, v := range values {
+			if flagName(key) == f.Name {
+				flagged[key] = *v
+			}
+		}
+	})
+
+	fromFile := map[string]string{}
+	if *file != "" {
+		var err error
+		if fromFile, err = readFile(*file, defaults); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	raw := map[string]string{}
+	cfg := build(func(key string, value interface{}) interface{} {
+		v, ok := flagged[key]
+		if !ok {
+			v, ok = os.LookupEnv(key)
+		}
+		if !ok {
+			v, ok = fromFile[key]
+		}
+		if !ok {
+			return value
+		}
+		raw[key] = v
+		return v
+	})
+	if err := checkTypes(cfg, raw); err != nil {
+		return nil, nil, err
+	}
+	if err := cfg.readSecrets(); err != nil {
+		return nil, nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if cfg.Token.defaultSecrets() {
+		log.Printf("JWTs are signed with the built-in keys; set JWT_ACCESS_SECRET and JWT_REFRESH_SECRET")
+	}
+	return cfg, flags.Args(), nil
+}
+
+// flagName is the command line flag of a setting.
+func flagName(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
+
+// readFile reads the YAML configuration file. Lists may be written as
+// sequences.
+func readFile(path string, known map[string]interface{}) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	res := map[string]string{}
+	for key, value := range doc {
+		name := strings.ToUpper(key)
+		if _, ok := known[name]; !ok {
+			return nil, fmt.Errorf("%s: unknown setting %s", path, key)
+		}
+		switch v := value.(type) {
+		case nil:
+			res[name] = ""
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = cast.ToString(item)
+			}
+			res[name] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("%s: %s is not a value", path, key)
+		default:
+			res[name] = cast.ToString(v)
+		}
+	}
+	return res, nil
+}
+
+// checkTypes reports the values given for numbers, booleans and durations
+// that are none, which the conversions in build silently turn into zero.
+func checkTypes(cfg *Config, raw map[string]string) error {
+	var errs []error
+	sections := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			key := section.Type().Field(j).Name
+			value, ok := raw[key]
+			if !ok {
+				continue
+			}
+			var err error
+			switch section.Field(j).Interface().(type) {
+			case time.Duration:
+				_, err = cast.ToDurationE(value)
+			case int:
+				_, err = cast.ToIntE(value)
+			case bool:
+				_, err = cast.ToBoolE(value)
+			case float64:
+				_, err = cast.ToFloat64E(value)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid value %q", key, value))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readSecrets replaces the keys that are given as files with the contents
+// of the files.
+func (c *Config) readSecrets() error {
+	for _, s := range []struct {
+		path  string
+		value *string
+	}{
+		{c.Token.JWT_ACCESS_SECRET_FILE, &c.Token.JWT_ACCESS_SECRET},
+		{c.Token.JWT_REFRESH_SECRET_FILE, &c.Token.JWT_REFRESH_SECRET},
+		{c.Token.PASETO_SECRET_KEY_FILE, &c.Token.PASETO_SECRET_KEY},
+	} {
+		if s.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(s.path)
+		if err != nil {
+			return err
+		}
+		*s.value = strings.TrimSpace(string(data))
+	}
+	return nil
+}
+
+// defaultSecrets tells whether JWTs are issued or accepted with one of the
+// built-in keys.
+func (t TokenConfig) defaultSecrets() bool {
+	jwt := t.TOKEN_FORMAT == "jwt"
+	for _, f := range t.TOKEN_ACCEPT_FORMATS {
+		jwt = jwt || f == "jwt"
+	}
+	return jwt && (t.JWT_ACCESS_SECRET == DefaultJWTAccessSecret || t.JWT_REFRESH_SECRET == DefaultJWTRefreshSecret)
+}
+
+// Validate checks the settings that are not checked where they are used.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	for key, addr := range map[string]string{
+		"USER_PORT":         c.Server.USER_PORT,
+		"HTTP_PORT":         c.Server.HTTP_PORT,
+		"USER_SERVICE_ADDR": c.Server.USER_SERVICE_ADDR,
+	} {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			fail("%s: %v", key, err)
+		}
+	}
+	if c.Server.METRICS_ADDR != "" {
+		if _, _, err := net.SplitHostPort(c.Server.METRICS_ADDR); err != nil {
+			fail("METRICS_ADDR: %v", err)
+		}
+	}
+
+	if c.Server.SHUTDOWN_DRAIN_DELAY < 0 || c.Server.SHUTDOWN_TIMEOUT <= 0 {
+		fail("SHUTDOWN_DRAIN_DELAY cannot be negative and SHUTDOWN_TIMEOUT has to be positive")
+	}
+	if c.Server.HEALTH_CHECK_TIMEOUT <= 0 {
+		fail("HEALTH_CHECK_TIMEOUT has to be positive")
+	}
+
+	if c.Lockout.LOCKOUT_FAILURE_WINDOW <= 0 || c.Lockout.LOCKOUT_DECAY <= 0 {
+		fail("LOCKOUT_FAILURE_WINDOW and LOCKOUT_DECAY have to be positive")
+	}
+
+	p := c.Postgres
+	if p.DB_DSN == "" && (p.DB_HOST == "" || p.DB_NAME == "") {
+		fail("DB_HOST and DB_NAME are required unless DB_DSN is set")
+	}
+	if p.DB_MAX_OPEN_CONNS < 0 || p.DB_MAX_IDLE_CONNS < 0 {
+		fail("DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS cannot be negative")
+	}
+	if p.DB_MAX_OPEN_CONNS > 0 && p.DB_MAX_IDLE_CONNS > p.DB_MAX_OPEN_CONNS {
+		fail("DB_MAX_IDLE_CONNS cannot be over DB_MAX_OPEN_CONNS")
+	}
+
+	t := c.Token
+	if t.ACCESS_TOKEN_TTL <= 0 || t.PASSWORD_CHANGE_TOKEN_TTL <= 0 || t.REFRESH_TOKEN_TTL <= 0 {
+		fail("token lifetimes have to be positive")
+	} else if t.REFRESH_TOKEN_TTL < t.ACCESS_TOKEN_TTL {
+		fail("REFRESH_TOKEN_TTL cannot be shorter than ACCESS_TOKEN_TTL")
+	}
+	if t.JWT_ACCESS_SECRET == "" || t.JWT_REFRESH_SECRET == "" {
+		fail("JWT_ACCESS_SECRET and JWT_REFRESH_SECRET are required")
+	} else if t.JWT_ACCESS_SECRET == t.JWT_REFRESH_SECRET {
+		fail("JWT_ACCESS_SECRET and JWT_REFRESH_SECRET have to differ")
+	} else if t.defaultSecrets() && !t.JWT_ALLOW_DEFAULT_SECRETS {
+		fail("JWT_ACCESS_SECRET and JWT_REFRESH_SECRET have to be set; the built-in keys are only allowed with JWT_ALLOW_DEFAULT_SECRETS")
+	}
+
+	for _, origin := range c.CORS.CORS_ALLOWED_ORIGINS {
+		if origin == "*" {
+			if c.CORS.CORS_ALLOW_CREDENTIALS {
+				fail("CORS_ALLOW_CREDENTIALS cannot be combined with the origin *")
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			fail("CORS_ALLOWED_ORIGINS: %q is not an origin", origin)
+		}
+	}
+
+	switch c.Tracing.TRACING_EXPORTER {
+	case "none", "otlp", "stdout", "memory":
+	default:
+		fail("TRACING_EXPORTER: unknown exporter %q", c.Tracing.TRACING_EXPORTER)
+	}
+	if c.Tracing.TRACING_SAMPLE_RATIO < 0 || c.Tracing.TRACING_SAMPLE_RATIO > 1 {
+		fail("TRACING_SAMPLE_RATIO has to be between 0 and 1")
+	}
+
+	if c.Audit.AUDIT_RETENTION < 0 {
+		fail("AUDIT_RETENTION cannot be negative")
+	} else if c.Audit.AUDIT_RETENTION > 0 && (c.Audit.AUDIT_EXPORT_DIR == "" || c.Audit.AUDIT_PURGE_INTERVAL <= 0) {
+		fail("AUDIT_EXPORT_DIR and a positive AUDIT_PURGE_INTERVAL are required unless AUDIT_RETENTION is 0")
+	}
+
+	switch strings.ToLower(c.Log.LOG_LEVEL) {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("LOG_LEVEL: unknown level %q", c.Log.LOG_LEVEL)
+	}
+	switch c.Log.LOG_FORMAT {
+	case "text", "json":
+	default:
+		fail("LOG_FORMAT: unknown format %q", c.Log.LOG_FORMAT)
+	}
+	if c.Log.LOG_FILE == "" {
+		fail("LOG_FILE is required")
+	}
+	if c.Log.LOG_MAX_SIZE_MB <= 0 || c.Log.LOG_MAX_BACKUPS < 0 || c.Log.LOG_MAX_AGE_DAYS < 0 {
+		fail("LOG_MAX_SIZE_MB has to be positive, LOG_MAX_BACKUPS and LOG_MAX_AGE_DAYS cannot be negative")
+	}
+	return errors.Join(errs...)
+}
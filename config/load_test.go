@@ -0,0 +1,102 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSecrets sets the JWT keys, which Load refuses to default.
+func testSecrets(t *testing.T) {
+	t.Setenv("JWT_ACCESS_SECRET", "access")
+	t.Setenv("JWT_REFRESH_SECRET", "refresh")
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	testSecrets(t)
+	file := filepath.Join(t.TempDir(), "auth.yaml")
+	yaml := "DB_HOST: file-host\nDB_NAME: file-db\nDB_MAX_OPEN_CONNS: 40\nCORS_ALLOWED_ORIGINS: [https://a.example, https://b.example]\n"
+	if err := os.WriteFile(file, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DB_NAME", "env-db")
+	t.Setenv("ACCESS_TOKEN_TTL", "15m")
+
+	cfg, err := Load([]string{"--config", file, "--access-token-ttl", "20m", "--http-port", ":9000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Postgres.DB_HOST != "file-host" || cfg.Postgres.DB_MAX_OPEN_CONNS != 40 {
+		t.Errorf("file values = %q, %d", cfg.Postgres.DB_HOST, cfg.Postgres.DB_MAX_OPEN_CONNS)
+	}
+	if cfg.Postgres.DB_NAME != "env-db" {
+		t.Errorf("DB_NAME = %q, want the environment over the file", cfg.Postgres.DB_NAME)
+	}
+	if cfg.Token.ACCESS_TOKEN_TTL != 20*time.Minute || cfg.Server.HTTP_PORT != ":9000" {
+		t.Errorf("flag values = %v, %q", cfg.Token.ACCESS_TOKEN_TTL, cfg.Server.HTTP_PORT)
+	}
+	if want := []string{"https://a.example", "https://b.example"}; !reflect.DeepEqual(cfg.CORS.CORS_ALLOWED_ORIGINS, want) {
+		t.Errorf("CORS_ALLOWED_ORIGINS = %v", cfg.CORS.CORS_ALLOWED_ORIGINS)
+	}
+	if cfg.Server.USER_PORT != ":50051" {
+		t.Errorf("USER_PORT = %q, want the default", cfg.Server.USER_PORT)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	testSecrets(t)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--db-max-open-conns", "many"}, "DB_MAX_OPEN_CONNS"},
+		{[]string{"--access-token-ttl", "soon"}, "ACCESS_TOKEN_TTL"},
+		{[]string{"--refresh-token-ttl", "1m"}, "REFRESH_TOKEN_TTL"},
+		{[]string{"--http-port", "8085"}, "HTTP_PORT"},
+		{[]string{"--cors-allowed-origins", "*", "--cors-allow-credentials", "true"}, "CORS_ALLOW_CREDENTIALS"},
+		{[]string{"--log-format", "xml"}, "LOG_FORMAT"},
+		{[]string{"--audit-retention", "1h", "--audit-export-dir", ""}, "AUDIT_EXPORT_DIR"},
+		{[]string{"--db-host", "db", "up"}, "unexpected argument"},
+	}
+	for _, tt := range tests {
+		if _, err := Load(tt.args); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Load(%v) = %v, want an error about %s", tt.args, err, tt.want)
+		}
+	}
+
+	file := filepath.Join(t.TempDir(), "auth.yaml")
+	if err := os.WriteFile(file, []byte("DB_HOSTNAME: db\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load([]string{"--config", file}); err == nil {
+		t.Error("an unknown setting in the file was accepted")
+	}
+}
+
+func TestParse(t *testing.T) {
+	testSecrets(t)
+	cfg, rest, err := Parse([]string{"--db-migrate-on-start", "true", "to", "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Postgres.DB_MIGRATE_ON_START || strings.Join(rest, " ") != "to 3" {
+		t.Errorf("Parse = %v, %v", cfg.Postgres.DB_MIGRATE_ON_START, rest)
+	}
+}
+
+func TestLoadDefaultSecrets(t *testing.T) {
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "JWT_ALLOW_DEFAULT_SECRETS") {
+		t.Errorf("Load with the built-in keys = %v, want an error", err)
+	}
+	if _, err := Load([]string{"--jwt-allow-default-secrets", "true"}); err != nil {
+		t.Errorf("Load with the built-in keys allowed = %v", err)
+	}
+	// They do not matter once JWTs are neither issued nor accepted.
+	paseto := []string{"--token-format", "paseto", "--token-accept-formats", "paseto", "--paseto-secret-key", strings.Repeat("ab", 32)}
+	if _, err := Load(paseto); err != nil {
+		t.Errorf("Load for PASETO alone = %v", err)
+	}
+}
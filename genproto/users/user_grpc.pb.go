@@ -34,6 +34,34 @@ type UserClient interface {
 	Activity(ctx context.Context, in *UserId, opts ...grpc.CallOption) (*ActivityResponse, error)
 	Follow(ctx context.Context, in *FollowRequest, opts ...grpc.CallOption) (*FollowResponse, error)
 	Followers(ctx context.Context, in *FollowersRequest, opts ...grpc.CallOption) (*FollowersResponse, error)
+	UnlockAccount(ctx context.Context, in *UserId, opts ...grpc.CallOption) (*BoolResponse, error)
+	RequestEmailChange(ctx context.Context, in *EmailChangeRequest, opts ...grpc.CallOption) (*BoolResponse, error)
+	ConfirmEmailChange(ctx context.Context, in *EmailChangeToken, opts ...grpc.CallOption) (*BoolResponse, error)
+	CancelEmailChange(ctx context.Context, in *EmailChangeToken, opts ...grpc.CallOption) (*BoolResponse, error)
+	ChangeUsername(ctx context.Context, in *ChangeUsernameRequest, opts ...grpc.CallOption) (*ChangeUsernameResponse, error)
+	GetUserByUsername(ctx context.Context, in *UsernameLookupRequest, opts ...grpc.CallOption) (*UsernameLookupResponse, error)
+	CreateDeviceAuthorization(ctx context.Context, in *DeviceAuthorizationRequest, opts ...grpc.CallOption) (*DeviceAuthorizationResponse, error)
+	VerifyDeviceCode(ctx context.Context, in *DeviceVerificationRequest, opts ...grpc.CallOption) (*BoolResponse, error)
+	PollDeviceToken(ctx context.Context, in *DeviceTokenRequest, opts ...grpc.CallOption) (*UserInfo, error)
+	DescribeDeviceCode(ctx context.Context, in *DeviceVerificationRequest, opts ...grpc.CallOption) (*DeviceAuthorizationInfo, error)
+	SSOLogin(ctx context.Context, in *SSOLoginRequest, opts ...grpc.CallOption) (*UserInfo, error)
+	CreateScimToken(ctx context.Context, in *ScimTokenRequest, opts ...grpc.CallOption) (*ScimTokenResponse, error)
+	RevokeScimToken(ctx context.Context, in *ScimResourceId, opts ...grpc.CallOption) (*BoolResponse, error)
+	AuthenticateScimToken(ctx context.Context, in *ScimToken, opts ...grpc.CallOption) (*ScimPartner, error)
+	ScimListUsers(ctx context.Context, in *ScimListRequest, opts ...grpc.CallOption) (*ScimUserList, error)
+	ScimGetUser(ctx context.Context, in *ScimResourceId, opts ...grpc.CallOption) (*ScimUser, error)
+	ScimCreateUser(ctx context.Context, in *ScimUserRequest, opts ...grpc.CallOption) (*ScimUser, error)
+	ScimReplaceUser(ctx context.Context, in *ScimUserRequest, opts ...grpc.CallOption) (*ScimUser, error)
+	ScimDeleteUser(ctx context.Context, in *ScimResourceId, opts ...grpc.CallOption) (*BoolResponse, error)
+	ScimListGroups(ctx context.Context, in *ScimListRequest, opts ...grpc.CallOption) (*ScimGroupList, error)
+	ScimGetGroup(ctx context.Context, in *ScimResourceId, opts ...grpc.CallOption) (*ScimGroup, error)
+	ScimCreateGroup(ctx context.Context, in *ScimGroupRequest, opts ...grpc.CallOption) (*ScimGroup, error)
+	ScimReplaceGroup(ctx context.Context, in *ScimGroupRequest, opts ...grpc.CallOption) (*ScimGroup, error)
+	ScimDeleteGroup(ctx context.Context, in *ScimResourceId, opts ...grpc.CallOption) (*BoolResponse, error)
+	ForcePasswordChange(ctx context.Context, in *UserId, opts ...grpc.CallOption) (*BoolResponse, error)
+	SetPasswordExpiry(ctx context.Context, in *PasswordExpiryRequest, opts ...grpc.CallOption) (*BoolResponse, error)
+	GetTokenProfile(ctx context.Context, in *UserId, opts ...grpc.CallOption) (*TokenProfile, error)
+	ListAuditEvents(ctx context.Context, in *AuditEventFilter, opts ...grpc.CallOption) (*AuditEventList, error)
 }
 
 type userClient struct {
@@ -152,6 +180,258 @@ func (c *userClient) Followers(ctx context.Context, in *FollowersRequest, opts .
 	return out, nil
 }
 
+func (c *userClient) UnlockAccount(ctx context.Context, in *UserId, opts ...grpc.CallOption) (*BoolResponse, error) {
+	out := new(BoolResponse)
+	err := c.cc.Invoke(ctx, "/user.User/UnlockAccount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) RequestEmailChange(ctx context.Context, in *EmailChangeRequest, opts ...grpc.CallOption) (*BoolResponse, error) {
+	out := new(BoolResponse)
+	err := c.cc.Invoke(ctx, "/user.User/RequestEmailChange", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) ConfirmEmailChange(ctx context.Context, in *EmailChangeToken, opts ...grpc.CallOption) (*BoolResponse, error) {
+	out := new(BoolResponse)
+	err := c.cc.Invoke(ctx, "/user.User/ConfirmEmailChange", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) CancelEmailChange(ctx context.Context, in *EmailChangeToken, opts ...grpc.CallOption) (*BoolResponse, error) {
+	out := new(BoolResponse)
+	err := c.cc.Invoke(ctx, "/user.User/CancelEmailChange", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) ChangeUsername(ctx context.Context, in *ChangeUsernameRequest, opts ...grpc.CallOption) (*ChangeUsernameResponse, error) {
+	out := new(ChangeUsernameResponse)
+	err := c.cc.Invoke(ctx, "/user.User/ChangeUsername", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) GetUserByUsername(ctx context.Context, in *UsernameLookupRequest, opts ...grpc.CallOption) (*UsernameLookupResponse, error) {
+	out := new(UsernameLookupResponse)
+	err := c.cc.Invoke(ctx, "/user.User/GetUserByUsername", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) CreateDeviceAuthorization(ctx context.Context, in *DeviceAuthorizationRequest, opts ...grpc.CallOption) (*DeviceAuthorizationResponse, error) {
+	out := new(DeviceAuthorizationResponse)
+	err := c.cc.Invoke(ctx, "/user.User/CreateDeviceAuthorization", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) VerifyDeviceCode(ctx context.Context, in *DeviceVerificationRequest, opts ...grpc.CallOption) (*BoolResponse, error) {
+	out := new(BoolResponse)
+	err := c.cc.Invoke(ctx, "/user.User/VerifyDeviceCode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) PollDeviceToken(ctx context.Context, in *DeviceTokenRequest, opts ...grpc.CallOption) (*UserInfo, error) {
+	out := new(UserInfo)
+	err := c.cc.Invoke(ctx, "/user.User/PollDeviceToken", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) DescribeDeviceCode(ctx context.Context, in *DeviceVerificationRequest, opts ...grpc.CallOption) (*DeviceAuthorizationInfo, error) {
+	out := new(DeviceAuthorizationInfo)
+	err := c.cc.Invoke(ctx, "/user.User/DescribeDeviceCode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) SSOLogin(ctx context.Context, in *SSOLoginRequest, opts ...grpc.CallOption) (*UserInfo, error) {
+	out := new(UserInfo)
+	err := c.cc.Invoke(ctx, "/user.User/SSOLogin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) CreateScimToken(ctx context.Context, in *ScimTokenRequest, opts ...grpc.CallOption) (*ScimTokenResponse, error) {
+	out := new(ScimTokenResponse)
+	err := c.cc.Invoke(ctx, "/user.User/CreateScimToken", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) RevokeScimToken(ctx context.Context, in *ScimResourceId, opts ...grpc.CallOption) (*BoolResponse, error) {
+	out := new(BoolResponse)
+	err := c.cc.Invoke(ctx, "/user.User/RevokeScimToken", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) AuthenticateScimToken(ctx context.Context, in *ScimToken, opts ...grpc.CallOption) (*ScimPartner, error) {
+	out := new(ScimPartner)
+	err := c.cc.Invoke(ctx, "/user.User/AuthenticateScimToken", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) ScimListUsers(ctx context.Context, in *ScimListRequest, opts ...grpc.CallOption) (*ScimUserList, error) {
+	out := new(ScimUserList)
+	err := c.cc.Invoke(ctx, "/user.User/ScimListUsers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) ScimGetUser(ctx context.Context, in *ScimResourceId, opts ...grpc.CallOption) (*ScimUser, error) {
+	out := new(ScimUser)
+	err := c.cc.Invoke(ctx, "/user.User/ScimGetUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) ScimCreateUser(ctx context.Context, in *ScimUserRequest, opts ...grpc.CallOption) (*ScimUser, error) {
+	out := new(ScimUser)
+	err := c.cc.Invoke(ctx, "/user.User/ScimCreateUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) ScimReplaceUser(ctx context.Context, in *ScimUserRequest, opts ...grpc.CallOption) (*ScimUser, error) {
+	out := new(ScimUser)
+	err := c.cc.Invoke(ctx, "/user.User/ScimReplaceUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) ScimDeleteUser(ctx context.Context, in *ScimResourceId, opts ...grpc.CallOption) (*BoolResponse, error) {
+	out := new(BoolResponse)
+	err := c.cc.Invoke(ctx, "/user.User/ScimDeleteUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) ScimListGroups(ctx context.Context, in *ScimListRequest, opts ...grpc.CallOption) (*ScimGroupList, error) {
+	out := new(ScimGroupList)
+	err := c.cc.Invoke(ctx, "/user.User/ScimListGroups", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) ScimGetGroup(ctx context.Context, in *ScimResourceId, opts ...grpc.CallOption) (*ScimGroup, error) {
+	out := new(ScimGroup)
+	err := c.cc.Invoke(ctx, "/user.User/ScimGetGroup", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) ScimCreateGroup(ctx context.Context, in *ScimGroupRequest, opts ...grpc.CallOption) (*ScimGroup, error) {
+	out := new(ScimGroup)
+	err := c.cc.Invoke(ctx, "/user.User/ScimCreateGroup", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) ScimReplaceGroup(ctx context.Context, in *ScimGroupRequest, opts ...grpc.CallOption) (*ScimGroup, error) {
+	out := new(ScimGroup)
+	err := c.cc.Invoke(ctx, "/user.User/ScimReplaceGroup", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) ScimDeleteGroup(ctx context.Context, in *ScimResourceId, opts ...grpc.CallOption) (*BoolResponse, error) {
+	out := new(BoolResponse)
+	err := c.cc.Invoke(ctx, "/user.User/ScimDeleteGroup", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) ForcePasswordChange(ctx context.Context, in *UserId, opts ...grpc.CallOption) (*BoolResponse, error) {
+	out := new(BoolResponse)
+	err := c.cc.Invoke(ctx, "/user.User/ForcePasswordChange", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) SetPasswordExpiry(ctx context.Context, in *PasswordExpiryRequest, opts ...grpc.CallOption) (*BoolResponse, error) {
+	out := new(BoolResponse)
+	err := c.cc.Invoke(ctx, "/user.User/SetPasswordExpiry", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) GetTokenProfile(ctx context.Context, in *UserId, opts ...grpc.CallOption) (*TokenProfile, error) {
+	out := new(TokenProfile)
+	err := c.cc.Invoke(ctx, "/user.User/GetTokenProfile", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userClient) ListAuditEvents(ctx context.Context, in *AuditEventFilter, opts ...grpc.CallOption) (*AuditEventList, error) {
+	out := new(AuditEventList)
+	err := c.cc.Invoke(ctx, "/user.User/ListAuditEvents", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // UserServer is the server API for User service.
 // All implementations must embed UnimplementedUserServer
 // for forward compatibility
@@ -168,6 +448,34 @@ type UserServer interface {
 	Activity(context.Context, *UserId) (*ActivityResponse, error)
 	Follow(context.Context, *FollowRequest) (*FollowResponse, error)
 	Followers(context.Context, *FollowersRequest) (*FollowersResponse, error)
+	UnlockAccount(context.Context, *UserId) (*BoolResponse, error)
+	RequestEmailChange(context.Context, *EmailChangeRequest) (*BoolResponse, error)
+	ConfirmEmailChange(context.Context, *EmailChangeToken) (*BoolResponse, error)
+	CancelEmailChange(context.Context, *EmailChangeToken) (*BoolResponse, error)
+	ChangeUsername(context.Context, *ChangeUsernameRequest) (*ChangeUsernameResponse, error)
+	GetUserByUsername(context.Context, *UsernameLookupRequest) (*UsernameLookupResponse, error)
+	CreateDeviceAuthorization(context.Context, *DeviceAuthorizationRequest) (*DeviceAuthorizationResponse, error)
+	VerifyDeviceCode(context.Context, *DeviceVerificationRequest) (*BoolResponse, error)
+	PollDeviceToken(context.Context, *DeviceTokenRequest) (*UserInfo, error)
+	DescribeDeviceCode(context.Context, *DeviceVerificationRequest) (*DeviceAuthorizationInfo, error)
+	SSOLogin(context.Context, *SSOLoginRequest) (*UserInfo, error)
+	CreateScimToken(context.Context, *ScimTokenRequest) (*ScimTokenResponse, error)
+	RevokeScimToken(context.Context, *ScimResourceId) (*BoolResponse, error)
+	AuthenticateScimToken(context.Context, *ScimToken) (*ScimPartner, error)
+	ScimListUsers(context.Context, *ScimListRequest) (*ScimUserList, error)
+	ScimGetUser(context.Context, *ScimResourceId) (*ScimUser, error)
+	ScimCreateUser(context.Context, *ScimUserRequest) (*ScimUser, error)
+	ScimReplaceUser(context.Context, *ScimUserRequest) (*ScimUser, error)
+	ScimDeleteUser(context.Context, *ScimResourceId) (*BoolResponse, error)
+	ScimListGroups(context.Context, *ScimListRequest) (*ScimGroupList, error)
+	ScimGetGroup(context.Context, *ScimResourceId) (*ScimGroup, error)
+	ScimCreateGroup(context.Context, *ScimGroupRequest) (*ScimGroup, error)
+	ScimReplaceGroup(context.Context, *ScimGroupRequest) (*ScimGroup, error)
+	ScimDeleteGroup(context.Context, *ScimResourceId) (*BoolResponse, error)
+	ForcePasswordChange(context.Context, *UserId) (*BoolResponse, error)
+	SetPasswordExpiry(context.Context, *PasswordExpiryRequest) (*BoolResponse, error)
+	GetTokenProfile(context.Context, *UserId) (*TokenProfile, error)
+	ListAuditEvents(context.Context, *AuditEventFilter) (*AuditEventList, error)
 	mustEmbedUnimplementedUserServer()
 }
 
@@ -211,6 +519,90 @@ func (UnimplementedUserServer) Follow(context.Context, *FollowRequest) (*FollowR
 func (UnimplementedUserServer) Followers(context.Context, *FollowersRequest) (*FollowersResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Followers not implemented")
 }
+func (UnimplementedUserServer) UnlockAccount(context.Context, *UserId) (*BoolResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnlockAccount not implemented")
+}
+func (UnimplementedUserServer) RequestEmailChange(context.Context, *EmailChangeRequest) (*BoolResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RequestEmailChange not implemented")
+}
+func (UnimplementedUserServer) ConfirmEmailChange(context.Context, *EmailChangeToken) (*BoolResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfirmEmailChange not implemented")
+}
+func (UnimplementedUserServer) CancelEmailChange(context.Context, *EmailChangeToken) (*BoolResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelEmailChange not implemented")
+}
+func (UnimplementedUserServer) ChangeUsername(context.Context, *ChangeUsernameRequest) (*ChangeUsernameResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangeUsername not implemented")
+}
+func (UnimplementedUserServer) GetUserByUsername(context.Context, *UsernameLookupRequest) (*UsernameLookupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserByUsername not implemented")
+}
+func (UnimplementedUserServer) CreateDeviceAuthorization(context.Context, *DeviceAuthorizationRequest) (*DeviceAuthorizationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateDeviceAuthorization not implemented")
+}
+func (UnimplementedUserServer) VerifyDeviceCode(context.Context, *DeviceVerificationRequest) (*BoolResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VerifyDeviceCode not implemented")
+}
+func (UnimplementedUserServer) PollDeviceToken(context.Context, *DeviceTokenRequest) (*UserInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PollDeviceToken not implemented")
+}
+func (UnimplementedUserServer) DescribeDeviceCode(context.Context, *DeviceVerificationRequest) (*DeviceAuthorizationInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DescribeDeviceCode not implemented")
+}
+func (UnimplementedUserServer) SSOLogin(context.Context, *SSOLoginRequest) (*UserInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SSOLogin not implemented")
+}
+func (UnimplementedUserServer) CreateScimToken(context.Context, *ScimTokenRequest) (*ScimTokenResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateScimToken not implemented")
+}
+func (UnimplementedUserServer) RevokeScimToken(context.Context, *ScimResourceId) (*BoolResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeScimToken not implemented")
+}
+func (UnimplementedUserServer) AuthenticateScimToken(context.Context, *ScimToken) (*ScimPartner, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AuthenticateScimToken not implemented")
+}
+func (UnimplementedUserServer) ScimListUsers(context.Context, *ScimListRequest) (*ScimUserList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScimListUsers not implemented")
+}
+func (UnimplementedUserServer) ScimGetUser(context.Context, *ScimResourceId) (*ScimUser, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScimGetUser not implemented")
+}
+func (UnimplementedUserServer) ScimCreateUser(context.Context, *ScimUserRequest) (*ScimUser, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScimCreateUser not implemented")
+}
+func (UnimplementedUserServer) ScimReplaceUser(context.Context, *ScimUserRequest) (*ScimUser, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScimReplaceUser not implemented")
+}
+func (UnimplementedUserServer) ScimDeleteUser(context.Context, *ScimResourceId) (*BoolResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScimDeleteUser not implemented")
+}
+func (UnimplementedUserServer) ScimListGroups(context.Context, *ScimListRequest) (*ScimGroupList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScimListGroups not implemented")
+}
+func (UnimplementedUserServer) ScimGetGroup(context.Context, *ScimResourceId) (*ScimGroup, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScimGetGroup not implemented")
+}
+func (UnimplementedUserServer) ScimCreateGroup(context.Context, *ScimGroupRequest) (*ScimGroup, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScimCreateGroup not implemented")
+}
+func (UnimplementedUserServer) ScimReplaceGroup(context.Context, *ScimGroupRequest) (*ScimGroup, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScimReplaceGroup not implemented")
+}
+func (UnimplementedUserServer) ScimDeleteGroup(context.Context, *ScimResourceId) (*BoolResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScimDeleteGroup not implemented")
+}
+func (UnimplementedUserServer) ForcePasswordChange(context.Context, *UserId) (*BoolResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ForcePasswordChange not implemented")
+}
+func (UnimplementedUserServer) SetPasswordExpiry(context.Context, *PasswordExpiryRequest) (*BoolResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetPasswordExpiry not implemented")
+}
+func (UnimplementedUserServer) GetTokenProfile(context.Context, *UserId) (*TokenProfile, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTokenProfile not implemented")
+}
+func (UnimplementedUserServer) ListAuditEvents(context.Context, *AuditEventFilter) (*AuditEventList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAuditEvents not implemented")
+}
 func (UnimplementedUserServer) mustEmbedUnimplementedUserServer() {}
 
 // UnsafeUserServer may be embedded to opt out of forward compatibility for this service.
@@ -440,54 +832,558 @@ func _User_Followers_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
-// User_ServiceDesc is the grpc.ServiceDesc for User service.
-// It's only intended for direct use with grpc.RegisterService,
-// and not to be introspected or modified (even as a copy)
-var User_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "user.User",
-	HandlerType: (*UserServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "Register",
-			Handler:    _User_Register_Handler,
-		},
-		{
-			MethodName: "Login",
-			Handler:    _User_Login_Handler,
-		},
-		{
-			MethodName: "GetProfile",
-			Handler:    _User_GetProfile_Handler,
-		},
-		{
-			MethodName: "UpdateProfile",
-			Handler:    _User_UpdateProfile_Handler,
-		},
-		{
-			MethodName: "GetUsers",
-			Handler:    _User_GetUsers_Handler,
-		},
-		{
-			MethodName: "DeleteUser",
-			Handler:    _User_DeleteUser_Handler,
-		},
-		{
-			MethodName: "EmailRecovery",
-			Handler:    _User_EmailRecovery_Handler,
-		},
-		{
-			MethodName: "CheckRefreshToken",
-			Handler:    _User_CheckRefreshToken_Handler,
-		},
-		{
-			MethodName: "Logout",
-			Handler:    _User_Logout_Handler,
-		},
-		{
-			MethodName: "Activity",
-			Handler:    _User_Activity_Handler,
-		},
-		{
+func _User_UnlockAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).UnlockAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/UnlockAccount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).UnlockAccount(ctx, req.(*UserId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_RequestEmailChange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmailChangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).RequestEmailChange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/RequestEmailChange",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).RequestEmailChange(ctx, req.(*EmailChangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_ConfirmEmailChange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmailChangeToken)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ConfirmEmailChange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/ConfirmEmailChange",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ConfirmEmailChange(ctx, req.(*EmailChangeToken))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_CancelEmailChange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmailChangeToken)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).CancelEmailChange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/CancelEmailChange",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).CancelEmailChange(ctx, req.(*EmailChangeToken))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_ChangeUsername_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeUsernameRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ChangeUsername(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/ChangeUsername",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ChangeUsername(ctx, req.(*ChangeUsernameRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_GetUserByUsername_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UsernameLookupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).GetUserByUsername(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/GetUserByUsername",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).GetUserByUsername(ctx, req.(*UsernameLookupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_CreateDeviceAuthorization_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeviceAuthorizationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).CreateDeviceAuthorization(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/CreateDeviceAuthorization",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).CreateDeviceAuthorization(ctx, req.(*DeviceAuthorizationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_VerifyDeviceCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeviceVerificationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).VerifyDeviceCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/VerifyDeviceCode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).VerifyDeviceCode(ctx, req.(*DeviceVerificationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_PollDeviceToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeviceTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).PollDeviceToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/PollDeviceToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).PollDeviceToken(ctx, req.(*DeviceTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_DescribeDeviceCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeviceVerificationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).DescribeDeviceCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/DescribeDeviceCode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).DescribeDeviceCode(ctx, req.(*DeviceVerificationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_SSOLogin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SSOLoginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).SSOLogin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/SSOLogin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).SSOLogin(ctx, req.(*SSOLoginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_CreateScimToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScimTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).CreateScimToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/CreateScimToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).CreateScimToken(ctx, req.(*ScimTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_RevokeScimToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScimResourceId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).RevokeScimToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/RevokeScimToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).RevokeScimToken(ctx, req.(*ScimResourceId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_AuthenticateScimToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScimToken)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).AuthenticateScimToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/AuthenticateScimToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).AuthenticateScimToken(ctx, req.(*ScimToken))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_ScimListUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScimListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ScimListUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/ScimListUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ScimListUsers(ctx, req.(*ScimListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_ScimGetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScimResourceId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ScimGetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/ScimGetUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ScimGetUser(ctx, req.(*ScimResourceId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_ScimCreateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScimUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ScimCreateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/ScimCreateUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ScimCreateUser(ctx, req.(*ScimUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_ScimReplaceUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScimUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ScimReplaceUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/ScimReplaceUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ScimReplaceUser(ctx, req.(*ScimUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_ScimDeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScimResourceId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ScimDeleteUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/ScimDeleteUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ScimDeleteUser(ctx, req.(*ScimResourceId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_ScimListGroups_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScimListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ScimListGroups(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/ScimListGroups",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ScimListGroups(ctx, req.(*ScimListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_ScimGetGroup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScimResourceId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ScimGetGroup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/ScimGetGroup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ScimGetGroup(ctx, req.(*ScimResourceId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_ScimCreateGroup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScimGroupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ScimCreateGroup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/ScimCreateGroup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ScimCreateGroup(ctx, req.(*ScimGroupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_ScimReplaceGroup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScimGroupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ScimReplaceGroup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/ScimReplaceGroup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ScimReplaceGroup(ctx, req.(*ScimGroupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_ScimDeleteGroup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScimResourceId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ScimDeleteGroup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/ScimDeleteGroup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ScimDeleteGroup(ctx, req.(*ScimResourceId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_ForcePasswordChange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ForcePasswordChange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/ForcePasswordChange",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ForcePasswordChange(ctx, req.(*UserId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_SetPasswordExpiry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PasswordExpiryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).SetPasswordExpiry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/SetPasswordExpiry",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).SetPasswordExpiry(ctx, req.(*PasswordExpiryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_GetTokenProfile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).GetTokenProfile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/GetTokenProfile",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).GetTokenProfile(ctx, req.(*UserId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _User_ListAuditEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuditEventFilter)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServer).ListAuditEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.User/ListAuditEvents",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServer).ListAuditEvents(ctx, req.(*AuditEventFilter))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// User_ServiceDesc is the grpc.ServiceDesc for User service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var User_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "user.User",
+	HandlerType: (*UserServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _User_Register_Handler,
+		},
+		{
+			MethodName: "Login",
+			Handler:    _User_Login_Handler,
+		},
+		{
+			MethodName: "GetProfile",
+			Handler:    _User_GetProfile_Handler,
+		},
+		{
+			MethodName: "UpdateProfile",
+			Handler:    _User_UpdateProfile_Handler,
+		},
+		{
+			MethodName: "GetUsers",
+			Handler:    _User_GetUsers_Handler,
+		},
+		{
+			MethodName: "DeleteUser",
+			Handler:    _User_DeleteUser_Handler,
+		},
+		{
+			MethodName: "EmailRecovery",
+			Handler:    _User_EmailRecovery_Handler,
+		},
+		{
+			MethodName: "CheckRefreshToken",
+			Handler:    _User_CheckRefreshToken_Handler,
+		},
+		{
+			MethodName: "Logout",
+			Handler:    _User_Logout_Handler,
+		},
+		{
+			MethodName: "Activity",
+			Handler:    _User_Activity_Handler,
+		},
+		{
 			MethodName: "Follow",
 			Handler:    _User_Follow_Handler,
 		},
@@ -495,6 +1391,118 @@ var User_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Followers",
 			Handler:    _User_Followers_Handler,
 		},
+		{
+			MethodName: "UnlockAccount",
+			Handler:    _User_UnlockAccount_Handler,
+		},
+		{
+			MethodName: "RequestEmailChange",
+			Handler:    _User_RequestEmailChange_Handler,
+		},
+		{
+			MethodName: "ConfirmEmailChange",
+			Handler:    _User_ConfirmEmailChange_Handler,
+		},
+		{
+			MethodName: "CancelEmailChange",
+			Handler:    _User_CancelEmailChange_Handler,
+		},
+		{
+			MethodName: "ChangeUsername",
+			Handler:    _User_ChangeUsername_Handler,
+		},
+		{
+			MethodName: "GetUserByUsername",
+			Handler:    _User_GetUserByUsername_Handler,
+		},
+		{
+			MethodName: "CreateDeviceAuthorization",
+			Handler:    _User_CreateDeviceAuthorization_Handler,
+		},
+		{
+			MethodName: "VerifyDeviceCode",
+			Handler:    _User_VerifyDeviceCode_Handler,
+		},
+		{
+			MethodName: "PollDeviceToken",
+			Handler:    _User_PollDeviceToken_Handler,
+		},
+		{
+			MethodName: "DescribeDeviceCode",
+			Handler:    _User_DescribeDeviceCode_Handler,
+		},
+		{
+			MethodName: "SSOLogin",
+			Handler:    _User_SSOLogin_Handler,
+		},
+		{
+			MethodName: "CreateScimToken",
+			Handler:    _User_CreateScimToken_Handler,
+		},
+		{
+			MethodName: "RevokeScimToken",
+			Handler:    _User_RevokeScimToken_Handler,
+		},
+		{
+			MethodName: "AuthenticateScimToken",
+			Handler:    _User_AuthenticateScimToken_Handler,
+		},
+		{
+			MethodName: "ScimListUsers",
+			Handler:    _User_ScimListUsers_Handler,
+		},
+		{
+			MethodName: "ScimGetUser",
+			Handler:    _User_ScimGetUser_Handler,
+		},
+		{
+			MethodName: "ScimCreateUser",
+			Handler:    _User_ScimCreateUser_Handler,
+		},
+		{
+			MethodName: "ScimReplaceUser",
+			Handler:    _User_ScimReplaceUser_Handler,
+		},
+		{
+			MethodName: "ScimDeleteUser",
+			Handler:    _User_ScimDeleteUser_Handler,
+		},
+		{
+			MethodName: "ScimListGroups",
+			Handler:    _User_ScimListGroups_Handler,
+		},
+		{
+			MethodName: "ScimGetGroup",
+			Handler:    _User_ScimGetGroup_Handler,
+		},
+		{
+			MethodName: "ScimCreateGroup",
+			Handler:    _User_ScimCreateGroup_Handler,
+		},
+		{
+			MethodName: "ScimReplaceGroup",
+			Handler:    _User_ScimReplaceGroup_Handler,
+		},
+		{
+			MethodName: "ScimDeleteGroup",
+			Handler:    _User_ScimDeleteGroup_Handler,
+		},
+		{
+			MethodName: "ForcePasswordChange",
+			Handler:    _User_ForcePasswordChange_Handler,
+		},
+		{
+			MethodName: "SetPasswordExpiry",
+			Handler:    _User_SetPasswordExpiry_Handler,
+		},
+		{
+			MethodName: "GetTokenProfile",
+			Handler:    _User_GetTokenProfile_Handler,
+		},
+		{
+			MethodName: "ListAuditEvents",
+			Handler:    _User_ListAuditEvents_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "user.proto",
@@ -0,0 +1,28 @@
+-- Usernames and emails are looked up case-insensitively, so two accounts that
+-- only differ by letter case can no longer be told apart. Refuse to migrate
+-- until such accounts have been merged or renamed by hand.
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(format('%s "%s" is shared by users %s', kind, value, ids), E'\n')
+    INTO duplicates
+    FROM (
+        SELECT 'username' AS kind, lower(username) AS value, string_agg(id::TEXT, ', ') AS ids
+        FROM users
+        GROUP BY lower(username)
+        HAVING count(*) > 1
+        UNION ALL
+        SELECT 'email' AS kind, lower(email) AS value, string_agg(id::TEXT, ', ') AS ids
+        FROM users
+        GROUP BY lower(email)
+        HAVING count(*) > 1
+    ) d;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'users differing only in case must be resolved first:%', E'\n' || duplicates;
+    END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower_key ON users (lower(username));
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_key ON users (lower(email));
@@ -0,0 +1,25 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID REFERENCES users(id),
+    login VARCHAR(100) NOT NULL,
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL,
+    attempted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_user_id_idx ON login_attempts (user_id, attempted_at);
+CREATE INDEX IF NOT EXISTS login_attempts_ip_idx ON login_attempts (ip, attempted_at);
+
+-- One row per locked subject: scope is either 'user' (key = user id) or
+-- 'ip' (key = client address).
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    scope VARCHAR(10) NOT NULL,
+    key VARCHAR(64) NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    lockouts INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (scope, key)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS email_changes;
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_revoked_at;
@@ -0,0 +1,17 @@
+-- Refresh tokens issued at or before this moment are no longer accepted.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_revoked_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS email_changes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    old_email VARCHAR(100) NOT NULL,
+    new_email VARCHAR(100) NOT NULL,
+    confirm_token_hash VARCHAR(64) UNIQUE NOT NULL,
+    cancel_token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    confirmed_at TIMESTAMP WITH TIME ZONE,
+    cancelled_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS email_changes_user_id_idx ON email_changes (user_id);
@@ -0,0 +1,13 @@
+-- Every rename leaves the previous username here. Until reserved_until the
+-- old name cannot be taken by anybody else and lookups by it resolve to the
+-- account that gave it up.
+CREATE TABLE IF NOT EXISTS username_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id),
+    username VARCHAR(50) NOT NULL,
+    changed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    reserved_until TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS username_history_username_idx ON username_history (lower(username), reserved_until);
+CREATE INDEX IF NOT EXISTS username_history_user_id_idx ON username_history (user_id, changed_at);
@@ -0,0 +1,13 @@
+-- Pending OAuth 2.0 device authorization grants (RFC 8628).
+CREATE TABLE IF NOT EXISTS device_authorizations (
+    device_code_hash VARCHAR(64) PRIMARY KEY,
+    user_code VARCHAR(8) UNIQUE NOT NULL,
+    client_id VARCHAR(100) NOT NULL,
+    scope TEXT NOT NULL DEFAULT '',
+    status VARCHAR(10) NOT NULL DEFAULT 'pending',
+    user_id UUID REFERENCES users(id),
+    poll_interval INTEGER NOT NULL,
+    last_polled_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
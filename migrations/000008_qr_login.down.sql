@@ -0,0 +1,2 @@
+ALTER TABLE device_authorizations DROP COLUMN IF EXISTS requester_agent;
+ALTER TABLE device_authorizations DROP COLUMN IF EXISTS requester_ip;
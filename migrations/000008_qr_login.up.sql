@@ -0,0 +1,4 @@
+-- Shown to the user approving a QR code or device login, so they can tell
+-- where the request came from.
+ALTER TABLE device_authorizations ADD COLUMN IF NOT EXISTS requester_ip VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE device_authorizations ADD COLUMN IF NOT EXISTS requester_agent TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS sso_identities;
+ALTER TABLE users DROP COLUMN IF EXISTS organization_id;
+DROP TABLE IF EXISTS organizations;
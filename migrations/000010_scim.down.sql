@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS scim_group_members;
+DROP TABLE IF EXISTS scim_groups;
+DROP TABLE IF EXISTS scim_users;
+DROP TABLE IF EXISTS scim_tokens;
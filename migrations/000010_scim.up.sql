@@ -0,0 +1,41 @@
+-- Bearer tokens partner agencies provision their staff with. Only the
+-- sha256 of a token is stored.
+CREATE TABLE IF NOT EXISTS scim_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id),
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    description VARCHAR(200) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Users provisioned over SCIM. user_name is what the partner calls the user,
+-- often an email address, and doesn't have to be a valid username.
+CREATE TABLE IF NOT EXISTS scim_users (
+    user_id UUID PRIMARY KEY REFERENCES users(id),
+    organization_id UUID NOT NULL REFERENCES organizations(id),
+    user_name VARCHAR(255) NOT NULL,
+    external_id VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS scim_users_user_name_idx ON scim_users (organization_id, lower(user_name));
+
+CREATE TABLE IF NOT EXISTS scim_groups (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id),
+    display_name VARCHAR(255) NOT NULL,
+    external_id VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS scim_groups_display_name_idx ON scim_groups (organization_id, lower(display_name));
+
+CREATE TABLE IF NOT EXISTS scim_group_members (
+    group_id UUID NOT NULL REFERENCES scim_groups(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id),
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS scim_group_members_user_id_idx ON scim_group_members (user_id);
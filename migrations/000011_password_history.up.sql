@@ -0,0 +1,10 @@
+-- Hashes of replaced passwords, so that recent ones are not reused. They
+-- are kept as bcrypt hashes.
+CREATE TABLE IF NOT EXISTS password_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id),
+    password_hash VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS password_history_user_id_idx ON password_history (user_id, created_at DESC);
@@ -0,0 +1,3 @@
+ALTER TABLE organizations DROP COLUMN IF EXISTS password_max_age_days;
+ALTER TABLE users DROP COLUMN IF EXISTS password_changed_at;
+ALTER TABLE users DROP COLUMN IF EXISTS must_change_password;
@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS must_change_password BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+UPDATE users SET password_changed_at = created_at WHERE created_at IS NOT NULL;
+
+-- NULL falls back to PASSWORD_MAX_AGE_DAYS, 0 means passwords never expire.
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS password_max_age_days INTEGER;
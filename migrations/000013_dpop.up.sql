@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS dpop_proofs (
+    key TEXT PRIMARY KEY,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS dpop_proofs_expires_at_idx ON dpop_proofs (expires_at);
@@ -0,0 +1,45 @@
+-- Security events kept for compliance. actor_id is who acted: a user id,
+-- scim:<organization id> for a partner, or '' for an anonymous caller.
+-- The table is append-only: rows cannot be changed, and only the retention
+-- purge, which sets audit.purge for its transaction, may delete them. The
+-- trigger guards against mistakes, not against the application role: any
+-- session of it can SET audit.purge = 'on' as well, and its owner can drop
+-- the trigger. Where the log must hold up against a compromised service,
+-- grant that role INSERT and SELECT only and run the purge as another one.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    event VARCHAR(64) NOT NULL,
+    outcome VARCHAR(16) NOT NULL,
+    actor_id VARCHAR(100) NOT NULL DEFAULT '',
+    target_type VARCHAR(32) NOT NULL DEFAULT '',
+    target_id VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_occurred_at_idx ON audit_events (occurred_at);
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events (actor_id, occurred_at);
+CREATE INDEX IF NOT EXISTS audit_events_target_id_idx ON audit_events (target_id, occurred_at);
+CREATE INDEX IF NOT EXISTS audit_events_event_idx ON audit_events (event, occurred_at);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' AND current_setting('audit.purge', true) = 'on' THEN
+        RETURN OLD;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
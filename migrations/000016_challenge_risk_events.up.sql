@@ -0,0 +1,11 @@
+-- Failed logins and signups per client address, shared by the gateways to
+-- decide when a client has to solve a challenge.
+CREATE TABLE IF NOT EXISTS challenge_risk_events (
+    id BIGSERIAL PRIMARY KEY,
+    key VARCHAR(255) NOT NULL,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS challenge_risk_events_key_idx ON challenge_risk_events (key, occurred_at);
+CREATE INDEX IF NOT EXISTS challenge_risk_events_expires_at_idx ON challenge_risk_events (expires_at);
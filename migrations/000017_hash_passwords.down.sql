@@ -0,0 +1 @@
+-- Hashed passwords cannot be turned back into the passwords; they stay.
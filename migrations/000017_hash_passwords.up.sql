@@ -0,0 +1,8 @@
+-- Passwords used to be stored as typed. Hash them the way pkg/password
+-- does: bcrypt, cost 10, of the base64 of their SHA-256. Rows that already
+-- hold a bcrypt hash are left alone.
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+UPDATE users
+SET password = crypt(encode(digest(password, 'sha256'), 'base64'), gen_salt('bf', 10))
+WHERE password !~ '^\$2[aby]\$\d{2}\$.{53}$';
@@ -0,0 +1,8 @@
+-- IDs of the SAML assertions consumed, kept until they expire so that no
+-- gateway accepts one twice.
+CREATE TABLE IF NOT EXISTS saml_assertions (
+    id TEXT PRIMARY KEY,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS saml_assertions_expires_at_idx ON saml_assertions (expires_at);
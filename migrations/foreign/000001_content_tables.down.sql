@@ -0,0 +1,11 @@
+-- Drop tables in reverse order of their dependencies
+DROP TABLE IF EXISTS travel_tips;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS itinerary_activities;
+DROP TABLE IF EXISTS itinerary_destinations;
+DROP TABLE IF EXISTS itineraries;
+DROP TABLE IF EXISTS destinations;
+DROP TABLE IF EXISTS likes;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS story_tags;
+DROP TABLE IF EXISTS stories;
@@ -0,0 +1,35 @@
+// Package migrations embeds the SQL migrations in the binary.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+var (
+	//go:embed *.sql
+	auth embed.FS
+	//go:embed foreign/*.sql
+	foreign embed.FS
+)
+
+// Auth is the schema of this service.
+var Auth fs.FS = auth
+
+// Foreign holds the tables of other services that this one reads. They
+// are only for development and test databases.
+var Foreign = mustSub(foreign, "foreign")
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// The tables the versions applied of each set are kept in.
+const (
+	AuthTable    = "auth_schema_migrations"
+	ForeignTable = "foreign_schema_migrations"
+)
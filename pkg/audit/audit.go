@@ -0,0 +1,109 @@
+// Package audit names the security events the service records for
+// compliance and carries who caused them from the gateway to the service.
+package audit
+
+import (
+	"auth/pkg/trust"
+	"context"
+)
+
+// Events. Those of an administrator act on a user or an organization on
+// behalf of someone else.
+const (
+	EventLogin           = "auth.login"
+	EventSSOLogin        = "auth.sso_login"
+	EventTokenRefresh    = "auth.token_refresh"
+	EventTokenRevocation = "auth.token_revocation"
+
+	EventPasswordChange  = "user.password_change"
+	EventRoleChange      = "user.role_change"
+	EventAccountDeletion = "user.deletion"
+
+	EventAccountUnlock        = "admin.account_unlock"
+	EventPasswordChangeForced = "admin.password_change_forced"
+	EventPasswordExpiry       = "admin.password_expiry"
+	EventScimTokenCreation    = "admin.scim_token_creation"
+	EventScimTokenRevocation  = "admin.scim_token_revocation"
+	EventAuditQuery           = "admin.audit_query"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Kinds of targets.
+const (
+	TargetUser         = "user"
+	TargetOrganization = "organization"
+	TargetScimToken    = "scim_token"
+	TargetGroup        = "group"
+)
+
+// The gateway passes the user agent of the HTTP client and the user of
+// the access token on in these metadata keys; the address goes in
+// x-forwarded-for.
+const (
+	UserAgentMetadata = "x-user-agent"
+	ActorMetadata     = "x-actor-id"
+)
+
+// MaxUserAgent bounds the user agents recorded.
+const MaxUserAgent = 512
+
+// CleanUserAgent keeps the printable ASCII of a user agent, up to
+// MaxUserAgent bytes; gRPC refuses metadata with anything else.
+func CleanUserAgent(ua string) string {
+	b := make([]byte, 0, len(ua))
+	for i := 0; i < len(ua) && len(b) < MaxUserAgent; i++ {
+		if ua[i] >= 0x20 && ua[i] < 0x7f {
+			b = append(b, ua[i])
+		}
+	}
+	return string(b)
+}
+
+// Outcome is the outcome of an action that failed with err, or not.
+func Outcome(err error) string {
+	if err != nil {
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
+
+// ScimActor is the actor of the changes a partner organization makes over
+// SCIM.
+func ScimActor(organizationID string) string {
+	return "scim:" + organizationID
+}
+
+type actorKey struct{}
+
+// WithActor returns a context carrying the user who makes the request.
+func WithActor(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, actorKey{}, userID)
+}
+
+// Actor returns the user who makes the request, or "".
+func Actor(ctx context.Context) string {
+	id, _ := ctx.Value(actorKey{}).(string)
+	return id
+}
+
+// Source describes where an RPC comes from.
+type Source struct {
+	Actor     string
+	IP        string
+	UserAgent string
+}
+
+// FromIncoming reads the source of an RPC from the metadata a gateway
+// sends. Any other caller could forge that metadata, so for them the actor
+// and user agent stay empty and the address is that of the peer.
+func FromIncoming(ctx context.Context, gateways *trust.Gateways) Source {
+	return Source{
+		Actor:     gateways.Metadata(ctx, ActorMetadata),
+		IP:        gateways.ClientIP(ctx),
+		UserAgent: gateways.Metadata(ctx, UserAgentMetadata),
+	}
+}
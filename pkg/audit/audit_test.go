@@ -0,0 +1,145 @@
+package audit
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/trust"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestFromIncoming(t *testing.T) {
+	gateways, err := trust.ParseGateways([]string{"10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := metadata.Pairs(
+		trust.ForwardedForMetadata, "203.0.113.7",
+		UserAgentMetadata, "Mozilla/5.0",
+		ActorMetadata, "u1",
+	)
+	from := func(ip net.IP) context.Context {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: ip, Port: 4000}})
+		return metadata.NewIncomingContext(ctx, md)
+	}
+
+	src := FromIncoming(from(net.IPv4(10, 0, 0, 1)), gateways)
+	if src != (Source{Actor: "u1", IP: "203.0.113.7", UserAgent: "Mozilla/5.0"}) {
+		t.Errorf("FromIncoming from a gateway = %+v", src)
+	}
+
+	// Anyone else could have made the metadata up.
+	src = FromIncoming(from(net.IPv4(10, 0, 0, 2)), gateways)
+	if src != (Source{IP: "10.0.0.2"}) {
+		t.Errorf("FromIncoming from another peer = %+v", src)
+	}
+}
+
+func TestCleanUserAgent(t *testing.T) {
+	if got := CleanUserAgent("curl/8.0\n\x00é"); got != "curl/8.0" {
+		t.Errorf("CleanUserAgent = %q", got)
+	}
+	long := make([]byte, MaxUserAgent+10)
+	for i := range long {
+		long[i] = 'a'
+	}
+	if got := CleanUserAgent(string(long)); len(got) != MaxUserAgent {
+		t.Errorf("len = %d", len(got))
+	}
+}
+
+// fakePurger holds events in memory, oldest first.
+type fakePurger struct {
+	events []*pb.AuditEvent
+	cutoff time.Time
+	fail   bool
+}
+
+func (f *fakePurger) PurgeBefore(ctx context.Context, cutoff time.Time, limit int, export func([]*pb.AuditEvent) error) (int, error) {
+	f.cutoff = cutoff
+	n := min(len(f.events), limit)
+	if n == 0 {
+		return 0, nil
+	}
+	if err := export(f.events[:n]); err != nil {
+		return 0, err
+	}
+	if f.fail {
+		return 0, errors.New("commit failed")
+	}
+	f.events = f.events[n:]
+	return n, nil
+}
+
+func TestPurge(t *testing.T) {
+	repo := &fakePurger{}
+	for i := 0; i < PurgeBatch+5; i++ {
+		repo.events = append(repo.events, &pb.AuditEvent{Id: int64(i + 1), Event: EventLogin, Outcome: OutcomeSuccess})
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRetention(repo, 24*time.Hour, t.TempDir(), time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	r.now = func() time.Time { return now }
+
+	n, path, err := r.Purge(context.Background())
+	if err != nil || n != PurgeBatch+5 || len(repo.events) != 0 {
+		t.Fatalf("Purge = %d, %v; %d left", n, err, len(repo.events))
+	}
+	if !repo.cutoff.Equal(now.Add(-24 * time.Hour)) {
+		t.Errorf("cutoff = %v", repo.cutoff)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if info, _ := f.Stat(); info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v", info.Mode())
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bufio.NewScanner(gz)
+	count := 0
+	for lines.Scan() {
+		var e pb.AuditEvent
+		if err := json.Unmarshal(lines.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		count++
+		if e.Id != int64(count) {
+			t.Fatalf("event %d has id %d", count, e.Id)
+		}
+	}
+	if count != PurgeBatch+5 {
+		t.Errorf("exported %d events", count)
+	}
+
+	if n, path, err := r.Purge(context.Background()); n != 0 || path != "" || err != nil {
+		t.Errorf("Purge with nothing due = %d, %q, %v", n, path, err)
+	}
+}
+
+func TestPurgeKeepsExportOnFailure(t *testing.T) {
+	repo := &fakePurger{events: []*pb.AuditEvent{{Id: 1}}, fail: true}
+	r := NewRetention(repo, time.Hour, t.TempDir(), time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	n, path, err := r.Purge(context.Background())
+	if err == nil || n != 0 || len(repo.events) != 1 {
+		t.Fatalf("Purge = %d, %v", n, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("export of the events not purged is gone: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package audit
+
+import (
+	pb "auth/genproto/users"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PurgeBatch is how many events are exported and deleted in one
+// transaction.
+const PurgeBatch = 1000
+
+// Purger deletes up to limit of the oldest events that occurred before
+// cutoff, after handing them to export. Nothing is deleted when export
+// fails. It returns how many events it deleted.
+type Purger interface {
+	PurgeBefore(ctx context.Context, cutoff time.Time, limit int, export func([]*pb.AuditEvent) error) (int, error)
+}
+
+// Retention moves the events older than Keep out of the database into
+// gzipped JSON Lines files in Dir, one file per run.
+type Retention struct {
+	Repo     Purger
+	Keep     time.Duration
+	Dir      string
+	Interval time.Duration
+	Log      *slog.Logger
+
+	now func() time.Time
+}
+
+func NewRetention(repo Purger, keep time.Duration, dir string, interval time.Duration, log *slog.Logger) *Retention {
+	return &Retention{Repo: repo, Keep: keep, Dir: dir, Interval: interval, Log: log, now: time.Now}
+}
+
+// Run purges once and then every Interval until ctx is done.
+func (r *Retention) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		n, file, err := r.Purge(ctx)
+		switch {
+		case err != nil:
+			r.Log.Error("audit events purge failed", "error", err, "purged", n, "file", file)
+		case n > 0:
+			r.Log.Info("audit events purged", "purged", n, "file", file)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge exports and deletes the events that are due. It returns how many
+// it deleted and the file they went to, "" when there were none. Every
+// batch is synced to the file before it is deleted, so an event may end
+// up in two files but never in none.
+func (r *Retention) Purge(ctx context.Context) (int, string, error) {
+	now := r.now().UTC()
+	cutoff := now.Add(-r.Keep)
+
+	var (
+		f   *os.File
+		gz  *gzip.Writer
+		enc *json.Encoder
+	)
+	path := filepath.Join(r.Dir, fmt.Sprintf("audit-events-%s.jsonl.gz", now.Format("20060102T150405Z")))
+	export := func(events []*pb.AuditEvent) error {
+		if f == nil {
+			if err := os.MkdirAll(r.Dir, 0o700); err != nil {
+				return err
+			}
+			var err error
+			if f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600); err != nil {
+				return err
+			}
+			gz = gzip.NewWriter(f)
+			enc = json.NewEncoder(gz)
+		}
+		for _, e := range events {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		if err := gz.Flush(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}
+
+	total := 0
+	var err error
+	for {
+		var n int
+		n, err = r.Repo.PurgeBefore(ctx, cutoff, PurgeBatch, export)
+		total += n
+		if err != nil || n < PurgeBatch {
+			break
+		}
+	}
+	if f == nil {
+		return total, "", err
+	}
+	if cerr := gz.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return total, path, err
+}
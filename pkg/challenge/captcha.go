@@ -0,0 +1,73 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const TypeCaptcha = "captcha"
+
+// CaptchaProvider checks a response token produced by a hosted CAPTCHA
+// widget.
+type CaptchaProvider interface {
+	VerifyToken(ctx context.Context, token, remoteIP string) (bool, error)
+}
+
+// Captcha adapts a CaptchaProvider to the ChallengeVerifier interface.
+type Captcha struct {
+	Provider CaptchaProvider
+	SiteKey  string
+}
+
+func (c *Captcha) Issue(ctx context.Context) (Challenge, error) {
+	return Challenge{Type: TypeCaptcha, SiteKey: c.SiteKey}, nil
+}
+
+func (c *Captcha) Verify(ctx context.Context, s Solution) error {
+	ok, err := c.Provider.VerifyToken(ctx, s.Answer, s.RemoteIP)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidSolution
+	}
+	return nil
+}
+
+// SiteVerify talks to the siteverify endpoint shared by reCAPTCHA, hCaptcha
+// and Turnstile.
+type SiteVerify struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func (s *SiteVerify) VerifyToken(ctx context.Context, token, remoteIP string) (bool, error) {
+	form := url.Values{"secret": {s.Secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return false, err
+	}
+	return body.Success, nil
+}
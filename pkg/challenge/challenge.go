@@ -0,0 +1,66 @@
+package challenge
+
+import (
+	"auth/config"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var ErrInvalidSolution = errors.New("challenge solution is invalid")
+
+// Challenge is handed to a client that has to prove it is not a bot before
+// its request is accepted.
+type Challenge struct {
+	Type string `json:"type"`
+	// Token identifies a proof-of-work challenge and is sent back with the
+	// solution.
+	Token string `json:"token,omitempty"`
+	// Difficulty is the number of leading zero bits the proof-of-work hash
+	// has to have.
+	Difficulty int `json:"difficulty,omitempty"`
+	// SiteKey is the public key of a hosted CAPTCHA widget.
+	SiteKey string `json:"site_key,omitempty"`
+}
+
+// Solution is what the client sends back.
+type Solution struct {
+	Token    string
+	Answer   string
+	RemoteIP string
+}
+
+// ChallengeVerifier issues challenges and checks their solutions.
+type ChallengeVerifier interface {
+	Issue(ctx context.Context) (Challenge, error)
+	Verify(ctx context.Context, s Solution) error
+}
+
+// NewVerifier returns the configured verifier. The proof-of-work verifier
+// needs no network access and is the default.
+func NewVerifier(cfg config.ChallengeConfig) (ChallengeVerifier, error) {
+	switch cfg.CHALLENGE_PROVIDER {
+	case "pow":
+		secret := []byte(cfg.CHALLENGE_SECRET)
+		if len(secret) == 0 {
+			// Challenges then only verify on the instance that issued them.
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return nil, err
+			}
+		}
+		return NewProofOfWork(secret, cfg.POW_DIFFICULTY, cfg.CHALLENGE_TTL), nil
+	case "captcha":
+		provider := &SiteVerify{
+			URL:    cfg.CAPTCHA_VERIFY_URL,
+			Secret: cfg.CAPTCHA_SECRET,
+			Client: &http.Client{Timeout: 5 * time.Second},
+		}
+		return &Captcha{Provider: provider, SiteKey: cfg.CAPTCHA_SITE_KEY}, nil
+	default:
+		return nil, fmt.Errorf("unknown challenge provider %q", cfg.CHALLENGE_PROVIDER)
+	}
+}
@@ -0,0 +1,124 @@
+package challenge
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const TypeProofOfWork = "pow"
+
+// ProofOfWork is a hashcash-style verifier. A challenge token carries its
+// expiry, a random nonce and the difficulty and is signed with the secret,
+// so no state is needed until a solution is spent. A solution is an answer
+// for which sha256(token + ":" + answer) starts with Difficulty zero bits.
+type ProofOfWork struct {
+	secret     []byte
+	difficulty int
+	ttl        time.Duration
+
+	mu    sync.Mutex
+	spent map[string]time.Time
+	now   func() time.Time
+}
+
+func NewProofOfWork(secret []byte, difficulty int, ttl time.Duration) *ProofOfWork {
+	return &ProofOfWork{
+		secret:     secret,
+		difficulty: difficulty,
+		ttl:        ttl,
+		spent:      make(map[string]time.Time),
+		now:        time.Now,
+	}
+}
+
+func (p *ProofOfWork) Issue(ctx context.Context) (Challenge, error) {
+	payload := make([]byte, 8+16+1)
+	binary.BigEndian.PutUint64(payload, uint64(p.now().Add(p.ttl).Unix()))
+	if _, err := rand.Read(payload[8:24]); err != nil {
+		return Challenge{}, err
+	}
+	payload[24] = byte(p.difficulty)
+
+	token := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(p.sign(payload))
+	return Challenge{Type: TypeProofOfWork, Token: token, Difficulty: p.difficulty}, nil
+}
+
+func (p *ProofOfWork) Verify(ctx context.Context, s Solution) error {
+	encoded, mac, ok := strings.Cut(s.Token, ".")
+	if !ok {
+		return ErrInvalidSolution
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(payload) != 25 {
+		return ErrInvalidSolution
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(mac)
+	if err != nil || !hmac.Equal(sig, p.sign(payload)) {
+		return ErrInvalidSolution
+	}
+
+	expires := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+	if p.now().After(expires) {
+		return ErrInvalidSolution
+	}
+	if leadingZeroBits(s.Token, s.Answer) < int(payload[24]) {
+		return ErrInvalidSolution
+	}
+	return p.spend(s.Token, expires)
+}
+
+func (p *ProofOfWork) sign(payload []byte) []byte {
+	m := hmac.New(sha256.New, p.secret)
+	m.Write(payload)
+	return m.Sum(nil)
+}
+
+// spend makes sure every solved challenge is accepted only once.
+func (p *ProofOfWork) spend(token string, expires time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	for t, exp := range p.spent {
+		if now.After(exp) {
+			delete(p.spent, t)
+		}
+	}
+	if _, ok := p.spent[token]; ok {
+		return ErrInvalidSolution
+	}
+	p.spent[token] = expires
+	return nil
+}
+
+// Solve finds an answer to a proof-of-work challenge. Clients written in Go
+// can use it directly; browsers run the same loop in JavaScript.
+func Solve(token string, difficulty int) string {
+	for i := 0; ; i++ {
+		answer := strconv.Itoa(i)
+		if leadingZeroBits(token, answer) >= difficulty {
+			return answer
+		}
+	}
+}
+
+func leadingZeroBits(token, answer string) int {
+	sum := sha256.Sum256([]byte(token + ":" + answer))
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
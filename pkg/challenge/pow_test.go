@@ -0,0 +1,70 @@
+package challenge
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestProofOfWork(t *testing.T) {
+	ctx := context.Background()
+	pow := NewProofOfWork([]byte("secret"), 8, time.Minute)
+
+	ch, err := pow.Issue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer := Solve(ch.Token, ch.Difficulty)
+
+	if err := pow.Verify(ctx, Solution{Token: ch.Token, Answer: answer}); err != nil {
+		t.Fatalf("valid solution rejected: %v", err)
+	}
+	if err := pow.Verify(ctx, Solution{Token: ch.Token, Answer: answer}); err == nil {
+		t.Fatal("solution accepted twice")
+	}
+
+	ch, _ = pow.Issue(ctx)
+	other := NewProofOfWork([]byte("other secret"), 8, time.Minute)
+	if err := other.Verify(ctx, Solution{Token: ch.Token, Answer: Solve(ch.Token, ch.Difficulty)}); err == nil {
+		t.Fatal("challenge signed with another secret accepted")
+	}
+
+	ch, _ = pow.Issue(ctx)
+	pow.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if err := pow.Verify(ctx, Solution{Token: ch.Token, Answer: Solve(ch.Token, ch.Difficulty)}); err == nil {
+		t.Fatal("expired challenge accepted")
+	}
+}
+
+func TestRisk(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	store := NewMemoryRiskStore()
+	store.now = func() time.Time { return now }
+	risk := NewRisk(store, time.Hour, map[string]int{ActionLogin: 2})
+	required := func(action, ip string) bool {
+		t.Helper()
+		ok, err := risk.Required(ctx, action, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	risk.Record(ctx, ActionLogin, "1.2.3.4")
+	if required(ActionLogin, "1.2.3.4") {
+		t.Fatal("challenge required below the threshold")
+	}
+	risk.Record(ctx, ActionLogin, "1.2.3.4")
+	if !required(ActionLogin, "1.2.3.4") {
+		t.Fatal("challenge not required at the threshold")
+	}
+	if required(ActionLogin, "5.6.7.8") || required(ActionRegister, "1.2.3.4") {
+		t.Fatal("challenge required for an unrelated client or action")
+	}
+
+	now = now.Add(time.Hour + time.Second)
+	if required(ActionLogin, "1.2.3.4") {
+		t.Fatal("challenge still required after the window")
+	}
+}
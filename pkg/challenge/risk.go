@@ -0,0 +1,180 @@
+package challenge
+
+import (
+	"auth/config"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Actions that can demand a challenge.
+const (
+	ActionLogin    = "login"
+	ActionRegister = "register"
+)
+
+// Risk counts suspicious events per action and client address within a
+// sliding window: failed logins for ActionLogin and completed signups for
+// ActionRegister. Once a threshold is reached the client has to solve a
+// challenge until the window has passed.
+type Risk struct {
+	Store      RiskStore
+	window     time.Duration
+	thresholds map[string]int
+}
+
+// RiskStore keeps the suspicious events. Implementations must be safe for
+// concurrent use.
+type RiskStore interface {
+	// Add records an event of key, which counts for window.
+	Add(ctx context.Context, key string, window time.Duration) error
+	// Count returns the events of key within the last window.
+	Count(ctx context.Context, key string, window time.Duration) (int, error)
+}
+
+func NewRisk(store RiskStore, window time.Duration, thresholds map[string]int) *Risk {
+	return &Risk{Store: store, window: window, thresholds: thresholds}
+}
+
+// RiskFromConfig builds the risk signals with the configured backend. The
+// postgres backend shares them between instances through db.
+func RiskFromConfig(cfg config.ChallengeConfig, db *sql.DB, log *slog.Logger) (*Risk, error) {
+	var store RiskStore
+	switch cfg.CHALLENGE_RISK_BACKEND {
+	case "memory":
+		store = NewMemoryRiskStore()
+	case "postgres":
+		store = NewPostgresRiskStore(db, log)
+	default:
+		return nil, fmt.Errorf("unknown challenge risk backend %q", cfg.CHALLENGE_RISK_BACKEND)
+	}
+	return NewRisk(store, cfg.CHALLENGE_WINDOW, map[string]int{
+		ActionLogin:    cfg.CHALLENGE_AFTER_FAILED_LOGINS,
+		ActionRegister: cfg.CHALLENGE_AFTER_REGISTRATIONS,
+	}), nil
+}
+
+// Required reports whether the next request of the client has to carry a
+// solved challenge.
+func (r *Risk) Required(ctx context.Context, action, ip string) (bool, error) {
+	limit, ok := r.thresholds[action]
+	if !ok || limit <= 0 {
+		return false, nil
+	}
+	n, err := r.Store.Count(ctx, action+"|"+ip, r.window)
+	return n >= limit, err
+}
+
+// Record counts a suspicious event of the client.
+func (r *Risk) Record(ctx context.Context, action, ip string) error {
+	return r.Store.Add(ctx, action+"|"+ip, r.window)
+}
+
+// MemoryRiskStore keeps the events in the process. They are not shared
+// between instances.
+type MemoryRiskStore struct {
+	mu     sync.Mutex
+	events map[string][]time.Time
+	calls  int
+	now    func() time.Time
+}
+
+func NewMemoryRiskStore() *MemoryRiskStore {
+	return &MemoryRiskStore{events: make(map[string][]time.Time), now: time.Now}
+}
+
+func (s *MemoryRiskStore) Add(_ context.Context, key string, window time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events[key] = append(s.recent(key, window), s.now())
+
+	s.calls++
+	if s.calls%1000 == 0 {
+		for k := range s.events {
+			if len(s.recent(k, window)) == 0 {
+				delete(s.events, k)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryRiskStore) Count(_ context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.recent(key, window)), nil
+}
+
+// recent drops the events of key that left the window and returns the rest.
+func (s *MemoryRiskStore) recent(key string, window time.Duration) []time.Time {
+	events := s.events[key]
+	cutoff := s.now().Add(-window)
+	i := 0
+	for i < len(events) && !events[i].After(cutoff) {
+		i++
+	}
+	events = events[i:]
+	if len(events) == 0 {
+		delete(s.events, key)
+	} else {
+		s.events[key] = events
+	}
+	return events
+}
+
+// PostgresRiskStore keeps the events in the challenge_risk_events table so
+// that every instance of the gateway sees those of the others. Time is
+// taken from the database to avoid clock skew between instances.
+type PostgresRiskStore struct {
+	DB  *sql.DB
+	Log *slog.Logger
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresRiskStore(db *sql.DB, log *slog.Logger) *PostgresRiskStore {
+	return &PostgresRiskStore{DB: db, Log: log}
+}
+
+func (s *PostgresRiskStore) Add(ctx context.Context, key string, window time.Duration) error {
+	s.sweep(ctx)
+	_, err := s.DB.ExecContext(ctx, `
+	INSERT INTO challenge_risk_events (key, expires_at)
+	VALUES ($1, current_timestamp + make_interval(secs => $2))
+	`, key, window.Seconds())
+	return err
+}
+
+func (s *PostgresRiskStore) Count(ctx context.Context, key string, window time.Duration) (int, error) {
+	var n int
+	err := s.DB.QueryRowContext(ctx, `
+	SELECT
+		count(*)
+	FROM
+		challenge_risk_events
+	WHERE
+		key = $1 AND occurred_at > current_timestamp - make_interval(secs => $2)
+	`, key, window.Seconds()).Scan(&n)
+	return n, err
+}
+
+// sweep deletes expired events at most once a minute per instance.
+func (s *PostgresRiskStore) sweep(ctx context.Context) {
+	s.mu.Lock()
+	if time.Since(s.lastSweep) < time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSweep = time.Now()
+	s.mu.Unlock()
+
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM challenge_risk_events WHERE expires_at < current_timestamp`)
+	if err != nil {
+		s.Log.Error("expired challenge risk events not deleted", "error", err)
+	}
+}
@@ -0,0 +1,238 @@
+// Package claims copies profile fields into access tokens, so that the
+// services receiving them need not ask for the profile of the user just to
+// learn their username or tier.
+package claims
+
+import (
+	"auth/config"
+	pb "auth/genproto/users"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile fields a mapper may read.
+const (
+	SourceUsername      = "username"
+	SourceFullName      = "full_name"
+	SourceEmail         = "email"
+	SourceEmailVerified = "email_verified"
+	SourceRoles         = "roles"
+	SourceGroups        = "groups"
+	SourceTier          = "tier"
+	SourceLocale        = "locale"
+)
+
+// GroupPrefix starts the SCIM groups among the roles of a profile, which
+// are named scim:<organization>/<group> so that an agency cannot name a
+// group after a role of ours. The roles source leaves them out and the
+// groups source has only them.
+const GroupPrefix = "scim:"
+
+// DefaultAudience names, in the audiences allowlist, the tokens issued at
+// login, which carry no audience.
+const DefaultAudience = "default"
+
+// reserved claims are set by the token issuer and cannot be mapped.
+var reserved = map[string]bool{
+	"user_id": true, "role": true, "scope": true, "sub": true, "aud": true, "iss": true,
+	"iat": true, "exp": true, "nbf": true, "jti": true, "act": true, "cnf": true, "client_id": true,
+}
+
+// Mapper puts the Source field of the profile into Claim.
+type Mapper struct {
+	Claim  string `yaml:"claim"`
+	Source string `yaml:"source"`
+}
+
+// File is the CLAIMS_FILE, for example
+//
+//	max_claim_bytes: 256
+//	max_total_bytes: 1024
+//	mappers:
+//	  - {claim: preferred_username, source: username}
+//	  - {claim: tier, source: tier}
+//	  - {claim: roles, source: roles}
+//	  - {claim: groups, source: groups}
+//	audiences:
+//	  default: [preferred_username, tier]
+//	  story: [preferred_username, tier, roles, groups]
+type File struct {
+	Mappers []Mapper `yaml:"mappers"`
+	// MaxClaimBytes and MaxTotalBytes limit the JSON encoded size of one
+	// mapped claim and of all of them together. Claims over the limit are
+	// left out.
+	MaxClaimBytes int `yaml:"max_claim_bytes"`
+	MaxTotalBytes int `yaml:"max_total_bytes"`
+	// Audiences lists the mapped claims the tokens for each audience may
+	// carry. Audiences not listed get none.
+	Audiences map[string][]string `yaml:"audiences"`
+}
+
+// Enricher adds the mapped claims to tokens. A nil Enricher adds none.
+type Enricher struct {
+	mappers   []Mapper
+	maxClaim  int
+	maxTotal  int
+	audiences map[string]map[string]bool
+}
+
+func New(f File) (*Enricher, error) {
+	e := &Enricher{maxClaim: f.MaxClaimBytes, maxTotal: f.MaxTotalBytes, audiences: map[string]map[string]bool{}}
+	if e.maxClaim <= 0 {
+		e.maxClaim = 256
+	}
+	if e.maxTotal <= 0 {
+		e.maxTotal = 1024
+	}
+	mapped := map[string]bool{}
+	for _, m := range f.Mappers {
+		switch m.Source {
+		case SourceUsername, SourceFullName, SourceEmail, SourceEmailVerified, SourceRoles, SourceGroups, SourceTier, SourceLocale:
+		default:
+			return nil, fmt.Errorf("claim %q: unknown source %q", m.Claim, m.Source)
+		}
+		if m.Claim == "" || reserved[m.Claim] {
+			return nil, fmt.Errorf("claim %q cannot be mapped", m.Claim)
+		}
+		if mapped[m.Claim] {
+			return nil, fmt.Errorf("claim %q is mapped twice", m.Claim)
+		}
+		mapped[m.Claim] = true
+		e.mappers = append(e.mappers, m)
+	}
+	for audience, names := range f.Audiences {
+		allowed := map[string]bool{}
+		for _, name := range names {
+			if !mapped[name] {
+				return nil, fmt.Errorf("audience %q allows claim %q, which has no mapper", audience, name)
+			}
+			allowed[name] = true
+		}
+		e.audiences[audience] = allowed
+	}
+	return e, nil
+}
+
+// FromConfig returns nil while CLAIMS_FILE is empty.
+func FromConfig(cfg config.TokenConfig) (*Enricher, error) {
+	if cfg.CLAIMS_FILE == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(cfg.CLAIMS_FILE)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.CLAIMS_FILE, err)
+	}
+	return New(f)
+}
+
+// Enabled tells whether tokens for audience get any mapped claim, that is
+// whether the profile has to be loaded at all. "" is the default audience.
+func (e *Enricher) Enabled(audience string) bool {
+	return e != nil && len(e.allowed(audience)) > 0
+}
+
+// Load maps the profile of a user onto the extra claims of an access token
+// for audience, "" for the tokens of the gateway itself, and logs the claims
+// left out for their size. The profile is only fetched when the audience
+// gets any claim.
+func (e *Enricher) Load(ctx context.Context, log *slog.Logger, userID, audience string, profile func(context.Context, string) (*pb.TokenProfile, error)) (map[string]interface{}, error) {
+	if !e.Enabled(audience) {
+		return nil, nil
+	}
+	p, err := profile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	extra, dropped := e.Claims(p, audience)
+	if len(dropped) > 0 {
+		log.Warn("Claims left out of the access token for their size", "user_id", userID, "audience", audience, "claims", dropped)
+	}
+	return extra, nil
+}
+
+// Claims maps the profile for a token meant for audience. It also returns
+// the claims left out for their size.
+func (e *Enricher) Claims(p *pb.TokenProfile, audience string) (map[string]interface{}, []string) {
+	if e == nil || p == nil {
+		return nil, nil
+	}
+	allowed := e.allowed(audience)
+	res := map[string]interface{}{}
+	var dropped []string
+	total := 0
+	for _, m := range e.mappers {
+		if !allowed[m.Claim] {
+			continue
+		}
+		value := source(p, m.Source)
+		if value == nil {
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		// The name, its quotes, the colon and the separating comma.
+		size := len(m.Claim) + len(encoded) + 4
+		if len(encoded) > e.maxClaim || total+size > e.maxTotal {
+			dropped = append(dropped, m.Claim)
+			continue
+		}
+		total += size
+		res[m.Claim] = value
+	}
+	return res, dropped
+}
+
+func (e *Enricher) allowed(audience string) map[string]bool {
+	if audience == "" {
+		audience = DefaultAudience
+	}
+	return e.audiences[audience]
+}
+
+// source returns a field of the profile, or nil when it is empty.
+func source(p *pb.TokenProfile, name string) interface{} {
+	text := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	switch name {
+	case SourceUsername:
+		return text(p.Username)
+	case SourceFullName:
+		return text(p.FullName)
+	case SourceEmail:
+		return text(p.Email)
+	case SourceEmailVerified:
+		return p.EmailVerified
+	case SourceRoles, SourceGroups:
+		var list []string
+		for _, r := range p.Roles {
+			if strings.HasPrefix(r, GroupPrefix) == (name == SourceGroups) {
+				list = append(list, r)
+			}
+		}
+		if len(list) == 0 {
+			return nil
+		}
+		return list
+	case SourceTier:
+		return text(p.Tier)
+	case SourceLocale:
+		return text(p.Locale)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package claims
+
+import (
+	pb "auth/genproto/users"
+	"context"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClaims(t *testing.T) {
+	e, err := New(File{
+		MaxClaimBytes: 64,
+		MaxTotalBytes: 120,
+		Mappers: []Mapper{
+			{Claim: "preferred_username", Source: SourceUsername},
+			{Claim: "tier", Source: SourceTier},
+			{Claim: "roles", Source: SourceRoles},
+			{Claim: "email_verified", Source: SourceEmailVerified},
+			{Claim: "locale", Source: SourceLocale},
+		},
+		Audiences: map[string][]string{
+			DefaultAudience: {"preferred_username", "tier"},
+			"story":         {"preferred_username", "tier", "roles", "email_verified", "locale"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := &pb.TokenProfile{
+		UserId:        "u1",
+		Username:      "jdoe",
+		Tier:          "premium",
+		Roles:         []string{"user", strings.Repeat("g", 70)},
+		EmailVerified: true,
+	}
+
+	got, dropped := e.Claims(profile, "")
+	if want := map[string]interface{}{"preferred_username": "jdoe", "tier": "premium"}; !reflect.DeepEqual(got, want) || dropped != nil {
+		t.Errorf("Claims for the default audience = %v, %v", got, dropped)
+	}
+
+	// roles is over the limit of a claim and the empty locale is left out.
+	got, dropped = e.Claims(profile, "story")
+	if want := map[string]interface{}{"preferred_username": "jdoe", "tier": "premium", "email_verified": true}; !reflect.DeepEqual(got, want) || !reflect.DeepEqual(dropped, []string{"roles"}) {
+		t.Errorf("Claims for story = %v, %v", got, dropped)
+	}
+
+	if e.Enabled("media") {
+		t.Error("an audience that is not listed gets claims")
+	}
+	if got, _ := e.Claims(profile, "media"); len(got) != 0 {
+		t.Errorf("Claims for media = %v", got)
+	}
+
+	var none *Enricher
+	if none.Enabled("") {
+		t.Error("a nil Enricher is enabled")
+	}
+
+	for _, f := range []File{
+		{Mappers: []Mapper{{Claim: "role", Source: SourceRoles}}},
+		{Mappers: []Mapper{{Claim: "x", Source: "password"}}},
+		{Audiences: map[string][]string{"story": {"tier"}}},
+	} {
+		if _, err := New(f); err == nil {
+			t.Errorf("New(%+v) succeeded", f)
+		}
+	}
+}
+
+func TestGroups(t *testing.T) {
+	e, err := New(File{
+		Mappers: []Mapper{
+			{Claim: "roles", Source: SourceRoles},
+			{Claim: "groups", Source: SourceGroups},
+		},
+		Audiences: map[string][]string{"story": {"roles", "groups"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An agency naming a group admin does not make its members admins.
+	profile := &pb.TokenProfile{UserId: "u1", Roles: []string{"user", GroupPrefix + "skyway/admin", GroupPrefix + "skyway/Guides"}}
+	var fetched int
+	fetch := func(ctx context.Context, userID string) (*pb.TokenProfile, error) {
+		fetched++
+		return profile, nil
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	got, err := e.Load(context.Background(), log, "u1", "story", fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"roles":  []string{"user"},
+		"groups": []string{"scim:skyway/admin", "scim:skyway/Guides"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load = %v, want %v", got, want)
+	}
+
+	if got, err := e.Load(context.Background(), log, "u1", "", fetch); err != nil || got != nil {
+		t.Errorf("Load for the default audience = %v, %v", got, err)
+	}
+	if fetched != 1 {
+		t.Errorf("the profile was fetched %d times, want once", fetched)
+	}
+}
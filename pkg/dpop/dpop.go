@@ -0,0 +1,225 @@
+// Package dpop verifies DPoP proofs (RFC 9449). A client proves with every
+// request that it holds the private key its tokens are bound to, so a
+// token stolen on the way, on the Wi-Fi of an airport say, is of no use.
+package dpop
+
+import (
+	"auth/config"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Header is the request header carrying the proof.
+const Header = "DPoP"
+
+// Modes of DPOP_MODE.
+const (
+	ModeOff      = "off"
+	ModeOptional = "optional"
+	ModeRequired = "required"
+)
+
+var ErrInvalidProof = errors.New("invalid DPoP proof")
+
+// algorithms are the asymmetric JWS algorithms accepted for proofs.
+var algorithms = []string{"ES256", "ES384", "ES512", "RS256", "PS256"}
+
+// Verifier checks proofs for the requests reaching BaseURL.
+type Verifier struct {
+	// BaseURL is the public address of the gateway; proofs name the full
+	// URL of the request in htu.
+	BaseURL string
+	// MaxAge is how old a proof may be, and how far ahead the clock of the
+	// client may run.
+	MaxAge time.Duration
+	// Required refuses tokens that are not bound to a key.
+	Required bool
+	Replay   ReplayCache
+
+	now func() time.Time
+}
+
+func NewVerifier(baseURL string, maxAge time.Duration, required bool, replay ReplayCache) *Verifier {
+	return &Verifier{BaseURL: baseURL, MaxAge: maxAge, Required: required, Replay: replay, now: time.Now}
+}
+
+// FromConfig returns nil when DPoP is off.
+func FromConfig(cfg config.DPoPConfig, baseURL string, db *sql.DB, log *slog.Logger) (*Verifier, error) {
+	var replay ReplayCache
+	switch cfg.DPOP_REPLAY_BACKEND {
+	case "memory":
+		replay = NewMemoryCache()
+	case "postgres":
+		replay = NewPostgresCache(db, log)
+	default:
+		return nil, fmt.Errorf("unknown DPoP replay backend %q", cfg.DPOP_REPLAY_BACKEND)
+	}
+	switch cfg.DPOP_MODE {
+	case ModeOff:
+		return nil, nil
+	case ModeOptional, ModeRequired:
+		return NewVerifier(baseURL, cfg.DPOP_PROOF_MAX_AGE, cfg.DPOP_MODE == ModeRequired, replay), nil
+	}
+	return nil, fmt.Errorf("unknown DPoP mode %q", cfg.DPOP_MODE)
+}
+
+// Verify checks a proof sent with a method request to path and returns the
+// thumbprint of its key. accessToken is the token the request presents, if
+// any, which the proof has to name in ath.
+func (v *Verifier) Verify(ctx context.Context, proof, method, path, accessToken string) (string, error) {
+	var jkt string
+	parser := jwt.NewParser(jwt.WithValidMethods(algorithms), jwt.WithoutClaimsValidation())
+	token, err := parser.Parse(proof, func(t *jwt.Token) (interface{}, error) {
+		if typ, _ := t.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, errors.New("typ is not dpop+jwt")
+		}
+		jwk, ok := t.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("jwk is missing")
+		}
+		key, thumbprint, err := PublicKey(jwk)
+		if err != nil {
+			return nil, err
+		}
+		jkt = thumbprint
+		return key, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", ErrInvalidProof
+	}
+
+	jti, _ := claims["jti"].(string)
+	htm, _ := claims["htm"].(string)
+	htu, _ := claims["htu"].(string)
+	iat, _ := claims["iat"].(float64)
+	switch {
+	case jti == "" || len(jti) > 256:
+		return "", fmt.Errorf("%w: bad jti", ErrInvalidProof)
+	case htm != method:
+		return "", fmt.Errorf("%w: htm does not match the request", ErrInvalidProof)
+	case !v.sameURL(htu, path):
+		return "", fmt.Errorf("%w: htu does not match the request", ErrInvalidProof)
+	}
+	issued := time.Unix(int64(iat), 0)
+	now := v.now()
+	if issued.Before(now.Add(-v.MaxAge)) || issued.After(now.Add(v.MaxAge)) {
+		return "", fmt.Errorf("%w: iat is out of range", ErrInvalidProof)
+	}
+	if accessToken != "" {
+		ath, _ := claims["ath"].(string)
+		sum := sha256.Sum256([]byte(accessToken))
+		if ath != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return "", fmt.Errorf("%w: ath does not match the access token", ErrInvalidProof)
+		}
+	}
+
+	// Keep the jti for as long as a proof carrying it is accepted.
+	fresh, err := v.Replay.Remember(ctx, jkt+":"+jti, issued.Add(v.MaxAge))
+	if err != nil {
+		return "", err
+	}
+	if !fresh {
+		return "", fmt.Errorf("%w: proof was used before", ErrInvalidProof)
+	}
+	return jkt, nil
+}
+
+// sameURL compares htu with the URL of the request, ignoring the query and
+// fragment and the case of the scheme and host.
+func (v *Verifier) sameURL(htu, path string) bool {
+	got, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	want, err := url.Parse(strings.TrimRight(v.BaseURL, "/") + path)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(got.Scheme, want.Scheme) && strings.EqualFold(got.Host, want.Host) && got.Path == want.Path
+}
+
+// PublicKey reads a public JWK and returns the key and its RFC 7638
+// thumbprint.
+func PublicKey(jwk map[string]interface{}) (crypto.PublicKey, string, error) {
+	if _, ok := jwk["d"]; ok {
+		return nil, "", errors.New("jwk holds a private key")
+	}
+	field := func(name string) string {
+		s, _ := jwk[name].(string)
+		return s
+	}
+	var key crypto.PublicKey
+	var members map[string]string
+	switch field("kty") {
+	case "EC":
+		var curve elliptic.Curve
+		switch field("crv") {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, "", errors.New("unsupported curve")
+		}
+		x, err := base64.RawURLEncoding.DecodeString(field("x"))
+		if err != nil {
+			return nil, "", err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(field("y"))
+		if err != nil {
+			return nil, "", err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, "", errors.New("point is not on the curve")
+		}
+		key = pub
+		members = map[string]string{"crv": field("crv"), "kty": "EC", "x": field("x"), "y": field("y")}
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(field("n"))
+		if err != nil {
+			return nil, "", err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(field("e"))
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, "", errors.New("bad exponent")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < 2048 {
+			return nil, "", errors.New("RSA key is too short")
+		}
+		key = pub
+		members = map[string]string{"e": field("e"), "kty": "RSA", "n": field("n")}
+	default:
+		return nil, "", errors.New("unsupported key type")
+	}
+	// encoding/json sorts map keys, as RFC 7638 asks.
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return key, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
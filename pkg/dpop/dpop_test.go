@@ -0,0 +1,101 @@
+package dpop
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestThumbprint(t *testing.T) {
+	// The example of RFC 7638, section 3.1.
+	_, jkt, err := PublicKey(map[string]interface{}{
+		"kty": "RSA",
+		"n":   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		"e":   "AQAB",
+		"alg": "RS256",
+		"kid": "2011-04-29",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jkt != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("thumbprint = %s", jkt)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := map[string]interface{}{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+	_, want, err := PublicKey(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	cache := NewMemoryCache()
+	cache.now = func() time.Time { return now }
+	v := NewVerifier("https://auth.example", time.Minute, false, cache)
+	v.now = cache.now
+
+	proof := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["typ"] = "dpop+jwt"
+		token.Header["jwk"] = jwk
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	sum := sha256.Sum256([]byte("access-token"))
+	ath := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	ok := proof(jwt.MapClaims{"jti": "1", "htm": "GET", "htu": "https://AUTH.example/api/v1/users/profile?x=1", "iat": now.Unix(), "ath": ath})
+	jkt, err := v.Verify(ctx, ok, "GET", "/api/v1/users/profile", "access-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jkt != want {
+		t.Errorf("Verify = %s, want %s", jkt, want)
+	}
+	if _, err := v.Verify(ctx, ok, "GET", "/api/v1/users/profile", "access-token"); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("replayed proof: %v", err)
+	}
+
+	for name, claims := range map[string]jwt.MapClaims{
+		"method": {"jti": "2", "htm": "POST", "htu": "https://auth.example/api/v1/users/profile", "iat": now.Unix(), "ath": ath},
+		"url":    {"jti": "3", "htm": "GET", "htu": "https://auth.example/api/v1/admin", "iat": now.Unix(), "ath": ath},
+		"old":    {"jti": "4", "htm": "GET", "htu": "https://auth.example/api/v1/users/profile", "iat": now.Add(-2 * time.Minute).Unix(), "ath": ath},
+		"ath":    {"jti": "5", "htm": "GET", "htu": "https://auth.example/api/v1/users/profile", "iat": now.Unix(), "ath": "AAAA"},
+		"no jti": {"htm": "GET", "htu": "https://auth.example/api/v1/users/profile", "iat": now.Unix(), "ath": ath},
+	} {
+		if _, err := v.Verify(ctx, proof(claims), "GET", "/api/v1/users/profile", "access-token"); !errors.Is(err, ErrInvalidProof) {
+			t.Errorf("%s: Verify = %v", name, err)
+		}
+	}
+
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"jti": "6", "htm": "GET", "htu": "https://auth.example/x", "iat": now.Unix()})
+	hmac.Header["typ"] = "dpop+jwt"
+	hmac.Header["jwk"] = jwk
+	s, _ := hmac.SignedString([]byte("secret"))
+	if _, err := v.Verify(ctx, s, "GET", "/x", ""); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("symmetric proof: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package dpop
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ReplayCache remembers the proofs seen so that none is accepted twice.
+type ReplayCache interface {
+	// Remember stores key until expires and reports whether it was new.
+	Remember(ctx context.Context, key string, expires time.Time) (bool, error)
+}
+
+// MemoryCache keeps the proofs of a single instance in memory.
+type MemoryCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{seen: map[string]time.Time{}, now: time.Now}
+}
+
+func (m *MemoryCache) Remember(_ context.Context, key string, expires time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for k, exp := range m.seen {
+			if exp.Before(now) {
+				delete(m.seen, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	if exp, ok := m.seen[key]; ok && !exp.Before(now) {
+		return false, nil
+	}
+	m.seen[key] = expires
+	return true, nil
+}
+
+// PostgresCache keeps the proofs in the dpop_proofs table, shared by every
+// instance of the gateway.
+type PostgresCache struct {
+	DB  *sql.DB
+	Log *slog.Logger
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresCache(db *sql.DB, log *slog.Logger) *PostgresCache {
+	return &PostgresCache{DB: db, Log: log}
+}
+
+func (p *PostgresCache) Remember(ctx context.Context, key string, expires time.Time) (bool, error) {
+	p.sweep(ctx)
+	res, err := p.DB.ExecContext(ctx, `
+	INSERT INTO dpop_proofs (key, expires_at)
+	VALUES ($1, $2)
+	ON CONFLICT (key) DO UPDATE SET
+		expires_at = EXCLUDED.expires_at
+	WHERE
+		dpop_proofs.expires_at < current_timestamp
+	`, key, expires)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// sweep drops expired proofs at most once a minute.
+func (p *PostgresCache) sweep(ctx context.Context) {
+	p.mu.Lock()
+	if time.Since(p.lastSweep) < time.Minute {
+		p.mu.Unlock()
+		return
+	}
+	p.lastSweep = time.Now()
+	p.mu.Unlock()
+
+	_, err := p.DB.ExecContext(ctx, `DELETE FROM dpop_proofs WHERE expires_at < current_timestamp`)
+	if err != nil {
+		p.Log.Error("expired DPoP proofs not deleted", "error", err)
+	}
+}
@@ -0,0 +1,238 @@
+// Package exchange decides OAuth 2.0 token exchange (RFC 8693) requests.
+// Our services use it to call each other on behalf of a user with a token
+// that is narrowed to the service being called, instead of forwarding the
+// full access token of the user.
+package exchange
+
+import (
+	"auth/config"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	GrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// Error is a refused exchange. Code is the OAuth error code of RFC 6749 and
+// RFC 8693 returned to the client.
+type Error struct {
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func errorf(code, format string, args ...interface{}) error {
+	return &Error{Code: code, Description: fmt.Sprintf(format, args...)}
+}
+
+// Client is a service allowed to exchange tokens.
+type Client struct {
+	ID string `yaml:"id"`
+	// SecretSHA256 is the hex encoded SHA-256 of the client secret.
+	SecretSHA256 string `yaml:"secret_sha256"`
+	// Audiences are the services the client may get tokens for.
+	Audiences []string `yaml:"audiences"`
+	// Scopes limit what the issued tokens may carry; empty means no scope.
+	Scopes []string `yaml:"scopes"`
+	// TTL overrides the default lifetime of the issued tokens.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Subject is what the presented subject token says.
+type Subject struct {
+	UserID string
+	// Audience is empty for a token issued at login and names the service
+	// a token obtained by exchange is meant for.
+	Audience []string
+	Scope    string
+	// Act is the act claim of a token obtained by exchange.
+	Act       map[string]interface{}
+	ExpiresAt time.Time
+}
+
+// Grant is what the issued token carries.
+type Grant struct {
+	UserID    string
+	ClientID  string
+	Audience  string
+	Scope     string
+	Act       map[string]interface{}
+	ExpiresAt time.Time
+}
+
+// Policy holds the clients and the limits of issued tokens.
+type Policy struct {
+	clients map[string]*Client
+	// TTL is the lifetime of issued tokens, MaxDepth the longest act chain.
+	TTL      time.Duration
+	MaxDepth int
+}
+
+func NewPolicy(clients []*Client, ttl time.Duration, maxDepth int) (*Policy, error) {
+	p := &Policy{clients: map[string]*Client{}, TTL: ttl, MaxDepth: maxDepth}
+	for _, c := range clients {
+		if c.ID == "" || len(c.SecretSHA256) != sha256.Size*2 {
+			return nil, fmt.Errorf("token exchange client %q needs an id and a secret_sha256", c.ID)
+		}
+		if _, ok := p.clients[c.ID]; ok {
+			return nil, fmt.Errorf("token exchange client %q is listed twice", c.ID)
+		}
+		p.clients[c.ID] = c
+	}
+	return p, nil
+}
+
+// FromConfig loads the clients of TOKEN_EXCHANGE_CLIENTS_FILE. Token
+// exchange is refused to everyone while it is empty.
+func FromConfig(cfg config.OAuthConfig) (*Policy, error) {
+	var clients []*Client
+	if cfg.TOKEN_EXCHANGE_CLIENTS_FILE != "" {
+		var err error
+		if clients, err = LoadClients(cfg.TOKEN_EXCHANGE_CLIENTS_FILE); err != nil {
+			return nil, err
+		}
+	}
+	return NewPolicy(clients, cfg.TOKEN_EXCHANGE_TTL, cfg.TOKEN_EXCHANGE_MAX_DEPTH)
+}
+
+// LoadClients reads a YAML file like
+//
+//	clients:
+//	  - id: itinerary
+//	    secret_sha256: 5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8
+//	    audiences: [story, media]
+//	    scopes: [stories.read]
+//	    ttl: 2m
+func LoadClients(path string) ([]*Client, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Clients []*Client `yaml:"clients"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file.Clients, nil
+}
+
+// Authenticate returns the client with the given credentials.
+func (p *Policy) Authenticate(id, secret string) (*Client, error) {
+	c, ok := p.clients[id]
+	sum := sha256.Sum256([]byte(secret))
+	if !ok || subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(c.SecretSHA256))) != 1 {
+		return nil, errorf("invalid_client", "client authentication failed")
+	}
+	return c, nil
+}
+
+// Exchange decides whether client may act for the subject towards
+// audience. The issued token is meant for audience alone, carries at most
+// the requested scope, or the default scope when none is requested, and
+// records the client in front of the act chain of
+// the subject token. It never outlives the subject token.
+func (p *Policy) Exchange(client *Client, subject Subject, audience, scope string, now time.Time) (*Grant, error) {
+	if audience == "" {
+		return nil, errorf("invalid_request", "audience is required")
+	}
+	if !contains(client.Audiences, audience) {
+		return nil, errorf("invalid_target", "client may not get tokens for %s", audience)
+	}
+	// A token obtained by exchange may only be exchanged again by the
+	// service it was issued for.
+	if len(subject.Audience) > 0 && !contains(subject.Audience, client.ID) {
+		return nil, errorf("invalid_grant", "subject token is not meant for the client")
+	}
+	if depth(subject.Act)+1 > p.MaxDepth {
+		return nil, errorf("invalid_grant", "delegation chain is too long")
+	}
+
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		scopes = defaultScopes(client, subject)
+		if len(scopes) == 0 && subject.Scope != "" {
+			return nil, errorf("invalid_scope", "client may not carry any scope of the subject token")
+		}
+	}
+	for _, s := range scopes {
+		if !contains(client.Scopes, s) {
+			return nil, errorf("invalid_scope", "client may not request %s", s)
+		}
+		if subject.Scope != "" && !contains(strings.Fields(subject.Scope), s) {
+			return nil, errorf("invalid_scope", "subject token does not carry %s", s)
+		}
+	}
+
+	ttl := p.TTL
+	if client.TTL > 0 && client.TTL < ttl {
+		ttl = client.TTL
+	}
+	expires := now.Add(ttl)
+	if !subject.ExpiresAt.IsZero() && subject.ExpiresAt.Before(expires) {
+		expires = subject.ExpiresAt
+	}
+
+	act := map[string]interface{}{"sub": client.ID}
+	if subject.Act != nil {
+		act["act"] = subject.Act
+	}
+	return &Grant{
+		UserID:    subject.UserID,
+		ClientID:  client.ID,
+		Audience:  audience,
+		Scope:     strings.Join(scopes, " "),
+		Act:       act,
+		ExpiresAt: expires,
+	}, nil
+}
+
+// defaultScopes is the scope of a token requested without one: the scopes
+// of the subject token that the client may request, or all the client may
+// request when the subject token is not limited. An empty scope would lift
+// the limits of the subject token.
+func defaultScopes(client *Client, subject Subject) []string {
+	if subject.Scope == "" {
+		return append([]string(nil), client.Scopes...)
+	}
+	var scopes []string
+	for _, s := range strings.Fields(subject.Scope) {
+		if contains(client.Scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// depth is the number of actors in an act chain.
+func depth(act map[string]interface{}) int {
+	n := 0
+	for act != nil {
+		n++
+		act, _ = act["act"].(map[string]interface{})
+	}
+	return n
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
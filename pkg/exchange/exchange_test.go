@@ -0,0 +1,121 @@
+package exchange
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestPolicy(t *testing.T) *Policy {
+	sum := sha256.Sum256([]byte("s3cret"))
+	secret := hex.EncodeToString(sum[:])
+	p, err := NewPolicy([]*Client{
+		{ID: "itinerary", SecretSHA256: secret, Audiences: []string{"story"}, Scopes: []string{"stories.read", "stories.write"}},
+		{ID: "story", SecretSHA256: secret, Audiences: []string{"media"}, Scopes: []string{"stories.read"}, TTL: time.Minute},
+	}, 5*time.Minute, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func code(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+func TestExchange(t *testing.T) {
+	p := newTestPolicy(t)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	if _, err := p.Authenticate("itinerary", "wrong"); code(err) != "invalid_client" {
+		t.Fatalf("Authenticate with a wrong secret = %v", err)
+	}
+	itinerary, err := p.Authenticate("itinerary", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	story, _ := p.Authenticate("story", "s3cret")
+
+	user := Subject{UserID: "u1", ExpiresAt: now.Add(30 * time.Minute)}
+	g, err := p.Exchange(itinerary, user, "story", "stories.read", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Audience != "story" || g.Scope != "stories.read" || g.Act["sub"] != "itinerary" || !g.ExpiresAt.Equal(now.Add(5*time.Minute)) {
+		t.Errorf("Exchange = %+v", g)
+	}
+
+	// The story service passes the call on to the media service.
+	delegated := Subject{UserID: "u1", Audience: []string{g.Audience}, Scope: g.Scope, Act: g.Act, ExpiresAt: g.ExpiresAt}
+	g2, err := p.Exchange(story, delegated, "media", "stories.read", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, _ := g2.Act["act"].(map[string]interface{})
+	if g2.Act["sub"] != "story" || inner["sub"] != "itinerary" || !g2.ExpiresAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Exchange of a delegated token = %+v", g2)
+	}
+
+	for name, tt := range map[string]struct {
+		client   *Client
+		subject  Subject
+		audience string
+		scope    string
+		code     string
+	}{
+		"no audience":          {itinerary, user, "", "", "invalid_request"},
+		"audience not allowed": {itinerary, user, "media", "", "invalid_target"},
+		"scope not allowed":    {story, delegated, "media", "stories.write", "invalid_scope"},
+		"scope not granted":    {itinerary, Subject{UserID: "u1", Scope: "stories.read", Audience: []string{"itinerary"}}, "story", "stories.write", "invalid_scope"},
+		"token for another":    {itinerary, delegated, "story", "", "invalid_grant"},
+		"chain too long":       {story, Subject{UserID: "u1", Audience: []string{"story"}, Act: g2.Act}, "media", "", "invalid_grant"},
+	} {
+		if _, err := p.Exchange(tt.client, tt.subject, tt.audience, tt.scope, now); code(err) != tt.code {
+			t.Errorf("%s: Exchange = %v, want %s", name, err, tt.code)
+		}
+	}
+}
+
+func TestExchangeDefaultScope(t *testing.T) {
+	p := newTestPolicy(t)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	itinerary, _ := p.Authenticate("itinerary", "s3cret")
+	story, _ := p.Authenticate("story", "s3cret")
+
+	for name, tt := range map[string]struct {
+		client  *Client
+		subject Subject
+		want    string
+	}{
+		"unlimited subject":  {itinerary, Subject{UserID: "u1"}, "stories.read stories.write"},
+		"limited subject":    {itinerary, Subject{UserID: "u1", Scope: "stories.write profile"}, "stories.write"},
+		"delegated subject":  {story, Subject{UserID: "u1", Audience: []string{"story"}, Scope: "stories.read"}, "stories.read"},
+		"narrowed by client": {story, Subject{UserID: "u1", Audience: []string{"story"}, Scope: "stories.read stories.write"}, "stories.read"},
+	} {
+		audience := "story"
+		if tt.client == story {
+			audience = "media"
+		}
+		g, err := p.Exchange(tt.client, tt.subject, audience, "", now)
+		if err != nil {
+			t.Errorf("%s: Exchange = %v", name, err)
+			continue
+		}
+		if g.Scope != tt.want {
+			t.Errorf("%s: scope = %q, want %q", name, g.Scope, tt.want)
+		}
+	}
+
+	// Nothing the subject token carries is left for the client; the token
+	// must not come out unlimited.
+	subject := Subject{UserID: "u1", Audience: []string{"story"}, Scope: "stories.write"}
+	if _, err := p.Exchange(story, subject, "media", "", now); code(err) != "invalid_scope" {
+		t.Errorf("Exchange without a common scope = %v, want invalid_scope", err)
+	}
+}
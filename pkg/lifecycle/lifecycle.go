@@ -0,0 +1,159 @@
+// Package lifecycle runs the servers of the process and stops them in
+// order when it is asked to terminate, so that a rollout does not drop the
+// requests in flight.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Manager runs servers until the context of Run is done or one of them
+// fails, then reports itself not ready, waits for load balancers to notice
+// and runs the shutdown hooks.
+type Manager struct {
+	// Timeout bounds the whole shutdown, hooks included.
+	Timeout time.Duration
+	// DrainDelay is how long the process keeps serving while not ready,
+	// for the orchestrator to take it out of rotation.
+	DrainDelay time.Duration
+	Log        *slog.Logger
+
+	ready  atomic.Bool
+	drains []func()
+	hooks  []hook
+}
+
+type hook struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+func New(timeout, drainDelay time.Duration, log *slog.Logger) *Manager {
+	return &Manager{Timeout: timeout, DrainDelay: drainDelay, Log: log}
+}
+
+// Ready tells whether the process takes new traffic: from the start of Run
+// until the shutdown begins.
+func (m *Manager) Ready() bool {
+	return m.ready.Load()
+}
+
+// OnDrain adds a function called as soon as the process stops being
+// ready, for readiness reported elsewhere than through Ready.
+func (m *Manager) OnDrain(drain func()) {
+	m.drains = append(m.drains, drain)
+}
+
+// OnShutdown adds a hook. Hooks run one after another in the order they
+// were added, sharing what is left of the timeout.
+func (m *Manager) OnShutdown(name string, stop func(ctx context.Context) error) {
+	m.hooks = append(m.hooks, hook{name: name, stop: stop})
+}
+
+// Run starts every serve function and blocks until ctx is done or one of
+// them returns, then shuts down. It returns the error that ended a server,
+// or else the first error of a hook.
+func (m *Manager) Run(ctx context.Context, serve ...func() error) error {
+	failed := make(chan error, len(serve))
+	for _, s := range serve {
+		go func(s func() error) {
+			failed <- s()
+		}(s)
+	}
+	m.ready.Store(true)
+
+	var cause error
+	select {
+	case <-ctx.Done():
+		m.Log.Info("shutdown started")
+		m.drain()
+		select {
+		case <-time.After(m.DrainDelay):
+		case cause = <-failed:
+		}
+	case cause = <-failed:
+		m.drain()
+		m.Log.Error("server stopped, shutting down", "error", cause)
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	defer cancel()
+	var first error
+	for _, h := range m.hooks {
+		if err := h.stop(stopCtx); err != nil {
+			m.Log.Error("shutdown hook failed", "hook", h.name, "error", err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	m.Log.Info("shutdown finished")
+	if cause != nil {
+		return cause
+	}
+	return first
+}
+
+func (m *Manager) drain() {
+	m.ready.Store(false)
+	for _, d := range m.drains {
+		d()
+	}
+}
+
+// ServeHTTP is a serve function for an HTTP server that does not count the
+// closing of the server as a failure.
+func ServeHTTP(s *http.Server) func() error {
+	return func() error {
+		if err := s.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
+
+// Go runs job in the background and returns the shutdown hook that stops
+// it: the hook cancels the context of job and waits for it to return.
+func Go(job func(ctx context.Context)) func(ctx context.Context) error {
+	jobCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		job(jobCtx)
+	}()
+	return func(ctx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// StopGRPC stops a gRPC server gracefully, waiting for the calls in flight
+// until ctx is done and then cutting them off.
+func StopGRPC(s *grpc.Server) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			s.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			s.Stop()
+			return ctx.Err()
+		}
+	}
+}
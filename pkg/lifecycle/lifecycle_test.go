@@ -0,0 +1,89 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	m := New(time.Second, 10*time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	stop := make(chan struct{})
+	var order []string
+	var readyDuringHooks, drained bool
+	m.OnDrain(func() { drained = true })
+	m.OnShutdown("http", func(ctx context.Context) error {
+		readyDuringHooks = m.Ready()
+		order = append(order, "http")
+		close(stop)
+		return nil
+	})
+	m.OnShutdown("db", func(ctx context.Context) error {
+		order = append(order, "db")
+		return errors.New("close failed")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- m.Run(ctx, func() error {
+			<-stop
+			return nil
+		})
+	}()
+	for !m.Ready() {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	if err := <-done; err == nil || err.Error() != "close failed" {
+		t.Errorf("Run = %v, want the error of the hook", err)
+	}
+	if !reflect.DeepEqual(order, []string{"http", "db"}) {
+		t.Errorf("hooks ran in order %v", order)
+	}
+	if readyDuringHooks || m.Ready() || !drained {
+		t.Error("ready while shutting down")
+	}
+}
+
+func TestRunServerFails(t *testing.T) {
+	m := New(time.Second, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	stopped := false
+	m.OnShutdown("db", func(ctx context.Context) error {
+		stopped = true
+		return nil
+	})
+	failure := errors.New("address in use")
+	err := m.Run(context.Background(), func() error { return failure })
+	if !errors.Is(err, failure) || !stopped {
+		t.Errorf("Run = %v, hooks run: %v", err, stopped)
+	}
+}
+
+func TestGo(t *testing.T) {
+	stopped := make(chan struct{})
+	stop := Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+	if err := stop(context.Background()); err != nil {
+		t.Fatalf("stop = %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("stop returned before the job")
+	}
+
+	stuck := Go(func(ctx context.Context) { select {} })
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := stuck(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("stop of a stuck job = %v", err)
+	}
+}
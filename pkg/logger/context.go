@@ -0,0 +1,105 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDHeader carries the ID of a request to and from the gateway and
+// RequestIDMetadata from the gateway to the gRPC server.
+const (
+	RequestIDHeader   = "X-Request-ID"
+	RequestIDMetadata = "x-request-id"
+)
+
+type (
+	loggerKey    struct{}
+	requestIDKey struct{}
+)
+
+// validRequestID keeps IDs sent by clients from flooding or forging log
+// lines.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// ValidRequestID tells whether an ID received from a caller may be used.
+func ValidRequestID(id string) bool {
+	return validRequestID.MatchString(id)
+}
+
+// WithRequest returns a context carrying the ID of the request and the
+// logger of the request, which is l with the ID and args added.
+func WithRequest(ctx context.Context, l *slog.Logger, id string, args ...interface{}) context.Context {
+	l = l.With(append([]interface{}{"request_id", id}, args...)...)
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// With adds attributes to the logger of the request, such as the user
+// once they are known.
+func With(ctx context.Context, args ...interface{}) context.Context {
+	l, ok := ctx.Value(loggerKey{}).(*slog.Logger)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, loggerKey{}, l.With(args...))
+}
+
+// FromContext returns the logger of the request, or fallback outside of
+// one.
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return fallback
+}
+
+// RequestID returns the ID of the request, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// UnaryServerInterceptor gives every RPC a logger carrying the request ID
+// sent by the gateway, or a new one, and logs the outcome and latency of
+// the RPC.
+func UnaryServerInterceptor(base *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		id := ""
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(RequestIDMetadata); len(values) > 0 && ValidRequestID(values[0]) {
+				id = values[0]
+			}
+		}
+		if id == "" {
+			id = NewRequestID()
+		}
+		ctx = WithRequest(ctx, base, id, "rpc", info.FullMethod)
+		start := time.Now()
+		res, err := handler(ctx, req)
+
+		level := slog.LevelInfo
+		switch status.Code(err) {
+		case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss:
+			level = slog.LevelError
+		}
+		FromContext(ctx, base).Log(ctx, level, "rpc finished", "code", status.Code(err).String(), "latency", time.Since(start))
+		return res, err
+	}
+}
@@ -1,21 +1,49 @@
+// Package logger builds the structured logger of the service and carries
+// a request-scoped logger, with the ID of the request, through contexts
+// and over gRPC metadata.
 package logger
 
 import (
-	"log"
+	"auth/config"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
+
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-func NewLogger() *slog.Logger {
+// NewLogger writes to stdout, stderr or a file rotated by size. Secrets
+// and email addresses are redacted from every record.
+func NewLogger(cfg config.LogConfig) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LOG_LEVEL)); err != nil {
+		return nil, err
+	}
 	opts := &slog.HandlerOptions{
-		Level: slog.LevelDebug,
+		Level:       level,
+		ReplaceAttr: redact,
 	}
 
-	file, err := os.OpenFile("app.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatalf("error while opening file : %v", err)
+	var out io.Writer
+	switch strings.ToLower(cfg.LOG_FILE) {
+	case "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		// lumberjack creates the file readable by its owner only.
+		out = &lumberjack.Logger{
+			Filename:   cfg.LOG_FILE,
+			MaxSize:    cfg.LOG_MAX_SIZE_MB,
+			MaxBackups: cfg.LOG_MAX_BACKUPS,
+			MaxAge:     cfg.LOG_MAX_AGE_DAYS,
+			Compress:   cfg.LOG_COMPRESS,
+		}
 	}
 
-	logger := slog.New(slog.NewTextHandler(file, opts))
-	return logger
+	if cfg.LOG_FORMAT == "json" {
+		return slog.New(slog.NewJSONHandler(out, opts)), nil
+	}
+	return slog.New(slog.NewTextHandler(out, opts)), nil
 }
@@ -0,0 +1,103 @@
+package logger
+
+import (
+	"auth/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRedact(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{ReplaceAttr: redact}))
+	log.Info("Login or password is incorrect for jdoe@example.com",
+		"password", "hunter2",
+		"refresh_token", "abc",
+		"login", "jane.doe@mail.example.org",
+		"body", "Confirm at https://tt.example/api/v1/users/email/confirm?token=s3cr3t&x=1",
+		"error", errors.New("token eyJhbGciOi.eyJ1c2VyX2lkIjoi.c2lnbmF0dXJl is expired"),
+		"user_id", "u1",
+	)
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"msg":           "Login or password is incorrect for j***@example.com",
+		"password":      redacted,
+		"refresh_token": redacted,
+		"login":         "j***@mail.example.org",
+		"body":          "Confirm at https://tt.example/api/v1/users/email/confirm?token=[REDACTED]&x=1",
+		"error":         "token [REDACTED] is expired",
+		"user_id":       "u1",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestNewLoggerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.log")
+	log, err := NewLogger(config.LogConfig{LOG_LEVEL: "warn", LOG_FORMAT: "json", LOG_FILE: path, LOG_MAX_SIZE_MB: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Info("left out")
+	log.Warn("kept")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "left out") || !strings.Contains(string(data), "kept") {
+		t.Errorf("log = %s", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm()&0077 != 0 {
+		t.Errorf("log file mode = %v, want it private", info.Mode().Perm())
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.New(slog.NewJSONHandler(&buf, nil))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDMetadata, "req-42"))
+	intercept := UnaryServerInterceptor(base)
+	var inner string
+	_, err := intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/user.User/Login"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		inner = RequestID(ctx)
+		FromContext(ctx, base).Info("Login rpc method started")
+		return nil, nil
+	})
+	if err != nil || inner != "req-42" {
+		t.Fatalf("request ID in the RPC = %q, %v", inner, err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("log = %s", buf.String())
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, `"request_id":"req-42"`) || !strings.Contains(line, `"rpc":"/user.User/Login"`) {
+			t.Errorf("line lacks the request: %s", line)
+		}
+	}
+
+	// IDs that could forge log lines are replaced.
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDMetadata, "x\n{\"level\":\"ERROR\"}"))
+	intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/user.User/Login"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		inner = RequestID(ctx)
+		return nil, nil
+	})
+	if !ValidRequestID(inner) || strings.Contains(inner, "{") {
+		t.Errorf("request ID = %q", inner)
+	}
+}
@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	// secretKey matches the keys of attributes whose values are never
+	// logged.
+	secretKey = regexp.MustCompile(`(?i)(password|passwd|secret|token|authorization|cookie|otp|api_key|code_verifier|assertion)`)
+	email     = regexp.MustCompile(`([A-Za-z0-9._%+-])[A-Za-z0-9._%+-]*@([A-Za-z0-9.-]+\.[A-Za-z]{2,})`)
+	// secretValue matches tokens that show up in free text: JWTs, PASETOs
+	// and secrets in the query of links.
+	secretValue = regexp.MustCompile(`eyJ[\w-]*\.[\w-]+\.[\w-]+|v4\.public\.[\w-]+(\.[\w-]+)?`)
+	secretParam = regexp.MustCompile(`(?i)\b(token|code|secret|password)=[^&\s"']+`)
+)
+
+// redact is the ReplaceAttr of the handlers. It drops the values of secret
+// attributes and masks emails and tokens anywhere else, the message
+// included.
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if secretKey.MatchString(a.Key) && a.Value.Kind() != slog.KindGroup {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return a
+}
+
+// Redact masks the emails and secrets in s: jdoe@example.com becomes
+// j***@example.com.
+func Redact(s string) string {
+	if !strings.ContainsAny(s, "@.=") {
+		return s
+	}
+	s = secretValue.ReplaceAllString(s, redacted)
+	s = secretParam.ReplaceAllString(s, "$1="+redacted)
+	return email.ReplaceAllString(s, "$1***@$2")
+}
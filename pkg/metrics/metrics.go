@@ -0,0 +1,178 @@
+// Package metrics exposes Prometheus metrics: requests to the gateway and
+// the gRPC server, the database pool and the events of the service, such
+// as failed logins and lockouts, that are worth alerting on.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Outcomes of logins and token refreshes.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeLocked  = "locked"
+	OutcomeError   = "error"
+)
+
+// Metrics holds the collectors of the process. A nil Metrics records
+// nothing, so code paths do not have to check whether metrics are on.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	httpInFlight prometheus.Gauge
+
+	grpcRequests *prometheus.CounterVec
+	grpcDuration *prometheus.HistogramVec
+	grpcInFlight prometheus.Gauge
+
+	logins        *prometheus.CounterVec
+	registrations prometheus.Counter
+	refreshes     *prometheus.CounterVec
+	revocations   *prometheus.CounterVec
+	lockouts      *prometheus.CounterVec
+}
+
+// New registers the collectors, those of the Go runtime, the process and,
+// when db is not nil, its connection pool.
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests to the gateway by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Latency of HTTP requests to the gateway by method and route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		httpInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests being served by the gateway.",
+		}),
+		grpcRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "RPCs completed by the User server by method and status code.",
+		}, []string{"method", "code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Latency of RPCs to the User server by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+		grpcInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "grpc_server_in_flight",
+			Help: "RPCs being served by the User server.",
+		}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_logins_total",
+			Help: "Login attempts by outcome: success, failure, locked or error.",
+		}, []string{"outcome"}),
+		registrations: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "auth_registrations_total",
+			Help: "Accounts registered.",
+		}),
+		refreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_token_refreshes_total",
+			Help: "Refresh token uses by outcome.",
+		}, []string{"outcome"}),
+		revocations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_token_revocations_total",
+			Help: "Revocations of the tokens of a user or of a SCIM token, by reason.",
+		}, []string{"reason"}),
+		lockouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_lockouts_total",
+			Help: "Lockouts after failed logins, of an account or of an address.",
+		}, []string{"scope"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests, m.httpDuration, m.httpInFlight,
+		m.grpcRequests, m.grpcDuration, m.grpcInFlight,
+		m.logins, m.registrations, m.refreshes, m.revocations, m.lockouts,
+	)
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db, "user_service"))
+	}
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// StartHTTP counts a request to the gateway as in flight; the returned
+// function records it once it is answered. route is the route pattern, not
+// the path, to keep the number of series bounded.
+func (m *Metrics) StartHTTP() func(method, route string, code int) {
+	if m == nil {
+		return func(string, string, int) {}
+	}
+	start := time.Now()
+	m.httpInFlight.Inc()
+	return func(method, route string, code int) {
+		m.httpInFlight.Dec()
+		m.httpRequests.WithLabelValues(method, route, strconv.Itoa(code)).Inc()
+		m.httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// UnaryServerInterceptor records the RPCs of a gRPC server.
+func UnaryServerInterceptor(m *Metrics) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if m == nil {
+			return handler(ctx, req)
+		}
+		start := time.Now()
+		m.grpcInFlight.Inc()
+		defer m.grpcInFlight.Dec()
+		res, err := handler(ctx, req)
+		m.grpcRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+		m.grpcDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+		return res, err
+	}
+}
+
+func (m *Metrics) Login(outcome string) {
+	if m != nil {
+		m.logins.WithLabelValues(outcome).Inc()
+	}
+}
+
+func (m *Metrics) Registration() {
+	if m != nil {
+		m.registrations.Inc()
+	}
+}
+
+func (m *Metrics) TokenRefresh(outcome string) {
+	if m != nil {
+		m.refreshes.WithLabelValues(outcome).Inc()
+	}
+}
+
+func (m *Metrics) Revocation(reason string) {
+	if m != nil {
+		m.revocations.WithLabelValues(reason).Inc()
+	}
+}
+
+func (m *Metrics) Lockout(scope string) {
+	if m != nil {
+		m.lockouts.WithLabelValues(scope).Inc()
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New(nil)
+	m.Login(OutcomeFailure)
+	m.Login(OutcomeFailure)
+	m.Login(OutcomeSuccess)
+	m.Lockout("user")
+	if got := testutil.ToFloat64(m.logins.WithLabelValues(OutcomeFailure)); got != 2 {
+		t.Errorf("failed logins = %v", got)
+	}
+
+	done := m.StartHTTP()
+	if got := testutil.ToFloat64(m.httpInFlight); got != 1 {
+		t.Errorf("in flight = %v", got)
+	}
+	done("POST", "/api/v1/auth/login", 401)
+	if got := testutil.ToFloat64(m.httpRequests.WithLabelValues("POST", "/api/v1/auth/login", "401")); got != 1 || testutil.ToFloat64(m.httpInFlight) != 0 {
+		t.Errorf("requests = %v", got)
+	}
+
+	intercept := UnaryServerInterceptor(m)
+	info := &grpc.UnaryServerInfo{FullMethod: "/user.User/Login"}
+	intercept(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Unauthenticated, "no")
+	})
+	if got := testutil.ToFloat64(m.grpcRequests.WithLabelValues("/user.User/Login", "Unauthenticated")); got != 1 {
+		t.Errorf("RPCs = %v", got)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `auth_logins_total{outcome="failure"} 2`) || !strings.Contains(body, "auth_lockouts_total") {
+		t.Errorf("exposition lacks the counters:\n%s", body)
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.Login(OutcomeSuccess)
+	m.Registration()
+	m.TokenRefresh(OutcomeSuccess)
+	m.Revocation("email_change")
+	m.Lockout("ip")
+	m.StartHTTP()("GET", "/", 200)
+	res, err := UnaryServerInterceptor(m)(context.Background(), "req", &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return req, nil
+	})
+	if res != "req" || err != nil {
+		t.Errorf("interceptor = %v, %v", res, err)
+	}
+}
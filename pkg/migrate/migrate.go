@@ -0,0 +1,357 @@
+// Package migrate applies SQL migrations to Postgres. Migrations are pairs
+// of files named 000001_name.up.sql and 000001_name.down.sql. The versions
+// applied are kept in a table, and an advisory lock keeps two processes,
+// such as replicas starting together, from migrating at the same time.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Migration is one version of the schema.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status tells whether a migration is applied. Applied versions the binary
+// does not know of have no Name.
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+var (
+	fileName   = regexp.MustCompile(`^(\d+)_([A-Za-z0-9_]+)\.(up|down)\.sql$`)
+	identifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+)
+
+// Load reads the migrations in the root of fsys, in order of version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m := fileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("%s: not a migration file", e.Name())
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("%s: invalid version", e.Name())
+		}
+		data, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("version %d is used by %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(data)
+		} else {
+			mig.Down = string(data)
+		}
+	}
+
+	res := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("version %d (%s) has no up migration", m.Version, m.Name)
+		}
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, nil
+}
+
+type Migrator struct {
+	DB *sql.DB
+	// Table keeps the versions applied; each set of migrations has its
+	// own.
+	Table      string
+	Migrations []Migration
+	Log        *slog.Logger
+}
+
+func New(db *sql.DB, fsys fs.FS, table string, log *slog.Logger) (*Migrator, error) {
+	if !identifier.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Table: table, Migrations: migrations, Log: log}, nil
+}
+
+// Latest is the version of the last migration, 0 when there is none.
+func (m *Migrator) Latest() int64 {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Up applies the migrations not applied yet.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the last steps migrations applied.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	if steps <= 0 {
+		return errors.New("the number of migrations to roll back has to be positive")
+	}
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := sortedVersions(applied)
+		target := int64(0)
+		if steps < len(versions) {
+			target = versions[len(versions)-1-steps]
+		}
+		todo, err := plan(m.Migrations, applied, target)
+		if err != nil {
+			return err
+		}
+		// Down only rolls back, even when older migrations are missing.
+		var down []step
+		for _, s := range todo {
+			if s.down {
+				down = append(down, s)
+			}
+		}
+		return m.migrate(ctx, conn, down)
+	})
+}
+
+// To applies or rolls back migrations until the schema is at version:
+// every migration up to it applied, and none after it.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version < 0 {
+		return errors.New("version cannot be negative")
+	}
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		todo, err := plan(m.Migrations, applied, version)
+		if err != nil {
+			return err
+		}
+		return m.migrate(ctx, conn, todo)
+	})
+}
+
+// Baseline records the migrations up to version as applied without
+// running them, for databases that were migrated by hand before.
+func (m *Migrator) Baseline(ctx context.Context, version int64) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.Migrations {
+			if mig.Version > version {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if _, err := conn.ExecContext(ctx, "INSERT INTO "+m.Table+" (version, name) VALUES ($1, $2)", mig.Version, mig.Name); err != nil {
+				return err
+			}
+			m.Log.Info("migration marked as applied", "version", mig.Version, "name", mig.Name)
+		}
+		return nil
+	})
+}
+
+// Status lists the migrations the binary knows of and any other version
+// applied, in order of version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var res []Status
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		known := map[int64]bool{}
+		for _, mig := range m.Migrations {
+			known[mig.Version] = true
+			at, ok := applied[mig.Version]
+			res = append(res, Status{Version: mig.Version, Name: mig.Name, Applied: ok, AppliedAt: at})
+		}
+		for v, at := range applied {
+			if !known[v] {
+				res = append(res, Status{Version: v, Applied: true, AppliedAt: at})
+			}
+		}
+		return nil
+	})
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, err
+}
+
+// step is a migration to apply, or to roll back when down is set.
+type step struct {
+	Migration
+	down bool
+}
+
+// plan lists the steps that bring the applied versions to target: the
+// migrations after it rolled back, newest first, then those up to it
+// applied, oldest first.
+func plan(migrations []Migration, applied map[int64]time.Time, target int64) ([]step, error) {
+	known := map[int64]Migration{}
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+	if _, ok := known[target]; !ok && target != 0 {
+		return nil, fmt.Errorf("unknown version %d", target)
+	}
+
+	var steps []step
+	versions := sortedVersions(applied)
+	for i := len(versions) - 1; i >= 0 && versions[i] > target; i-- {
+		m, ok := known[versions[i]]
+		if !ok {
+			return nil, fmt.Errorf("version %d is applied but unknown to this binary", versions[i])
+		}
+		if m.Down == "" {
+			return nil, fmt.Errorf("version %d (%s) cannot be rolled back", m.Version, m.Name)
+		}
+		steps = append(steps, step{Migration: m, down: true})
+	}
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok && m.Version <= target {
+			steps = append(steps, step{Migration: m})
+		}
+	}
+	return steps, nil
+}
+
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, steps []step) error {
+	if len(steps) == 0 {
+		m.Log.Info("nothing to migrate", "table", m.Table)
+		return nil
+	}
+	for _, s := range steps {
+		start := time.Now()
+		if err := m.run(ctx, conn, s); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", s.Version, s.Name, err)
+		}
+		direction := "up"
+		if s.down {
+			direction = "down"
+		}
+		m.Log.Info("migration done", "version", s.Version, "name", s.Name, "direction", direction, "duration", time.Since(start))
+	}
+	return nil
+}
+
+// run applies or rolls back one migration together with its version row,
+// so that a failed migration leaves nothing behind.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, s step) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script, record := s.Up, "INSERT INTO "+m.Table+" (version, name) VALUES ($1, $2)"
+	args := []interface{}{s.Version, s.Name}
+	if s.down {
+		script, record = s.Down, "DELETE FROM "+m.Table+" WHERE version = $1"
+		args = args[:1]
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// locked runs f on a connection holding the advisory lock of the table,
+// which it creates if need be. The lock is taken on the session, so
+// everything has to go through that connection.
+func (m *Migrator) locked(ctx context.Context, f func(conn *sql.Conn) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", m.Table); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock(hashtext($1))", m.Table)
+
+	_, err = conn.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS `+m.Table+` (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+	return f(conn)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM "+m.Table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := map[int64]time.Time{}
+	for rows.Next() {
+		var (
+			v  int64
+			at time.Time
+		)
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		res[v] = at
+	}
+	return res, rows.Err()
+}
+
+func sortedVersions(applied map[int64]time.Time) []int64 {
+	versions := make([]int64, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
@@ -0,0 +1,109 @@
+package migrate
+
+import (
+	"auth/migrations"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000002_more.up.sql":      {Data: []byte("CREATE TABLE b ();")},
+		"000002_more.down.sql":    {Data: []byte("DROP TABLE b;")},
+		"000001_init.up.sql":      {Data: []byte("CREATE TABLE a ();")},
+		"foreign/000001_x.up.sql": {Data: []byte("-")},
+	}
+	got, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Migration{
+		{Version: 1, Name: "init", Up: "CREATE TABLE a ();"},
+		{Version: 2, Name: "more", Up: "CREATE TABLE b ();", Down: "DROP TABLE b;"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load = %+v", got)
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"stray file":     {"README.md": {}},
+		"no up":          {"000001_init.down.sql": {Data: []byte("-")}},
+		"shared version": {"000001_a.up.sql": {Data: []byte("-")}, "000001_b.up.sql": {Data: []byte("-")}},
+		"version zero":   {"000000_init.up.sql": {Data: []byte("-")}},
+	} {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "a", Up: "-", Down: "-"},
+		{Version: 2, Name: "b", Up: "-", Down: "-"},
+		{Version: 3, Name: "c", Up: "-"},
+	}
+	applied := func(versions ...int64) map[int64]time.Time {
+		res := map[int64]time.Time{}
+		for _, v := range versions {
+			res[v] = time.Now()
+		}
+		return res
+	}
+	type move struct {
+		version int64
+		down    bool
+	}
+	moves := func(steps []step) []move {
+		res := []move{}
+		for _, s := range steps {
+			res = append(res, move{s.Version, s.down})
+		}
+		return res
+	}
+
+	steps, err := plan(migrations, applied(1), 3)
+	if err != nil || !reflect.DeepEqual(moves(steps), []move{{2, false}, {3, false}}) {
+		t.Errorf("up = %v, %v", moves(steps), err)
+	}
+	steps, err = plan(migrations, applied(1, 2), 0)
+	if err != nil || !reflect.DeepEqual(moves(steps), []move{{2, true}, {1, true}}) {
+		t.Errorf("down to 0 = %v, %v", moves(steps), err)
+	}
+	// A gap below the target is filled.
+	steps, err = plan(migrations, applied(2), 2)
+	if err != nil || !reflect.DeepEqual(moves(steps), []move{{1, false}}) {
+		t.Errorf("gap = %v, %v", moves(steps), err)
+	}
+
+	if _, err := plan(migrations, applied(1, 2, 3), 1); err == nil || !strings.Contains(err.Error(), "cannot be rolled back") {
+		t.Errorf("rolling back a migration without down: %v", err)
+	}
+	if _, err := plan(migrations, applied(1, 7), 1); err == nil {
+		t.Error("rolled back a version the binary does not know")
+	}
+	if _, err := plan(migrations, applied(), 5); err == nil {
+		t.Error("migrated to an unknown version")
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	auth, err := Load(migrations.Auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range auth {
+		if m.Version != int64(i+1) || m.Down == "" {
+			t.Errorf("migration %d (%s) is out of sequence or has no down", m.Version, m.Name)
+		}
+		if strings.Contains(m.Up, "stories") && m.Version == 1 {
+			t.Error("the schema of the service creates the tables of others")
+		}
+	}
+	if _, err := Load(migrations.Foreign); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,66 @@
+package notifier
+
+import (
+	"auth/config"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Notifier delivers a message to the owner of an email address.
+type Notifier interface {
+	Notify(ctx context.Context, to, subject, body string) error
+}
+
+// NewNotifier sends mail through SMTP when a host is configured and falls
+// back to writing the message to the log otherwise.
+func NewNotifier(cfg config.SMTPConfig, log *slog.Logger) Notifier {
+	if cfg.SMTP_HOST == "" {
+		return &LogNotifier{Log: log}
+	}
+	return &SMTPNotifier{cfg: cfg}
+}
+
+// LockoutMessage tells a user that their account was locked until the
+// given time after failed sign-ins from ip.
+func LockoutMessage(username, ip string, until time.Time) (subject, body string) {
+	body = fmt.Sprintf("Hi %s,\n\nyour account was locked until %s after too many failed sign-in attempts from %s.\n"+
+		"If this wasn't you, consider changing your password once the lock expires.",
+		username, until.UTC().Format(time.RFC1123), ip)
+	return "Your account has been locked", body
+}
+
+type LogNotifier struct {
+	Log *slog.Logger
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, to, subject, body string) error {
+	n.Log.Info("notification", "to", to, "subject", subject, "body", body)
+	return nil
+}
+
+type SMTPNotifier struct {
+	cfg config.SMTPConfig
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, to, subject, body string) error {
+	var auth smtp.Auth
+	if n.cfg.SMTP_USER != "" {
+		auth = smtp.PlainAuth("", n.cfg.SMTP_USER, n.cfg.SMTP_PASSWORD, n.cfg.SMTP_HOST)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + n.cfg.SMTP_FROM,
+		"To: " + to,
+		"Subject: " + subject,
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	addr := fmt.Sprintf("%s:%s", n.cfg.SMTP_HOST, n.cfg.SMTP_PORT)
+	return smtp.SendMail(addr, auth, n.cfg.SMTP_FROM, []string{to}, []byte(msg))
+}
@@ -0,0 +1,46 @@
+package notifier
+
+import (
+	"auth/config"
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockoutMessage(t *testing.T) {
+	until := time.Date(2024, 5, 1, 10, 30, 0, 0, time.FixedZone("UZT", 5*60*60))
+	subject, body := LockoutMessage("alice", "203.0.113.7", until)
+	if subject != "Your account has been locked" {
+		t.Errorf("subject = %q", subject)
+	}
+	for _, want := range []string{"Hi alice,", "locked until Wed, 01 May 2024 05:30:00 UTC", "attempts from 203.0.113.7.", "changing your password"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body %q does not contain %q", body, want)
+		}
+	}
+}
+
+func TestNewNotifierWithoutSMTP(t *testing.T) {
+	var buf bytes.Buffer
+	n := NewNotifier(config.SMTPConfig{SMTP_PORT: "587"}, slog.New(slog.NewTextHandler(&buf, nil)))
+	if _, ok := n.(*LogNotifier); !ok {
+		t.Fatalf("NewNotifier without SMTP_HOST = %T, want *LogNotifier", n)
+	}
+	if err := n.Notify(context.Background(), "alice@example.com", "Hello", "line one"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"to=alice@example.com", "subject=Hello", `body="line one"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log %q does not contain %q", buf.String(), want)
+		}
+	}
+
+	if n := NewNotifier(config.SMTPConfig{SMTP_HOST: "smtp.example.com"}, nil); n == nil {
+		t.Fatal("NewNotifier with SMTP_HOST = nil")
+	} else if _, ok := n.(*SMTPNotifier); !ok {
+		t.Errorf("NewNotifier with SMTP_HOST = %T, want *SMTPNotifier", n)
+	}
+}
@@ -0,0 +1,36 @@
+package paseto
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// The v4.public vectors of the PASETO specification.
+func TestVectors(t *testing.T) {
+	seed, _ := hex.DecodeString("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a3774")
+	key := ed25519.NewKeyFromSeed(seed)
+	payload := `{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`
+	footer := `{"kid":"zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN"}`
+
+	tests := []struct {
+		name, footer, implicit, token string
+	}{
+		{"4-S-1", "", "", "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA"},
+		{"4-S-2", footer, "", "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9v3Jt8mx_TdM2ceTGoqwrh4yDFn0XsHvvV_D0DtwQxVrJEBMl0F2caAdgnpKlt4p7xBnx1HcO-SPo8FPp214HDw.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9"},
+		{"4-S-3", footer, `{"test-vector":"4-S-3"}`, "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9NPWciuD3d0o5eXJXG5pJy-DiVEoyPYWs1YSTwWHNJq6DZD3je5gf-0M4JR9ipdUSJbIovzmBECeaWmaqcaP0DQ.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9"},
+	}
+	for _, tt := range tests {
+		if got := Sign(key, []byte(payload), []byte(tt.footer), []byte(tt.implicit)); got != tt.token {
+			t.Errorf("%s: Sign = %s", tt.name, got)
+		}
+		message, err := VerifyFooter(key.Public().(ed25519.PublicKey), tt.token, []byte(tt.footer), []byte(tt.implicit))
+		if err != nil || string(message) != payload {
+			t.Errorf("%s: Verify = %s, %v", tt.name, message, err)
+		}
+		if _, _, err := Verify(key.Public().(ed25519.PublicKey), tt.token, []byte("other")); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: Verify with another implicit assertion = %v", tt.name, err)
+		}
+	}
+}
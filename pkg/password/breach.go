@@ -0,0 +1,157 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Corpus looks up breached passwords by k-anonymity, as the Pwned Passwords
+// range API does: it is only ever given the first five hex digits of the
+// SHA-1 of a password and returns the suffixes of all breached hashes with
+// that prefix, along with how often each was seen.
+type Corpus interface {
+	Range(ctx context.Context, prefix string) (map[string]int, error)
+}
+
+// Breached tells how often password was seen in breaches.
+func Breached(ctx context.Context, c Corpus, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := c.Range(ctx, hash[:5])
+	if err != nil {
+		return 0, err
+	}
+	return suffixes[hash[5:]], nil
+}
+
+// FileCorpus reads a local copy of Pwned Passwords in the "ordered by hash"
+// SHA-1 format: one HASH:COUNT line per password, sorted by hash. The file
+// is searched in place, so it may be far larger than memory.
+type FileCorpus struct {
+	f    *os.File
+	size int64
+}
+
+func OpenCorpus(path string) (*FileCorpus, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &FileCorpus{f: f, size: info.Size()}, nil
+}
+
+func (c *FileCorpus) Close() error {
+	return c.f.Close()
+}
+
+func (c *FileCorpus) Range(ctx context.Context, prefix string) (map[string]int, error) {
+	prefix = strings.ToUpper(prefix)
+	if len(prefix) != 5 {
+		return nil, fmt.Errorf("range prefix must have 5 hex digits, got %q", prefix)
+	}
+
+	// Binary search for the first line whose hash is not below prefix.
+	lo, hi := int64(0), c.size
+	for lo < hi {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		mid := lo + (hi-lo)/2
+		start, line, err := c.lineAt(mid)
+		if err != nil {
+			return nil, err
+		}
+		if start < c.size && hashPrefix(line) < prefix {
+			lo = start + int64(len(line)) + 1
+		} else {
+			hi = mid
+		}
+	}
+	start, _, err := c.lineAt(lo)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]int)
+	scanner := bufio.NewScanner(io.NewSectionReader(c.f, start, c.size-start))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if hashPrefix(line) != prefix {
+			break
+		}
+		hash, count, _ := strings.Cut(line, ":")
+		n, _ := strconv.Atoi(count)
+		res[strings.ToUpper(hash[5:])] = n
+	}
+	return res, scanner.Err()
+}
+
+// lineAt returns the first line starting at or after offset, without its
+// newline. start is the size of the file when there is none.
+func (c *FileCorpus) lineAt(offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		// Skip the rest of the line offset falls into, unless offset is
+		// right after a newline.
+		nl, err := c.indexByte(offset-1, '\n')
+		if err != nil {
+			return 0, "", err
+		}
+		start = nl + 1
+	}
+	if start >= c.size {
+		return c.size, "", nil
+	}
+	end, err := c.indexByte(start, '\n')
+	if err != nil {
+		return 0, "", err
+	}
+	buf := make([]byte, end-start)
+	if _, err := c.f.ReadAt(buf, start); err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	return start, string(buf), nil
+}
+
+// indexByte returns the offset of the first b at or after offset, or the
+// size of the file.
+func (c *FileCorpus) indexByte(offset int64, b byte) (int64, error) {
+	buf := make([]byte, 128)
+	for offset < c.size {
+		n, err := c.f.ReadAt(buf, offset)
+		if i := bytes.IndexByte(buf[:n], b); i >= 0 {
+			return offset + int64(i), nil
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		offset += int64(n)
+	}
+	return c.size, nil
+}
+
+func hashPrefix(line string) string {
+	if len(line) < 5 {
+		return strings.ToUpper(line)
+	}
+	return strings.ToUpper(line[:5])
+}
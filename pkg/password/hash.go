@@ -0,0 +1,39 @@
+package password
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Passwords are kept as bcrypt hashes: the current one, to check it at
+// sign in, and the replaced ones, so that reuse can be refused without
+// keeping them readable. bcrypt only looks at 72 bytes, hence the SHA-256
+// in front of it.
+
+// Hash hashes a password to be stored.
+func Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword(prehash(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// Verify tells whether password is the one hash was made of.
+func Verify(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), prehash(password)) == nil
+}
+
+// InHistory tells whether password is one of the hashed old passwords.
+func InHistory(hashes []string, password string) bool {
+	for _, h := range hashes {
+		if Verify(h, password) {
+			return true
+		}
+	}
+	return false
+}
+
+func prehash(password string) []byte {
+	sum := sha256.Sum256([]byte(password))
+	return []byte(base64.StdEncoding.EncodeToString(sum[:]))
+}
@@ -0,0 +1,117 @@
+// Package password decides whether a new password is good enough: long
+// enough, hard to guess, unrelated to the account and not known from
+// breaches.
+package password
+
+import (
+	"auth/config"
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Reasons of a Violation.
+const (
+	ReasonTooShort = "too_short"
+	ReasonTooLong  = "too_long"
+	ReasonWeak     = "weak"
+	ReasonPersonal = "contains_personal_info"
+	ReasonBreached = "breached"
+	ReasonReused   = "reused"
+)
+
+// Violation is a rule a password breaks.
+type Violation struct {
+	Reason      string
+	Description string
+}
+
+// Account is what a password must not be made of.
+type Account struct {
+	Username string
+	Email    string
+	FullName string
+}
+
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// MinScore is the lowest acceptable Score, from 0 to 4.
+	MinScore int
+	// Breaches is optional.
+	Breaches Corpus
+}
+
+// FromConfig builds the policy, opening the breached password file if one
+// is configured.
+func FromConfig(cfg config.PasswordConfig) (*Policy, error) {
+	p := &Policy{
+		MinLength: cfg.PASSWORD_MIN_LENGTH,
+		MaxLength: cfg.PASSWORD_MAX_LENGTH,
+		MinScore:  cfg.PASSWORD_MIN_SCORE,
+	}
+	if cfg.PASSWORD_BREACHED_FILE != "" {
+		corpus, err := OpenCorpus(cfg.PASSWORD_BREACHED_FILE)
+		if err != nil {
+			return nil, fmt.Errorf("breached password file: %w", err)
+		}
+		p.Breaches = corpus
+	}
+	return p, nil
+}
+
+// Check returns the rules password breaks for the account. Only a failing
+// breach lookup is an error.
+func (p *Policy) Check(ctx context.Context, password string, account Account) ([]Violation, error) {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return []Violation{{ReasonTooShort, fmt.Sprintf("must be at least %d characters long", p.MinLength)}}, nil
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return []Violation{{ReasonTooLong, fmt.Sprintf("must be at most %d characters long", p.MaxLength)}}, nil
+	}
+
+	var res []Violation
+	lower := strings.ToLower(password)
+	local, _, _ := strings.Cut(account.Email, "@")
+	for _, w := range []string{account.Username, local} {
+		if w = strings.ToLower(w); len(w) >= 3 && strings.Contains(lower, w) {
+			res = append(res, Violation{ReasonPersonal, "must not contain your username or email"})
+			break
+		}
+	}
+	if Score(Guesses(password, account.words()...)) < p.MinScore {
+		res = append(res, Violation{ReasonWeak, "is too easy to guess; add more words or characters"})
+	}
+	if p.Breaches != nil {
+		n, err := Breached(ctx, p.Breaches, password)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			res = append(res, Violation{ReasonBreached, "appeared in a data breach and must not be used"})
+		}
+	}
+	return res, nil
+}
+
+// words are the parts of the account an attacker would try first.
+func (a Account) words() []string {
+	var res []string
+	add := func(s string) {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			res = append(res, s)
+		}
+	}
+	add(a.Username)
+	local, domain, _ := strings.Cut(a.Email, "@")
+	add(local)
+	if label, _, ok := strings.Cut(domain, "."); ok {
+		add(label)
+	}
+	for _, name := range strings.Fields(a.FullName) {
+		add(name)
+	}
+	return res
+}
@@ -0,0 +1,100 @@
+package password
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	for pw, want := range map[string]int{
+		"password":                  0,
+		"P@ssw0rd":                  0,
+		"qwerty123":                 0,
+		"aaaaaaaaaaaa":              0,
+		"Summer2024!":               1,
+		"correcthorsebatterystaple": 4,
+	} {
+		if got := Score(Guesses(pw)); got != want {
+			t.Errorf("Score(%s) = %d, want %d", pw, got, want)
+		}
+	}
+	if Guesses("jdoe1234jdoe", "jdoe") >= Guesses("jdoe1234jdoe") {
+		t.Error("user inputs do not make a password easier to guess")
+	}
+}
+
+func TestFileCorpus(t *testing.T) {
+	ctx := context.Background()
+	corpus, err := OpenCorpus("testdata/breached.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer corpus.Close()
+
+	for pw, want := range map[string]int{"password": 1000, "Tr0ub4dor&3": 2000, "bicycle-harbour-lantern": 3000, "unseen-rowing-teapot": 0} {
+		n, err := Breached(ctx, corpus, pw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("Breached(%s) = %d, want %d", pw, n, want)
+		}
+	}
+	// The first and the last line of the file.
+	for prefix, suffix := range map[string]string{"00000": "00000000000000000000000000000000000", "fffff": "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"} {
+		res, err := corpus.Range(ctx, prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := res[suffix]; !ok || len(res) != 1 {
+			t.Errorf("Range(%s) = %v", prefix, res)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	ctx := context.Background()
+	corpus, err := OpenCorpus("testdata/breached.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer corpus.Close()
+	p := &Policy{MinLength: 10, MaxLength: 64, MinScore: 3, Breaches: corpus}
+	account := Account{Username: "jdoe", Email: "jane.doe@agency.example", FullName: "Jane Doe"}
+
+	tests := []struct {
+		password string
+		reasons  []string
+	}{
+		{"short", []string{ReasonTooShort}},
+		{"bicycle-harbour-lantern", []string{ReasonBreached}},
+		{"jdoe-bicycle-harbour", []string{ReasonPersonal}},
+		{"Jane.Doe-1234-lantern", []string{ReasonPersonal}},
+		{"aaaaaaaaaaaaaaa", []string{ReasonWeak}},
+		{"rowing-teapot-over-moss", nil},
+	}
+	for _, tt := range tests {
+		violations, err := p.Check(ctx, tt.password, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reasons []string
+		for _, v := range violations {
+			reasons = append(reasons, v.Reason)
+		}
+		if len(reasons) != len(tt.reasons) || (len(reasons) > 0 && reasons[0] != tt.reasons[0]) {
+			t.Errorf("Check(%s) = %v, want %v", tt.password, reasons, tt.reasons)
+		}
+	}
+
+	hash, err := Hash("rowing-teapot-over-moss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(hash, "rowing-teapot-over-moss") || Verify(hash, "rowing-teapot-over-mess") || Verify("rowing-teapot-over-moss", "rowing-teapot-over-moss") {
+		t.Error("Verify does not match the hashed password only")
+	}
+	if !InHistory([]string{hash}, "rowing-teapot-over-moss") || InHistory([]string{hash}, "rowing-teapot-over-mess") {
+		t.Error("InHistory does not match the hashed password only")
+	}
+}
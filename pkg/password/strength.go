@@ -0,0 +1,300 @@
+package password
+
+import (
+	_ "embed"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The strength estimate follows zxcvbn: a password is split into the
+// patterns an attacker tries first (common passwords, the user's own
+// details, repeats, sequences, keyboard walks and dates) and the guesses
+// needed for it are those of the cheapest split.
+
+//go:embed common.txt
+var commonList string
+
+// commonRanks maps the most used passwords to their rank, 1 being the most
+// common.
+var commonRanks = func() map[string]int {
+	ranks := make(map[string]int)
+	for _, w := range strings.Fields(commonList) {
+		if _, ok := ranks[w]; !ok {
+			ranks[w] = len(ranks) + 1
+		}
+	}
+	return ranks
+}()
+
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm", "qazwsxedc", "1qaz2wsx3edc"}
+
+var leet = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+const (
+	minGuessesSingle = 10
+	minGuessesMulti  = 50
+	// referenceYear is what years in passwords are measured against.
+	referenceYear = 2024
+	minYearSpace  = 20
+)
+
+// Guesses estimates how many guesses an attacker needs for password.
+// userInputs are words the attacker knows about the user.
+func Guesses(password string, userInputs ...string) float64 {
+	runes := []rune(password)
+	n := len(runes)
+	if n == 0 {
+		return 1
+	}
+	dict := make(map[string]int)
+	for _, in := range userInputs {
+		if in = strings.ToLower(in); len(in) >= 3 {
+			if _, ok := dict[in]; !ok {
+				dict[in] = len(dict) + 1
+			}
+		}
+	}
+
+	// best[k][m] is the fewest guesses for the first k runes split into m
+	// patterns.
+	best := make([][]float64, n+1)
+	for k := range best {
+		best[k] = make([]float64, n+1)
+		for m := range best[k] {
+			best[k][m] = math.Inf(1)
+		}
+	}
+	best[0][0] = 1
+	for j := 1; j <= n; j++ {
+		for i := 0; i < j; i++ {
+			g := patternGuesses(runes[i:j], dict)
+			for m := 0; m < j; m++ {
+				if best[i][m] == math.Inf(1) {
+					continue
+				}
+				if v := best[i][m] * g; v < best[j][m+1] {
+					best[j][m+1] = v
+				}
+			}
+		}
+	}
+
+	res := math.Inf(1)
+	for m := 1; m <= n; m++ {
+		if best[n][m] == math.Inf(1) {
+			continue
+		}
+		// The order of the patterns has to be guessed too.
+		g := factorial(m)*best[n][m] + math.Pow(10000, float64(m-1))
+		res = math.Min(res, g)
+	}
+	return res
+}
+
+// Score maps guesses onto zxcvbn's 0 (too guessable) to 4 (very unguessable).
+func Score(guesses float64) int {
+	switch {
+	case guesses < 1e3+5:
+		return 0
+	case guesses < 1e6+5:
+		return 1
+	case guesses < 1e8+5:
+		return 2
+	case guesses < 1e10+5:
+		return 3
+	}
+	return 4
+}
+
+// patternGuesses returns the guesses of the cheapest pattern covering s.
+func patternGuesses(s []rune, userDict map[string]int) float64 {
+	g := math.Pow(10, float64(len(s)))
+	if len(s) >= 3 {
+		g = math.Min(g, dictionaryGuesses(s, userDict))
+		g = math.Min(g, repeatGuesses(s))
+		g = math.Min(g, sequenceGuesses(s))
+		g = math.Min(g, keyboardGuesses(s))
+		g = math.Min(g, dateGuesses(s))
+	}
+	if len(s) == 1 {
+		return math.Max(g, minGuessesSingle)
+	}
+	return math.Max(g, minGuessesMulti)
+}
+
+func dictionaryGuesses(s []rune, userDict map[string]int) float64 {
+	lower := strings.ToLower(string(s))
+	unleet, substituted := unLeet(lower)
+	variations := caseVariations(s)
+	if substituted {
+		variations *= 2
+	}
+
+	res := math.Inf(1)
+	for _, word := range []string{lower, unleet} {
+		for _, reversed := range []bool{false, true} {
+			w, factor := word, variations
+			if reversed {
+				w, factor = reverse(word), variations*2
+			}
+			for _, dict := range []map[string]int{userDict, commonRanks} {
+				if rank, ok := dict[w]; ok {
+					res = math.Min(res, float64(rank)*factor)
+				}
+			}
+		}
+	}
+	return res
+}
+
+func unLeet(s string) (string, bool) {
+	substituted := false
+	res := []rune(s)
+	for i, r := range res {
+		if l, ok := leet[r]; ok {
+			res[i] = l
+			substituted = true
+		}
+	}
+	return string(res), substituted
+}
+
+// caseVariations counts the ways the letters of a word could have been
+// capitalised, with the usual first-letter and all-caps cases cheap.
+func caseVariations(s []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			upper++
+		} else if unicode.IsLower(r) {
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	if lower == 0 || (upper == 1 && unicode.IsUpper(s[0])) || (upper == 1 && unicode.IsUpper(s[len(s)-1])) {
+		return 2
+	}
+	v := 0.0
+	for i := 1; i <= min(upper, lower); i++ {
+		v += binomial(upper+lower, i)
+	}
+	return v
+}
+
+// repeatGuesses handles "aaaa" and "abcabc".
+func repeatGuesses(s []rune) float64 {
+	n := len(s)
+	for p := 1; p <= n/2; p++ {
+		if n%p != 0 {
+			continue
+		}
+		repeated := true
+		for k := p; k < n && repeated; k++ {
+			repeated = s[k] == s[k-p]
+		}
+		if repeated {
+			return Guesses(string(s[:p])) * float64(n/p)
+		}
+	}
+	return math.Inf(1)
+}
+
+// sequenceGuesses handles runs like "abcd", "7654" and "acegi".
+func sequenceGuesses(s []rune) float64 {
+	delta := s[1] - s[0]
+	if delta == 0 || delta > 5 || delta < -5 {
+		return math.Inf(1)
+	}
+	for k := 2; k < len(s); k++ {
+		if s[k]-s[k-1] != delta {
+			return math.Inf(1)
+		}
+	}
+	var base float64
+	switch first := unicode.ToLower(s[0]); {
+	case strings.ContainsRune("aAzZ019", first):
+		base = 4
+	case unicode.IsDigit(first):
+		base = 10
+	default:
+		base = 26
+	}
+	if delta < 0 {
+		base *= 2
+	}
+	return base * float64(len(s)) * math.Abs(float64(delta))
+}
+
+// keyboardGuesses handles straight runs along a row of a QWERTY keyboard.
+func keyboardGuesses(s []rune) float64 {
+	lower := strings.ToLower(string(s))
+	for _, row := range keyboardRows {
+		if strings.Contains(row, lower) || strings.Contains(reverse(row), lower) {
+			return 40 * float64(len(s)) * caseVariations(s)
+		}
+	}
+	return math.Inf(1)
+}
+
+// dateGuesses handles years and all-digit dates such as 240591 or 19910524.
+func dateGuesses(s []rune) float64 {
+	digits := string(s)
+	if _, err := strconv.Atoi(digits); err != nil || digits[0] == '-' || digits[0] == '+' {
+		return math.Inf(1)
+	}
+	year := func(y int) float64 {
+		return math.Max(math.Abs(float64(y-referenceYear)), minYearSpace)
+	}
+	switch len(digits) {
+	case 4:
+		if y, _ := strconv.Atoi(digits); y >= 1900 && y <= 2099 {
+			return year(y)
+		}
+	case 6, 8:
+		yearDigits := len(digits) - 4
+		for _, y := range []string{digits[:yearDigits], digits[len(digits)-yearDigits:]} {
+			v, _ := strconv.Atoi(y)
+			if yearDigits == 2 {
+				v += 1900
+				if v < 1950 {
+					v += 100
+				}
+			} else if v < 1900 || v > 2099 {
+				continue
+			}
+			return 365 * year(v)
+		}
+	}
+	return math.Inf(1)
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+func factorial(n int) float64 {
+	f := 1.0
+	for i := 2; i <= n; i++ {
+		f *= float64(i)
+	}
+	return f
+}
+
+func binomial(n, k int) float64 {
+	r := 1.0
+	for i := 1; i <= k; i++ {
+		r = r * float64(n-k+i) / float64(i)
+	}
+	return r
+}
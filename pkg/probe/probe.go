@@ -0,0 +1,120 @@
+// Package probe answers the liveness and readiness probes of orchestrators
+// and load balancers, checking the dependencies the process needs to serve.
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Statuses of a Result and of its checks.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+// Check tells whether a dependency is usable.
+type Check func(ctx context.Context) error
+
+// Probe runs the checks of readiness.
+type Probe struct {
+	// Timeout bounds each check.
+	Timeout time.Duration
+	// Ready, when set, tells whether the process takes traffic at all; it
+	// is false while shutting down.
+	Ready func() bool
+
+	names  []string
+	checks []Check
+}
+
+func New(timeout time.Duration, ready func() bool) *Probe {
+	return &Probe{Timeout: timeout, Ready: ready}
+}
+
+// Add adds a check under name.
+func (p *Probe) Add(name string, check Check) {
+	p.names = append(p.names, name)
+	p.checks = append(p.checks, check)
+}
+
+// Result is the JSON body of a probe.
+type Result struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// OK tells whether every check passed.
+func (r Result) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Run runs the checks side by side. A nil Probe has nothing to check.
+func (p *Probe) Run(ctx context.Context) Result {
+	res := Result{Status: StatusOK}
+	if p == nil {
+		return res
+	}
+	if p.Ready != nil && !p.Ready() {
+		res.Status = StatusDraining
+	}
+	res.Checks = make(map[string]CheckResult, len(p.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := range p.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+			defer cancel()
+			start := time.Now()
+			err := check(ctx)
+			r := CheckResult{Status: StatusOK, Duration: time.Since(start).Round(time.Millisecond).String()}
+			if err != nil {
+				r.Status, r.Error = StatusUnavailable, err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			res.Checks[name] = r
+			if err != nil && res.Status == StatusOK {
+				res.Status = StatusUnavailable
+			}
+		}(p.names[i], p.checks[i])
+	}
+	wg.Wait()
+	return res
+}
+
+// Database pings the database.
+func Database(db *sql.DB) Check {
+	return db.PingContext
+}
+
+// GRPC asks a server for the status of service through the gRPC health
+// protocol.
+func GRPC(conn grpc.ClientConnInterface, service string) Check {
+	client := healthpb.NewHealthClient(conn)
+	return func(ctx context.Context) error {
+		res, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return err
+		}
+		if res.Status != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("%s is %s", service, res.Status)
+		}
+		return nil
+	}
+}
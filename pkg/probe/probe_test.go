@@ -0,0 +1,72 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestRun(t *testing.T) {
+	ready := true
+	p := New(20*time.Millisecond, func() bool { return ready })
+	p.Add("fine", func(ctx context.Context) error { return nil })
+	if res := p.Run(context.Background()); !res.OK() || res.Checks["fine"].Status != StatusOK {
+		t.Errorf("Run = %+v", res)
+	}
+
+	p.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	p.Add("down", func(ctx context.Context) error { return errors.New("connection refused") })
+	res := p.Run(context.Background())
+	if res.OK() || res.Checks["slow"].Status != StatusUnavailable || res.Checks["down"].Error != "connection refused" {
+		t.Errorf("Run = %+v", res)
+	}
+
+	ready = false
+	if res := p.Run(context.Background()); res.Status != StatusDraining {
+		t.Errorf("Run while draining = %+v", res)
+	}
+
+	var none *Probe
+	if !none.Run(context.Background()).OK() {
+		t.Error("a nil Probe is not ok")
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	lis := bufconn.Listen(1 << 16)
+	server := grpc.NewServer()
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(server, hs)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	check := GRPC(conn, "user.User")
+	hs.SetServingStatus("user.User", healthpb.HealthCheckResponse_SERVING)
+	if err := check(context.Background()); err != nil {
+		t.Errorf("check while serving = %v", err)
+	}
+	hs.SetServingStatus("user.User", healthpb.HealthCheckResponse_NOT_SERVING)
+	if err := check(context.Background()); err == nil {
+		t.Error("check while not serving passed")
+	}
+}
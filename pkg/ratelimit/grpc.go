@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"auth/pkg/trust"
+	"context"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCPolicy is used for every method without a policy of its own.
+const GRPCPolicy = "grpc"
+
+// MethodPolicies gives the methods that take a password or hand out a
+// session the policies of the matching gateway routes, which are far
+// stricter than GRPCPolicy. Their buckets are kept apart from those of the
+// gateway, so a request through the gateway is not counted twice.
+var MethodPolicies = map[string]string{
+	"/user.User/Register":        RegisterPolicy,
+	"/user.User/Login":           LoginPolicy,
+	"/user.User/SSOLogin":        LoginPolicy,
+	"/user.User/EmailRecovery":   PasswordPolicy,
+	"/user.User/PollDeviceToken": PollPolicy,
+}
+
+// UnaryServerInterceptor limits calls per client address: the one the
+// gateway forwards when the caller is one of the trusted gateways, or else
+// the address of the caller. Store failures let the call through.
+func UnaryServerInterceptor(l *Limiter, gateways *trust.Gateways) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		policy, ok := MethodPolicies[info.FullMethod]
+		if !ok {
+			policy = GRPCPolicy
+		}
+
+		res, err := l.Take(ctx, policy, callerKey(ctx, gateways))
+		if err != nil || res.Limit == 0 {
+			return handler(ctx, req)
+		}
+
+		md := metadata.Pairs(
+			"ratelimit-limit", strconv.Itoa(res.Limit),
+			"ratelimit-remaining", strconv.Itoa(res.Remaining),
+			"ratelimit-reset", strconv.Itoa(Seconds(res.Reset)),
+		)
+		if !res.Allowed {
+			md.Set("retry-after", strconv.Itoa(Seconds(res.RetryAfter)))
+			grpc.SetHeader(ctx, md)
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %d seconds", Seconds(res.RetryAfter))
+		}
+		grpc.SetHeader(ctx, md)
+		return handler(ctx, req)
+	}
+}
+
+func callerKey(ctx context.Context, gateways *trust.Gateways) string {
+	ip := gateways.ClientIP(ctx)
+	if ip == "" {
+		ip = "unknown"
+	}
+	return "grpc:ip:" + ip
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore keeps buckets in the process. Limits are not shared between
+// instances.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, p Policy) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.calls++
+	if s.calls%1000 == 0 {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(p.Burst), updated: now}
+		s.buckets[key] = b
+	}
+
+	res, tokens := refill(p, b.tokens, now.Sub(b.updated))
+	b.tokens, b.updated = tokens, now
+	return res, nil
+}
+
+// sweep drops buckets that have been idle for long enough to be full again
+// under any sensible policy.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > 24*time.Hour {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table so that every
+// instance of the service shares the same limits. Time is taken from the
+// database to avoid clock skew between instances.
+type PostgresStore struct {
+	DB  *sql.DB
+	Log *slog.Logger
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresStore(db *sql.DB, log *slog.Logger) *PostgresStore {
+	return &PostgresStore{DB: db, Log: log}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, p Policy) (Result, error) {
+	s.sweep(ctx)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO rate_limit_buckets (key, tokens)
+	VALUES ($1, $2)
+	ON CONFLICT (key) DO NOTHING
+	`, key, p.Burst)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var tokens, elapsed float64
+	err = tx.QueryRowContext(ctx, `
+	SELECT
+		tokens,
+		EXTRACT(EPOCH FROM current_timestamp - updated_at)
+	FROM
+		rate_limit_buckets
+	WHERE
+		key = $1
+	FOR UPDATE
+	`, key).Scan(&tokens, &elapsed)
+	if err != nil {
+		return Result{}, err
+	}
+
+	res, tokens := refill(p, tokens, time.Duration(elapsed*float64(time.Second)))
+	_, err = tx.ExecContext(ctx, `
+	UPDATE
+		rate_limit_buckets
+	SET
+		tokens = $2,
+		updated_at = current_timestamp
+	WHERE
+		key = $1
+	`, key, tokens)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return res, tx.Commit()
+}
+
+// sweep deletes idle buckets at most once every ten minutes per instance.
+func (s *PostgresStore) sweep(ctx context.Context) {
+	s.mu.Lock()
+	if time.Since(s.lastSweep) < 10*time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSweep = time.Now()
+	s.mu.Unlock()
+
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE updated_at < current_timestamp - INTERVAL '1 day'`)
+	if err != nil {
+		s.Log.Error("idle rate limit buckets not deleted", "error", err)
+	}
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"auth/config"
+	"auth/migrations"
+	"auth/pkg/migrate"
+	"auth/storage/postgres"
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testDB connects to the database of the configuration and brings its
+// schema up to date. Tests using it are skipped where there is none.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	cfg, err := config.Load([]string{"--jwt-allow-default-secrets", "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := postgres.ConnectDB(cfg.Postgres)
+	if err != nil {
+		t.Skipf("no database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := migrate.New(db, migrations.Auth, migrations.AuthTable, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestPostgresStoreTake(t *testing.T) {
+	ctx := context.Background()
+	store := NewPostgresStore(testDB(t), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	p := Policy{Name: "login", Rate: 0.001, Burst: 2}
+	key := "test:" + uuid.NewString()
+
+	for i := 1; i >= 0; i-- {
+		res, err := store.Take(ctx, key, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != i {
+			t.Fatalf("take %d: got %+v", 2-i, res)
+		}
+	}
+	res, err := store.Take(ctx, key, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.RetryAfter < 900*time.Second {
+		t.Fatalf("empty bucket: got %+v", res)
+	}
+	if res, _ := store.Take(ctx, "test:"+uuid.NewString(), p); !res.Allowed {
+		t.Fatalf("buckets are not independent: got %+v", res)
+	}
+}
+
+// TestPostgresStoreConcurrentTake checks that instances taking from the
+// same bucket at once never hand out more than it holds.
+func TestPostgresStoreConcurrentTake(t *testing.T) {
+	ctx := context.Background()
+	store := NewPostgresStore(testDB(t), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	p := Policy{Name: "login", Rate: 0.001, Burst: 5}
+	key := "test:" + uuid.NewString()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := store.Take(ctx, key, p)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if res.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != p.Burst {
+		t.Errorf("%d requests allowed, want %d", allowed, p.Burst)
+	}
+}
@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"auth/config"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy describes a token bucket: it holds at most Burst tokens and refills
+// at Rate tokens per second. Every request takes one token.
+type Policy struct {
+	Name  string
+	Rate  float64
+	Burst int
+}
+
+// ParsePolicy reads policies written as "<requests>/<period>", for example
+// "5/1m" allows five requests per minute with a burst of five.
+func ParsePolicy(name, spec string) (Policy, error) {
+	count, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("rate limit %s: expected <requests>/<period>, got %q", name, spec)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || n <= 0 {
+		return Policy{}, fmt.Errorf("rate limit %s: invalid request count %q", name, count)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || d <= 0 {
+		return Policy{}, fmt.Errorf("rate limit %s: invalid period %q", name, period)
+	}
+	return Policy{Name: name, Rate: float64(n) / d.Seconds(), Burst: n}, nil
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next token, zero when allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets. Implementations must be safe for concurrent use.
+type Store interface {
+	Take(ctx context.Context, key string, p Policy) (Result, error)
+}
+
+// Limiter binds a store to a set of named policies.
+type Limiter struct {
+	Store    Store
+	Policies map[string]Policy
+}
+
+func NewLimiter(store Store, policies ...Policy) *Limiter {
+	l := &Limiter{Store: store, Policies: make(map[string]Policy, len(policies))}
+	for _, p := range policies {
+		l.Policies[p.Name] = p
+	}
+	return l
+}
+
+// Take spends a token of the named policy for key. Unknown policies are not
+// limited.
+func (l *Limiter) Take(ctx context.Context, policy, key string) (Result, error) {
+	p, ok := l.Policies[policy]
+	if !ok {
+		return Result{Allowed: true}, nil
+	}
+	return l.Store.Take(ctx, policy+":"+key, p)
+}
+
+// refill computes the outcome for a bucket that had tokens left after
+// elapsed time, returning the result and the new token count.
+func refill(p Policy, tokens float64, elapsed time.Duration) (Result, float64) {
+	tokens = math.Min(float64(p.Burst), tokens+elapsed.Seconds()*p.Rate)
+
+	res := Result{Limit: p.Burst}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration((1 - tokens) / p.Rate)
+	}
+	res.Remaining = int(tokens)
+	res.Reset = secondsToDuration((float64(p.Burst) - tokens) / p.Rate)
+	return res, tokens
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// Seconds rounds d up to whole seconds, as used by the RateLimit-* and
+// Retry-After headers.
+func Seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Names of the policies configured by FromConfig.
+const (
+	RegisterPolicy = "register"
+	LoginPolicy    = "login"
+	PasswordPolicy = "password"
+	ReadPolicy     = "read"
+	WritePolicy    = "write"
+	ScimPolicy     = "scim"
+	// PollPolicy limits the polling of devices and QR code logins.
+	PollPolicy = "poll"
+)
+
+// FromConfig builds a limiter with the configured backend and policies. The
+// postgres backend shares limits between instances through db.
+func FromConfig(cfg config.RateLimitConfig, db *sql.DB, log *slog.Logger) (*Limiter, error) {
+	var store Store
+	switch cfg.RATE_LIMIT_BACKEND {
+	case "memory":
+		store = NewMemoryStore()
+	case "postgres":
+		store = NewPostgresStore(db, log)
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", cfg.RATE_LIMIT_BACKEND)
+	}
+
+	specs := []struct{ name, spec string }{
+		{RegisterPolicy, cfg.RATE_LIMIT_REGISTER},
+		{LoginPolicy, cfg.RATE_LIMIT_LOGIN},
+		{PasswordPolicy, cfg.RATE_LIMIT_PASSWORD},
+		{ReadPolicy, cfg.RATE_LIMIT_READ},
+		{WritePolicy, cfg.RATE_LIMIT_WRITE},
+		{GRPCPolicy, cfg.RATE_LIMIT_GRPC},
+		{ScimPolicy, cfg.RATE_LIMIT_SCIM},
+		{PollPolicy, cfg.RATE_LIMIT_POLL},
+	}
+	policies := make([]Policy, 0, len(specs))
+	for _, s := range specs {
+		p, err := ParsePolicy(s.name, s.spec)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return NewLimiter(store, policies...), nil
+}
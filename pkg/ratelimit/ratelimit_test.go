@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"auth/pkg/trust"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("login", "10/1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Burst != 10 || p.Rate != 10.0/60 {
+		t.Errorf("ParsePolicy returned %+v", p)
+	}
+
+	for _, spec := range []string{"", "10", "0/1m", "x/1m", "10/x", "10/-1s"} {
+		if _, err := ParsePolicy("bad", spec); err == nil {
+			t.Errorf("ParsePolicy(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	p := Policy{Name: "login", Rate: 1, Burst: 3}
+
+	for i := 2; i >= 0; i-- {
+		res, _ := store.Take(context.Background(), "k", p)
+		if !res.Allowed || res.Remaining != i {
+			t.Fatalf("take %d: got %+v", 3-i, res)
+		}
+	}
+
+	res, _ := store.Take(context.Background(), "k", p)
+	if res.Allowed || res.RetryAfter != time.Second {
+		t.Fatalf("empty bucket: got %+v", res)
+	}
+
+	res, _ = store.Take(context.Background(), "other", p)
+	if !res.Allowed {
+		t.Fatalf("buckets are not independent: got %+v", res)
+	}
+
+	now = now.Add(1500 * time.Millisecond)
+	res, _ = store.Take(context.Background(), "k", p)
+	if !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("after refill: got %+v", res)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	gateways, err := trust.ParseGateways([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLimiter(NewMemoryStore(), Policy{Name: GRPCPolicy, Rate: 1, Burst: 100}, Policy{Name: LoginPolicy, Rate: 0.01, Burst: 2})
+	intercept := UnaryServerInterceptor(l, gateways)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+	call := func(method, addr, forwardedFor string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(addr), Port: 40000}})
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", forwardedFor, "x-api-key", forwardedFor))
+		_, err := intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	// Rotating the forwarded address does not help a direct caller.
+	for i, ip := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+		err := call("/user.User/Login", "203.0.113.9", ip)
+		if i < 2 && err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if i == 2 && status.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("third login of a direct caller = %v, want ResourceExhausted", err)
+		}
+	}
+	// Other methods fall under the general policy.
+	if err := call("/user.User/GetProfile", "203.0.113.9", ""); err != nil {
+		t.Errorf("GetProfile = %v", err)
+	}
+	// Behind the gateway every end user has a bucket of their own.
+	for _, ip := range []string{"198.51.100.1", "198.51.100.1", "198.51.100.2"} {
+		if err := call("/user.User/Login", "127.0.0.1", ip); err != nil {
+			t.Errorf("login of %s through the gateway = %v", ip, err)
+		}
+	}
+	if err := call("/user.User/Login", "127.0.0.1", "198.51.100.1"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("third login of one end user = %v, want ResourceExhausted", err)
+	}
+}
@@ -0,0 +1,91 @@
+package saml
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ReplayCache remembers the assertions consumed so that none signs a user
+// in twice.
+type ReplayCache interface {
+	// Remember stores id until expires and reports whether it was new.
+	Remember(ctx context.Context, id string, expires time.Time) (bool, error)
+}
+
+// MemoryCache keeps the assertions of a single instance in memory.
+type MemoryCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+	now  func() time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{seen: make(map[string]time.Time), now: time.Now}
+}
+
+func (m *MemoryCache) Remember(_ context.Context, id string, expires time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for k, exp := range m.seen {
+		if now.After(exp) {
+			delete(m.seen, k)
+		}
+	}
+	if _, ok := m.seen[id]; ok {
+		return false, nil
+	}
+	m.seen[id] = expires
+	return true, nil
+}
+
+// PostgresCache keeps the assertions in the saml_assertions table, shared
+// by every instance of the gateway.
+type PostgresCache struct {
+	DB  *sql.DB
+	Log *slog.Logger
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresCache(db *sql.DB, log *slog.Logger) *PostgresCache {
+	return &PostgresCache{DB: db, Log: log}
+}
+
+func (p *PostgresCache) Remember(ctx context.Context, id string, expires time.Time) (bool, error) {
+	p.sweep(ctx)
+	res, err := p.DB.ExecContext(ctx, `
+	INSERT INTO saml_assertions (id, expires_at)
+	VALUES ($1, $2)
+	ON CONFLICT (id) DO UPDATE SET
+		expires_at = EXCLUDED.expires_at
+	WHERE
+		saml_assertions.expires_at < current_timestamp
+	`, id, expires)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// sweep drops expired assertions at most once a minute.
+func (p *PostgresCache) sweep(ctx context.Context) {
+	p.mu.Lock()
+	if time.Since(p.lastSweep) < time.Minute {
+		p.mu.Unlock()
+		return
+	}
+	p.lastSweep = time.Now()
+	p.mu.Unlock()
+
+	_, err := p.DB.ExecContext(ctx, `DELETE FROM saml_assertions WHERE expires_at < current_timestamp`)
+	if err != nil {
+		p.Log.Error("expired SAML assertions not deleted", "error", err)
+	}
+}
@@ -0,0 +1,68 @@
+package saml
+
+import (
+	"auth/config"
+	"auth/migrations"
+	"auth/pkg/migrate"
+	"auth/storage/postgres"
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testDB connects to the database of the configuration and brings its
+// schema up to date. Tests using it are skipped where there is none.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	cfg, err := config.Load([]string{"--jwt-allow-default-secrets", "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := postgres.ConnectDB(cfg.Postgres)
+	if err != nil {
+		t.Skipf("no database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := migrate.New(db, migrations.Auth, migrations.AuthTable, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// TestPostgresCache checks that an assertion consumed on one instance is
+// refused by the others until it expires.
+func TestPostgresCache(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	first, second := NewPostgresCache(db, log), NewPostgresCache(db, log)
+
+	id := "id-" + uuid.NewString()
+	for i, tc := range []struct {
+		cache   *PostgresCache
+		expires time.Time
+		fresh   bool
+	}{
+		{first, time.Now().Add(-time.Second), true},
+		{second, time.Now().Add(time.Minute), true},
+		{first, time.Now().Add(time.Minute), false},
+		{second, time.Now().Add(time.Minute), false},
+	} {
+		fresh, err := tc.cache.Remember(ctx, id, tc.expires)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fresh != tc.fresh {
+			t.Errorf("Remember %d = %v, want %v", i+1, fresh, tc.fresh)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type entityDescriptor struct {
+	XMLName         xml.Name        `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID        string          `xml:"entityID,attr"`
+	SPSSODescriptor spSSODescriptor `xml:"SPSSODescriptor"`
+}
+
+type spSSODescriptor struct {
+	AuthnRequestsSigned        bool                     `xml:"AuthnRequestsSigned,attr"`
+	WantAssertionsSigned       bool                     `xml:"WantAssertionsSigned,attr"`
+	ProtocolSupportEnumeration string                   `xml:"protocolSupportEnumeration,attr"`
+	NameIDFormats              []string                 `xml:"NameIDFormat"`
+	AssertionConsumerService   assertionConsumerService `xml:"AssertionConsumerService"`
+}
+
+type assertionConsumerService struct {
+	Binding   string `xml:"Binding,attr"`
+	Location  string `xml:"Location,attr"`
+	Index     int    `xml:"index,attr"`
+	IsDefault bool   `xml:"isDefault,attr"`
+}
+
+// Metadata describes us to the IdP of an agency.
+func (sp *ServiceProvider) Metadata(p *Provider) ([]byte, error) {
+	md := entityDescriptor{
+		EntityID: sp.EntityID,
+		SPSSODescriptor: spSSODescriptor{
+			WantAssertionsSigned:       true,
+			ProtocolSupportEnumeration: nsProtocol,
+			NameIDFormats:              []string{NameIDUnspecified, NameIDEmail},
+			AssertionConsumerService: assertionConsumerService{
+				Binding:   bindingPOST,
+				Location:  sp.ACSURL(p),
+				IsDefault: true,
+			},
+		},
+	}
+	out, err := xml.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+type authnRequest struct {
+	XMLName                     xml.Name     `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string       `xml:"ID,attr"`
+	Version                     string       `xml:"Version,attr"`
+	IssueInstant                string       `xml:"IssueInstant,attr"`
+	Destination                 string       `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string       `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string       `xml:"ProtocolBinding,attr"`
+	Issuer                      issuer       `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                nameIDPolicy `xml:"NameIDPolicy"`
+}
+
+type issuer struct {
+	Value string `xml:",chardata"`
+}
+
+type nameIDPolicy struct {
+	Format      string `xml:"Format,attr"`
+	AllowCreate bool   `xml:"AllowCreate,attr"`
+}
+
+// AuthnRequest builds the HTTP-Redirect binding URL that sends the browser
+// to the IdP. The returned request id has to be kept, usually in a cookie,
+// and passed to ParseResponse to match the answer.
+func (sp *ServiceProvider) AuthnRequest(p *Provider, relayState string) (string, string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", "", err
+	}
+	req := authnRequest{
+		ID:                          id,
+		Version:                     "2.0",
+		IssueInstant:                sp.now().UTC().Format(time.RFC3339),
+		Destination:                 p.SSOURL,
+		AssertionConsumerServiceURL: sp.ACSURL(p),
+		ProtocolBinding:             bindingPOST,
+		Issuer:                      issuer{Value: sp.EntityID},
+		NameIDPolicy:                nameIDPolicy{Format: NameIDUnspecified, AllowCreate: true},
+	}
+	out, err := xml.Marshal(req)
+	if err != nil {
+		return "", "", err
+	}
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := w.Write(out); err != nil {
+		return "", "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", "", err
+	}
+
+	query := url.Values{"SAMLRequest": {base64.StdEncoding.EncodeToString(buf.Bytes())}}
+	if relayState != "" {
+		query.Set("RelayState", relayState)
+	}
+	sep := "?"
+	if strings.Contains(p.SSOURL, "?") {
+		sep = "&"
+	}
+	return p.SSOURL + sep + query.Encode(), id, nil
+}
+
+// newID returns an XML ID, which must not start with a digit.
+func newID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "id-" + hex.EncodeToString(b), nil
+}
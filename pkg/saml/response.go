@@ -0,0 +1,296 @@
+package saml
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+// ErrInvalidResponse wraps every reason a response is rejected for. The
+// details are for logs only; users just learn that sign in failed.
+var ErrInvalidResponse = errors.New("invalid SAML response")
+
+// Assertion is the validated content of a response.
+type Assertion struct {
+	ID            string
+	Subject       string
+	SubjectFormat string
+	SessionIndex  string
+	Attributes    map[string][]string
+}
+
+// Attribute returns the first value of the named attribute.
+func (a *Assertion) Attribute(name string) string {
+	if v := a.Attributes[name]; name != "" && len(v) > 0 {
+		return strings.TrimSpace(v[0])
+	}
+	return ""
+}
+
+type xmlResponse struct {
+	InResponseTo string `xml:"InResponseTo,attr"`
+	Destination  string `xml:"Destination,attr"`
+	Issuer       string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Status       struct {
+		StatusCode struct {
+			Value string `xml:"Value,attr"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol Status"`
+}
+
+type xmlAssertion struct {
+	ID      string `xml:"ID,attr"`
+	Issuer  string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Subject struct {
+		NameID struct {
+			Format string `xml:"Format,attr"`
+			Value  string `xml:",chardata"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+		Confirmations []struct {
+			Method string `xml:"Method,attr"`
+			Data   struct {
+				InResponseTo string    `xml:"InResponseTo,attr"`
+				Recipient    string    `xml:"Recipient,attr"`
+				NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+			} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
+	Conditions struct {
+		NotBefore    time.Time `xml:"NotBefore,attr"`
+		NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+		Audiences    []struct {
+			Values []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Audience"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
+	AuthnStatement struct {
+		SessionIndex string `xml:"SessionIndex,attr"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnStatement"`
+	Attributes []struct {
+		Name   string   `xml:"Name,attr"`
+		Values []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement>Attribute"`
+}
+
+// ParseResponse validates the base64 encoded SAMLResponse the IdP posted to
+// the assertion consumer service. requestID is the id of the AuthnRequest
+// the response answers, or empty for IdP-initiated sign in.
+//
+// Either the response or its single assertion has to be signed by one of
+// the certificates of the provider, and only signed content is read.
+// Encrypted assertions are not supported.
+func (sp *ServiceProvider) ParseResponse(ctx context.Context, p *Provider, encoded, requestID string) (*Assertion, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, invalid("decoding: %v", err)
+	}
+	if bytes.Contains(raw, []byte("<!DOCTYPE")) {
+		return nil, invalid("document type declarations are not allowed")
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return nil, invalid("parsing: %v", err)
+	}
+	root := doc.Root()
+	if root == nil || root.Tag != "Response" || root.NamespaceURI() != nsProtocol {
+		return nil, invalid("not a SAML response")
+	}
+
+	now := sp.now()
+	validator := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: p.certs})
+	validator.Clock = dsig.NewFakeClockAt(now)
+
+	response := root
+	responseSigned := signed(root)
+	if responseSigned {
+		if response, err = validator.Validate(root); err != nil {
+			return nil, invalid("response signature: %v", err)
+		}
+	}
+
+	if len(children(response, nsAssertion, "EncryptedAssertion")) > 0 {
+		return nil, invalid("encrypted assertions are not supported")
+	}
+	assertions := children(response, nsAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, invalid("expected one assertion, got %d", len(assertions))
+	}
+	assertion := assertions[0]
+	if !responseSigned {
+		if !signed(assertion) {
+			return nil, invalid("neither the response nor the assertion is signed")
+		}
+		if assertion, err = validateDetached(validator, assertion); err != nil {
+			return nil, invalid("assertion signature: %v", err)
+		}
+	}
+
+	var res xmlResponse
+	if err := unmarshal(response, &res); err != nil {
+		return nil, invalid("response: %v", err)
+	}
+	var a xmlAssertion
+	if err := unmarshal(assertion, &a); err != nil {
+		return nil, invalid("assertion: %v", err)
+	}
+
+	if err := sp.check(ctx, p, &res, &a, requestID, now); err != nil {
+		return nil, err
+	}
+
+	result := &Assertion{
+		ID:            a.ID,
+		Subject:       strings.TrimSpace(a.Subject.NameID.Value),
+		SubjectFormat: a.Subject.NameID.Format,
+		SessionIndex:  a.AuthnStatement.SessionIndex,
+		Attributes:    make(map[string][]string),
+	}
+	if result.Subject == "" {
+		return nil, invalid("assertion has no subject")
+	}
+	for _, attr := range a.Attributes {
+		result.Attributes[attr.Name] = append(result.Attributes[attr.Name], attr.Values...)
+	}
+	return result, nil
+}
+
+// check applies the Web Browser SSO profile rules to the signed content.
+func (sp *ServiceProvider) check(ctx context.Context, p *Provider, res *xmlResponse, a *xmlAssertion, requestID string, now time.Time) error {
+	acs := sp.ACSURL(p)
+	if code := res.Status.StatusCode.Value; code != statusSuccess {
+		return invalid("status %s", code)
+	}
+	if res.Destination != "" && res.Destination != acs {
+		return invalid("destination %q", res.Destination)
+	}
+	if issuer := strings.TrimSpace(res.Issuer); issuer != "" && issuer != p.EntityID {
+		return invalid("response issuer %q", issuer)
+	}
+	if issuer := strings.TrimSpace(a.Issuer); issuer != p.EntityID {
+		return invalid("assertion issuer %q", issuer)
+	}
+	if err := sp.checkInResponseTo(p, res.InResponseTo, requestID); err != nil {
+		return err
+	}
+
+	skew := sp.MaxClockSkew
+	if !a.Conditions.NotBefore.IsZero() && now.Add(skew).Before(a.Conditions.NotBefore) {
+		return invalid("assertion is not valid before %s", a.Conditions.NotBefore)
+	}
+	if !a.Conditions.NotOnOrAfter.IsZero() && !now.Add(-skew).Before(a.Conditions.NotOnOrAfter) {
+		return invalid("assertion expired at %s", a.Conditions.NotOnOrAfter)
+	}
+	if !audienceMatches(a, sp.EntityID) {
+		return invalid("assertion is not addressed to %s", sp.EntityID)
+	}
+
+	var expires time.Time
+	for _, c := range a.Subject.Confirmations {
+		d := c.Data
+		if c.Method != methodBearer || d.Recipient != acs || d.NotOnOrAfter.IsZero() || !now.Add(-skew).Before(d.NotOnOrAfter) {
+			continue
+		}
+		if sp.checkInResponseTo(p, d.InResponseTo, requestID) != nil {
+			continue
+		}
+		expires = d.NotOnOrAfter
+		break
+	}
+	if expires.IsZero() {
+		return invalid("no usable bearer subject confirmation")
+	}
+	return sp.remember(ctx, a.ID, expires.Add(skew))
+}
+
+func (sp *ServiceProvider) checkInResponseTo(p *Provider, inResponseTo, requestID string) error {
+	switch {
+	case inResponseTo == "" && requestID == "" && p.AllowIDPInitiated:
+		return nil
+	case inResponseTo == "":
+		return invalid("unsolicited response")
+	case inResponseTo != requestID:
+		return invalid("response to unknown request %q", inResponseTo)
+	}
+	return nil
+}
+
+func audienceMatches(a *xmlAssertion, entityID string) bool {
+	// Every AudienceRestriction has to allow us.
+	if len(a.Conditions.Audiences) == 0 {
+		return false
+	}
+	for _, restriction := range a.Conditions.Audiences {
+		ok := false
+		for _, audience := range restriction.Values {
+			if strings.TrimSpace(audience) == entityID {
+				ok = true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// remember rejects replays of an assertion while it could still be used.
+func (sp *ServiceProvider) remember(ctx context.Context, id string, expires time.Time) error {
+	if id == "" {
+		return invalid("assertion has no id")
+	}
+	fresh, err := sp.Replay.Remember(ctx, id, expires)
+	if err != nil {
+		return fmt.Errorf("remembering assertion %s: %w", id, err)
+	}
+	if !fresh {
+		return invalid("assertion %s was already used", id)
+	}
+	return nil
+}
+
+func signed(el *etree.Element) bool {
+	return len(children(el, dsig.Namespace, dsig.SignatureTag)) > 0
+}
+
+func children(el *etree.Element, space, tag string) []*etree.Element {
+	var res []*etree.Element
+	for _, c := range el.ChildElements() {
+		if c.Tag == tag && c.NamespaceURI() == space {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// validateDetached validates an element that relies on namespaces declared
+// by its ancestors.
+func validateDetached(validator *dsig.ValidationContext, el *etree.Element) (*etree.Element, error) {
+	ctx, err := etreeutils.NSBuildParentContext(el)
+	if err != nil {
+		return nil, err
+	}
+	detached, err := etreeutils.NSDetatch(ctx, el)
+	if err != nil {
+		return nil, err
+	}
+	return validator.Validate(detached)
+}
+
+func unmarshal(el *etree.Element, v interface{}) error {
+	ctx, err := etreeutils.NSBuildParentContext(el)
+	if err != nil {
+		return err
+	}
+	return etreeutils.NSUnmarshalElement(ctx, el, v)
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidResponse, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,239 @@
+// Package saml is the service provider side of SAML 2.0 Web Browser SSO. It
+// lets the staff of partner travel agencies sign in with their corporate
+// identity provider.
+package saml
+
+import (
+	"auth/config"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	bindingPOST = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	NameIDUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	NameIDEmail       = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+
+	statusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	methodBearer  = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// Provider is the identity provider of one agency.
+type Provider struct {
+	// ID names the provider in our URLs, as in /saml/<id>/login.
+	ID string `yaml:"id"`
+	// Organization is the slug of the agency whose staff sign in here.
+	Organization     string `yaml:"organization"`
+	OrganizationName string `yaml:"organization_name"`
+	EntityID         string `yaml:"entity_id"`
+	// SSOURL receives our AuthnRequests over the HTTP-Redirect binding.
+	SSOURL string `yaml:"sso_url"`
+	// Certificate holds the PEM encoded signing certificates of the IdP,
+	// more than one while it rolls its keys over. CertificateFile may name a
+	// file holding them instead.
+	Certificate     string       `yaml:"certificate"`
+	CertificateFile string       `yaml:"certificate_file"`
+	Attributes      AttributeMap `yaml:"attributes"`
+	// AllowIDPInitiated accepts responses that don't answer an AuthnRequest
+	// of ours.
+	AllowIDPInitiated bool `yaml:"allow_idp_initiated"`
+	// LinkByEmail signs existing accounts with the asserted email in instead
+	// of refusing to create a second one. Only enable it for IdPs that own
+	// the email domains of their users.
+	LinkByEmail bool `yaml:"link_by_email"`
+
+	certs []*x509.Certificate
+}
+
+// AttributeMap names the assertion attributes carrying each users column.
+// FullName falls back to FirstName and LastName and Email to the NameID when
+// that is an email address.
+type AttributeMap struct {
+	Email     string `yaml:"email"`
+	Username  string `yaml:"username"`
+	FullName  string `yaml:"full_name"`
+	FirstName string `yaml:"first_name"`
+	LastName  string `yaml:"last_name"`
+}
+
+// Identity is what an assertion says about the user, mapped onto users.
+type Identity struct {
+	Subject  string
+	Email    string
+	Username string
+	FullName string
+}
+
+// Identity maps the attributes of a validated assertion.
+func (p *Provider) Identity(a *Assertion) Identity {
+	id := Identity{
+		Subject:  a.Subject,
+		Email:    a.Attribute(p.Attributes.Email),
+		Username: a.Attribute(p.Attributes.Username),
+		FullName: a.Attribute(p.Attributes.FullName),
+	}
+	if id.Email == "" && a.SubjectFormat == NameIDEmail {
+		id.Email = a.Subject
+	}
+	if id.FullName == "" {
+		id.FullName = strings.TrimSpace(a.Attribute(p.Attributes.FirstName) + " " + a.Attribute(p.Attributes.LastName))
+	}
+	return id
+}
+
+// ServiceProvider is us. One entity id is shared by all agencies; each
+// agency gets its own metadata and assertion consumer service URL.
+type ServiceProvider struct {
+	EntityID string
+	// BaseURL is the public address of the gateway.
+	BaseURL      string
+	MaxClockSkew time.Duration
+
+	// Replay holds the assertions already consumed.
+	Replay ReplayCache
+
+	providers map[string]*Provider
+	now       func() time.Time
+}
+
+func NewServiceProvider(entityID, baseURL string, skew time.Duration, replay ReplayCache, providers []*Provider) (*ServiceProvider, error) {
+	sp := &ServiceProvider{
+		EntityID:     entityID,
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		MaxClockSkew: skew,
+		Replay:       replay,
+		providers:    make(map[string]*Provider),
+		now:          time.Now,
+	}
+	for _, p := range providers {
+		if err := p.load(); err != nil {
+			return nil, fmt.Errorf("saml provider %q: %w", p.ID, err)
+		}
+		if _, ok := sp.providers[p.ID]; ok {
+			return nil, fmt.Errorf("saml provider %q is configured twice", p.ID)
+		}
+		sp.providers[p.ID] = p
+	}
+	return sp, nil
+}
+
+// FromConfig loads the providers listed in SAML_PROVIDERS_FILE. Without the
+// file SSO is simply not offered. The postgres replay backend shares the
+// consumed assertions between instances through db.
+func FromConfig(cfg config.SAMLConfig, publicURL string, db *sql.DB, log *slog.Logger) (*ServiceProvider, error) {
+	var replay ReplayCache
+	switch cfg.SAML_REPLAY_BACKEND {
+	case "memory":
+		replay = NewMemoryCache()
+	case "postgres":
+		replay = NewPostgresCache(db, log)
+	default:
+		return nil, fmt.Errorf("unknown SAML replay backend %q", cfg.SAML_REPLAY_BACKEND)
+	}
+	entityID := cfg.SAML_ENTITY_ID
+	if entityID == "" {
+		entityID = strings.TrimRight(publicURL, "/") + "/saml"
+	}
+	var providers []*Provider
+	if cfg.SAML_PROVIDERS_FILE != "" {
+		var err error
+		if providers, err = LoadProviders(cfg.SAML_PROVIDERS_FILE); err != nil {
+			return nil, err
+		}
+	}
+	return NewServiceProvider(entityID, publicURL, cfg.SAML_MAX_CLOCK_SKEW, replay, providers)
+}
+
+// LoadProviders reads a YAML file like
+//
+//	providers:
+//	  - id: skyway
+//	    organization: skyway-travel
+//	    organization_name: Skyway Travel
+//	    entity_id: https://idp.skyway.example/
+//	    sso_url: https://idp.skyway.example/sso
+//	    certificate_file: /etc/auth/saml/skyway.crt
+//	    attributes: {email: mail, username: uid, full_name: displayName}
+func LoadProviders(path string) ([]*Provider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Providers []*Provider `yaml:"providers"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file.Providers, nil
+}
+
+func (p *Provider) load() error {
+	switch {
+	case p.ID == "" || url.PathEscape(p.ID) != p.ID:
+		return errors.New("id must be a non-empty URL path segment")
+	case p.Organization == "":
+		return errors.New("organization is required")
+	case p.EntityID == "":
+		return errors.New("entity_id is required")
+	case p.SSOURL == "":
+		return errors.New("sso_url is required")
+	}
+	if p.OrganizationName == "" {
+		p.OrganizationName = p.Organization
+	}
+
+	data := []byte(p.Certificate)
+	if p.CertificateFile != "" {
+		var err error
+		if data, err = os.ReadFile(p.CertificateFile); err != nil {
+			return err
+		}
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+		p.certs = append(p.certs, cert)
+	}
+	if len(p.certs) == 0 {
+		return errors.New("no signing certificate")
+	}
+	return nil
+}
+
+// Provider returns the agency IdP with the given id.
+func (sp *ServiceProvider) Provider(id string) (*Provider, error) {
+	p, ok := sp.providers[id]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// ACSURL is where the IdP posts its responses.
+func (sp *ServiceProvider) ACSURL(p *Provider) string {
+	return sp.BaseURL + "/saml/" + p.ID + "/acs"
+}
@@ -0,0 +1,187 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The fixtures are produced by testdata/generate.go.
+var fixtureTime = time.Date(2024, 5, 1, 10, 1, 0, 0, time.UTC)
+
+func newTestSP(t *testing.T, certFile string) (*ServiceProvider, *Provider) {
+	t.Helper()
+	replay := NewMemoryCache()
+	replay.now = func() time.Time { return fixtureTime }
+	return newTestSPWith(t, certFile, replay)
+}
+
+func newTestSPWith(t *testing.T, certFile string, replay ReplayCache) (*ServiceProvider, *Provider) {
+	t.Helper()
+	sp, err := NewServiceProvider("https://auth.example.com/saml", "https://auth.example.com/", time.Minute, replay, []*Provider{{
+		ID:              "skyway",
+		Organization:    "skyway-travel",
+		EntityID:        "https://idp.skyway.example/",
+		SSOURL:          "https://idp.skyway.example/sso",
+		CertificateFile: certFile,
+		Attributes:      AttributeMap{Username: "uid", FirstName: "givenName", LastName: "sn"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp.now = func() time.Time { return fixtureTime }
+	p, err := sp.Provider("skyway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sp, p
+}
+
+func fixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func TestParseResponse(t *testing.T) {
+	for _, name := range []string{"response_assertion_signed.xml", "response_signed.xml"} {
+		t.Run(name, func(t *testing.T) {
+			sp, p := newTestSP(t, "testdata/idp.crt")
+			response := encode(fixture(t, name))
+
+			a, err := sp.ParseResponse(context.Background(), p, response, "id-request1")
+			if err != nil {
+				t.Fatalf("valid response rejected: %v", err)
+			}
+			want := Identity{Subject: "jane.doe@skyway.example", Email: "jane.doe@skyway.example", Username: "jdoe", FullName: "Jane Doe"}
+			if got := p.Identity(a); got != want {
+				t.Fatalf("identity = %+v, want %+v", got, want)
+			}
+
+			if _, err := sp.ParseResponse(context.Background(), p, response, "id-request1"); !errors.Is(err, ErrInvalidResponse) {
+				t.Fatalf("replayed assertion accepted: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseResponseRejects(t *testing.T) {
+	signed := fixture(t, "response_assertion_signed.xml")
+
+	tests := []struct {
+		name      string
+		response  string
+		requestID string
+		cert      string
+		setup     func(sp *ServiceProvider, p *Provider)
+	}{
+		{
+			name:     "tampered attribute",
+			response: strings.Replace(signed, "jdoe", "admin", 1),
+		},
+		{
+			name:     "unsigned",
+			response: regexp.MustCompile(`(?s)<ds:Signature.*</ds:Signature>`).ReplaceAllString(signed, ""),
+		},
+		{
+			name: "unknown signer",
+			cert: "testdata/other.crt",
+		},
+		{
+			name: "expired",
+			setup: func(sp *ServiceProvider, p *Provider) {
+				sp.now = func() time.Time { return fixtureTime.Add(10 * time.Minute) }
+			},
+		},
+		{
+			name: "not yet valid",
+			setup: func(sp *ServiceProvider, p *Provider) {
+				sp.now = func() time.Time { return fixtureTime.Add(-10 * time.Minute) }
+			},
+		},
+		{
+			name:  "wrong audience",
+			setup: func(sp *ServiceProvider, p *Provider) { sp.EntityID = "https://other.example.com/saml" },
+		},
+		{
+			name:  "wrong issuer",
+			setup: func(sp *ServiceProvider, p *Provider) { p.EntityID = "https://idp.other.example/" },
+		},
+		{
+			name:      "other request",
+			requestID: "id-request2",
+		},
+		{
+			name:      "unsolicited",
+			requestID: "-",
+			setup:     func(sp *ServiceProvider, p *Provider) { p.AllowIDPInitiated = true },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.response == "" {
+				tt.response = signed
+			}
+			if tt.cert == "" {
+				tt.cert = "testdata/idp.crt"
+			}
+			switch tt.requestID {
+			case "":
+				tt.requestID = "id-request1"
+			case "-":
+				tt.requestID = ""
+			}
+			sp, p := newTestSP(t, tt.cert)
+			if tt.setup != nil {
+				tt.setup(sp, p)
+			}
+			if _, err := sp.ParseResponse(context.Background(), p, encode(tt.response), tt.requestID); !errors.Is(err, ErrInvalidResponse) {
+				t.Fatalf("got %v, want ErrInvalidResponse", err)
+			}
+		})
+	}
+}
+
+func TestAuthnRequest(t *testing.T) {
+	sp, p := newTestSP(t, "testdata/idp.crt")
+	location, id, err := sp.AuthnRequest(p, "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "idp.skyway.example" || u.Query().Get("RelayState") != "state" {
+		t.Fatalf("unexpected redirect %s", location)
+	}
+	deflated, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`ID="` + id + `"`, `AssertionConsumerServiceURL="https://auth.example.com/saml/skyway/acs"`, `>https://auth.example.com/saml<`} {
+		if !bytes.Contains(req, []byte(want)) {
+			t.Errorf("AuthnRequest %s lacks %s", req, want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+//go:build ignore
+
+// generate writes the test keys and the signed fixture responses. Run it
+// from pkg/saml with: go run testdata/generate.go
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+const response = `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_response1" Version="2.0" IssueInstant="2024-05-01T10:00:00Z" Destination="https://auth.example.com/saml/skyway/acs" InResponseTo="id-request1">
+  <saml:Issuer>https://idp.skyway.example/</saml:Issuer>
+  <samlp:Status>
+    <samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/>
+  </samlp:Status>
+  <saml:Assertion ID="_assertion1" Version="2.0" IssueInstant="2024-05-01T10:00:00Z">
+    <saml:Issuer>https://idp.skyway.example/</saml:Issuer>
+    <saml:Subject>
+      <saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">jane.doe@skyway.example</saml:NameID>
+      <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml:SubjectConfirmationData InResponseTo="id-request1" Recipient="https://auth.example.com/saml/skyway/acs" NotOnOrAfter="2024-05-01T10:05:00Z"/>
+      </saml:SubjectConfirmation>
+    </saml:Subject>
+    <saml:Conditions NotBefore="2024-05-01T09:59:00Z" NotOnOrAfter="2024-05-01T10:05:00Z">
+      <saml:AudienceRestriction>
+        <saml:Audience>https://auth.example.com/saml</saml:Audience>
+      </saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:AuthnStatement AuthnInstant="2024-05-01T10:00:00Z" SessionIndex="_session1">
+      <saml:AuthnContext>
+        <saml:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport</saml:AuthnContextClassRef>
+      </saml:AuthnContext>
+    </saml:AuthnStatement>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="uid">
+        <saml:AttributeValue>jdoe</saml:AttributeValue>
+      </saml:Attribute>
+      <saml:Attribute Name="givenName">
+        <saml:AttributeValue>Jane</saml:AttributeValue>
+      </saml:Attribute>
+      <saml:Attribute Name="sn">
+        <saml:AttributeValue>Doe</saml:AttributeValue>
+      </saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`
+
+func main() {
+	idp := newKeyPair("idp")
+	newKeyPair("other")
+
+	// The assertion alone is signed, as most IdPs do by default.
+	doc := parse()
+	assertion := doc.Root().SelectElement("Assertion")
+	ctx, err := etreeutils.NSBuildParentContext(assertion)
+	if err != nil {
+		log.Fatal(err)
+	}
+	detached, err := etreeutils.NSDetatch(ctx, assertion)
+	if err != nil {
+		log.Fatal(err)
+	}
+	signed := sign(idp, detached)
+	doc.Root().RemoveChild(assertion)
+	doc.Root().AddChild(signed)
+	write("response_assertion_signed.xml", doc)
+
+	// The whole response is signed.
+	doc = parse()
+	doc.SetRoot(sign(idp, doc.Root()))
+	write("response_signed.xml", doc)
+}
+
+func newKeyPair(name string) *dsig.SigningContext {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name + ".example"},
+		NotBefore:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2124, 1, 1, 0, 0, 0, 0, time.UTC),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.WriteFile("testdata/"+name+".crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, err := dsig.NewSigningContext(key, [][]byte{cert})
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	return ctx
+}
+
+func parse() *etree.Document {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(response); err != nil {
+		log.Fatal(err)
+	}
+	return doc
+}
+
+// sign signs el and moves the signature behind the Issuer, where the SAML
+// schema wants it.
+func sign(ctx *dsig.SigningContext, el *etree.Element) *etree.Element {
+	signed, err := ctx.SignEnveloped(el)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sig := signed.RemoveChildAt(len(signed.Child) - 1)
+	signed.InsertChildAt(signed.SelectElement("Issuer").Index()+1, sig)
+	return signed
+}
+
+func write(name string, doc *etree.Document) {
+	out, err := doc.WriteToString()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("testdata/"+name, []byte(strings.TrimSpace(out)+"\n"), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,392 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Filter is a parsed filter expression (RFC 7644 section 3.4.2.2).
+type Filter interface {
+	isFilter()
+}
+
+// Compare is "attrPath op value", or "attrPath pr" with a nil Value. Path
+// and Op are lower case and Path has no schema URN prefix.
+type Compare struct {
+	Path  string
+	Op    string
+	Value interface{}
+}
+
+type And struct {
+	Left, Right Filter
+}
+
+type Or struct {
+	Left, Right Filter
+}
+
+type Not struct {
+	Filter Filter
+}
+
+// ValuePath selects the values of a multi-valued attribute, as in
+// emails[type eq "work"].
+type ValuePath struct {
+	Path   string
+	Filter Filter
+}
+
+func (Compare) isFilter()   {}
+func (And) isFilter()       {}
+func (Or) isFilter()        {}
+func (Not) isFilter()       {}
+func (ValuePath) isFilter() {}
+
+var operators = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+// ParseFilter parses a filter query parameter.
+func ParseFilter(s string) (Filter, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, invalidFilter("unexpected %q", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+// NormalizePath lower cases an attribute path and strips the schema URN
+// clients may qualify it with.
+func NormalizePath(path string) string {
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		path = path[strings.LastIndex(path, ":")+1:]
+	}
+	return strings.ToLower(path)
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.IndexByte("()[]", c) >= 0:
+			tokens = append(tokens, token{text: string(c)})
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return nil, invalidFilter("unterminated string")
+			}
+			var v string
+			if err := json.Unmarshal([]byte(s[i:j+1]), &v); err != nil {
+				return nil, invalidFilter("invalid string %s", s[i:j+1])
+			}
+			tokens = append(tokens, token{text: v, quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for j < len(s) && strings.IndexByte(" \t()[]\"", s[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, token{text: s[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// keyword consumes the next token if it is the unquoted word kw.
+func (p *parser) keyword(kw string) bool {
+	t, ok := p.peek()
+	if ok && !t.quoted && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (Filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (Filter, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = And{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (Filter, error) {
+	if p.keyword("not") {
+		if !p.keyword("(") {
+			return nil, invalidFilter("expected ( after not")
+		}
+		f, err := p.group(")")
+		if err != nil {
+			return nil, err
+		}
+		return Not{Filter: f}, nil
+	}
+	if p.keyword("(") {
+		return p.group(")")
+	}
+	return p.attribute()
+}
+
+func (p *parser) group(closing string) (Filter, error) {
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.keyword(closing) {
+		return nil, invalidFilter("expected %s", closing)
+	}
+	return f, nil
+}
+
+func (p *parser) attribute() (Filter, error) {
+	t, ok := p.peek()
+	if !ok || t.quoted || strings.IndexAny(t.text, "()[]") >= 0 {
+		return nil, invalidFilter("expected attribute path")
+	}
+	p.pos++
+	path := NormalizePath(t.text)
+
+	if p.keyword("[") {
+		f, err := p.group("]")
+		if err != nil {
+			return nil, err
+		}
+		return ValuePath{Path: path, Filter: f}, nil
+	}
+	if p.keyword("pr") {
+		return Compare{Path: path, Op: "pr"}, nil
+	}
+
+	op, ok := p.peek()
+	if !ok || op.quoted || !operators[strings.ToLower(op.text)] {
+		return nil, invalidFilter("expected operator after %s", t.text)
+	}
+	p.pos++
+	v, ok := p.peek()
+	if !ok {
+		return nil, invalidFilter("expected value after %s", op.text)
+	}
+	p.pos++
+	value, err := literal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Compare{Path: path, Op: strings.ToLower(op.text), Value: value}, nil
+}
+
+func literal(t token) (interface{}, error) {
+	if t.quoted {
+		return t.text, nil
+	}
+	switch strings.ToLower(t.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return nil, invalidFilter("invalid value %s", t.text)
+	}
+	return n, nil
+}
+
+func invalidFilter(format string, args ...interface{}) *Error {
+	return Errorf(http.StatusBadRequest, "invalidFilter", format, args...)
+}
+
+// Match tells whether the JSON object v satisfies f. Multi-valued
+// attributes match when any of their values does.
+func Match(f Filter, v map[string]interface{}) bool {
+	switch f := f.(type) {
+	case And:
+		return Match(f.Left, v) && Match(f.Right, v)
+	case Or:
+		return Match(f.Left, v) || Match(f.Right, v)
+	case Not:
+		return !Match(f.Filter, v)
+	case ValuePath:
+		for _, item := range values(lookup(v, f.Path)) {
+			if m, ok := item.(map[string]interface{}); ok && Match(f.Filter, m) {
+				return true
+			}
+		}
+		return false
+	case Compare:
+		for _, actual := range values(lookup(v, f.Path)) {
+			if m, ok := actual.(map[string]interface{}); ok {
+				actual = get(m, "value")
+			}
+			if compare(actual, f.Op, f.Value) {
+				return true
+			}
+		}
+		return f.Op == "ne" && len(values(lookup(v, f.Path))) == 0
+	}
+	return false
+}
+
+// lookup follows a dotted path, collecting the sub-attribute from every
+// value of a multi-valued attribute on the way.
+func lookup(v map[string]interface{}, path string) interface{} {
+	name, rest, nested := strings.Cut(path, ".")
+	value := get(v, name)
+	if !nested {
+		return value
+	}
+	var res []interface{}
+	for _, item := range values(value) {
+		if m, ok := item.(map[string]interface{}); ok {
+			res = append(res, values(lookup(m, rest))...)
+		}
+	}
+	return res
+}
+
+// get reads an attribute by its case-insensitive name.
+func get(v map[string]interface{}, name string) interface{} {
+	if key, ok := key(v, name); ok {
+		return v[key]
+	}
+	return nil
+}
+
+func key(v map[string]interface{}, name string) (string, bool) {
+	for k := range v {
+		if strings.EqualFold(k, name) {
+			return k, true
+		}
+	}
+	return name, false
+}
+
+func values(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
+
+func compare(actual interface{}, op string, expected interface{}) bool {
+	if op == "pr" {
+		s, isString := actual.(string)
+		return actual != nil && (!isString || s != "")
+	}
+	switch a := actual.(type) {
+	case string:
+		e, ok := expected.(string)
+		if !ok {
+			return false
+		}
+		a, e = strings.ToLower(a), strings.ToLower(e)
+		switch op {
+		case "eq":
+			return a == e
+		case "ne":
+			return a != e
+		case "co":
+			return strings.Contains(a, e)
+		case "sw":
+			return strings.HasPrefix(a, e)
+		case "ew":
+			return strings.HasSuffix(a, e)
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	case bool:
+		e, ok := expected.(bool)
+		return ok && (op == "eq" && a == e || op == "ne" && a != e)
+	case float64:
+		e, ok := expected.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return a == e
+		case "ne":
+			return a != e
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	}
+	return false
+}
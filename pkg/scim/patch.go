@@ -0,0 +1,259 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Apply runs PATCH operations (RFC 7644 section 3.5.2) against the JSON
+// representation of a resource. Operation names are case-insensitive since
+// some clients capitalise them.
+func Apply(resource map[string]interface{}, ops []PatchOperation) error {
+	for _, op := range ops {
+		if err := apply(resource, strings.ToLower(op.Op), op.Path, op.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func apply(res map[string]interface{}, op, path string, value interface{}) error {
+	switch op {
+	case "add", "replace", "remove":
+	default:
+		return Errorf(http.StatusBadRequest, "invalidSyntax", "unknown operation %q", op)
+	}
+	if path == "" {
+		if op == "remove" {
+			return Errorf(http.StatusBadRequest, "noTarget", "remove needs a path")
+		}
+		attrs, ok := value.(map[string]interface{})
+		if !ok {
+			return invalidValue("value must be an object when there is no path")
+		}
+		for k, v := range attrs {
+			if err := apply(res, op, k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if op != "remove" && value == nil {
+		return invalidValue("%s needs a value", op)
+	}
+
+	attr, filter, sub, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	name, _ := key(res, attr)
+
+	if filter == nil {
+		if sub == "" {
+			switch op {
+			case "remove":
+				delete(res, name)
+			case "add":
+				if current, ok := res[name].([]interface{}); ok {
+					res[name] = appendUnique(current, values(value))
+				} else {
+					res[name] = value
+				}
+			case "replace":
+				res[name] = value
+			}
+			return nil
+		}
+		switch current := res[name].(type) {
+		case nil:
+			if op != "remove" {
+				res[name] = map[string]interface{}{sub: value}
+			}
+		case map[string]interface{}:
+			setSub(current, op, sub, value)
+		case []interface{}:
+			for _, item := range current {
+				if m, ok := item.(map[string]interface{}); ok {
+					setSub(m, op, sub, value)
+				}
+			}
+		default:
+			return invalidPath("%s has no sub-attributes", attr)
+		}
+		return nil
+	}
+
+	current, ok := res[name].([]interface{})
+	if !ok && res[name] != nil {
+		return invalidPath("%s is not multi-valued", attr)
+	}
+	kept := make([]interface{}, 0, len(current))
+	matched := false
+	for _, item := range current {
+		m, ok := item.(map[string]interface{})
+		if !ok || !Match(filter, m) {
+			kept = append(kept, item)
+			continue
+		}
+		matched = true
+		switch {
+		case op == "remove" && sub == "":
+		case sub == "":
+			kept = append(kept, value)
+		default:
+			setSub(m, op, sub, value)
+			kept = append(kept, m)
+		}
+	}
+	if !matched && op != "remove" {
+		// emails[type eq "work"].value is how clients add a work email.
+		item, ok := seed(filter)
+		if !ok {
+			return Errorf(http.StatusBadRequest, "noTarget", "no value matches %s", path)
+		}
+		if sub == "" {
+			v, ok := value.(map[string]interface{})
+			if !ok {
+				return invalidValue("value must be an object")
+			}
+			for k, x := range v {
+				item[k] = x
+			}
+		} else {
+			item[sub] = value
+		}
+		kept = append(kept, item)
+	}
+	res[name] = kept
+	return nil
+}
+
+// parsePath splits attr, attr.sub, attr[filter] and attr[filter].sub.
+func parsePath(path string) (string, Filter, string, error) {
+	i := strings.IndexByte(path, '[')
+	if i < 0 {
+		attr, sub, _ := strings.Cut(NormalizePath(path), ".")
+		return attr, nil, sub, nil
+	}
+	j := strings.LastIndexByte(path, ']')
+	if j < i {
+		return "", nil, "", invalidPath("unbalanced brackets in %s", path)
+	}
+	f, err := ParseFilter(path[i+1 : j])
+	if err != nil {
+		return "", nil, "", invalidPath("%s: %v", path, err)
+	}
+	sub := path[j+1:]
+	if sub != "" {
+		if sub[0] != '.' {
+			return "", nil, "", invalidPath("%s", path)
+		}
+		sub = strings.ToLower(sub[1:])
+	}
+	return NormalizePath(path[:i]), f, sub, nil
+}
+
+func setSub(m map[string]interface{}, op, sub string, value interface{}) {
+	k, _ := key(m, sub)
+	if op == "remove" {
+		delete(m, k)
+		return
+	}
+	m[k] = value
+}
+
+// appendUnique adds values to a multi-valued attribute, skipping complex
+// values whose value sub-attribute is already present.
+func appendUnique(current, add []interface{}) []interface{} {
+	seen := make(map[string]bool)
+	for _, item := range current {
+		if m, ok := item.(map[string]interface{}); ok {
+			seen[strings.ToLower(toString(get(m, "value")))] = true
+		}
+	}
+	for _, item := range add {
+		if m, ok := item.(map[string]interface{}); ok {
+			v := strings.ToLower(toString(get(m, "value")))
+			if v != "" && seen[v] {
+				continue
+			}
+			seen[v] = true
+		}
+		current = append(current, item)
+	}
+	return current
+}
+
+// seed builds the value an equality filter selects.
+func seed(f Filter) (map[string]interface{}, bool) {
+	switch f := f.(type) {
+	case Compare:
+		if f.Op != "eq" || strings.Contains(f.Path, ".") {
+			return nil, false
+		}
+		return map[string]interface{}{f.Path: f.Value}, true
+	case And:
+		left, ok := seed(f.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := seed(f.Right)
+		if !ok {
+			return nil, false
+		}
+		for k, v := range right {
+			left[k] = v
+		}
+		return left, true
+	}
+	return nil, false
+}
+
+func toString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
+
+// Decode converts a patched JSON representation back into a resource.
+// Booleans sent as strings, as in "active": "False", are accepted.
+func Decode(resource map[string]interface{}, v interface{}) error {
+	if k, ok := key(resource, "active"); ok {
+		if s, ok := resource[k].(string); ok {
+			b, err := strconv.ParseBool(strings.ToLower(s))
+			if err != nil {
+				return invalidValue("active must be a boolean")
+			}
+			resource[k] = b
+		}
+	}
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return invalidValue("%v", err)
+	}
+	return nil
+}
+
+// Encode returns the JSON representation of a resource for Apply.
+func Encode(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res map[string]interface{}
+	return res, json.Unmarshal(data, &res)
+}
+
+func invalidValue(format string, args ...interface{}) *Error {
+	return Errorf(http.StatusBadRequest, "invalidValue", format, args...)
+}
+
+func invalidPath(format string, args ...interface{}) *Error {
+	return Errorf(http.StatusBadRequest, "invalidPath", format, args...)
+}
@@ -0,0 +1,161 @@
+// Package scim holds the protocol side of SCIM 2.0 (RFC 7643 and 7644):
+// resource representations, filters and PATCH operations. Partner agencies
+// use it to provision the accounts of their staff.
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	UserSchema  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GroupSchema = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ListSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchSchema = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	// MediaType is the content type of every SCIM response.
+	MediaType = "application/scim+json"
+)
+
+type User struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName"`
+	Name        *Name    `json:"name,omitempty"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	// Active is true unless set; an inactive user is deprovisioned.
+	Active *bool    `json:"active,omitempty"`
+	Groups []Member `json:"groups,omitempty"`
+	Meta   *Meta    `json:"meta,omitempty"`
+}
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// FullName is displayName or else the formatted or composed name.
+func (u *User) FullName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	if u.Name == nil {
+		return ""
+	}
+	if u.Name.Formatted != "" {
+		return u.Name.Formatted
+	}
+	return strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+}
+
+// Email returns the primary email, or the first one if none is marked.
+func (u *User) Email() string {
+	for _, e := range u.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+func (u *User) IsActive() bool {
+	return u.Active == nil || *u.Active
+}
+
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Member `json:"members,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Member references a user from a group, or a group from a user.
+type Member struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+	Version      string `json:"version,omitempty"`
+}
+
+// Version turns the last modification time into a weak ETag.
+func Version(lastModified string) string {
+	return `W/"` + lastModified + `"`
+}
+
+// ParseVersion is the inverse of Version. It returns an empty string for
+// "*" and for anything that isn't one of our ETags.
+func ParseVersion(etag string) string {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	if v, err := strconv.Unquote(etag); err == nil {
+		return v
+	}
+	return ""
+}
+
+type ListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int64       `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Error is an error response (RFC 7644 section 3.12).
+type Error struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func Errorf(status int, scimType, format string, args ...interface{}) *Error {
+	return &Error{Status: status, ScimType: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Schemas  []string `json:"schemas"`
+		Status   string   `json:"status"`
+		ScimType string   `json:"scimType,omitempty"`
+		Detail   string   `json:"detail,omitempty"`
+	}{[]string{ErrorSchema}, strconv.Itoa(e.Status), e.ScimType, e.Detail})
+}
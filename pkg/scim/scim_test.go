@@ -0,0 +1,140 @@
+package scim
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   Filter
+	}{
+		{`userName eq "jdoe"`, Compare{Path: "username", Op: "eq", Value: "jdoe"}},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName SW "J"`, Compare{Path: "username", Op: "sw", Value: "J"}},
+		{`title pr and not (active eq false)`, And{
+			Left:  Compare{Path: "title", Op: "pr"},
+			Right: Not{Filter: Compare{Path: "active", Op: "eq", Value: false}},
+		}},
+		{`a eq 1 or b eq 2 and c eq "x"`, Or{
+			Left:  Compare{Path: "a", Op: "eq", Value: 1.0},
+			Right: And{Left: Compare{Path: "b", Op: "eq", Value: 2.0}, Right: Compare{Path: "c", Op: "eq", Value: "x"}},
+		}},
+		{`emails[type eq "work" and value co "@agency.example"]`, ValuePath{Path: "emails", Filter: And{
+			Left:  Compare{Path: "type", Op: "eq", Value: "work"},
+			Right: Compare{Path: "value", Op: "co", Value: "@agency.example"},
+		}}},
+		{`displayName eq "say \"hi\""`, Compare{Path: "displayname", Op: "eq", Value: `say "hi"`}},
+	}
+	for _, tt := range tests {
+		got, err := ParseFilter(tt.filter)
+		if err != nil {
+			t.Errorf("ParseFilter(%s): %v", tt.filter, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseFilter(%s) = %#v, want %#v", tt.filter, got, tt.want)
+		}
+	}
+
+	for _, filter := range []string{``, `userName`, `userName eq`, `userName xx "a"`, `(userName eq "a"`, `userName eq "a`, `userName eq "a" and`} {
+		var e *Error
+		if _, err := ParseFilter(filter); !errors.As(err, &e) || e.ScimType != "invalidFilter" {
+			t.Errorf("ParseFilter(%s) = %v, want invalidFilter", filter, err)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	user := map[string]interface{}{
+		"userName": "JDoe",
+		"active":   true,
+		"emails": []interface{}{
+			map[string]interface{}{"value": "jane@agency.example", "type": "work"},
+			map[string]interface{}{"value": "jane@home.example", "type": "home"},
+		},
+	}
+	for filter, want := range map[string]bool{
+		`userName eq "jdoe"`:                               true,
+		`username ne "jdoe"`:                               false,
+		`emails co "@home."`:                               true,
+		`emails.value ew "home.example"`:                   true,
+		`emails[type eq "work" and value sw "jane@home"]`:  false,
+		`emails[type eq "work"] and not (active eq false)`: true,
+		`title pr`: false,
+	} {
+		f, err := ParseFilter(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Match(f, user); got != want {
+			t.Errorf("Match(%s) = %v, want %v", filter, got, want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	active := true
+	user, err := Encode(&User{
+		Schemas:  []string{UserSchema},
+		UserName: "jdoe",
+		Name:     &Name{GivenName: "Jane"},
+		Emails:   []Email{{Value: "jane@agency.example", Type: "work", Primary: true}},
+		Active:   &active,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Apply(user, []PatchOperation{
+		{Op: "Replace", Path: "active", Value: "False"},
+		{Op: "replace", Path: `emails[type eq "work"].value`, Value: "jane.doe@agency.example"},
+		{Op: "add", Path: `emails[type eq "home"].value`, Value: "jane@home.example"},
+		{Op: "replace", Value: map[string]interface{}{"displayName": "Jane Doe", "name.familyName": "Doe"}},
+		{Op: "remove", Path: "name.givenName"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got User
+	if err := Decode(user, &got); err != nil {
+		t.Fatal(err)
+	}
+	inactive := false
+	want := User{
+		Schemas:     []string{UserSchema},
+		UserName:    "jdoe",
+		Name:        &Name{FamilyName: "Doe"},
+		DisplayName: "Jane Doe",
+		Emails: []Email{
+			{Value: "jane.doe@agency.example", Type: "work", Primary: true},
+			{Value: "jane@home.example", Type: "home"},
+		},
+		Active: &inactive,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("patched user = %+v, want %+v", got, want)
+	}
+
+	group, _ := Encode(&Group{DisplayName: "Agents", Members: []Member{{Value: "1"}, {Value: "2"}}})
+	err = Apply(group, []PatchOperation{
+		{Op: "add", Path: "members", Value: []interface{}{map[string]interface{}{"value": "2"}, map[string]interface{}{"value": "3"}}},
+		{Op: "remove", Path: `members[value eq "1"]`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g Group
+	if err := Decode(group, &g); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g.Members, []Member{{Value: "2"}, {Value: "3"}}) {
+		t.Fatalf("members = %+v", g.Members)
+	}
+
+	var e *Error
+	if err := Apply(group, []PatchOperation{{Op: "move", Path: "members"}}); !errors.As(err, &e) {
+		t.Fatalf("unknown operation accepted: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+// Package tracing sets up OpenTelemetry tracing, so that a request can be
+// followed from the gateway through the gRPC server down to its SQL
+// queries. Trace context travels between processes in W3C traceparent
+// headers and gRPC metadata.
+package tracing
+
+import (
+	"auth/config"
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Exporters of TRACING_EXPORTER.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterMemory = "memory"
+)
+
+// Tracing is the installed tracer provider.
+type Tracing struct {
+	provider *sdktrace.TracerProvider
+	// Memory holds the finished spans with the memory exporter, for tests.
+	Memory *tracetest.InMemoryExporter
+}
+
+// Setup installs the global tracer provider and the W3C propagators. With
+// the none exporter spans are not recorded, but trace context coming from
+// callers is still passed on.
+func Setup(ctx context.Context, cfg config.TracingConfig) (*Tracing, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	t := &Tracing{}
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.TRACING_EXPORTER {
+	case ExporterNone:
+		return t, nil
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.OTLP_ENDPOINT)}
+		if cfg.OTLP_INSECURE {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New()
+	case ExporterMemory:
+		t.Memory = tracetest.NewInMemoryExporter()
+		exporter = t.Memory
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.TRACING_EXPORTER)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(cfg.TRACING_SERVICE_NAME)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TRACING_SAMPLE_RATIO))),
+	}
+	if t.Memory != nil {
+		// Spans are there as soon as they end, which tests rely on.
+		options = append(options, sdktrace.WithSyncer(exporter))
+	} else {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	t.provider = sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(t.provider)
+	return t, nil
+}
+
+// Shutdown exports the spans still buffered and stops the provider.
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	if t == nil || t.provider == nil {
+		return nil
+	}
+	return t.provider.Shutdown(ctx)
+}
@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"auth/config"
+	"context"
+	"net"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// A trace started by the caller continues in the gRPC server.
+func TestPropagation(t *testing.T) {
+	traces, err := Setup(context.Background(), config.TracingConfig{
+		TRACING_EXPORTER:     ExporterMemory,
+		TRACING_SERVICE_NAME: "test",
+		TRACING_SAMPLE_RATIO: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer traces.Shutdown(context.Background())
+
+	lis := bufconn.Listen(1 << 16)
+	server := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+	defer server.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, root := otel.Tracer("test").Start(context.Background(), "GET /api/v1/users/:user_id/followers")
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+	server.GracefulStop()
+
+	spans := traces.Memory.GetSpans()
+	kinds := map[trace.SpanKind]int{}
+	for _, s := range spans {
+		if s.SpanContext.TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("span %s is in trace %s, not in %s", s.Name, s.SpanContext.TraceID(), root.SpanContext().TraceID())
+		}
+		kinds[s.SpanKind]++
+	}
+	if kinds[trace.SpanKindClient] != 1 || kinds[trace.SpanKindServer] != 1 {
+		t.Errorf("spans = %v, want a client and a server span", spans)
+	}
+}
+
+func TestSetupUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), config.TracingConfig{TRACING_EXPORTER: "zipkin"}); err == nil {
+		t.Error("an unknown exporter was accepted")
+	}
+	none, err := Setup(context.Background(), config.TracingConfig{TRACING_EXPORTER: ExporterNone})
+	if err != nil || none.Shutdown(context.Background()) != nil {
+		t.Errorf("Setup with none = %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Package trust tells which gRPC peers are gateways of ours, whose metadata
+// about the end user can be believed. Any other caller could set that
+// metadata to whatever suits it.
+package trust
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// ForwardedForMetadata carries the address of the end user from the
+// gateway.
+const ForwardedForMetadata = "x-forwarded-for"
+
+// Gateways are the networks the gateways call the gRPC server from.
+type Gateways struct {
+	nets []*net.IPNet
+}
+
+// ParseGateways reads CIDRs such as 10.0.0.0/8; a bare address stands for
+// itself.
+func ParseGateways(cidrs []string) (*Gateways, error) {
+	g := &Gateways{}
+	for _, c := range cidrs {
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("trusted gateway %q is not an address or CIDR", c)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			g.nets = append(g.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("trusted gateway %q: %w", c, err)
+		}
+		g.nets = append(g.nets, n)
+	}
+	return g, nil
+}
+
+// Trusted reports whether the caller is a gateway.
+func (g *Gateways) Trusted(ctx context.Context) bool {
+	if g == nil {
+		return false
+	}
+	ip := net.ParseIP(PeerIP(ctx))
+	if ip == nil {
+		return false
+	}
+	for _, n := range g.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Metadata returns the first value of the metadata key when the caller is
+// a gateway and "" otherwise.
+func (g *Gateways) Metadata(ctx context.Context, key string) string {
+	if !g.Trusted(ctx) {
+		return ""
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// ClientIP is the address of the end user as forwarded by a gateway, or
+// else the address of the caller.
+func (g *Gateways) ClientIP(ctx context.Context) string {
+	if ip := g.Metadata(ctx, ForwardedForMetadata); ip != "" {
+		return ip
+	}
+	return PeerIP(ctx)
+}
+
+// PeerIP is the address of the caller, "" when it is not known.
+func PeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
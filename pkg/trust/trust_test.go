@@ -0,0 +1,48 @@
+package trust
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// call is the context of a call from addr carrying the metadata pairs.
+func call(addr string, kv ...string) context.Context {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(addr), Port: 40000}})
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(kv...))
+}
+
+func TestGateways(t *testing.T) {
+	g, err := ParseGateways([]string{"127.0.0.1", "::1", "10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[string]bool{"127.0.0.1": true, "::1": true, "10.1.2.3": true, "10.2.0.1": false, "203.0.113.9": false} {
+		if got := g.Trusted(call(addr)); got != want {
+			t.Errorf("Trusted(%s) = %v", addr, got)
+		}
+	}
+
+	if ip := g.ClientIP(call("10.1.2.3", ForwardedForMetadata, "198.51.100.7")); ip != "198.51.100.7" {
+		t.Errorf("ClientIP through a gateway = %q", ip)
+	}
+	if ip := g.ClientIP(call("203.0.113.9", ForwardedForMetadata, "198.51.100.7")); ip != "203.0.113.9" {
+		t.Errorf("ClientIP of another caller = %q, want its own address", ip)
+	}
+	if v := g.Metadata(call("203.0.113.9", "x-actor-id", "admin"), "x-actor-id"); v != "" {
+		t.Errorf("Metadata of another caller = %q", v)
+	}
+	var none *Gateways
+	if none.Trusted(call("127.0.0.1")) {
+		t.Error("nil Gateways trusts a caller")
+	}
+
+	for _, bad := range []string{"localhost", "10.0.0.0/33"} {
+		if _, err := ParseGateways([]string{bad}); err == nil {
+			t.Errorf("ParseGateways(%q) succeeded", bad)
+		}
+	}
+}
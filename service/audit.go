@@ -0,0 +1,105 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/audit"
+	"auth/pkg/logger"
+	"context"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	auditDefaultLimit = 50
+	auditMaxLimit     = 500
+)
+
+// audit records a security event. The actor, address and user agent are
+// those a trusted gateway forwards unless the event names them. An event
+// that cannot be recorded is logged; the action it describes stands.
+func (u *UserService) audit(ctx context.Context, e *pb.AuditEvent) {
+	src := audit.FromIncoming(ctx, u.gateways)
+	if e.ActorId == "" {
+		e.ActorId = src.Actor
+	}
+	if e.Ip == "" {
+		e.Ip = src.IP
+	}
+	e.UserAgent = audit.CleanUserAgent(src.UserAgent)
+	e.RequestId = logger.RequestID(ctx)
+	// The caller going away does not undo what happened.
+	if err := u.Audit.Record(context.WithoutCancel(ctx), e); err != nil {
+		u.log(ctx).Error("Audit event not recorded", "event", e.Event, "outcome", e.Outcome, "error", err)
+	}
+}
+
+// auditRevocation records that tokens were revoked: all those of a user or
+// a SCIM token, for reason.
+func (u *UserService) auditRevocation(ctx context.Context, targetType, targetID, reason string) {
+	u.audit(ctx, &pb.AuditEvent{
+		Event:      audit.EventTokenRevocation,
+		Outcome:    audit.OutcomeSuccess,
+		TargetType: targetType,
+		TargetId:   targetID,
+		Details:    map[string]string{"reason": reason},
+	})
+}
+
+// ListAuditEvents returns a page of the audit events matching the filter,
+// newest first. The query is itself recorded.
+func (u *UserService) ListAuditEvents(ctx context.Context, req *pb.AuditEventFilter) (*pb.AuditEventList, error) {
+	u.log(ctx).Info("ListAuditEvents rpc method started")
+	for _, t := range []string{req.From, req.To} {
+		if t == "" {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, t); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "from and to must be RFC 3339 times")
+		}
+	}
+	switch {
+	case req.Limit < 0 || req.Offset < 0:
+		return nil, status.Error(codes.InvalidArgument, "limit and offset cannot be negative")
+	case req.Limit == 0:
+		req.Limit = auditDefaultLimit
+	case req.Limit > auditMaxLimit:
+		req.Limit = auditMaxLimit
+	}
+
+	res, err := u.Audit.ListAuditEvents(ctx, req)
+	u.audit(ctx, &pb.AuditEvent{
+		Event:   audit.EventAuditQuery,
+		Outcome: audit.Outcome(err),
+		Details: auditFilterDetails(req),
+	})
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+	u.log(ctx).Info("ListAuditEvents rpc method finished")
+	return res, nil
+}
+
+func auditFilterDetails(f *pb.AuditEventFilter) map[string]string {
+	details := map[string]string{
+		"limit":  strconv.FormatInt(f.Limit, 10),
+		"offset": strconv.FormatInt(f.Offset, 10),
+	}
+	for key, value := range map[string]string{
+		"event":     f.Event,
+		"outcome":   f.Outcome,
+		"actor_id":  f.ActorId,
+		"target_id": f.TargetId,
+		"ip":        f.Ip,
+		"from":      f.From,
+		"to":        f.To,
+	} {
+		if value != "" {
+			details[key] = value
+		}
+	}
+	return details
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/audit"
+	"auth/pkg/trust"
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// TestAuditSource checks that events take the end user forwarded by a
+// gateway, and only the address of any other caller.
+func TestAuditSource(t *testing.T) {
+	u, _, events := newTestService(newFakeUsers(testUser()))
+	from := func(ip string) context.Context {
+		return metadata.NewIncomingContext(fromPeer(ip), metadata.Pairs(
+			trust.ForwardedForMetadata, "203.0.113.7",
+			audit.UserAgentMetadata, "Mozilla/5.0",
+			audit.ActorMetadata, "admin",
+		))
+	}
+
+	u.auditRevocation(from(testGateway), audit.TargetUser, "u1", "test")
+	u.auditRevocation(from("10.0.0.2"), audit.TargetUser, "u1", "test")
+	got := events.find(audit.EventTokenRevocation)
+	if len(got) != 2 {
+		t.Fatalf("%d events recorded", len(got))
+	}
+	if e := got[0]; e.ActorId != "admin" || e.Ip != "203.0.113.7" || e.UserAgent != "Mozilla/5.0" {
+		t.Errorf("event of a gateway = %+v", e)
+	}
+	if e := got[1]; e.ActorId != "" || e.Ip != "10.0.0.2" || e.UserAgent != "" {
+		t.Errorf("event of another peer = %+v", e)
+	}
+}
+
+// TestDeviceLoginAudit checks that signing in on a device or by a QR code
+// is recorded as a login.
+func TestDeviceLoginAudit(t *testing.T) {
+	ctx := context.Background()
+	u, _, events := newTestService(newFakeUsers(testUser()))
+	devices := newFakeDevices()
+	u.Devices = devices
+
+	for _, tc := range []struct{ clientID, method string }{
+		{"tv-app", "device"},
+		{QRLoginClient, "qr"},
+	} {
+		deviceCode, deviceCodeHash, err := newSecret()
+		if err != nil {
+			t.Fatal(err)
+		}
+		devices.approve(deviceCodeHash, tc.clientID, "u1")
+		req := &pb.DeviceTokenRequest{DeviceCode: deviceCode, ClientId: tc.clientID}
+		if _, err := u.PollDeviceToken(ctx, req); err != nil {
+			t.Fatalf("%s: %v", tc.method, err)
+		}
+	}
+
+	got := events.find(audit.EventLogin)
+	if len(got) != 2 {
+		t.Fatalf("%d login events recorded, want one per sign in", len(got))
+	}
+	for i, method := range []string{"device", "qr"} {
+		e := got[i]
+		if e.Outcome != audit.OutcomeSuccess || e.ActorId != "u1" || e.TargetId != "u1" || e.Details["method"] != method {
+			t.Errorf("login event = %+v, want a %s sign in of u1", e, method)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"context"
+	"database/sql"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GetTokenProfile returns what the claim mappers of the gateway may put
+// into the access tokens of a user.
+func (u *UserService) GetTokenProfile(ctx context.Context, req *pb.UserId) (*pb.TokenProfile, error) {
+	u.log(ctx).Info("GetTokenProfile rpc method started")
+	res, err := u.Repo.TokenProfile(ctx, req.Id)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, err
+	}
+	u.log(ctx).Info("GetTokenProfile rpc method finished")
+	return res, nil
+}
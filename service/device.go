@@ -0,0 +1,194 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/audit"
+	"auth/storage/postgres"
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// userCodeAlphabet leaves out vowels and look-alike characters, as RFC 8628
+// suggests, so codes are easy to type and never spell words.
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// QRLoginClient is the client id of logins approved by scanning a QR code.
+// They share the device authorization machinery, with the user code acting
+// as the session id in the QR code.
+const QRLoginClient = "qr-login"
+
+// CreateDeviceAuthorization starts an RFC 8628 device authorization for a
+// registered device client, or a QR code login for QRLoginClient.
+func (u *UserService) CreateDeviceAuthorization(ctx context.Context, req *pb.DeviceAuthorizationRequest) (*pb.DeviceAuthorizationResponse, error) {
+	u.log(ctx).Info("CreateDeviceAuthorization rpc method started")
+	ttl, interval, uri := u.oauth.DEVICE_CODE_TTL, u.oauth.DEVICE_POLL_INTERVAL, u.oauth.DEVICE_VERIFICATION_URI
+	if req.ClientId == QRLoginClient {
+		// The gateway polls on behalf of the browser at its own pace.
+		ttl, interval, uri = u.oauth.QR_LOGIN_TTL, 0, u.oauth.QR_LOGIN_URI
+	} else if !slices.Contains(u.oauth.DEVICE_CLIENTS, req.ClientId) {
+		return nil, status.Error(codes.InvalidArgument, "invalid_client")
+	}
+
+	deviceCode, deviceCodeHash, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	auth := postgres.DeviceAuthorization{
+		DeviceCodeHash: deviceCodeHash,
+		ClientID:       req.ClientId,
+		Scope:          req.Scope,
+		RequesterIP:    u.clientIP(ctx, req.Ip),
+		RequesterAgent: req.UserAgent,
+		PollInterval:   interval,
+		ExpiresAt:      time.Now().Add(ttl),
+	}
+
+	// User codes are short, so retry the rare collision with a pending one.
+	for i := 0; ; i++ {
+		auth.UserCode, err = newUserCode()
+		if err != nil {
+			return nil, err
+		}
+		err = u.Devices.CreateDeviceAuthorization(ctx, &auth)
+		var pqErr *pq.Error
+		if i < 3 && errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			continue
+		}
+		break
+	}
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+
+	userCode := auth.UserCode[:4] + "-" + auth.UserCode[4:]
+	u.log(ctx).Info("CreateDeviceAuthorization rpc method finished")
+	return &pb.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationUri:         uri,
+		VerificationUriComplete: uri + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int64(ttl.Seconds()),
+		Interval:                int64(interval.Seconds()),
+	}, nil
+}
+
+// DescribeDeviceCode tells the user who is about to approve a code which
+// client asked for it and from where.
+func (u *UserService) DescribeDeviceCode(ctx context.Context, req *pb.DeviceVerificationRequest) (*pb.DeviceAuthorizationInfo, error) {
+	u.log(ctx).Info("DescribeDeviceCode rpc method started")
+	d, err := u.Devices.GetPendingDeviceAuthorization(ctx, normalizeUserCode(req.UserCode))
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		if errors.Is(err, postgres.ErrDeviceCodeNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, err
+	}
+	u.log(ctx).Info("DescribeDeviceCode rpc method finished")
+	return &pb.DeviceAuthorizationInfo{
+		ClientId:  d.ClientID,
+		Scope:     d.Scope,
+		Ip:        d.RequesterIP,
+		UserAgent: d.RequesterAgent,
+		ExpiresAt: d.ExpiresAt.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// VerifyDeviceCode records whether the signed in user approves the device
+// showing the user code.
+func (u *UserService) VerifyDeviceCode(ctx context.Context, req *pb.DeviceVerificationRequest) (*pb.BoolResponse, error) {
+	u.log(ctx).Info("VerifyDeviceCode rpc method started")
+	err := u.Devices.DecideDeviceAuthorization(ctx, normalizeUserCode(req.UserCode), req.UserId, req.Approve)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		if errors.Is(err, postgres.ErrDeviceCodeNotFound) {
+			return &pb.BoolResponse{Success: false}, status.Error(codes.NotFound, err.Error())
+		}
+		return &pb.BoolResponse{Success: false}, err
+	}
+	u.log(ctx).Info("VerifyDeviceCode rpc method finished")
+	return &pb.BoolResponse{Success: true}, nil
+}
+
+// PollDeviceToken returns the approving user once, with the reason they
+// have to change their password if they do, and records the sign in. Until
+// then the status message carries the RFC 8628 error code for the device.
+func (u *UserService) PollDeviceToken(ctx context.Context, req *pb.DeviceTokenRequest) (*pb.UserInfo, error) {
+	u.log(ctx).Info("PollDeviceToken rpc method started")
+	userID, err := u.Devices.PollDeviceAuthorization(ctx, hashSecret(req.DeviceCode), req.ClientId)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgres.ErrAuthorizationPending):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, postgres.ErrSlowDown):
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		case errors.Is(err, postgres.ErrAccessDenied):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case errors.Is(err, postgres.ErrExpiredToken):
+			return nil, status.Error(codes.DeadlineExceeded, err.Error())
+		}
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+
+	user, err := u.Repo.GetUserByID(ctx, userID)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+	// Like Login, a device only gets the restricted token while the user
+	// has to change their password.
+	user.PasswordChangeReason, err = u.passwordChangeReason(ctx, userID)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+	method := "device"
+	if req.ClientId == QRLoginClient {
+		method = "qr"
+	}
+	u.audit(ctx, &pb.AuditEvent{
+		Event:      audit.EventLogin,
+		Outcome:    audit.OutcomeSuccess,
+		ActorId:    userID,
+		TargetType: audit.TargetUser,
+		TargetId:   userID,
+		Details:    map[string]string{"method": method, "client_id": req.ClientId},
+	})
+	u.log(ctx).Info("PollDeviceToken rpc method finished")
+	return user, nil
+}
+
+func newUserCode() (string, error) {
+	b := make([]byte, 8)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// normalizeUserCode accepts codes typed in lower case or with separators.
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(userCodeAlphabet, r) {
+			return r
+		}
+		return -1
+	}, code)
+}
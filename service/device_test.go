@@ -0,0 +1,87 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestDeviceAuthorization walks a device and a QR code login from the code
+// to the token, and checks that each hands out the user only once.
+func TestDeviceAuthorization(t *testing.T) {
+	ctx := fromPeer(testGateway)
+	u, _, _ := newTestService(newFakeUsers(testUser()))
+	u.Devices = newFakeDevices()
+	u.oauth.DEVICE_CLIENTS = []string{"tv-app"}
+
+	if _, err := u.CreateDeviceAuthorization(ctx, &pb.DeviceAuthorizationRequest{ClientId: "toaster"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreateDeviceAuthorization of an unknown client = %v, want InvalidArgument", err)
+	}
+
+	for _, clientID := range []string{"tv-app", QRLoginClient} {
+		res, err := u.CreateDeviceAuthorization(ctx, &pb.DeviceAuthorizationRequest{ClientId: clientID, Ip: "198.51.100.1"})
+		if err != nil {
+			t.Fatalf("%s: %v", clientID, err)
+		}
+		if clientID == QRLoginClient && res.Interval != 0 {
+			t.Errorf("%s: interval = %d, want none", clientID, res.Interval)
+		}
+		poll := &pb.DeviceTokenRequest{DeviceCode: res.DeviceCode, ClientId: clientID}
+		if _, err := u.PollDeviceToken(ctx, poll); status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("%s: PollDeviceToken before approval = %v, want authorization_pending", clientID, err)
+		}
+
+		// Users may type the code in lower case and without the dash.
+		typed := strings.ToLower(strings.ReplaceAll(res.UserCode, "-", ""))
+		info, err := u.DescribeDeviceCode(ctx, &pb.DeviceVerificationRequest{UserCode: typed})
+		if err != nil {
+			t.Fatalf("%s: %v", clientID, err)
+		}
+		if info.ClientId != clientID || info.Ip != "198.51.100.1" {
+			t.Errorf("%s: DescribeDeviceCode = %+v", clientID, info)
+		}
+		if _, err := u.VerifyDeviceCode(ctx, &pb.DeviceVerificationRequest{UserCode: typed, UserId: "u1", Approve: true}); err != nil {
+			t.Fatalf("%s: %v", clientID, err)
+		}
+		if _, err := u.VerifyDeviceCode(ctx, &pb.DeviceVerificationRequest{UserCode: typed, UserId: "u1", Approve: true}); status.Code(err) != codes.NotFound {
+			t.Errorf("%s: VerifyDeviceCode twice = %v, want NotFound", clientID, err)
+		}
+
+		if _, err := u.PollDeviceToken(ctx, &pb.DeviceTokenRequest{DeviceCode: res.DeviceCode, ClientId: "other"}); status.Code(err) != codes.DeadlineExceeded {
+			t.Errorf("%s: PollDeviceToken of another client = %v, want expired_token", clientID, err)
+		}
+		user, err := u.PollDeviceToken(ctx, poll)
+		if err != nil {
+			t.Fatalf("%s: %v", clientID, err)
+		}
+		if user.Id != "u1" {
+			t.Errorf("%s: PollDeviceToken = %q, want u1", clientID, user.Id)
+		}
+		if _, err := u.PollDeviceToken(ctx, poll); status.Code(err) != codes.DeadlineExceeded {
+			t.Errorf("%s: PollDeviceToken after the token = %v, want expired_token", clientID, err)
+		}
+	}
+}
+
+func TestDeviceAuthorizationDenied(t *testing.T) {
+	ctx := context.Background()
+	u, _, _ := newTestService(newFakeUsers(testUser()))
+	u.Devices = newFakeDevices()
+	u.oauth.DEVICE_CLIENTS = []string{"tv-app"}
+
+	res, err := u.CreateDeviceAuthorization(ctx, &pb.DeviceAuthorizationRequest{ClientId: "tv-app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.VerifyDeviceCode(ctx, &pb.DeviceVerificationRequest{UserCode: res.UserCode, UserId: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+	poll := &pb.DeviceTokenRequest{DeviceCode: res.DeviceCode, ClientId: "tv-app"}
+	if _, err := u.PollDeviceToken(ctx, poll); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("PollDeviceToken after denial = %v, want access_denied", err)
+	}
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/audit"
+	"auth/pkg/password"
+	"auth/storage/postgres"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RequestEmailChange checks the current password and mails a confirmation
+// link to the new address and a cancel link to the current one. The email
+// is only swapped once the link is confirmed.
+//
+// The answer does not tell whether the new address belongs to another
+// account: if it does, its owner is told of the attempt instead of being
+// sent a link, and the rest goes on as usual.
+func (u *UserService) RequestEmailChange(ctx context.Context, req *pb.EmailChangeRequest) (*pb.BoolResponse, error) {
+	u.log(ctx).Info("RequestEmailChange rpc method started")
+	user, err := u.Repo.GetUserByID(ctx, req.UserId)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return &pb.BoolResponse{Success: false}, err
+	}
+	if !password.Verify(user.Password, req.CurrentPassword) {
+		u.log(ctx).Error("Password is incorrect")
+		return &pb.BoolResponse{Success: false}, status.Error(codes.PermissionDenied, "password is incorrect")
+	}
+
+	addr, err := mail.ParseAddress(req.NewEmail)
+	if err != nil || addr.Address != req.NewEmail {
+		return &pb.BoolResponse{Success: false}, status.Error(codes.InvalidArgument, "new email is not a valid address")
+	}
+	if strings.EqualFold(req.NewEmail, user.Email) {
+		return &pb.BoolResponse{Success: false}, status.Error(codes.InvalidArgument, "new email is the current email")
+	}
+	owner, err := u.Repo.GetUserByEmail(ctx, req.NewEmail)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		u.log(ctx).Error(err.Error())
+		return &pb.BoolResponse{Success: false}, err
+	}
+
+	confirm, confirmHash, err := newSecret()
+	if err != nil {
+		return &pb.BoolResponse{Success: false}, err
+	}
+	cancel, cancelHash, err := newSecret()
+	if err != nil {
+		return &pb.BoolResponse{Success: false}, err
+	}
+	expires := time.Now().Add(u.account.EMAIL_CHANGE_TTL)
+
+	err = u.Repo.CreateEmailChange(ctx, &postgres.EmailChange{
+		UserID:           user.Id,
+		OldEmail:         user.Email,
+		NewEmail:         req.NewEmail,
+		ConfirmTokenHash: confirmHash,
+		CancelTokenHash:  cancelHash,
+		ExpiresAt:        expires,
+	})
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return &pb.BoolResponse{Success: false}, err
+	}
+
+	if owner != nil {
+		u.log(ctx).Info("Email change to an address in use", "user_id", user.Id, "owner_id", owner.Id)
+		err = u.notifier.Notify(ctx, req.NewEmail, "Someone tried to use your email address", fmt.Sprintf(
+			"Hi %s,\n\nsomeone asked to move another account to this address. "+
+				"It already belongs to your account, so nothing was changed and there is nothing you need to do.",
+			owner.Username))
+	} else {
+		err = u.notifier.Notify(ctx, req.NewEmail, "Confirm your new email address", fmt.Sprintf(
+			"Hi %s,\n\nopen the link below to use this address for your account:\n%s\n\nThe link expires at %s.",
+			user.Username, u.link("/api/v1/users/email/confirm", confirm), expires.UTC().Format(time.RFC1123)))
+	}
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return &pb.BoolResponse{Success: false}, err
+	}
+	err = u.notifier.Notify(ctx, user.Email, "Your email address is about to change", fmt.Sprintf(
+		"Hi %s,\n\nsomeone asked to change the email of your account to %s.\n"+
+			"If this wasn't you, cancel the change and update your password:\n%s",
+		user.Username, req.NewEmail, u.link("/api/v1/users/email/cancel", cancel)))
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return &pb.BoolResponse{Success: false}, err
+	}
+
+	u.log(ctx).Info("RequestEmailChange rpc method finished")
+	return &pb.BoolResponse{Success: true}, nil
+}
+
+// ConfirmEmailChange applies a pending change and signs the user out
+// everywhere by revoking their refresh tokens.
+func (u *UserService) ConfirmEmailChange(ctx context.Context, req *pb.EmailChangeToken) (*pb.BoolResponse, error) {
+	u.log(ctx).Info("ConfirmEmailChange rpc method started")
+	ch, err := u.Repo.ConfirmEmailChange(ctx, hashSecret(req.Token))
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		if errors.Is(err, postgres.ErrEmailChangeNotFound) {
+			return &pb.BoolResponse{Success: false}, status.Error(codes.NotFound, err.Error())
+		}
+		return &pb.BoolResponse{Success: false}, err
+	}
+	u.log(ctx).Info("Email changed", "user_id", ch.UserID)
+	u.metrics.Revocation("email_change")
+	u.auditRevocation(ctx, audit.TargetUser, ch.UserID, "email_change")
+	u.log(ctx).Info("ConfirmEmailChange rpc method finished")
+	return &pb.BoolResponse{Success: true}, nil
+}
+
+func (u *UserService) CancelEmailChange(ctx context.Context, req *pb.EmailChangeToken) (*pb.BoolResponse, error) {
+	u.log(ctx).Info("CancelEmailChange rpc method started")
+	err := u.Repo.CancelEmailChange(ctx, hashSecret(req.Token))
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		if errors.Is(err, postgres.ErrEmailChangeNotFound) {
+			return &pb.BoolResponse{Success: false}, status.Error(codes.NotFound, err.Error())
+		}
+		return &pb.BoolResponse{Success: false}, err
+	}
+	u.log(ctx).Info("CancelEmailChange rpc method finished")
+	return &pb.BoolResponse{Success: true}, nil
+}
+
+// link builds an absolute link to a gateway route carrying token.
+func (u *UserService) link(path, token string) string {
+	return strings.TrimRight(u.account.PUBLIC_URL, "/") + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/audit"
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// requestEmailChange asks to change the email of u1 to newEmail and returns
+// the tokens of the confirm and cancel links mailed for it.
+func requestEmailChange(t *testing.T, u *UserService, newEmail string) (confirm, cancel string) {
+	t.Helper()
+	req := &pb.EmailChangeRequest{UserId: "u1", CurrentPassword: "correct horse", NewEmail: newEmail}
+	if _, err := u.RequestEmailChange(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	sent := u.notifier.(fakeNotifier)
+	toNew, toOld := <-sent, <-sent
+	if toNew.to != newEmail || toOld.to != "alice@example.com" {
+		t.Fatalf("mailed %s and %s", toNew.to, toOld.to)
+	}
+	return linkToken(t, toNew.body, "/api/v1/users/email/confirm"), linkToken(t, toOld.body, "/api/v1/users/email/cancel")
+}
+
+// linkToken returns the token of the link to path in a message.
+func linkToken(t *testing.T, body, path string) string {
+	t.Helper()
+	_, rest, ok := strings.Cut(body, path+"?token=")
+	if !ok {
+		t.Fatalf("no link to %s in %q", path, body)
+	}
+	token, err := url.QueryUnescape(strings.Fields(rest)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRequestEmailChangeRefused(t *testing.T) {
+	ctx := context.Background()
+	u, _, _ := newTestService(newFakeUsers(testUser()))
+
+	for _, tc := range []struct {
+		password, email string
+		want            codes.Code
+	}{
+		{"wrong", "alice@example.org", codes.PermissionDenied},
+		{"correct horse", "Alice <alice@example.org>", codes.InvalidArgument},
+		{"correct horse", "ALICE@example.com", codes.InvalidArgument},
+	} {
+		req := &pb.EmailChangeRequest{UserId: "u1", CurrentPassword: tc.password, NewEmail: tc.email}
+		if _, err := u.RequestEmailChange(ctx, req); status.Code(err) != tc.want {
+			t.Errorf("RequestEmailChange(%q, %q) = %v, want %v", tc.password, tc.email, err, tc.want)
+		}
+	}
+	if len(u.notifier.(fakeNotifier)) != 0 {
+		t.Error("refused requests mailed a link")
+	}
+}
+
+// TestRequestEmailChangeTaken checks that asking for an address of another
+// account looks the same to the requester, while its owner is only told of
+// the attempt.
+func TestRequestEmailChangeTaken(t *testing.T) {
+	ctx := context.Background()
+	users := newFakeUsers(testUser(), &pb.UserInfo{Id: "u2", Username: "bob", Email: "bob@example.com"})
+	u, _, _ := newTestService(users)
+
+	req := &pb.EmailChangeRequest{UserId: "u1", CurrentPassword: "correct horse", NewEmail: "bob@example.com"}
+	res, err := u.RequestEmailChange(ctx, req)
+	if err != nil || !res.Success {
+		t.Fatalf("RequestEmailChange = %v, %v", res, err)
+	}
+	sent := u.notifier.(fakeNotifier)
+	toOwner, toOld := <-sent, <-sent
+	if toOwner.to != "bob@example.com" || strings.Contains(toOwner.body, "/api/v1/users/email/confirm") {
+		t.Errorf("mailed %s: %q", toOwner.to, toOwner.body)
+	}
+	if toOld.to != "alice@example.com" {
+		t.Errorf("mailed %s", toOld.to)
+	}
+	linkToken(t, toOld.body, "/api/v1/users/email/cancel")
+	if users.users["u1"].Email != "alice@example.com" {
+		t.Errorf("email = %q", users.users["u1"].Email)
+	}
+}
+
+// TestConfirmEmailChange checks that only the latest link applies the
+// change, once, and signs the user out everywhere.
+func TestConfirmEmailChange(t *testing.T) {
+	ctx := context.Background()
+	users := newFakeUsers(testUser())
+	u, _, events := newTestService(users)
+
+	stale, _ := requestEmailChange(t, u, "alice@example.net")
+	confirm, _ := requestEmailChange(t, u, "alice@example.org")
+	if _, err := u.ConfirmEmailChange(ctx, &pb.EmailChangeToken{Token: stale}); status.Code(err) != codes.NotFound {
+		t.Errorf("ConfirmEmailChange of a replaced request = %v, want NotFound", err)
+	}
+
+	if _, err := u.ConfirmEmailChange(ctx, &pb.EmailChangeToken{Token: confirm}); err != nil {
+		t.Fatal(err)
+	}
+	if users.users["u1"].Email != "alice@example.org" {
+		t.Errorf("email = %q", users.users["u1"].Email)
+	}
+	if users.revokedAt["u1"].IsZero() {
+		t.Error("refresh tokens were not revoked")
+	}
+	got := events.find(audit.EventTokenRevocation)
+	if len(got) != 1 || got[0].TargetId != "u1" || got[0].Details["reason"] != "email_change" {
+		t.Errorf("revocation events = %+v", got)
+	}
+
+	if _, err := u.ConfirmEmailChange(ctx, &pb.EmailChangeToken{Token: confirm}); status.Code(err) != codes.NotFound {
+		t.Errorf("ConfirmEmailChange twice = %v, want NotFound", err)
+	}
+}
+
+func TestCancelEmailChange(t *testing.T) {
+	ctx := context.Background()
+	users := newFakeUsers(testUser())
+	u, _, _ := newTestService(users)
+
+	confirm, cancel := requestEmailChange(t, u, "alice@example.org")
+	if _, err := u.CancelEmailChange(ctx, &pb.EmailChangeToken{Token: cancel}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.ConfirmEmailChange(ctx, &pb.EmailChangeToken{Token: confirm}); status.Code(err) != codes.NotFound {
+		t.Errorf("ConfirmEmailChange after cancel = %v, want NotFound", err)
+	}
+	if users.users["u1"].Email != "alice@example.com" {
+		t.Errorf("email = %q", users.users["u1"].Email)
+	}
+	if _, err := u.CancelEmailChange(ctx, &pb.EmailChangeToken{Token: cancel}); status.Code(err) != codes.NotFound {
+		t.Errorf("CancelEmailChange twice = %v, want NotFound", err)
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"auth/config"
+	pb "auth/genproto/users"
+	"auth/pkg/metrics"
+	"auth/pkg/notifier"
+	"auth/storage/postgres"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// loginGuard tracks failed logins per account and per client address and
+// locks a subject out for an exponentially growing period once it exceeds
+// its allowance within the failure window.
+type loginGuard struct {
+	repo     LockoutStore
+	cfg      config.LockoutConfig
+	notifier notifier.Notifier
+	log      *slog.Logger
+	metrics  *metrics.Metrics
+}
+
+// locked reports whether either the account or the address is locked out.
+func (g *loginGuard) locked(ctx context.Context, userID, ip string) (bool, error) {
+	if userID != "" {
+		until, err := g.repo.LockedUntil(ctx, postgres.LockoutScopeUser, userID)
+		if err != nil || !until.IsZero() {
+			return !until.IsZero(), err
+		}
+	}
+	if ip != "" {
+		until, err := g.repo.LockedUntil(ctx, postgres.LockoutScopeIP, ip)
+		if err != nil || !until.IsZero() {
+			return !until.IsZero(), err
+		}
+	}
+	return false, nil
+}
+
+// failure records a failed attempt. user is nil when the login does not
+// belong to any account.
+func (g *loginGuard) failure(ctx context.Context, user *pb.UserInfo, login, ip string) {
+	userID := ""
+	if user != nil {
+		userID = user.Id
+	}
+	g.record(ctx, userID, login, ip, false)
+
+	if user != nil {
+		until, err := g.register(ctx, postgres.LockoutScopeUser, user.Id, g.cfg.MAX_FAILED_LOGINS)
+		if err != nil {
+			g.log.Error(err.Error())
+		} else if !until.IsZero() {
+			g.metrics.Lockout(postgres.LockoutScopeUser)
+			g.notifyLocked(user, ip, until)
+		}
+	}
+	if ip != "" {
+		until, err := g.register(ctx, postgres.LockoutScopeIP, ip, g.cfg.MAX_FAILED_LOGINS_PER_IP)
+		if err != nil {
+			g.log.Error(err.Error())
+		} else if !until.IsZero() {
+			g.metrics.Lockout(postgres.LockoutScopeIP)
+		}
+	}
+}
+
+// success records a successful attempt and clears the account's failures.
+func (g *loginGuard) success(ctx context.Context, user *pb.UserInfo, login, ip string) {
+	g.record(ctx, user.Id, login, ip, true)
+	if err := g.repo.Reset(ctx, postgres.LockoutScopeUser, user.Id); err != nil {
+		g.log.Error(err.Error())
+	}
+}
+
+// record keeps the attempt in the login history without touching any
+// counters.
+func (g *loginGuard) record(ctx context.Context, userID, login, ip string, success bool) {
+	if err := g.repo.RecordAttempt(ctx, userID, login, ip, success); err != nil {
+		g.log.Error(err.Error())
+	}
+}
+
+// register counts a failure for the subject, which is locked out once it
+// reaches limit, and returns the end of the new lockout.
+func (g *loginGuard) register(ctx context.Context, scope, key string, limit int) (time.Time, error) {
+	return g.repo.RegisterFailure(ctx, scope, key, postgres.LockoutPolicy{
+		MaxFailures:  limit,
+		Window:       g.cfg.LOCKOUT_FAILURE_WINDOW,
+		BaseDuration: g.cfg.LOCKOUT_BASE_DURATION,
+		MaxDuration:  g.cfg.LOCKOUT_MAX_DURATION,
+		Decay:        g.cfg.LOCKOUT_DECAY,
+	})
+}
+
+func (g *loginGuard) notifyLocked(user *pb.UserInfo, ip string, until time.Time) {
+	subject, body := notifier.LockoutMessage(user.Username, ip, until)
+
+	// Sent in the background so that delivery time does not leak into the
+	// login response time.
+	go func() {
+		err := g.notifier.Notify(context.Background(), user.Email, subject, body)
+		if err != nil {
+			g.log.Error(err.Error())
+		}
+	}()
+}
+
+// pad sleeps until at least the configured minimum login duration has passed
+// since start, so that every outcome takes about the same time.
+func (g *loginGuard) pad(ctx context.Context, start time.Time) {
+	wait := g.cfg.LOGIN_MIN_DURATION - time.Since(start)
+	if wait <= 0 {
+		return
+	}
+	select {
+	case <-time.After(wait):
+	case <-ctx.Done():
+	}
+}
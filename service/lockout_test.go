@@ -0,0 +1,97 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/audit"
+	"auth/pkg/password"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testPasswordHash is the stored password of testUser, "correct horse".
+var testPasswordHash = func() string {
+	hash, err := password.Hash("correct horse")
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}()
+
+func testUser() *pb.UserInfo {
+	return &pb.UserInfo{Id: "u1", Username: "alice", Email: "alice@example.com", Password: testPasswordHash}
+}
+
+func TestUnlockAccountClearsAddressLockout(t *testing.T) {
+	ctx := fromPeer(testGateway)
+	u, _, events := newTestService(newFakeUsers(testUser()))
+	u.guard.cfg.MAX_FAILED_LOGINS_PER_IP = 2
+
+	for i := 0; i < 2; i++ {
+		u.Login(ctx, &pb.LoginRequest{Login: "alice", Password: "wrong", Ip: "198.51.100.1"})
+	}
+	// Another address locked by failures against some other account.
+	for i := 0; i < 2; i++ {
+		u.Login(ctx, &pb.LoginRequest{Login: "nobody", Password: "wrong", Ip: "198.51.100.2"})
+	}
+	if _, err := u.Login(ctx, &pb.LoginRequest{Login: "alice", Password: "correct horse", Ip: "198.51.100.1"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Login from a locked address = %v", err)
+	}
+
+	if _, err := u.UnlockAccount(ctx, &pb.UserId{Id: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Login(ctx, &pb.LoginRequest{Login: "alice", Password: "correct horse", Ip: "198.51.100.1"}); err != nil {
+		t.Errorf("Login after UnlockAccount = %v", err)
+	}
+	if _, err := u.Login(ctx, &pb.LoginRequest{Login: "alice", Password: "correct horse", Ip: "198.51.100.2"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Login from an address the user never used = %v, want it still locked", err)
+	}
+	if events := events.find(audit.EventAccountUnlock); len(events) != 1 || events[0].Outcome != audit.OutcomeSuccess {
+		t.Errorf("unlock events = %v", events)
+	}
+}
+
+func TestLockoutNotice(t *testing.T) {
+	ctx := fromPeer(testGateway)
+	u, _, _ := newTestService(newFakeUsers(testUser()))
+	u.guard.cfg.MAX_FAILED_LOGINS = 2
+
+	for i := 0; i < 2; i++ {
+		u.Login(ctx, &pb.LoginRequest{Login: "alice@example.com", Password: "wrong", Ip: "203.0.113.7"})
+	}
+	select {
+	case m := <-u.guard.notifier.(fakeNotifier):
+		if m.to != "alice@example.com" || m.subject != "Your account has been locked" {
+			t.Errorf("notice = %+v", m)
+		}
+		if !strings.Contains(m.body, "Hi alice,") || !strings.Contains(m.body, "from 203.0.113.7.") {
+			t.Errorf("notice body = %q", m.body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no lockout notice sent")
+	}
+}
+
+// TestLockoutIgnoresReportedAddress checks that a caller other than the
+// gateway cannot escape the lockout of its address by making one up.
+func TestLockoutIgnoresReportedAddress(t *testing.T) {
+	ctx := fromPeer("203.0.113.9")
+	u, lockouts, _ := newTestService(newFakeUsers(testUser()))
+	u.guard.cfg.MAX_FAILED_LOGINS_PER_IP = 2
+
+	for _, ip := range []string{"198.51.100.1", "198.51.100.2"} {
+		u.Login(ctx, &pb.LoginRequest{Login: "nobody", Password: "wrong", Ip: ip})
+	}
+	if _, err := u.Login(ctx, &pb.LoginRequest{Login: "alice", Password: "correct horse", Ip: "198.51.100.3"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Login from a locked address = %v", err)
+	}
+	for _, a := range lockouts.attempts {
+		if a.ip != "203.0.113.9" {
+			t.Errorf("attempt recorded from %q, want the address of the caller", a.ip)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/audit"
+	"auth/pkg/password"
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// checkPassword holds a new password to the policy. For existing users,
+// current is the hash of their password and the last PASSWORD_HISTORY ones
+// may not be reused either. field names the request field in the error
+// details.
+func (u *UserService) checkPassword(ctx context.Context, field, pw, userID, current string, account password.Account) error {
+	violations, err := u.passwords.Check(ctx, pw, account)
+	if err != nil {
+		return err
+	}
+	if userID != "" && len(violations) == 0 {
+		reused := password.Verify(current, pw)
+		if !reused && u.passwordCfg.PASSWORD_HISTORY > 0 {
+			hashes, err := u.Repo.PasswordHistory(ctx, userID, u.passwordCfg.PASSWORD_HISTORY)
+			if err != nil {
+				return err
+			}
+			reused = password.InHistory(hashes, pw)
+		}
+		if reused {
+			violations = append(violations, password.Violation{
+				Reason:      password.ReasonReused,
+				Description: "must differ from your recent passwords",
+			})
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return passwordError(field, violations)
+}
+
+// unknownPassword hashes a random password nobody is told, for accounts
+// that sign in through their organization.
+func unknownPassword() (string, error) {
+	secret, _, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	return password.Hash(secret)
+}
+
+// passwordError reports the violations as field violations of a
+// BadRequest, followed by one ErrorInfo per violation, in the same order,
+// carrying its machine readable reason.
+func passwordError(field string, violations []password.Violation) error {
+	st := status.New(codes.InvalidArgument, "password does not meet the password policy")
+	badRequest := &errdetails.BadRequest{}
+	details := []protoadapt.MessageV1{badRequest}
+	for _, v := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: v.Description,
+		})
+		details = append(details, &errdetails.ErrorInfo{
+			Reason:   v.Reason,
+			Domain:   "auth",
+			Metadata: map[string]string{"field": field},
+		})
+	}
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// Reasons a user has to change their password before anything else.
+const (
+	passwordChangeForced  = "forced"
+	passwordChangeExpired = "expired"
+)
+
+func (u *UserService) passwordChangeReason(ctx context.Context, userID string) (string, error) {
+	mustChange, expired, err := u.Repo.PasswordState(ctx, userID, u.passwordCfg.PASSWORD_MAX_AGE_DAYS)
+	switch {
+	case err != nil:
+		return "", err
+	case mustChange:
+		return passwordChangeForced, nil
+	case expired:
+		return passwordChangeExpired, nil
+	}
+	return "", nil
+}
+
+// ForcePasswordChange makes the user change their password at the next
+// login, for example after their credentials leaked. Their sessions end.
+func (u *UserService) ForcePasswordChange(ctx context.Context, req *pb.UserId) (*pb.BoolResponse, error) {
+	u.log(ctx).Info("ForcePasswordChange rpc method started")
+	err := u.Repo.ForcePasswordChange(ctx, req.Id)
+	u.audit(ctx, &pb.AuditEvent{Event: audit.EventPasswordChangeForced, Outcome: audit.Outcome(err), TargetType: audit.TargetUser, TargetId: req.Id})
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		if errors.Is(err, sql.ErrNoRows) {
+			return &pb.BoolResponse{Success: false}, status.Error(codes.NotFound, "user not found")
+		}
+		return &pb.BoolResponse{Success: false}, err
+	}
+	u.metrics.Revocation("password_change_forced")
+	u.auditRevocation(ctx, audit.TargetUser, req.Id, "password_change_forced")
+	u.log(ctx).Info("ForcePasswordChange rpc method finished")
+	return &pb.BoolResponse{Success: true}, nil
+}
+
+// SetPasswordExpiry sets how long passwords of the members of an
+// organization are good for.
+func (u *UserService) SetPasswordExpiry(ctx context.Context, req *pb.PasswordExpiryRequest) (*pb.BoolResponse, error) {
+	u.log(ctx).Info("SetPasswordExpiry rpc method started")
+	if req.MaxAgeDays < 0 || req.MaxAgeDays > 3650 {
+		return &pb.BoolResponse{Success: false}, status.Error(codes.InvalidArgument, "max_age_days must be between 0 and 3650")
+	}
+	err := u.Repo.SetPasswordMaxAge(ctx, req.Organization, int(req.MaxAgeDays))
+	u.audit(ctx, &pb.AuditEvent{
+		Event:      audit.EventPasswordExpiry,
+		Outcome:    audit.Outcome(err),
+		TargetType: audit.TargetOrganization,
+		TargetId:   req.Organization,
+		Details:    map[string]string{"max_age_days": strconv.FormatInt(req.MaxAgeDays, 10)},
+	})
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		if errors.Is(err, sql.ErrNoRows) {
+			return &pb.BoolResponse{Success: false}, status.Error(codes.NotFound, "organization not found")
+		}
+		return &pb.BoolResponse{Success: false}, err
+	}
+	u.log(ctx).Info("SetPasswordExpiry rpc method finished")
+	return &pb.BoolResponse{Success: true}, nil
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/password"
+	"auth/pkg/saml"
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestForcedPasswordChange checks that every way of signing in tells the
+// gateway to issue the restricted token, and that refreshing is refused.
+func TestForcedPasswordChange(t *testing.T) {
+	ctx := context.Background()
+	users := newFakeUsers(testUser())
+	users.mustChange["u1"] = true
+	u, _, _ := newTestService(users)
+
+	user, err := u.Login(ctx, &pb.LoginRequest{Login: "alice", Password: "correct horse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.PasswordChangeReason != passwordChangeForced {
+		t.Errorf("Login: PasswordChangeReason = %q, want %q", user.PasswordChangeReason, passwordChangeForced)
+	}
+
+	var token pb.Tokens
+	if err := u.tokens.GeneratedRefreshToken(testUser(), &token, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.CheckRefreshToken(ctx, &pb.CheckRefreshTokenRequest{RefreshToken: token.Refreshtoken}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("CheckRefreshToken = %v, want FailedPrecondition", err)
+	}
+
+	deviceCode, deviceCodeHash, err := newSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices := newFakeDevices()
+	devices.approve(deviceCodeHash, QRLoginClient, "u1")
+	u.Devices = devices
+	user, err = u.PollDeviceToken(ctx, &pb.DeviceTokenRequest{DeviceCode: deviceCode, ClientId: QRLoginClient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.PasswordChangeReason != passwordChangeForced {
+		t.Errorf("PollDeviceToken: PasswordChangeReason = %q, want %q", user.PasswordChangeReason, passwordChangeForced)
+	}
+
+	users.identities["skyway/s-1"] = "u1"
+	u.providers = map[string]*saml.Provider{"skyway": {ID: "skyway", Organization: "skyway-travel"}}
+	user, err = u.SSOLogin(ctx, &pb.SSOLoginRequest{Provider: "skyway", Subject: "s-1", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.PasswordChangeReason != passwordChangeForced {
+		t.Errorf("SSOLogin: PasswordChangeReason = %q, want %q", user.PasswordChangeReason, passwordChangeForced)
+	}
+}
+
+// TestPasswordsAreHashed checks that passwords are stored as hashes only
+// and that the replaced ones may not be used again.
+func TestPasswordsAreHashed(t *testing.T) {
+	ctx := context.Background()
+	users := newFakeUsers()
+	u, _, _ := newTestService(users)
+
+	const first, second = "rowing-teapot-over-moss", "quiet-lantern-under-snow"
+	res, err := u.Register(ctx, &pb.RegisterRequest{Username: "bob", Email: "bob@example.com", Password: first, FullName: "Bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := func() string {
+		user, err := users.GetUserByID(ctx, res.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.Password
+	}
+	if stored() == first || !password.Verify(stored(), first) {
+		t.Errorf("Register stored %q", stored())
+	}
+	if _, err := u.Login(ctx, &pb.LoginRequest{Login: "bob", Password: first}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := u.EmailRecovery(ctx, &pb.EmailRecoveryRequest{UserId: res.Id, OldPassword: second, NewPassword: first}); err == nil {
+		t.Error("EmailRecovery with a wrong password succeeded")
+	}
+	if _, err := u.EmailRecovery(ctx, &pb.EmailRecoveryRequest{UserId: res.Id, OldPassword: first, NewPassword: second}); err != nil {
+		t.Fatal(err)
+	}
+	if stored() == second || !password.Verify(stored(), second) {
+		t.Errorf("EmailRecovery stored %q", stored())
+	}
+	if _, err := u.Login(ctx, &pb.LoginRequest{Login: "bob", Password: first}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Login with the old password = %v, want Unauthenticated", err)
+	}
+	if _, err := u.EmailRecovery(ctx, &pb.EmailRecoveryRequest{UserId: res.Id, OldPassword: second, NewPassword: first}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("EmailRecovery back to the old password = %v, want InvalidArgument", err)
+	}
+	if _, err := u.EmailRecovery(ctx, &pb.EmailRecoveryRequest{UserId: res.Id, OldPassword: second, NewPassword: second}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("EmailRecovery to the same password = %v, want InvalidArgument", err)
+	}
+}
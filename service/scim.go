@@ -0,0 +1,322 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/audit"
+	"auth/pkg/scim"
+	"auth/storage/postgres"
+	"context"
+	"database/sql"
+	"errors"
+	"net/mail"
+	"strings"
+
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	scimDefaultCount = 100
+	scimMaxCount     = 500
+)
+
+// CreateScimToken issues a bearer token a partner agency provisions its
+// staff with. The token is only shown once.
+func (u *UserService) CreateScimToken(ctx context.Context, req *pb.ScimTokenRequest) (*pb.ScimTokenResponse, error) {
+	u.log(ctx).Info("CreateScimToken rpc method started")
+	if req.Organization == "" {
+		return nil, status.Error(codes.InvalidArgument, "organization is required")
+	}
+	token, hash, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	id, err := u.Repo.CreateScimToken(ctx, req.Organization, hash, req.Description)
+	u.audit(ctx, &pb.AuditEvent{
+		Event:      audit.EventScimTokenCreation,
+		Outcome:    audit.Outcome(err),
+		TargetType: audit.TargetScimToken,
+		TargetId:   id,
+		Details:    map[string]string{"organization": req.Organization},
+	})
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+	u.log(ctx).Info("CreateScimToken rpc method finished")
+	return &pb.ScimTokenResponse{Id: id, Token: token, Organization: req.Organization}, nil
+}
+
+func (u *UserService) RevokeScimToken(ctx context.Context, req *pb.ScimResourceId) (*pb.BoolResponse, error) {
+	u.log(ctx).Info("RevokeScimToken rpc method started")
+	err := u.Repo.RevokeScimToken(ctx, req.Id)
+	u.audit(ctx, &pb.AuditEvent{Event: audit.EventScimTokenRevocation, Outcome: audit.Outcome(err), TargetType: audit.TargetScimToken, TargetId: req.Id})
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return &pb.BoolResponse{Success: false}, scimError(err)
+	}
+	u.metrics.Revocation("scim_token")
+	u.auditRevocation(ctx, audit.TargetScimToken, req.Id, "scim_token")
+	u.log(ctx).Info("RevokeScimToken rpc method finished")
+	return &pb.BoolResponse{Success: true}, nil
+}
+
+// AuthenticateScimToken tells which organization a bearer token belongs to.
+func (u *UserService) AuthenticateScimToken(ctx context.Context, req *pb.ScimToken) (*pb.ScimPartner, error) {
+	u.log(ctx).Info("AuthenticateScimToken rpc method started")
+	partner, err := u.Repo.AuthenticateScimToken(ctx, hashSecret(req.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Error(codes.Unauthenticated, "invalid SCIM token")
+	}
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+	u.log(ctx).Info("AuthenticateScimToken rpc method finished")
+	return partner, nil
+}
+
+func (u *UserService) ScimListUsers(ctx context.Context, req *pb.ScimListRequest) (*pb.ScimUserList, error) {
+	u.log(ctx).Info("ScimListUsers rpc method started")
+	filter, start, count, err := scimPage(req)
+	if err != nil {
+		return nil, err
+	}
+	users, total, err := u.Repo.ScimListUsers(ctx, req.OrganizationId, filter, start, count)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, scimError(err)
+	}
+	u.log(ctx).Info("ScimListUsers rpc method finished")
+	return &pb.ScimUserList{TotalResults: total, Resources: users}, nil
+}
+
+func (u *UserService) ScimGetUser(ctx context.Context, req *pb.ScimResourceId) (*pb.ScimUser, error) {
+	u.log(ctx).Info("ScimGetUser rpc method started")
+	user, err := u.Repo.ScimGetUser(ctx, req.OrganizationId, req.Id)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, scimError(err)
+	}
+	u.log(ctx).Info("ScimGetUser rpc method finished")
+	return user, nil
+}
+
+// ScimCreateUser provisions an account for a member of staff of the
+// partner. The account gets an unusable password; staff sign in through
+// the single sign-on of their agency.
+func (u *UserService) ScimCreateUser(ctx context.Context, req *pb.ScimUserRequest) (*pb.ScimUser, error) {
+	u.log(ctx).Info("ScimCreateUser rpc method started")
+	if err := validateScimUser(req.User); err != nil {
+		return nil, err
+	}
+	if !req.User.Active {
+		return nil, status.Error(codes.InvalidArgument, "cannot provision an inactive user")
+	}
+	username, err := u.freeUsername(ctx, req.User.UserName, req.User.Email)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+	password, err := unknownPassword()
+	if err != nil {
+		return nil, err
+	}
+	user, err := u.Repo.ScimCreateUser(ctx, req.OrganizationId, req.User, username, password)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, scimError(err)
+	}
+	u.log(ctx).Info("ScimCreateUser rpc method finished")
+	return user, nil
+}
+
+// ScimReplaceUser updates a provisioned account. An inactive user is
+// deprovisioned.
+func (u *UserService) ScimReplaceUser(ctx context.Context, req *pb.ScimUserRequest) (*pb.ScimUser, error) {
+	u.log(ctx).Info("ScimReplaceUser rpc method started")
+	if err := validateScimUser(req.User); err != nil {
+		return nil, err
+	}
+	user, err := u.Repo.ScimReplaceUser(ctx, req.OrganizationId, req.User, req.IfMatch)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, scimError(err)
+	}
+	u.log(ctx).Info("ScimReplaceUser rpc method finished")
+	return user, nil
+}
+
+func (u *UserService) ScimDeleteUser(ctx context.Context, req *pb.ScimResourceId) (*pb.BoolResponse, error) {
+	u.log(ctx).Info("ScimDeleteUser rpc method started")
+	err := u.Repo.ScimDeleteUser(ctx, req.OrganizationId, req.Id)
+	u.audit(ctx, &pb.AuditEvent{
+		Event:      audit.EventAccountDeletion,
+		Outcome:    audit.Outcome(err),
+		ActorId:    audit.ScimActor(req.OrganizationId),
+		TargetType: audit.TargetUser,
+		TargetId:   req.Id,
+	})
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return &pb.BoolResponse{Success: false}, scimError(err)
+	}
+	u.log(ctx).Info("ScimDeleteUser rpc method finished")
+	return &pb.BoolResponse{Success: true}, nil
+}
+
+func (u *UserService) ScimListGroups(ctx context.Context, req *pb.ScimListRequest) (*pb.ScimGroupList, error) {
+	u.log(ctx).Info("ScimListGroups rpc method started")
+	filter, start, count, err := scimPage(req)
+	if err != nil {
+		return nil, err
+	}
+	groups, total, err := u.Repo.ScimListGroups(ctx, req.OrganizationId, filter, start, count)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, scimError(err)
+	}
+	u.log(ctx).Info("ScimListGroups rpc method finished")
+	return &pb.ScimGroupList{TotalResults: total, Resources: groups}, nil
+}
+
+func (u *UserService) ScimGetGroup(ctx context.Context, req *pb.ScimResourceId) (*pb.ScimGroup, error) {
+	u.log(ctx).Info("ScimGetGroup rpc method started")
+	group, err := u.Repo.ScimGetGroup(ctx, req.OrganizationId, req.Id)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, scimError(err)
+	}
+	u.log(ctx).Info("ScimGetGroup rpc method finished")
+	return group, nil
+}
+
+func (u *UserService) ScimCreateGroup(ctx context.Context, req *pb.ScimGroupRequest) (*pb.ScimGroup, error) {
+	u.log(ctx).Info("ScimCreateGroup rpc method started")
+	if req.Group == nil || strings.TrimSpace(req.Group.DisplayName) == "" {
+		return nil, status.Error(codes.InvalidArgument, "displayName is required")
+	}
+	group, err := u.Repo.ScimCreateGroup(ctx, req.OrganizationId, req.Group)
+	u.auditGroup(ctx, req.OrganizationId, "create", group, req.Group, err)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, scimError(err)
+	}
+	u.log(ctx).Info("ScimCreateGroup rpc method finished")
+	return group, nil
+}
+
+func (u *UserService) ScimReplaceGroup(ctx context.Context, req *pb.ScimGroupRequest) (*pb.ScimGroup, error) {
+	u.log(ctx).Info("ScimReplaceGroup rpc method started")
+	if req.Group == nil || strings.TrimSpace(req.Group.DisplayName) == "" {
+		return nil, status.Error(codes.InvalidArgument, "displayName is required")
+	}
+	group, err := u.Repo.ScimReplaceGroup(ctx, req.OrganizationId, req.Group, req.IfMatch)
+	u.auditGroup(ctx, req.OrganizationId, "replace", group, req.Group, err)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, scimError(err)
+	}
+	u.log(ctx).Info("ScimReplaceGroup rpc method finished")
+	return group, nil
+}
+
+func (u *UserService) ScimDeleteGroup(ctx context.Context, req *pb.ScimResourceId) (*pb.BoolResponse, error) {
+	u.log(ctx).Info("ScimDeleteGroup rpc method started")
+	err := u.Repo.ScimDeleteGroup(ctx, req.OrganizationId, req.Id)
+	u.auditGroup(ctx, req.OrganizationId, "delete", nil, &pb.ScimGroup{Id: req.Id}, err)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return &pb.BoolResponse{Success: false}, scimError(err)
+	}
+	u.log(ctx).Info("ScimDeleteGroup rpc method finished")
+	return &pb.BoolResponse{Success: true}, nil
+}
+
+// auditGroup records a change to a SCIM group as a change of the roles of
+// its members, since groups end up in their access tokens. requested
+// stands in for the group when the change failed.
+func (u *UserService) auditGroup(ctx context.Context, organizationID, change string, group, requested *pb.ScimGroup, err error) {
+	details := map[string]string{"change": change}
+	if group == nil {
+		group = requested
+	}
+	if group.DisplayName != "" {
+		details["display_name"] = group.DisplayName
+	}
+	if change != "delete" {
+		members := make([]string, len(group.Members))
+		for i, m := range group.Members {
+			members[i] = m.Value
+		}
+		details["members"] = strings.Join(members, ",")
+	}
+	u.audit(ctx, &pb.AuditEvent{
+		Event:      audit.EventRoleChange,
+		Outcome:    audit.Outcome(err),
+		ActorId:    audit.ScimActor(organizationID),
+		TargetType: audit.TargetGroup,
+		TargetId:   group.Id,
+		Details:    details,
+	})
+}
+
+// scimPage parses the filter and applies the defaults of startIndex and
+// count, which SCIM counts from 1.
+func scimPage(req *pb.ScimListRequest) (scim.Filter, int64, int64, error) {
+	var filter scim.Filter
+	if req.Filter != "" {
+		f, err := scim.ParseFilter(req.Filter)
+		if err != nil {
+			return nil, 0, 0, status.Error(codes.InvalidArgument, err.Error())
+		}
+		filter = f
+	}
+	start, count := req.StartIndex, req.Count
+	if start < 1 {
+		start = 1
+	}
+	if count < 1 {
+		count = scimDefaultCount
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+	return filter, start, count, nil
+}
+
+func validateScimUser(user *pb.ScimUser) error {
+	if user == nil || strings.TrimSpace(user.UserName) == "" {
+		return status.Error(codes.InvalidArgument, "userName is required")
+	}
+	if _, err := mail.ParseAddress(user.Email); err != nil {
+		return status.Error(codes.InvalidArgument, "a valid email is required")
+	}
+	if user.FullName == "" {
+		user.FullName = user.UserName
+	}
+	return nil
+}
+
+// scimError maps repository errors to the status codes the gateway turns
+// into SCIM error responses.
+func scimError(err error) error {
+	var scimErr *scim.Error
+	var pqErr *pq.Error
+	switch {
+	case errors.As(err, &scimErr):
+		return status.Error(codes.InvalidArgument, scimErr.Detail)
+	case errors.Is(err, postgres.ErrScimNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, postgres.ErrScimVersionMismatch):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, postgres.ErrScimInvalidMember):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.As(err, &pqErr) && pqErr.Code == "23505":
+		return status.Error(codes.AlreadyExists, "a resource with this name already exists")
+	case errors.As(err, &pqErr) && pqErr.Code == "22P02":
+		return status.Error(codes.InvalidArgument, "invalid value in filter")
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/audit"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	usernameInvalidChars  = regexp.MustCompile(`[^A-Za-z0-9._]+`)
+	usernameRepeatedMarks = regexp.MustCompile(`[._]{2,}`)
+)
+
+// SSOLogin signs in a user asserted by the identity provider of an agency.
+// The gateway has already validated the assertion. The first sign in of a
+// subject creates an account, or links the account with the asserted email
+// when the provider is trusted to do so. The organization and whether to
+// link come from the provider's configuration; the request's Organization,
+// OrganizationName and LinkByEmail are ignored since any caller of the RPC
+// could set them.
+func (u *UserService) SSOLogin(ctx context.Context, req *pb.SSOLoginRequest) (*pb.UserInfo, error) {
+	u.log(ctx).Info("SSOLogin rpc method started")
+	if req.Provider == "" || req.Subject == "" {
+		return nil, status.Error(codes.InvalidArgument, "provider and subject are required")
+	}
+	provider, ok := u.providers[req.Provider]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "unknown identity provider")
+	}
+	orgName := provider.OrganizationName
+	if orgName == "" {
+		orgName = provider.Organization
+	}
+
+	ssoEvent := func(outcome, userID string) {
+		e := &pb.AuditEvent{
+			Event:      audit.EventSSOLogin,
+			Outcome:    outcome,
+			TargetType: audit.TargetUser,
+			TargetId:   userID,
+			Details:    map[string]string{"provider": req.Provider, "subject": req.Subject, "organization": provider.Organization},
+		}
+		if outcome == audit.OutcomeSuccess {
+			e.ActorId = userID
+		}
+		u.audit(ctx, e)
+	}
+	// signedIn finishes a successful sign in. As with Login, the gateway
+	// only issues the restricted token while the password has to change.
+	signedIn := func(user *pb.UserInfo) (*pb.UserInfo, error) {
+		reason, err := u.passwordChangeReason(ctx, user.Id)
+		if err != nil {
+			u.log(ctx).Error(err.Error())
+			return nil, err
+		}
+		user.PasswordChangeReason = reason
+		ssoEvent(audit.OutcomeSuccess, user.Id)
+		u.log(ctx).Info("SSOLogin rpc method finished")
+		return user, nil
+	}
+
+	user, err := u.Repo.GetUserBySSOIdentity(ctx, req.Provider, req.Subject)
+	if err == nil {
+		return signedIn(user)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+
+	if req.Email == "" {
+		return nil, status.Error(codes.InvalidArgument, "identity provider did not assert an email")
+	}
+	orgID, err := u.Repo.EnsureOrganization(ctx, provider.Organization, orgName)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+
+	existing, err := u.Repo.GetUserByEmail(ctx, req.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+	if existing != nil {
+		// Accounts their agency provisioned over SCIM are linked regardless.
+		orgOf, err := u.Repo.UserOrganization(ctx, existing.Id)
+		if err != nil {
+			u.log(ctx).Error(err.Error())
+			return nil, err
+		}
+		if !provider.LinkByEmail && orgOf != orgID {
+			u.log(ctx).Error("SSO email belongs to an existing account", "provider", req.Provider, "subject", req.Subject)
+			ssoEvent(audit.OutcomeFailure, existing.Id)
+			return nil, status.Error(codes.AlreadyExists, "an account with this email already exists")
+		}
+		if err := u.Repo.LinkSSOIdentity(ctx, req.Provider, req.Subject, existing.Id, orgID); err != nil {
+			u.log(ctx).Error(err.Error())
+			return nil, err
+		}
+		return signedIn(existing)
+	}
+
+	username, err := u.freeUsername(ctx, req.Username, req.Email)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+	fullName := req.FullName
+	if fullName == "" {
+		fullName = username
+	}
+	// SSO accounts sign in through their agency; nobody knows this password.
+	password, err := unknownPassword()
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+	user, err = u.Repo.CreateSSOUser(ctx, &pb.UserInfo{
+		Username: username,
+		Email:    req.Email,
+		Password: password,
+		FullName: fullName,
+	}, req.Provider, req.Subject, orgID)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+
+	return signedIn(user)
+}
+
+// freeUsername turns the preferred username, or the local part of the
+// email, into a valid username and numbers it until it is free.
+func (u *UserService) freeUsername(ctx context.Context, preferred, email string) (string, error) {
+	base, _, _ := strings.Cut(preferred, "@")
+	if base == "" {
+		base, _, _ = strings.Cut(email, "@")
+	}
+	base = usernameInvalidChars.ReplaceAllString(base, "_")
+	base = usernameRepeatedMarks.ReplaceAllString(base, "_")
+	if len(base) > 25 {
+		base = base[:25]
+	}
+	base = strings.Trim(base, "._")
+	for len(base) < 3 {
+		base += "0"
+	}
+
+	for i := 0; i < 100; i++ {
+		candidate := base
+		if i > 0 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+		err := u.checkUsername(ctx, "", candidate)
+		if err == nil {
+			return candidate, nil
+		}
+		if c := status.Code(err); c != codes.AlreadyExists && c != codes.InvalidArgument {
+			return "", err
+		}
+	}
+	return "", status.Error(codes.AlreadyExists, "no free username left for this account")
+}
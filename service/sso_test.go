@@ -0,0 +1,55 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/audit"
+	"auth/pkg/saml"
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSSOLoginLinking(t *testing.T) {
+	ctx := context.Background()
+	users := newFakeUsers(testUser())
+	users.orgs["other"] = "org-other"
+	users.orgOf["u1"] = "org-other"
+	u, _, events := newTestService(users)
+	u.providers = map[string]*saml.Provider{
+		"skyway":  {ID: "skyway", Organization: "skyway-travel"},
+		"trusted": {ID: "trusted", Organization: "trusted-travel", LinkByEmail: true},
+	}
+
+	// The request asks for linking and names the user's organization; both
+	// are the caller's to make up and must not matter.
+	_, err := u.SSOLogin(ctx, &pb.SSOLoginRequest{
+		Provider:     "skyway",
+		Subject:      "s-1",
+		Email:        "alice@example.com",
+		Organization: "other",
+		LinkByEmail:  true,
+	})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("SSOLogin for a provider without linking = %v, want AlreadyExists", err)
+	}
+	if _, ok := users.identities["skyway/s-1"]; ok {
+		t.Error("the identity was linked to the existing account")
+	}
+	if failed := events.find(audit.EventSSOLogin); len(failed) != 1 || failed[0].Outcome != audit.OutcomeFailure {
+		t.Errorf("SSO login events = %v, want one failure", failed)
+	}
+
+	if _, err := u.SSOLogin(ctx, &pb.SSOLoginRequest{Provider: "unknown", Subject: "s-1", Email: "alice@example.com"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SSOLogin for an unknown provider = %v, want InvalidArgument", err)
+	}
+
+	user, err := u.SSOLogin(ctx, &pb.SSOLoginRequest{Provider: "trusted", Subject: "t-1", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Id != "u1" || users.identities["trusted/t-1"] != "u1" {
+		t.Errorf("SSOLogin for a provider with linking signed in %q, want the existing account", user.Id)
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/scim"
+	"auth/storage/postgres"
+	"context"
+	"time"
+)
+
+// UserStore keeps the users, their credentials and the organizations they
+// belong to; *postgres.UserRepo in production.
+type UserStore interface {
+	CreateUser(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error)
+	GetUserByID(ctx context.Context, id string) (*pb.UserInfo, error)
+	GetUserByEmail(ctx context.Context, email string) (*pb.UserInfo, error)
+	GetUserByUsername(ctx context.Context, username string) (*pb.UserInfo, error)
+	GetUserByLogin(ctx context.Context, login string) (*pb.UserInfo, error)
+	GetUserProfile(ctx context.Context, id *pb.UserId) (*pb.GetProfileResponse, error)
+	UpdateUser(ctx context.Context, req *pb.UpdateProfileRequest) (*pb.UpdateProfileResponse, error)
+	GetUsers(ctx context.Context, req *pb.GetUsersRequest) (*pb.GetUsersResponse, error)
+	DeleteUser(ctx context.Context, id string) error
+	GetUserActivity(ctx context.Context, userID string) (*pb.ActivityResponse, error)
+	Follow(ctx context.Context, followerID string, followingID string) (*pb.FollowResponse, error)
+	GetFollowers(ctx context.Context, followerID string, limit, offset int64) (*pb.FollowersResponse, error)
+	TokenProfile(ctx context.Context, userID string) (*pb.TokenProfile, error)
+	TokensRevokedAt(ctx context.Context, userID string) (time.Time, error)
+	RevokeTokens(ctx context.Context, userID string) error
+
+	CreateEmailChange(ctx context.Context, ch *postgres.EmailChange) error
+	ConfirmEmailChange(ctx context.Context, confirmTokenHash string) (*postgres.EmailChange, error)
+	CancelEmailChange(ctx context.Context, cancelTokenHash string) error
+
+	LastUsernameChange(ctx context.Context, userID string) (time.Time, error)
+	UsernameReservedBy(ctx context.Context, username string) (string, error)
+	ChangeUsername(ctx context.Context, userID, username string, cooldown, reservation time.Duration) (string, error)
+	ResolveUsername(ctx context.Context, username string) (*pb.Users, bool, error)
+
+	PasswordHistory(ctx context.Context, userID string, n int) ([]string, error)
+	ChangePassword(ctx context.Context, userID, hash, oldHash string, keep int) error
+	PasswordState(ctx context.Context, userID string, defaultMaxAgeDays int) (mustChange, expired bool, err error)
+	ForcePasswordChange(ctx context.Context, userID string) error
+	SetPasswordMaxAge(ctx context.Context, slug string, days int) error
+
+	EnsureOrganization(ctx context.Context, slug, name string) (string, error)
+	GetUserBySSOIdentity(ctx context.Context, provider, subject string) (*pb.UserInfo, error)
+	LinkSSOIdentity(ctx context.Context, provider, subject, userID, organizationID string) error
+	CreateSSOUser(ctx context.Context, user *pb.UserInfo, provider, subject, organizationID string) (*pb.UserInfo, error)
+	UserOrganization(ctx context.Context, userID string) (string, error)
+
+	CreateScimToken(ctx context.Context, slug, tokenHash, description string) (string, error)
+	RevokeScimToken(ctx context.Context, id string) error
+	AuthenticateScimToken(ctx context.Context, tokenHash string) (*pb.ScimPartner, error)
+	ScimListUsers(ctx context.Context, orgID string, filter scim.Filter, startIndex, count int64) ([]*pb.ScimUser, int64, error)
+	ScimGetUser(ctx context.Context, orgID, id string) (*pb.ScimUser, error)
+	ScimCreateUser(ctx context.Context, orgID string, user *pb.ScimUser, username, password string) (*pb.ScimUser, error)
+	ScimReplaceUser(ctx context.Context, orgID string, user *pb.ScimUser, ifMatch string) (*pb.ScimUser, error)
+	ScimDeleteUser(ctx context.Context, orgID, id string) error
+	ScimListGroups(ctx context.Context, orgID string, filter scim.Filter, startIndex, count int64) ([]*pb.ScimGroup, int64, error)
+	ScimGetGroup(ctx context.Context, orgID, id string) (*pb.ScimGroup, error)
+	ScimCreateGroup(ctx context.Context, orgID string, group *pb.ScimGroup) (*pb.ScimGroup, error)
+	ScimReplaceGroup(ctx context.Context, orgID string, group *pb.ScimGroup, ifMatch string) (*pb.ScimGroup, error)
+	ScimDeleteGroup(ctx context.Context, orgID, id string) error
+}
+
+// DeviceStore keeps the pending device and QR code logins;
+// *postgres.DeviceRepo in production.
+type DeviceStore interface {
+	CreateDeviceAuthorization(ctx context.Context, d *postgres.DeviceAuthorization) error
+	GetPendingDeviceAuthorization(ctx context.Context, userCode string) (*postgres.DeviceAuthorization, error)
+	DecideDeviceAuthorization(ctx context.Context, userCode, userID string, approve bool) error
+	PollDeviceAuthorization(ctx context.Context, deviceCodeHash, clientID string) (string, error)
+}
+
+// AuditStore keeps the security events; *postgres.AuditRepo in production.
+type AuditStore interface {
+	Record(ctx context.Context, e *pb.AuditEvent) error
+	ListAuditEvents(ctx context.Context, f *pb.AuditEventFilter) (*pb.AuditEventList, error)
+}
+
+// LockoutStore counts the failed logins of accounts and addresses;
+// *postgres.LockoutRepo in production.
+type LockoutStore interface {
+	RecordAttempt(ctx context.Context, userID, login, ip string, success bool) error
+	LockedUntil(ctx context.Context, scope, key string) (time.Time, error)
+	RegisterFailure(ctx context.Context, scope, key string, p postgres.LockoutPolicy) (time.Time, error)
+	Reset(ctx context.Context, scope, key string) error
+	ResetAddressesOf(ctx context.Context, userID string, since time.Time) error
+}
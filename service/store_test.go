@@ -0,0 +1,478 @@
+package service
+
+import (
+	"auth/api/auth"
+	"auth/config"
+	pb "auth/genproto/users"
+	"auth/pkg/password"
+	"auth/pkg/trust"
+	"auth/storage/postgres"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// The fakes keep what the tests look at in memory. UserStore is embedded so
+// that a method a test does not expect to be called panics.
+
+type fakeUsers struct {
+	UserStore
+
+	mu    sync.Mutex
+	users map[string]*pb.UserInfo
+	// mustChange holds the users forced to change their password.
+	mustChange map[string]bool
+	revokedAt  map[string]time.Time
+	// orgs maps organization slugs to IDs, orgOf users to organization IDs
+	// and identities "provider/subject" to users.
+	orgs       map[string]string
+	orgOf      map[string]string
+	identities map[string]string
+	// emailChanges are the pending email changes.
+	emailChanges []*postgres.EmailChange
+	// history holds the hashes of the replaced passwords, oldest first.
+	history map[string][]string
+}
+
+func newFakeUsers(users ...*pb.UserInfo) *fakeUsers {
+	f := &fakeUsers{
+		users:      make(map[string]*pb.UserInfo),
+		mustChange: make(map[string]bool),
+		revokedAt:  make(map[string]time.Time),
+		orgs:       make(map[string]string),
+		orgOf:      make(map[string]string),
+		identities: make(map[string]string),
+		history:    make(map[string][]string),
+	}
+	for _, u := range users {
+		f.users[u.Id] = u
+	}
+	return f
+}
+
+func (f *fakeUsers) user(match func(*pb.UserInfo) bool) (*pb.UserInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, u := range f.users {
+		if match(u) {
+			return proto.Clone(u).(*pb.UserInfo), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeUsers) GetUserByID(ctx context.Context, id string) (*pb.UserInfo, error) {
+	return f.user(func(u *pb.UserInfo) bool { return u.Id == id })
+}
+
+func (f *fakeUsers) GetUserByEmail(ctx context.Context, email string) (*pb.UserInfo, error) {
+	return f.user(func(u *pb.UserInfo) bool { return u.Email == email })
+}
+
+func (f *fakeUsers) GetUserByUsername(ctx context.Context, username string) (*pb.UserInfo, error) {
+	return f.user(func(u *pb.UserInfo) bool { return u.Username == username })
+}
+
+func (f *fakeUsers) GetUserByLogin(ctx context.Context, login string) (*pb.UserInfo, error) {
+	return f.user(func(u *pb.UserInfo) bool { return u.Username == login || u.Email == login })
+}
+
+func (f *fakeUsers) CreateUser(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := fmt.Sprintf("u%d", len(f.users)+1)
+	f.users[id] = &pb.UserInfo{Id: id, Username: req.Username, Email: req.Email, Password: req.Password, FullName: req.FullName}
+	return &pb.RegisterResponse{Id: id, Username: req.Username, Email: req.Email, FullName: req.FullName}, nil
+}
+
+func (f *fakeUsers) PasswordHistory(ctx context.Context, userID string, n int) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	hashes := slices.Clone(f.history[userID])
+	slices.Reverse(hashes)
+	return hashes[:min(n, len(hashes))], nil
+}
+
+func (f *fakeUsers) ChangePassword(ctx context.Context, userID, hash, oldHash string, keep int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	user, ok := f.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.Password = hash
+	f.mustChange[userID] = false
+	if keep > 0 {
+		f.history[userID] = append(f.history[userID], oldHash)
+	}
+	f.history[userID] = f.history[userID][max(0, len(f.history[userID])-keep):]
+	return nil
+}
+
+func (f *fakeUsers) PasswordState(ctx context.Context, userID string, defaultMaxAgeDays int) (bool, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.mustChange[userID], false, nil
+}
+
+func (f *fakeUsers) TokensRevokedAt(ctx context.Context, userID string) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.revokedAt[userID], nil
+}
+
+func (f *fakeUsers) RevokeTokens(ctx context.Context, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.users[userID]; !ok {
+		return sql.ErrNoRows
+	}
+	f.revokedAt[userID] = time.Now()
+	return nil
+}
+
+func (f *fakeUsers) CreateEmailChange(ctx context.Context, ch *postgres.EmailChange) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// A new request replaces the pending one of the user.
+	f.emailChanges = slices.DeleteFunc(f.emailChanges, func(p *postgres.EmailChange) bool { return p.UserID == ch.UserID })
+	f.emailChanges = append(f.emailChanges, ch)
+	return nil
+}
+
+func (f *fakeUsers) ConfirmEmailChange(ctx context.Context, confirmTokenHash string) (*postgres.EmailChange, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := slices.IndexFunc(f.emailChanges, func(p *postgres.EmailChange) bool {
+		return p.ConfirmTokenHash == confirmTokenHash && p.ExpiresAt.After(time.Now())
+	})
+	if i < 0 {
+		return nil, postgres.ErrEmailChangeNotFound
+	}
+	ch := f.emailChanges[i]
+	f.emailChanges = slices.Delete(f.emailChanges, i, i+1)
+	user, ok := f.users[ch.UserID]
+	if !ok || user.Email != ch.OldEmail {
+		return nil, postgres.ErrEmailChangeNotFound
+	}
+	user.Email = ch.NewEmail
+	f.revokedAt[ch.UserID] = time.Now()
+	return ch, nil
+}
+
+func (f *fakeUsers) CancelEmailChange(ctx context.Context, cancelTokenHash string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := len(f.emailChanges)
+	f.emailChanges = slices.DeleteFunc(f.emailChanges, func(p *postgres.EmailChange) bool { return p.CancelTokenHash == cancelTokenHash })
+	if len(f.emailChanges) == n {
+		return postgres.ErrEmailChangeNotFound
+	}
+	return nil
+}
+
+func (f *fakeUsers) TokenProfile(ctx context.Context, userID string) (*pb.TokenProfile, error) {
+	return &pb.TokenProfile{UserId: userID}, nil
+}
+
+func (f *fakeUsers) UsernameReservedBy(ctx context.Context, username string) (string, error) {
+	return "", nil
+}
+
+func (f *fakeUsers) EnsureOrganization(ctx context.Context, slug, name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.orgs[slug]; !ok {
+		f.orgs[slug] = "org-" + slug
+	}
+	return f.orgs[slug], nil
+}
+
+func (f *fakeUsers) UserOrganization(ctx context.Context, userID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.orgOf[userID], nil
+}
+
+func (f *fakeUsers) GetUserBySSOIdentity(ctx context.Context, provider, subject string) (*pb.UserInfo, error) {
+	f.mu.Lock()
+	userID, ok := f.identities[provider+"/"+subject]
+	f.mu.Unlock()
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return f.GetUserByID(ctx, userID)
+}
+
+func (f *fakeUsers) LinkSSOIdentity(ctx context.Context, provider, subject, userID, organizationID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.identities[provider+"/"+subject] = userID
+	if f.orgOf[userID] == "" {
+		f.orgOf[userID] = organizationID
+	}
+	return nil
+}
+
+func (f *fakeUsers) CreateSSOUser(ctx context.Context, user *pb.UserInfo, provider, subject, organizationID string) (*pb.UserInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	user = proto.Clone(user).(*pb.UserInfo)
+	user.Id = fmt.Sprintf("u%d", len(f.users)+1)
+	f.users[user.Id] = user
+	f.identities[provider+"/"+subject] = user.Id
+	f.orgOf[user.Id] = organizationID
+	return proto.Clone(user).(*pb.UserInfo), nil
+}
+
+type fakeLockouts struct {
+	mu       sync.Mutex
+	attempts []postgresAttempt
+	failures map[string]int
+	locked   map[string]time.Time
+}
+
+type postgresAttempt struct {
+	userID, ip string
+	success    bool
+	at         time.Time
+}
+
+func newFakeLockouts() *fakeLockouts {
+	return &fakeLockouts{failures: make(map[string]int), locked: make(map[string]time.Time)}
+}
+
+func (f *fakeLockouts) RecordAttempt(ctx context.Context, userID, login, ip string, success bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts = append(f.attempts, postgresAttempt{userID: userID, ip: ip, success: success, at: time.Now()})
+	return nil
+}
+
+func (f *fakeLockouts) LockedUntil(ctx context.Context, scope, key string) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if until := f.locked[scope+":"+key]; until.After(time.Now()) {
+		return until, nil
+	}
+	return time.Time{}, nil
+}
+
+// RegisterFailure locks for the base duration and leaves the window and
+// decay, which the query of LockoutRepo applies, out.
+func (f *fakeLockouts) RegisterFailure(ctx context.Context, scope, key string, p postgres.LockoutPolicy) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[scope+":"+key]++
+	if p.MaxFailures <= 0 || f.failures[scope+":"+key] < p.MaxFailures {
+		return time.Time{}, nil
+	}
+	f.failures[scope+":"+key] = 0
+	f.locked[scope+":"+key] = time.Now().Add(p.BaseDuration)
+	return f.locked[scope+":"+key], nil
+}
+
+func (f *fakeLockouts) Reset(ctx context.Context, scope, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.failures, scope+":"+key)
+	delete(f.locked, scope+":"+key)
+	return nil
+}
+
+func (f *fakeLockouts) ResetAddressesOf(ctx context.Context, userID string, since time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, a := range f.attempts {
+		if a.userID == userID && a.ip != "" && !a.at.Before(since) {
+			delete(f.failures, postgres.LockoutScopeIP+":"+a.ip)
+			delete(f.locked, postgres.LockoutScopeIP+":"+a.ip)
+		}
+	}
+	return nil
+}
+
+// fakeDevices holds the device authorizations by the hash of their device
+// code and moves them through the states DeviceRepo does.
+type fakeDevices struct {
+	mu     sync.Mutex
+	byHash map[string]*postgres.DeviceAuthorization
+}
+
+func newFakeDevices() *fakeDevices {
+	return &fakeDevices{byHash: make(map[string]*postgres.DeviceAuthorization)}
+}
+
+// approve adds an authorization the user has already approved.
+func (f *fakeDevices) approve(deviceCodeHash, clientID, userID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.byHash[deviceCodeHash] = &postgres.DeviceAuthorization{
+		DeviceCodeHash: deviceCodeHash,
+		ClientID:       clientID,
+		Status:         postgres.DeviceStatusApproved,
+		UserID:         userID,
+		ExpiresAt:      time.Now().Add(time.Minute),
+	}
+}
+
+func (f *fakeDevices) pending(userCode string) *postgres.DeviceAuthorization {
+	for _, d := range f.byHash {
+		if d.UserCode == userCode && d.Status == postgres.DeviceStatusPending && d.ExpiresAt.After(time.Now()) {
+			return d
+		}
+	}
+	return nil
+}
+
+func (f *fakeDevices) CreateDeviceAuthorization(ctx context.Context, d *postgres.DeviceAuthorization) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	created := *d
+	created.Status = postgres.DeviceStatusPending
+	f.byHash[d.DeviceCodeHash] = &created
+	return nil
+}
+
+func (f *fakeDevices) GetPendingDeviceAuthorization(ctx context.Context, userCode string) (*postgres.DeviceAuthorization, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := f.pending(userCode)
+	if d == nil {
+		return nil, postgres.ErrDeviceCodeNotFound
+	}
+	found := *d
+	return &found, nil
+}
+
+func (f *fakeDevices) DecideDeviceAuthorization(ctx context.Context, userCode, userID string, approve bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := f.pending(userCode)
+	if d == nil {
+		return postgres.ErrDeviceCodeNotFound
+	}
+	d.UserID, d.Status = userID, postgres.DeviceStatusDenied
+	if approve {
+		d.Status = postgres.DeviceStatusApproved
+	}
+	return nil
+}
+
+func (f *fakeDevices) PollDeviceAuthorization(ctx context.Context, deviceCodeHash, clientID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d, ok := f.byHash[deviceCodeHash]
+	switch {
+	case !ok || d.ClientID != clientID || !d.ExpiresAt.After(time.Now()) || d.Status == postgres.DeviceStatusConsumed:
+		return "", postgres.ErrExpiredToken
+	case d.Status == postgres.DeviceStatusDenied:
+		return "", postgres.ErrAccessDenied
+	case d.Status == postgres.DeviceStatusPending:
+		return "", postgres.ErrAuthorizationPending
+	}
+	d.Status = postgres.DeviceStatusConsumed
+	return d.UserID, nil
+}
+
+type fakeAudit struct {
+	mu     sync.Mutex
+	events []*pb.AuditEvent
+}
+
+func (f *fakeAudit) Record(ctx context.Context, e *pb.AuditEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, e)
+	return nil
+}
+
+func (f *fakeAudit) ListAuditEvents(ctx context.Context, filter *pb.AuditEventFilter) (*pb.AuditEventList, error) {
+	return &pb.AuditEventList{}, nil
+}
+
+// find returns the recorded events named event.
+func (f *fakeAudit) find(event string) []*pb.AuditEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []*pb.AuditEvent
+	for _, e := range f.events {
+		if e.Event == event {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+type sentMessage struct {
+	to, subject, body string
+}
+
+// fakeNotifier hands the messages over a channel, since lockout notices
+// are sent in the background.
+type fakeNotifier chan sentMessage
+
+func (n fakeNotifier) Notify(ctx context.Context, to, subject, body string) error {
+	n <- sentMessage{to: to, subject: subject, body: body}
+	return nil
+}
+
+// testGateway is the address of the gateway the test services trust.
+const testGateway = "10.0.0.1"
+
+// fromPeer returns a context of an RPC made from the address ip.
+func fromPeer(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 4000}})
+}
+
+// newTestService returns a service on the fakes with the default settings.
+func newTestService(users *fakeUsers) (*UserService, *fakeLockouts, *fakeAudit) {
+	cfg, err := config.Load([]string{"--jwt-access-secret", "access", "--jwt-refresh-secret", "refresh"})
+	if err != nil {
+		panic(err)
+	}
+	tokens, err := auth.FromConfig(cfg.Token)
+	if err != nil {
+		panic(err)
+	}
+	gateways, err := trust.ParseGateways([]string{testGateway})
+	if err != nil {
+		panic(err)
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	lockouts := newFakeLockouts()
+	audit := &fakeAudit{}
+	notify := make(fakeNotifier, 10)
+	passwords, err := password.FromConfig(cfg.Password)
+	if err != nil {
+		panic(err)
+	}
+	cfg.Lockout.LOGIN_MIN_DURATION = 0
+	return &UserService{
+		Repo:   users,
+		Audit:  audit,
+		Log:    log,
+		tokens: tokens,
+		guard: &loginGuard{
+			repo:     lockouts,
+			cfg:      cfg.Lockout,
+			notifier: notify,
+			log:      log,
+		},
+		notifier:    notify,
+		account:     cfg.Account,
+		oauth:       cfg.OAuth,
+		passwords:   passwords,
+		passwordCfg: cfg.Password,
+		gateways:    gateways,
+	}, lockouts, audit
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"auth/api/auth"
+	pb "auth/genproto/users"
+	"auth/pkg/audit"
+	"auth/pkg/metrics"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var errRefreshTokenInvalid = status.Error(codes.Unauthenticated, "refresh token is invalid or revoked")
+
+// CheckRefreshToken validates a refresh token against the revocations of its
+// user and issues a new access token for it, bound to the DPoP key of the
+// request if there is one.
+func (u *UserService) CheckRefreshToken(ctx context.Context, req *pb.CheckRefreshTokenRequest) (*pb.CheckRefreshTokenResponse, error) {
+	u.log(ctx).Info("CheckRefreshToken rpc method started")
+	userID := ""
+	refreshEvent := func(outcome, reason string) {
+		e := &pb.AuditEvent{Event: audit.EventTokenRefresh, Outcome: outcome, ActorId: userID, TargetType: audit.TargetUser, TargetId: userID}
+		if reason != "" {
+			e.Details = map[string]string{"reason": reason}
+		}
+		u.audit(ctx, e)
+	}
+	claims, err := u.tokens.ExtractRefreshClaim(req.RefreshToken)
+	if err != nil || claims == nil {
+		u.log(ctx).Error("Refresh token is invalid")
+		u.metrics.TokenRefresh(metrics.OutcomeFailure)
+		refreshEvent(audit.OutcomeFailure, "invalid_token")
+		return nil, errRefreshTokenInvalid
+	}
+	userID, _ = claims["user_id"].(string)
+	issuedAt := auth.IssuedAt(claims)
+
+	// A refresh token bound to a DPoP key is only good with a proof made
+	// with that key.
+	if jkt := auth.Confirmation(claims); jkt != "" && jkt != req.DpopJkt {
+		u.log(ctx).Error("Refresh token is bound to another DPoP key", "user_id", userID)
+		u.metrics.TokenRefresh(metrics.OutcomeFailure)
+		refreshEvent(audit.OutcomeFailure, "dpop_mismatch")
+		return nil, errRefreshTokenInvalid
+	}
+
+	revokedAt, err := u.Repo.TokensRevokedAt(ctx, userID)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		u.metrics.TokenRefresh(metrics.OutcomeFailure)
+		return nil, errRefreshTokenInvalid
+	}
+	// Tokens issued before the microsecond precision of the issue time
+	// only tell the second, and are void if that is the second of the
+	// revocation.
+	if !revokedAt.IsZero() && !issuedAt.After(revokedAt.Truncate(time.Microsecond)) {
+		u.log(ctx).Error("Refresh token is revoked", "user_id", userID)
+		u.metrics.TokenRefresh(metrics.OutcomeFailure)
+		refreshEvent(audit.OutcomeFailure, "revoked")
+		return nil, errRefreshTokenInvalid
+	}
+
+	user, err := u.Repo.GetUserByID(ctx, userID)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		u.metrics.TokenRefresh(metrics.OutcomeFailure)
+		return nil, errRefreshTokenInvalid
+	}
+	user.Id = userID
+
+	// Only a new login hands out the restricted token for a password change.
+	reason, err := u.passwordChangeReason(ctx, userID)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		u.metrics.TokenRefresh(metrics.OutcomeError)
+		return nil, err
+	}
+	if reason != "" {
+		u.log(ctx).Error("Refresh rejected, password change required", "user_id", userID, "reason", reason)
+		u.metrics.TokenRefresh(metrics.OutcomeFailure)
+		refreshEvent(audit.OutcomeFailure, "password_change_required")
+		return nil, status.Error(codes.FailedPrecondition, "password change required; log in again")
+	}
+
+	extra, err := u.mappers.Load(ctx, u.log(ctx), userID, "", u.Repo.TokenProfile)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		u.metrics.TokenRefresh(metrics.OutcomeError)
+		return nil, err
+	}
+	var token pb.Tokens
+	if err := u.tokens.GeneratedAccessToken(user, &token, req.DpopJkt, extra); err != nil {
+		u.log(ctx).Error(err.Error())
+		u.metrics.TokenRefresh(metrics.OutcomeError)
+		return nil, err
+	}
+	u.metrics.TokenRefresh(metrics.OutcomeSuccess)
+	refreshEvent(audit.OutcomeSuccess, "")
+	u.log(ctx).Info("CheckRefreshToken rpc method finished")
+	return &pb.CheckRefreshTokenResponse{AccessToken: token.Accestoken, RefreshToken: req.RefreshToken}, nil
+}
+
+// Logout ends every session of the owner of the access or refresh token the
+// gateway passes in the auth.LogoutMetadata: the refresh tokens issued to
+// them so far are refused from now on. Access tokens run out on their own.
+func (u *UserService) Logout(ctx context.Context, _ *pb.Void) (*pb.BoolResponse, error) {
+	u.log(ctx).Info("Logout rpc method started")
+	md, _ := metadata.FromIncomingContext(ctx)
+	var userID string
+	if values := md.Get(auth.LogoutMetadata); len(values) > 0 {
+		claims, err := u.tokens.ExtractAccessClaim(values[0])
+		if err != nil {
+			claims, err = u.tokens.ExtractRefreshClaim(values[0])
+		}
+		if err == nil {
+			userID, _ = claims["user_id"].(string)
+		}
+	}
+	if userID == "" {
+		u.log(ctx).Error("Logout without a valid token")
+		return &pb.BoolResponse{Success: false}, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	if err := u.Repo.RevokeTokens(ctx, userID); err != nil {
+		u.log(ctx).Error(err.Error())
+		if errors.Is(err, sql.ErrNoRows) {
+			return &pb.BoolResponse{Success: false}, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return &pb.BoolResponse{Success: false}, err
+	}
+	u.audit(ctx, &pb.AuditEvent{
+		Event:      audit.EventTokenRevocation,
+		Outcome:    audit.OutcomeSuccess,
+		ActorId:    userID,
+		TargetType: audit.TargetUser,
+		TargetId:   userID,
+		Details:    map[string]string{"reason": "logout"},
+	})
+	u.log(ctx).Info("Logout rpc method finished")
+	return &pb.BoolResponse{Success: true}, nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"auth/api/auth"
+	pb "auth/genproto/users"
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogoutRevokesRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	u, _, _ := newTestService(newFakeUsers(testUser()))
+
+	var token pb.Tokens
+	if err := u.tokens.GeneratedAccessToken(testUser(), &token, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.tokens.GeneratedRefreshToken(testUser(), &token, ""); err != nil {
+		t.Fatal(err)
+	}
+	refresh := &pb.CheckRefreshTokenRequest{RefreshToken: token.Refreshtoken}
+	if _, err := u.CheckRefreshToken(ctx, refresh); err != nil {
+		t.Fatalf("CheckRefreshToken before logout = %v", err)
+	}
+
+	if _, err := u.Logout(ctx, &pb.Void{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Logout without a token = %v, want Unauthenticated", err)
+	}
+	loggingOut := metadata.NewIncomingContext(ctx, metadata.Pairs(auth.LogoutMetadata, token.Accestoken))
+	if _, err := u.Logout(loggingOut, &pb.Void{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.CheckRefreshToken(ctx, refresh); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("CheckRefreshToken after logout = %v, want Unauthenticated", err)
+	}
+}
+
+// TestRevocationWithinASecond checks that a revocation voids the refresh
+// tokens issued before it but not those issued right after, in the same
+// second.
+func TestRevocationWithinASecond(t *testing.T) {
+	ctx := context.Background()
+	users := newFakeUsers(testUser())
+	u, _, _ := newTestService(users)
+
+	refresh := func() *pb.CheckRefreshTokenRequest {
+		t.Helper()
+		var token pb.Tokens
+		if err := u.tokens.GeneratedRefreshToken(testUser(), &token, ""); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+		return &pb.CheckRefreshTokenRequest{RefreshToken: token.Refreshtoken}
+	}
+	before := refresh()
+	users.revokedAt["u1"] = time.Now()
+	time.Sleep(time.Millisecond)
+	after := refresh()
+
+	if _, err := u.CheckRefreshToken(ctx, before); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("CheckRefreshToken of a token issued before = %v, want Unauthenticated", err)
+	}
+	if _, err := u.CheckRefreshToken(ctx, after); err != nil {
+		t.Errorf("CheckRefreshToken of a token issued after = %v", err)
+	}
+}
@@ -1,150 +1,371 @@
 package service
 
 import (
+	"auth/api/auth"
+	"auth/config"
 	pb "auth/genproto/users"
+	"auth/pkg/audit"
+	"auth/pkg/claims"
 	"auth/pkg/logger"
+	"auth/pkg/metrics"
+	"auth/pkg/notifier"
+	"auth/pkg/password"
+	"auth/pkg/saml"
+	"auth/pkg/trust"
 	"auth/storage/postgres"
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 	"log/slog"
+	"time"
+
+	"golang.org/x/text/language"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// errInvalidCredentials is returned for every failed login so that callers
+// cannot tell unknown, locked and mistyped accounts apart.
+var errInvalidCredentials = status.Error(codes.Unauthenticated, "invalid login or password")
+
 type UserService struct {
 	pb.UnimplementedUserServer
-	Repo *postgres.UserRepo
-	Log  *slog.Logger
+	Repo     UserStore
+	Devices  DeviceStore
+	Audit    AuditStore
+	Log      *slog.Logger
+	tokens   *auth.Tokens
+	guard    *loginGuard
+	notifier notifier.Notifier
+	account  config.AccountConfig
+	oauth    config.OAuthConfig
+	// passwords is the policy new passwords are checked against.
+	passwords   *password.Policy
+	passwordCfg config.PasswordConfig
+	// mappers add profile fields to the access tokens issued on refresh.
+	mappers *claims.Enricher
+	metrics *metrics.Metrics
+	// providers are the agency identity providers SSOLogin accepts, by ID.
+	providers map[string]*saml.Provider
+	// gateways are the peers whose word on the end user audit events take.
+	gateways *trust.Gateways
 }
 
-func NewUserService(db *sql.DB) *UserService {
+// NewUserService builds the service, which issues and verifies tokens with
+// tokens; m may be nil when metrics are off.
+func NewUserService(db *sql.DB, cfg *config.Config, tokens *auth.Tokens, log *slog.Logger, m *metrics.Metrics) (*UserService, error) {
+	notify := notifier.NewNotifier(cfg.SMTP, log)
+	passwords, err := password.FromConfig(cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+	mappers, err := claims.FromConfig(cfg.Token)
+	if err != nil {
+		return nil, err
+	}
+	gateways, err := trust.ParseGateways(cfg.Server.TRUSTED_GATEWAYS)
+	if err != nil {
+		return nil, err
+	}
+	providers := map[string]*saml.Provider{}
+	if cfg.SAML.SAML_PROVIDERS_FILE != "" {
+		list, err := saml.LoadProviders(cfg.SAML.SAML_PROVIDERS_FILE)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range list {
+			providers[p.ID] = p
+		}
+	}
 	return &UserService{
-		Repo: postgres.NewUserRepository(db),
-		Log:  logger.NewLogger(),
+		Repo:    postgres.NewUserRepository(db),
+		Devices: postgres.NewDeviceRepository(db),
+		Audit:   postgres.NewAuditRepository(db),
+		Log:     log,
+		tokens:  tokens,
+		guard: &loginGuard{
+			repo:     postgres.NewLockoutRepository(db),
+			cfg:      cfg.Lockout,
+			notifier: notify,
+			log:      log,
+			metrics:  m,
+		},
+		notifier: notify,
+		account:  cfg.Account,
+		oauth:    cfg.OAuth,
+
+		passwords:   passwords,
+		passwordCfg: cfg.Password,
+		mappers:     mappers,
+		metrics:     m,
+		providers:   providers,
+		gateways:    gateways,
+	}, nil
+}
+
+// log is the logger of the RPC, carrying the ID of the request.
+func (u *UserService) log(ctx context.Context) *slog.Logger {
+	return logger.FromContext(ctx, u.Log)
+}
+
+// clientIP is the address of the end user. Only a trusted gateway may tell
+// it, in the request or in the metadata; for any other caller it is the
+// address of the caller itself.
+func (u *UserService) clientIP(ctx context.Context, reported string) string {
+	if reported != "" && u.gateways.Trusted(ctx) {
+		return reported
 	}
+	return u.gateways.ClientIP(ctx)
 }
 
 func (u *UserService) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
-	u.Log.Info("Register rpc method started")
-	res, err := u.Repo.CreateUser(ctx, req)
+	u.log(ctx).Info("Register rpc method started")
+	if err := u.checkUsername(ctx, "", req.Username); err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+	account := password.Account{Username: req.Username, Email: req.Email, FullName: req.FullName}
+	if err := u.checkPassword(ctx, "password", req.Password, "", "", account); err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+	hash, err := password.Hash(req.Password)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+	res, err := u.Repo.CreateUser(ctx, &pb.RegisterRequest{
+		Username: req.Username,
+		Email:    req.Email,
+		Password: hash,
+		FullName: req.FullName,
+	})
 	if err != nil {
-		u.Log.Error(err.Error())
+		u.log(ctx).Error(err.Error())
 		return nil, err
 	}
-	u.Log.Info("Register rpc method finished")
+	u.metrics.Registration()
+	u.log(ctx).Info("Register rpc method finished")
 	return res, nil
 }
 func (u *UserService) Login(ctx context.Context, req *pb.LoginRequest) (*pb.UserInfo, error) {
-	u.Log.Info("Login rpc method started")
-	res, err := u.Repo.GetUserByEmail(ctx, req.Email)
+	u.log(ctx).Info("Login rpc method started")
+	start := time.Now()
+	defer u.guard.pad(ctx, start)
+
+	login := req.Login
+	if login == "" {
+		login = req.Email
+	}
+	ip := u.clientIP(ctx, req.Ip)
+	res, err := u.Repo.GetUserByLogin(ctx, login)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		u.log(ctx).Error(err.Error())
+		u.metrics.Login(metrics.OutcomeError)
+		return nil, err
+	}
+
+	userID := ""
+	if res != nil {
+		userID = res.Id
+	}
+	loginEvent := func(outcome, reason string) {
+		e := &pb.AuditEvent{
+			Event:      audit.EventLogin,
+			Outcome:    outcome,
+			TargetType: audit.TargetUser,
+			TargetId:   userID,
+			Ip:         ip,
+			Details:    map[string]string{"method": "password", "login": login},
+		}
+		if outcome == audit.OutcomeSuccess {
+			e.ActorId = userID
+		} else {
+			e.Details["reason"] = reason
+		}
+		u.audit(ctx, e)
+	}
+	locked, err := u.guard.locked(ctx, userID, ip)
 	if err != nil {
-		u.Log.Error(err.Error())
+		u.log(ctx).Error(err.Error())
+		u.metrics.Login(metrics.OutcomeError)
 		return nil, err
 	}
-	if res.Password != req.Password {
-		u.Log.Error("Password is incorrect")
-		return nil, fmt.Errorf("password is incorrect")
+	if locked {
+		u.log(ctx).Error("Login rejected, account or address is locked out", "login", login, "ip", ip)
+		u.guard.record(ctx, userID, login, ip, false)
+		u.metrics.Login(metrics.OutcomeLocked)
+		loginEvent(audit.OutcomeFailure, "locked")
+		return nil, errInvalidCredentials
 	}
 
-	u.Log.Info("Login rpc method finished")
+	if res == nil || !password.Verify(res.Password, req.Password) {
+		u.log(ctx).Error("Login or password is incorrect", "login", login, "ip", ip)
+		u.guard.failure(ctx, res, login, ip)
+		u.metrics.Login(metrics.OutcomeFailure)
+		loginEvent(audit.OutcomeFailure, "invalid_credentials")
+		return nil, errInvalidCredentials
+	}
+	u.guard.success(ctx, res, login, ip)
+
+	res.PasswordChangeReason, err = u.passwordChangeReason(ctx, res.Id)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		u.metrics.Login(metrics.OutcomeError)
+		return nil, err
+	}
+	u.metrics.Login(metrics.OutcomeSuccess)
+	loginEvent(audit.OutcomeSuccess, "")
+
+	u.log(ctx).Info("Login rpc method finished")
 	return res, nil
 }
 
 func (u *UserService) GetProfile(ctx context.Context, id *pb.UserId) (*pb.GetProfileResponse, error) {
-	u.Log.Info("GetProfile rpc method started")
+	u.log(ctx).Info("GetProfile rpc method started")
 	res, err := u.Repo.GetUserProfile(ctx, id)
 	if err != nil {
-		u.Log.Error(err.Error())
+		u.log(ctx).Error(err.Error())
 		return nil, err
 	}
-	u.Log.Info("GetProfile rpc method finished")
+	u.log(ctx).Info("GetProfile rpc method finished")
 	return res, nil
 }
 
 func (u *UserService) UpdateProfile(ctx context.Context, req *pb.UpdateProfileRequest) (*pb.UpdateProfileResponse, error) {
-	u.Log.Info("UpdateProfile rpc method started")
+	u.log(ctx).Info("UpdateProfile rpc method started")
+	if req.Locale != "" {
+		tag, err := language.Parse(req.Locale)
+		if err != nil {
+			u.log(ctx).Error(err.Error())
+			return nil, status.Error(codes.InvalidArgument, "locale must be a BCP 47 language tag")
+		}
+		req.Locale = tag.String()
+	}
 	res, err := u.Repo.UpdateUser(ctx, req)
 	if err != nil {
-		u.Log.Error(err.Error())
+		u.log(ctx).Error(err.Error())
 		return nil, err
 	}
-	u.Log.Info("UpdateProfile rpc method finished")
+	u.log(ctx).Info("UpdateProfile rpc method finished")
 	return res, nil
 }
 
 func (u *UserService) GetUsers(ctx context.Context, req *pb.GetUsersRequest) (*pb.GetUsersResponse, error) {
-	u.Log.Info("GetUsers rpc method started")
+	u.log(ctx).Info("GetUsers rpc method started")
 	res, err := u.Repo.GetUsers(ctx, req)
 	if err != nil {
-		u.Log.Error(err.Error())
+		u.log(ctx).Error(err.Error())
 		return nil, err
 	}
-	u.Log.Info("GetUsers rpc method finished")
+	u.log(ctx).Info("GetUsers rpc method finished")
 	return res, nil
 }
 
 func (u *UserService) DeleteUser(ctx context.Context, req *pb.UserId) (*pb.BoolResponse, error) {
-	u.Log.Info("DeleteUser rpc method started")
+	u.log(ctx).Info("DeleteUser rpc method started")
 	err := u.Repo.DeleteUser(ctx, req.Id)
+	u.audit(ctx, &pb.AuditEvent{Event: audit.EventAccountDeletion, Outcome: audit.Outcome(err), TargetType: audit.TargetUser, TargetId: req.Id})
 	if err != nil {
-		u.Log.Error(err.Error())
+		u.log(ctx).Error(err.Error())
 		return &pb.BoolResponse{Success: false}, err
 	}
-	u.Log.Info("DeleteUser rpc method finished")
+	u.log(ctx).Info("DeleteUser rpc method finished")
 	return &pb.BoolResponse{Success: true}, nil
 }
 
 func (u *UserService) EmailRecovery(ctx context.Context, req *pb.EmailRecoveryRequest) (*pb.BoolResponse, error) {
-	u.Log.Info("EmailRecovery rpc method started")
+	u.log(ctx).Info("EmailRecovery rpc method started")
 	user, err := u.Repo.GetUserByID(ctx, req.UserId)
 	if err != nil {
-		u.Log.Error(err.Error())
+		u.log(ctx).Error(err.Error())
 		return &pb.BoolResponse{Success: false}, err
 	}
-	if user.Password != req.OldPassword {
-		u.Log.Error("Password is incorrect")
+	passwordEvent := func(outcome, reason string) {
+		e := &pb.AuditEvent{Event: audit.EventPasswordChange, Outcome: outcome, TargetType: audit.TargetUser, TargetId: user.Id}
+		if reason != "" {
+			e.Details = map[string]string{"reason": reason}
+		}
+		u.audit(ctx, e)
+	}
+	if !password.Verify(user.Password, req.OldPassword) {
+		u.log(ctx).Error("Password is incorrect")
+		passwordEvent(audit.OutcomeFailure, "invalid_password")
 		return &pb.BoolResponse{Success: false}, errors.New("password is incorrect")
 	}
+	account := password.Account{Username: user.Username, Email: user.Email, FullName: user.FullName}
+	if err := u.checkPassword(ctx, "new_password", req.NewPassword, user.Id, user.Password, account); err != nil {
+		u.log(ctx).Error(err.Error())
+		passwordEvent(audit.OutcomeFailure, "policy")
+		return &pb.BoolResponse{Success: false}, err
+	}
+	hash, err := password.Hash(req.NewPassword)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return &pb.BoolResponse{Success: false}, err
+	}
 
-	err = u.Repo.UpdatePassword(ctx, req)
+	err = u.Repo.ChangePassword(ctx, user.Id, hash, user.Password, u.passwordCfg.PASSWORD_HISTORY)
 	if err != nil {
-		u.Log.Error(err.Error())
+		u.log(ctx).Error(err.Error())
 		return &pb.BoolResponse{Success: false}, err
 	}
-	u.Log.Info("EmailRecovery rpc method finished")
+	passwordEvent(audit.OutcomeSuccess, "")
+	u.log(ctx).Info("EmailRecovery rpc method finished")
 	return &pb.BoolResponse{Success: true}, nil
 }
 
 func (u *UserService) Activity(ctx context.Context, req *pb.UserId) (*pb.ActivityResponse, error) {
-	u.Log.Info("Activity rpc method started")
+	u.log(ctx).Info("Activity rpc method started")
 	res, err := u.Repo.GetUserActivity(ctx, req.Id)
 	if err != nil {
-		u.Log.Error(err.Error())
+		u.log(ctx).Error(err.Error())
 		return nil, err
 	}
-	u.Log.Info("Activity rpc method finished")
+	u.log(ctx).Info("Activity rpc method finished")
 	return res, nil
 }
 
 func (u *UserService) Follow(ctx context.Context, req *pb.FollowRequest) (*pb.FollowResponse, error) {
-	u.Log.Info("Follow rpc method started")
+	u.log(ctx).Info("Follow rpc method started")
 
 	res, err := u.Repo.Follow(ctx, req.FollowerId, req.FollowingId)
 	if err != nil {
-		u.Log.Error(err.Error())
+		u.log(ctx).Error(err.Error())
 		return nil, err
 	}
 
-	u.Log.Info("Follow rpc method finished")
+	u.log(ctx).Info("Follow rpc method finished")
 	return res, nil
 }
 
 func (u *UserService) Followers(ctx context.Context, req *pb.FollowersRequest) (*pb.FollowersResponse, error) {
-	u.Log.Info("Followers rpc method started")
+	u.log(ctx).Info("Followers rpc method started")
 	res, err := u.Repo.GetFollowers(ctx, req.UserId, req.Limit, req.Offset)
 	if err != nil {
-		u.Log.Error(err.Error())
+		u.log(ctx).Error(err.Error())
 	}
-	u.Log.Info("Followers rpc method finished")
+	u.log(ctx).Info("Followers rpc method finished")
 	return res, nil
 }
+
+// UnlockAccount lifts the lockout of the account and those of the addresses
+// that signed in to it, or tried to, while a lockout could still be running.
+// Otherwise the user could stay locked out by their address. Addresses an
+// attacker used against the account start over as well.
+func (u *UserService) UnlockAccount(ctx context.Context, req *pb.UserId) (*pb.BoolResponse, error) {
+	u.log(ctx).Info("UnlockAccount rpc method started")
+	err := u.guard.repo.Reset(ctx, postgres.LockoutScopeUser, req.Id)
+	if err == nil {
+		since := time.Now().Add(-u.guard.cfg.LOCKOUT_MAX_DURATION)
+		err = u.guard.repo.ResetAddressesOf(ctx, req.Id, since)
+	}
+	u.audit(ctx, &pb.AuditEvent{Event: audit.EventAccountUnlock, Outcome: audit.Outcome(err), TargetType: audit.TargetUser, TargetId: req.Id})
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return &pb.BoolResponse{Success: false}, err
+	}
+	u.log(ctx).Info("UnlockAccount rpc method finished")
+	return &pb.BoolResponse{Success: true}, nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	pb "auth/genproto/users"
+	"auth/storage/postgres"
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// usernamePattern allows 3 to 30 letters, digits, dots and underscores that
+// start and end with a letter or digit.
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._]{1,28}[A-Za-z0-9]$`)
+
+// reservedUsernames can't be registered because they would be mistaken for
+// the service itself or clash with routes.
+var reservedUsernames = map[string]bool{
+	"admin": true, "administrator": true, "root": true, "system": true,
+	"support": true, "help": true, "security": true, "moderator": true,
+	"staff": true, "official": true, "traveltales": true, "api": true,
+	"auth": true, "oauth": true, "login": true, "logout": true,
+	"register": true, "signup": true, "settings": true, "profile": true,
+	"email": true, "me": true, "null": true, "undefined": true,
+}
+
+// checkUsername validates username for the given user, who may be empty for
+// a new account. Old usernames stay reserved for their former owner.
+func (u *UserService) checkUsername(ctx context.Context, userID, username string) error {
+	if !usernamePattern.MatchString(username) {
+		return status.Error(codes.InvalidArgument, "username must be 3 to 30 letters, digits, dots or underscores and start and end with a letter or digit")
+	}
+	if strings.Contains(username, "..") || strings.Contains(username, "__") {
+		return status.Error(codes.InvalidArgument, "username must not repeat dots or underscores")
+	}
+	if reservedUsernames[strings.ToLower(username)] {
+		return status.Error(codes.InvalidArgument, "username is reserved")
+	}
+
+	owner, err := u.Repo.GetUserByUsername(ctx, username)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if owner != nil && owner.Id != userID {
+		return status.Error(codes.AlreadyExists, "username is already taken")
+	}
+
+	reservedBy, err := u.Repo.UsernameReservedBy(ctx, username)
+	if err != nil {
+		return err
+	}
+	if reservedBy != "" && reservedBy != userID {
+		return status.Error(codes.AlreadyExists, "username is already taken")
+	}
+	return nil
+}
+
+// ChangeUsername renames a user at most once per cooldown period. The old
+// username stays reserved for the user and keeps resolving to their account
+// for the reservation period.
+func (u *UserService) ChangeUsername(ctx context.Context, req *pb.ChangeUsernameRequest) (*pb.ChangeUsernameResponse, error) {
+	u.log(ctx).Info("ChangeUsername rpc method started")
+	user, err := u.Repo.GetUserByID(ctx, req.UserId)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+	if user.Username == req.NewUsername {
+		return nil, status.Error(codes.InvalidArgument, "new username is the current username")
+	}
+
+	last, err := u.Repo.LastUsernameChange(ctx, req.UserId)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+	if next := last.Add(u.account.USERNAME_CHANGE_COOLDOWN); !last.IsZero() && time.Now().Before(next) {
+		return nil, status.Errorf(codes.FailedPrecondition, "username can be changed again after %s", next.UTC().Format(time.RFC3339))
+	}
+
+	if err := u.checkUsername(ctx, req.UserId, req.NewUsername); err != nil {
+		u.log(ctx).Error(err.Error())
+		return nil, err
+	}
+
+	now := time.Now()
+	old, err := u.Repo.ChangeUsername(ctx, req.UserId, req.NewUsername, u.account.USERNAME_CHANGE_COOLDOWN, u.account.USERNAME_RESERVATION)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		switch {
+		case errors.Is(err, postgres.ErrUsernameChangeTooSoon):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, postgres.ErrUsernameReserved):
+			return nil, status.Error(codes.AlreadyExists, "username is already taken")
+		}
+		return nil, err
+	}
+
+	u.log(ctx).Info("ChangeUsername rpc method finished")
+	return &pb.ChangeUsernameResponse{
+		UserId:           req.UserId,
+		Username:         req.NewUsername,
+		PreviousUsername: old,
+		NextChangeAt:     now.Add(u.account.USERNAME_CHANGE_COOLDOWN).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func (u *UserService) GetUserByUsername(ctx context.Context, req *pb.UsernameLookupRequest) (*pb.UsernameLookupResponse, error) {
+	u.log(ctx).Info("GetUserByUsername rpc method started")
+	user, redirected, err := u.Repo.ResolveUsername(ctx, req.Username)
+	if err != nil {
+		u.log(ctx).Error(err.Error())
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, err
+	}
+	u.log(ctx).Info("GetUserByUsername rpc method finished")
+	return &pb.UsernameLookupResponse{User: user, Redirected: redirected}, nil
+}
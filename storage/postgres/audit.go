@@ -0,0 +1,195 @@
+package postgres
+
+import (
+	pb "auth/genproto/users"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// auditPurgeLock is the advisory lock that keeps replicas from purging
+// the audit events at the same time.
+const auditPurgeLock = 0x61756469
+
+type AuditRepo struct {
+	DB *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepo {
+	return &AuditRepo{DB: db}
+}
+
+func (r *AuditRepo) Record(ctx context.Context, e *pb.AuditEvent) error {
+	details, err := json.Marshal(e.Details)
+	if err != nil {
+		return err
+	}
+	if e.Details == nil {
+		details = []byte("{}")
+	}
+	_, err = r.DB.ExecContext(ctx, `
+	INSERT INTO audit_events (event, outcome, actor_id, target_type, target_id, ip, user_agent, request_id, details)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, e.Event, e.Outcome, e.ActorId, e.TargetType, e.TargetId, e.Ip, e.UserAgent, e.RequestId, details)
+	return err
+}
+
+// ListAuditEvents returns the events matching the filter, newest first,
+// with the number of matching events. from and to have to be RFC 3339
+// times or empty.
+func (r *AuditRepo) ListAuditEvents(ctx context.Context, f *pb.AuditEventFilter) (*pb.AuditEventList, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	add := func(cond string, value interface{}) {
+		args = append(args, value)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	for _, c := range []struct {
+		column, value string
+	}{
+		{"event", f.Event},
+		{"outcome", f.Outcome},
+		{"actor_id", f.ActorId},
+		{"target_id", f.TargetId},
+		{"ip", f.Ip},
+	} {
+		if c.value != "" {
+			add(c.column+" = $%d", c.value)
+		}
+	}
+	if f.From != "" {
+		add("occurred_at >= $%d::TIMESTAMPTZ", f.From)
+	}
+	if f.To != "" {
+		add("occurred_at < $%d::TIMESTAMPTZ", f.To)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	res := &pb.AuditEventList{Events: make([]*pb.AuditEvent, 0), Offset: f.Offset, Limit: f.Limit}
+	err := r.DB.QueryRowContext(ctx, "SELECT count(*) FROM audit_events "+where, args...).Scan(&res.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	SELECT
+		id, occurred_at, event, outcome, actor_id, target_type, target_id, ip, user_agent, request_id, details
+	FROM
+		audit_events
+	` + where + `
+	ORDER BY
+		occurred_at DESC, id DESC
+	`
+	args = append(args, f.Limit, f.Offset)
+	query += fmt.Sprintf("LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		res.Events = append(res.Events, e)
+	}
+	return res, rows.Err()
+}
+
+// PurgeBefore deletes up to limit of the oldest events that occurred
+// before cutoff, handing them to export first. It does nothing while
+// another replica purges.
+func (r *AuditRepo) PurgeBefore(ctx context.Context, cutoff time.Time, limit int, export func([]*pb.AuditEvent) error) (int, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, auditPurgeLock).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+	SELECT
+		id, occurred_at, event, outcome, actor_id, target_type, target_id, ip, user_agent, request_id, details
+	FROM
+		audit_events
+	WHERE
+		occurred_at < $1
+	ORDER BY
+		id
+	LIMIT $2
+	`, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		events []*pb.AuditEvent
+		ids    []int64
+	)
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, e)
+		ids = append(ids, e.Id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+	if err := export(events); err != nil {
+		return 0, err
+	}
+
+	// The trigger on audit_events refuses deletes outside of a purge. It
+	// only stops accidents; see migration 000015.
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('audit.purge', 'on', true)`); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM audit_events WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+func scanAuditEvent(rows *sql.Rows) (*pb.AuditEvent, error) {
+	var (
+		e          pb.AuditEvent
+		occurredAt time.Time
+		details    []byte
+	)
+	err := rows.Scan(&e.Id, &occurredAt, &e.Event, &e.Outcome, &e.ActorId, &e.TargetType, &e.TargetId, &e.Ip, &e.UserAgent, &e.RequestId, &details)
+	if err != nil {
+		return nil, err
+	}
+	e.OccurredAt = occurredAt.UTC().Format(time.RFC3339Nano)
+	if err := json.Unmarshal(details, &e.Details); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
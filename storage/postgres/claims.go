@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/claims"
+	"context"
+
+	"github.com/lib/pq"
+)
+
+// TokenProfile returns what claim mappers may put into the access tokens of
+// a user. The roles are the role of the user followed by the SCIM groups
+// their organization put them in, named as claims.GroupPrefix says.
+func (r *UserRepo) TokenProfile(ctx context.Context, userID string) (*pb.TokenProfile, error) {
+	res := pb.TokenProfile{UserId: userID}
+	var groups []string
+	err := r.DB.QueryRowContext(ctx, `
+	SELECT
+		u.username,
+		u.full_name,
+		u.email,
+		u.email_verified,
+		u.role,
+		u.tier,
+		u.locale,
+		ARRAY(
+			SELECT $2::text || o.slug || '/' || g.display_name
+			FROM scim_group_members m
+			JOIN scim_groups g ON g.id = m.group_id
+			JOIN organizations o ON o.id = g.organization_id
+			WHERE m.user_id = u.id
+			ORDER BY o.slug, g.display_name
+		)
+	FROM
+		users u
+	WHERE
+		u.id = $1 AND u.deleted_at = 0
+	`, userID, claims.GroupPrefix).Scan(&res.Username, &res.FullName, &res.Email, &res.EmailVerified, &res.Role, &res.Tier, &res.Locale, pq.Array(&groups))
+	if err != nil {
+		return nil, err
+	}
+	res.Roles = append([]string{res.Role}, groups...)
+	return &res, nil
+}
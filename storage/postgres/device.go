@@ -0,0 +1,187 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Outcomes of polling for a device token, named after the RFC 8628 error
+// codes.
+var (
+	ErrAuthorizationPending = errors.New("authorization_pending")
+	ErrSlowDown             = errors.New("slow_down")
+	ErrAccessDenied         = errors.New("access_denied")
+	ErrExpiredToken         = errors.New("expired_token")
+	ErrDeviceCodeNotFound   = errors.New("device code not found or expired")
+)
+
+const (
+	DeviceStatusPending  = "pending"
+	DeviceStatusApproved = "approved"
+	DeviceStatusDenied   = "denied"
+	DeviceStatusConsumed = "consumed"
+)
+
+type DeviceAuthorization struct {
+	DeviceCodeHash string
+	UserCode       string
+	ClientID       string
+	Scope          string
+	Status         string
+	UserID         string
+	RequesterIP    string
+	RequesterAgent string
+	PollInterval   time.Duration
+	ExpiresAt      time.Time
+}
+
+type DeviceRepo struct {
+	DB *sql.DB
+}
+
+func NewDeviceRepository(db *sql.DB) *DeviceRepo {
+	return &DeviceRepo{DB: db}
+}
+
+func (r *DeviceRepo) CreateDeviceAuthorization(ctx context.Context, d *DeviceAuthorization) error {
+	query := `
+	INSERT INTO device_authorizations (
+		device_code_hash, user_code, client_id, scope, requester_ip, requester_agent, poll_interval, expires_at
+	)
+	VALUES (
+		$1, $2, $3, $4, $5, $6, $7, $8
+	)`
+	_, err := r.DB.ExecContext(ctx, query, d.DeviceCodeHash, d.UserCode, d.ClientID, d.Scope,
+		d.RequesterIP, d.RequesterAgent, int(d.PollInterval.Seconds()), d.ExpiresAt)
+	return err
+}
+
+// GetPendingDeviceAuthorization looks up an authorization that still waits
+// for the user's decision.
+func (r *DeviceRepo) GetPendingDeviceAuthorization(ctx context.Context, userCode string) (*DeviceAuthorization, error) {
+	d := DeviceAuthorization{UserCode: userCode}
+	err := r.DB.QueryRowContext(ctx, `
+	SELECT
+		client_id,
+		scope,
+		requester_ip,
+		requester_agent,
+		expires_at
+	FROM
+		device_authorizations
+	WHERE
+		user_code = $1 AND status = 'pending' AND expires_at > current_timestamp
+	`, userCode).Scan(&d.ClientID, &d.Scope, &d.RequesterIP, &d.RequesterAgent, &d.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrDeviceCodeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// DecideDeviceAuthorization records the user's approval or denial of a
+// pending authorization.
+func (r *DeviceRepo) DecideDeviceAuthorization(ctx context.Context, userCode, userID string, approve bool) error {
+	status := DeviceStatusDenied
+	if approve {
+		status = DeviceStatusApproved
+	}
+
+	res, err := r.DB.ExecContext(ctx, `
+	UPDATE
+		device_authorizations
+	SET
+		status = $3,
+		user_id = $2
+	WHERE
+		user_code = $1 AND status = 'pending' AND expires_at > current_timestamp
+	`, userCode, userID, status)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n < 1 {
+		return ErrDeviceCodeNotFound
+	}
+	return nil
+}
+
+// PollDeviceAuthorization handles a token request of the device. It returns
+// the approving user's id exactly once; until then it reports why no token
+// can be issued yet. Polling faster than the interval slows the device down
+// by another five seconds, as RFC 8628 asks; authorizations without an
+// interval are never slowed down.
+func (r *DeviceRepo) PollDeviceAuthorization(ctx context.Context, deviceCodeHash, clientID string) (string, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var (
+		status, owner string
+		userID        sql.NullString
+		interval      int
+		expired, fast bool
+	)
+	err = tx.QueryRowContext(ctx, `
+	SELECT
+		status,
+		client_id,
+		user_id,
+		poll_interval,
+		expires_at <= current_timestamp,
+		poll_interval > 0 AND coalesce(last_polled_at > current_timestamp - make_interval(secs => poll_interval), false)
+	FROM
+		device_authorizations
+	WHERE
+		device_code_hash = $1
+	FOR UPDATE
+	`, deviceCodeHash).Scan(&status, &owner, &userID, &interval, &expired, &fast)
+	if err == sql.ErrNoRows || (err == nil && owner != clientID) {
+		return "", ErrExpiredToken
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case expired || status == DeviceStatusConsumed:
+		return "", ErrExpiredToken
+	case status == DeviceStatusDenied:
+		return "", ErrAccessDenied
+	case fast:
+		interval += 5
+	case status == DeviceStatusApproved:
+		status = DeviceStatusConsumed
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE
+		device_authorizations
+	SET
+		status = $2,
+		poll_interval = $3,
+		last_polled_at = current_timestamp
+	WHERE
+		device_code_hash = $1
+	`, deviceCodeHash, status, interval)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	switch {
+	case fast:
+		return "", ErrSlowDown
+	case status == DeviceStatusConsumed:
+		return userID.String, nil
+	default:
+		return "", ErrAuthorizationPending
+	}
+}
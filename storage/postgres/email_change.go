@@ -0,0 +1,157 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrEmailChangeNotFound = errors.New("email change not found or expired")
+
+type EmailChange struct {
+	UserID           string
+	OldEmail         string
+	NewEmail         string
+	ConfirmTokenHash string
+	CancelTokenHash  string
+	ExpiresAt        time.Time
+}
+
+// CreateEmailChange stores a pending change and withdraws any older pending
+// change of the same user.
+func (r *UserRepo) CreateEmailChange(ctx context.Context, ch *EmailChange) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE
+		email_changes
+	SET
+		cancelled_at = current_timestamp
+	WHERE
+		user_id = $1 AND confirmed_at IS NULL AND cancelled_at IS NULL
+	`, ch.UserID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO email_changes (
+		user_id, old_email, new_email, confirm_token_hash, cancel_token_hash, expires_at
+	)
+	VALUES (
+		$1, $2, $3, $4, $5, $6
+	)`, ch.UserID, ch.OldEmail, ch.NewEmail, ch.ConfirmTokenHash, ch.CancelTokenHash, ch.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ConfirmEmailChange swaps the email of the user and revokes all of their
+// refresh tokens. The change only applies while the account still has the
+// email it was requested for.
+func (r *UserRepo) ConfirmEmailChange(ctx context.Context, confirmTokenHash string) (*EmailChange, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ch := EmailChange{ConfirmTokenHash: confirmTokenHash}
+	err = tx.QueryRowContext(ctx, `
+	UPDATE
+		email_changes
+	SET
+		confirmed_at = current_timestamp
+	WHERE
+		confirm_token_hash = $1 AND confirmed_at IS NULL AND cancelled_at IS NULL
+		AND expires_at > current_timestamp
+	RETURNING user_id, old_email, new_email
+	`, confirmTokenHash).Scan(&ch.UserID, &ch.OldEmail, &ch.NewEmail)
+	if err == sql.ErrNoRows {
+		return nil, ErrEmailChangeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+	UPDATE
+		users
+	SET
+		email = $2,
+		email_verified = true,
+		tokens_revoked_at = current_timestamp,
+		updated_at = current_timestamp
+	WHERE
+		id = $1 AND email = $3 AND deleted_at = 0
+	`, ch.UserID, ch.NewEmail, ch.OldEmail)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n < 1 {
+		return nil, ErrEmailChangeNotFound
+	}
+
+	return &ch, tx.Commit()
+}
+
+func (r *UserRepo) CancelEmailChange(ctx context.Context, cancelTokenHash string) error {
+	res, err := r.DB.ExecContext(ctx, `
+	UPDATE
+		email_changes
+	SET
+		cancelled_at = current_timestamp
+	WHERE
+		cancel_token_hash = $1 AND confirmed_at IS NULL AND cancelled_at IS NULL
+	`, cancelTokenHash)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n < 1 {
+		return ErrEmailChangeNotFound
+	}
+	return nil
+}
+
+// TokensRevokedAt returns the moment before which refresh tokens of the user
+// are void, or the zero time if they never were revoked.
+func (r *UserRepo) TokensRevokedAt(ctx context.Context, userID string) (time.Time, error) {
+	var revokedAt sql.NullTime
+	err := r.DB.QueryRowContext(ctx, `
+	SELECT
+		tokens_revoked_at
+	FROM
+		users
+	WHERE
+		id = $1 AND deleted_at = 0
+	`, userID).Scan(&revokedAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return revokedAt.Time, nil
+}
+
+// RevokeTokens voids the refresh tokens issued to the user so far.
+func (r *UserRepo) RevokeTokens(ctx context.Context, userID string) error {
+	res, err := r.DB.ExecContext(ctx, `
+	UPDATE
+		users
+	SET
+		tokens_revoked_at = current_timestamp
+	WHERE
+		id = $1 AND deleted_at = 0
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
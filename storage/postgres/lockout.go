@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	LockoutScopeUser = "user"
+	LockoutScopeIP   = "ip"
+)
+
+type LockoutRepo struct {
+	DB *sql.DB
+}
+
+func NewLockoutRepository(db *sql.DB) *LockoutRepo {
+	return &LockoutRepo{DB: db}
+}
+
+func (r *LockoutRepo) RecordAttempt(ctx context.Context, userID, login, ip string, success bool) error {
+	query := `
+	INSERT INTO login_attempts (user_id, login, ip, success)
+	VALUES (NULLIF($1, '')::UUID, $2, $3, $4)
+	`
+	_, err := r.DB.ExecContext(ctx, query, userID, login, ip, success)
+	return err
+}
+
+// LockedUntil reports when the lockout of the given subject expires, or the
+// zero time when it is not locked.
+func (r *LockoutRepo) LockedUntil(ctx context.Context, scope, key string) (time.Time, error) {
+	query := `
+	SELECT
+		locked_until
+	FROM
+		login_lockouts
+	WHERE
+		scope = $1 AND key = $2 AND locked_until > current_timestamp
+	`
+	var until time.Time
+	err := r.DB.QueryRowContext(ctx, query, scope, key).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+// LockoutPolicy tells when RegisterFailure locks a subject out.
+type LockoutPolicy struct {
+	// MaxFailures failures, each within Window of the one before, lock the
+	// subject out; 0 never does.
+	MaxFailures int
+	Window      time.Duration
+	// The first lockout lasts BaseDuration and every next one twice as long
+	// as the one before, up to MaxDuration. After Decay without failures the
+	// subject starts over from BaseDuration.
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+	Decay        time.Duration
+}
+
+// registerFailure counts the failure and locks the subject once it reaches
+// the limit, in one statement so that concurrent failures cannot both
+// escape or both cause the lockout. Failures and lockouts that are too old
+// are forgotten first; updated_at is the time of the last failure.
+var registerFailure = fmt.Sprintf(`
+	UPDATE
+		login_lockouts
+	SET
+		failures = CASE WHEN %[3]s THEN 0 ELSE %[1]s END,
+		lockouts = %[2]s + CASE WHEN %[3]s THEN 1 ELSE 0 END,
+		locked_until = CASE
+			WHEN %[3]s THEN current_timestamp + LEAST(
+				make_interval(secs => $6) * power(2, LEAST(%[2]s, 30)),
+				make_interval(secs => $7))
+			ELSE locked_until
+		END,
+		updated_at = current_timestamp
+	WHERE
+		scope = $1 AND key = $2
+	RETURNING failures = 0, locked_until
+	`,
+	// The failures with this one.
+	`(CASE WHEN updated_at < current_timestamp - make_interval(secs => $3) THEN 0 ELSE failures END + 1)`,
+	// The lockouts that still count.
+	`(CASE WHEN GREATEST(updated_at, locked_until) < current_timestamp - make_interval(secs => $4) THEN 0 ELSE lockouts END)`,
+	// Whether this failure locks the subject out.
+	`($5 > 0 AND (CASE WHEN updated_at < current_timestamp - make_interval(secs => $3) THEN 0 ELSE failures END + 1) >= $5)`,
+)
+
+// RegisterFailure counts a failed attempt and returns the end of the
+// lockout it caused, or the zero time when it caused none.
+func (r *LockoutRepo) RegisterFailure(ctx context.Context, scope, key string, p LockoutPolicy) (time.Time, error) {
+	_, err := r.DB.ExecContext(ctx, `
+	INSERT INTO login_lockouts (scope, key)
+	VALUES ($1, $2)
+	ON CONFLICT (scope, key) DO NOTHING
+	`, scope, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var (
+		locked bool
+		until  sql.NullTime
+	)
+	err = r.DB.QueryRowContext(ctx, registerFailure, scope, key,
+		p.Window.Seconds(), p.Decay.Seconds(), p.MaxFailures, p.BaseDuration.Seconds(), p.MaxDuration.Seconds(),
+	).Scan(&locked, &until)
+	if err != nil || !locked {
+		return time.Time{}, err
+	}
+	return until.Time, nil
+}
+
+// Reset forgets all failures and lockouts of the subject.
+func (r *LockoutRepo) Reset(ctx context.Context, scope, key string) error {
+	_, err := r.DB.ExecContext(ctx, `DELETE FROM login_lockouts WHERE scope = $1 AND key = $2`, scope, key)
+	return err
+}
+
+// ResetAddressesOf forgets the failures and lockouts of the addresses that
+// tried to sign in to the account of the user since the given time.
+func (r *LockoutRepo) ResetAddressesOf(ctx context.Context, userID string, since time.Time) error {
+	query := `
+	DELETE FROM
+		login_lockouts
+	WHERE
+		scope = $1 AND key IN (
+			SELECT DISTINCT ip FROM login_attempts
+			WHERE user_id = $2 AND ip <> '' AND attempted_at >= $3
+		)
+	`
+	_, err := r.DB.ExecContext(ctx, query, LockoutScopeIP, userID, since)
+	return err
+}
@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"auth/migrations"
+	"auth/pkg/migrate"
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testDB connects to the database of the configuration and brings its
+// schema up to date. Tests using it are skipped where there is none.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := ConnectDB(testConfig())
+	if err != nil {
+		t.Skipf("no database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := migrate.New(db, migrations.Auth, migrations.AuthTable, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRegisterFailure(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	r := NewLockoutRepository(db)
+	p := LockoutPolicy{MaxFailures: 3, Window: time.Minute, BaseDuration: time.Minute, MaxDuration: 3 * time.Minute, Decay: time.Hour}
+	key := uuid.NewString()
+	// age moves the last failure and the end of the lockout into the past.
+	age := func(d time.Duration) {
+		t.Helper()
+		_, err := db.ExecContext(ctx, `
+		UPDATE login_lockouts
+		SET updated_at = current_timestamp - make_interval(secs => $3), locked_until = current_timestamp - make_interval(secs => $3)
+		WHERE scope = $1 AND key = $2
+		`, LockoutScopeIP, key, d.Seconds())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// lockFor fails until the subject is locked out and returns for how long.
+	lockFor := func(failures int) time.Duration {
+		t.Helper()
+		for i := 1; i <= failures; i++ {
+			until, err := r.RegisterFailure(ctx, LockoutScopeIP, key, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i < failures && !until.IsZero() {
+				t.Fatalf("locked out after %d failures", i)
+			}
+			if i == failures {
+				if until.IsZero() {
+					t.Fatalf("not locked out after %d failures", i)
+				}
+				return time.Until(until).Round(time.Minute)
+			}
+		}
+		return 0
+	}
+
+	if d := lockFor(3); d != time.Minute {
+		t.Errorf("first lockout = %v", d)
+	}
+	age(time.Second)
+	if d := lockFor(3); d != 2*time.Minute {
+		t.Errorf("second lockout = %v", d)
+	}
+	age(time.Second)
+	if d := lockFor(3); d != 3*time.Minute {
+		t.Errorf("third lockout = %v, want the maximum", d)
+	}
+
+	// Failures further apart than the window do not add up.
+	age(time.Second)
+	for i := 0; i < 2; i++ {
+		if _, err := r.RegisterFailure(ctx, LockoutScopeIP, key, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	age(2 * time.Minute)
+	if d := lockFor(3); d != 3*time.Minute {
+		t.Errorf("lockout after the window = %v", d)
+	}
+
+	// After a quiet period the lockouts start over.
+	age(2 * time.Hour)
+	if d := lockFor(3); d != time.Minute {
+		t.Errorf("lockout after the decay = %v", d)
+	}
+}
+
+// TestRegisterFailureConcurrent checks that concurrent failures are all
+// counted and lock the subject out exactly once per limit.
+func TestRegisterFailureConcurrent(t *testing.T) {
+	ctx := context.Background()
+	r := NewLockoutRepository(testDB(t))
+	p := LockoutPolicy{MaxFailures: 5, Window: time.Minute, BaseDuration: time.Minute, MaxDuration: time.Hour, Decay: time.Hour}
+	key := uuid.NewString()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		lockouts int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			until, err := r.RegisterFailure(ctx, LockoutScopeIP, key, p)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !until.IsZero() {
+				mu.Lock()
+				lockouts++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if lockouts != 2 {
+		t.Errorf("%d lockouts, want 2", lockouts)
+	}
+}
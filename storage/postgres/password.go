@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+)
+
+// PasswordHistory returns the hashes of the last n passwords the user
+// replaced, newest first.
+func (r *UserRepo) PasswordHistory(ctx context.Context, userID string, n int) ([]string, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+	SELECT
+		password_hash
+	FROM
+		password_history
+	WHERE
+		user_id = $1
+	ORDER BY
+		created_at DESC, id DESC
+	LIMIT $2
+	`, userID, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, rows.Err()
+}
+
+// ChangePassword replaces the hash of the password and remembers the old
+// one, keeping only the last keep entries of the history. It returns
+// sql.ErrNoRows if the user does not exist or was deleted meanwhile.
+func (r *UserRepo) ChangePassword(ctx context.Context, userID, hash, oldHash string, keep int) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+	UPDATE
+		users
+	SET
+		password = $2,
+		must_change_password = false,
+		password_changed_at = current_timestamp,
+		updated_at = current_timestamp
+	WHERE
+		id = $1 AND deleted_at = 0
+	`, userID, hash)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if keep > 0 {
+		_, err = tx.ExecContext(ctx, `INSERT INTO password_history (user_id, password_hash) VALUES ($1, $2)`, userID, oldHash)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `
+	DELETE FROM
+		password_history
+	WHERE
+		user_id = $1 AND id NOT IN (
+			SELECT id FROM password_history WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2
+		)
+	`, userID, keep)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PasswordState tells whether an admin demanded a new password from the
+// user and whether their password is older than allowed. defaultMaxAgeDays
+// applies to users outside an organization with a limit of its own.
+func (r *UserRepo) PasswordState(ctx context.Context, userID string, defaultMaxAgeDays int) (mustChange, expired bool, err error) {
+	err = r.DB.QueryRowContext(ctx, `
+	SELECT
+		u.must_change_password,
+		COALESCE(o.password_max_age_days, $2) > 0
+			AND u.password_changed_at + make_interval(days => COALESCE(o.password_max_age_days, $2)) < current_timestamp
+	FROM
+		users u
+	LEFT JOIN
+		organizations o ON o.id = u.organization_id
+	WHERE
+		u.id = $1
+	`, userID, defaultMaxAgeDays).Scan(&mustChange, &expired)
+	return mustChange, expired, err
+}
+
+// ForcePasswordChange makes the user pick a new password at their next
+// login and ends their sessions.
+func (r *UserRepo) ForcePasswordChange(ctx context.Context, userID string) error {
+	res, err := r.DB.ExecContext(ctx, `
+	UPDATE
+		users
+	SET
+		must_change_password = true,
+		tokens_revoked_at = current_timestamp
+	WHERE
+		id = $1 AND deleted_at = 0
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetPasswordMaxAge sets how many days passwords of the members of an
+// organization are good for.
+func (r *UserRepo) SetPasswordMaxAge(ctx context.Context, slug string, days int) error {
+	res, err := r.DB.ExecContext(ctx, `UPDATE organizations SET password_max_age_days = $2 WHERE slug = $1`, slug, days)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -5,21 +5,33 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-func ConnectDB() (*sql.DB, error) {
-	cfg := config.Load()
-
-	conn := fmt.Sprintf("port = %s host=%s user=%s password=%s dbname=%s sslmode=disable",
-		cfg.Postgres.DB_PORT, cfg.Postgres.DB_HOST, cfg.Postgres.DB_USER, cfg.Postgres.DB_PASSWORD, cfg.Postgres.DB_NAME)
+func ConnectDB(cfg config.PostgresConfig) (*sql.DB, error) {
+	conn := cfg.DB_DSN
+	if conn == "" {
+		conn = fmt.Sprintf("port = %s host=%s user=%s password=%s dbname=%s sslmode=%s",
+			cfg.DB_PORT, cfg.DB_HOST, cfg.DB_USER, cfg.DB_PASSWORD, cfg.DB_NAME, cfg.DB_SSLMODE)
+	}
 
-	db, err := sql.Open("postgres", conn)
+	// Every query gets a span under the one of the RPC it serves.
+	db, err := otelsql.Open("postgres", conn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}),
+	)
 	if err != nil {
 		return nil, err
 	}
+	db.SetMaxOpenConns(cfg.DB_MAX_OPEN_CONNS)
+	db.SetMaxIdleConns(cfg.DB_MAX_IDLE_CONNS)
+	db.SetConnMaxLifetime(cfg.DB_CONN_MAX_LIFETIME)
+	db.SetConnMaxIdleTime(cfg.DB_CONN_MAX_IDLE_TIME)
 
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
@@ -0,0 +1,757 @@
+package postgres
+
+import (
+	pb "auth/genproto/users"
+	"auth/pkg/scim"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrScimNotFound        = errors.New("resource not found")
+	ErrScimVersionMismatch = errors.New("resource was modified since it was read")
+	ErrScimInvalidMember   = errors.New("members must be users of the organization")
+)
+
+const (
+	scimText = iota
+	scimExact
+	scimBool
+	scimTime
+	// scimExists columns are a subquery with a %s for the condition.
+	scimExists
+)
+
+type scimColumn struct {
+	expr string
+	kind int
+}
+
+var scimUserColumns = map[string]scimColumn{
+	"id":                {"u.id::text", scimExact},
+	"username":          {"s.user_name", scimText},
+	"externalid":        {"s.external_id", scimText},
+	"displayname":       {"u.full_name", scimText},
+	"name.formatted":    {"u.full_name", scimText},
+	"emails":            {"u.email", scimText},
+	"emails.value":      {"u.email", scimText},
+	"active":            {"u.deleted_at = 0", scimBool},
+	"meta.created":      {"u.created_at", scimTime},
+	"meta.lastmodified": {"u.updated_at", scimTime},
+}
+
+var scimGroupColumns = map[string]scimColumn{
+	"id":                {"g.id::text", scimExact},
+	"displayname":       {"g.display_name", scimText},
+	"externalid":        {"g.external_id", scimText},
+	"members":           {"EXISTS (SELECT 1 FROM scim_group_members m WHERE m.group_id = g.id AND m.user_id::text %s)", scimExists},
+	"members.value":     {"EXISTS (SELECT 1 FROM scim_group_members m WHERE m.group_id = g.id AND m.user_id::text %s)", scimExists},
+	"meta.created":      {"g.created_at", scimTime},
+	"meta.lastmodified": {"g.updated_at", scimTime},
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// scimWhere translates a filter into SQL, appending its parameters to args.
+func scimWhere(f scim.Filter, columns map[string]scimColumn, prefix string, args *[]interface{}) (string, error) {
+	switch f := f.(type) {
+	case scim.And, scim.Or:
+		var left, right scim.Filter
+		op := "AND"
+		if and, ok := f.(scim.And); ok {
+			left, right = and.Left, and.Right
+		} else {
+			or := f.(scim.Or)
+			left, right, op = or.Left, or.Right, "OR"
+		}
+		l, err := scimWhere(left, columns, prefix, args)
+		if err != nil {
+			return "", err
+		}
+		r, err := scimWhere(right, columns, prefix, args)
+		if err != nil {
+			return "", err
+		}
+		return "(" + l + " " + op + " " + r + ")", nil
+	case scim.Not:
+		inner, err := scimWhere(f.Filter, columns, prefix, args)
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + inner, nil
+	case scim.ValuePath:
+		return scimWhere(f.Filter, columns, prefix+f.Path+".", args)
+	case scim.Compare:
+		return scimCompare(f, columns, prefix, args)
+	}
+	return "", fmt.Errorf("unknown filter %T", f)
+}
+
+func scimCompare(f scim.Compare, columns map[string]scimColumn, prefix string, args *[]interface{}) (string, error) {
+	path := prefix + f.Path
+	col, ok := columns[path]
+	if !ok {
+		return "", scim.Errorf(http.StatusBadRequest, "invalidFilter", "filtering on %s is not supported", path)
+	}
+	unsupported := scim.Errorf(http.StatusBadRequest, "invalidFilter", "%s %s %v is not supported", path, f.Op, f.Value)
+	param := func(v interface{}) string {
+		*args = append(*args, v)
+		return fmt.Sprintf("$%d", len(*args))
+	}
+	sqlOps := map[string]string{"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+
+	if f.Op == "pr" {
+		switch col.kind {
+		case scimText:
+			return "(" + col.expr + " <> '')", nil
+		case scimTime:
+			return "(" + col.expr + " IS NOT NULL)", nil
+		case scimExists:
+			return fmt.Sprintf(col.expr, "IS NOT NULL"), nil
+		default:
+			return "TRUE", nil
+		}
+	}
+
+	switch col.kind {
+	case scimText:
+		value, ok := f.Value.(string)
+		if !ok {
+			return "", unsupported
+		}
+		lower := "lower(" + col.expr + ")"
+		switch f.Op {
+		case "co":
+			return lower + " LIKE '%' || lower(" + param(likeEscaper.Replace(value)) + ") || '%'", nil
+		case "sw":
+			return lower + " LIKE lower(" + param(likeEscaper.Replace(value)) + ") || '%'", nil
+		case "ew":
+			return lower + " LIKE '%' || lower(" + param(likeEscaper.Replace(value)) + ")", nil
+		}
+		return lower + " " + sqlOps[f.Op] + " lower(" + param(value) + ")", nil
+	case scimExact, scimExists:
+		value, ok := f.Value.(string)
+		if !ok || (f.Op != "eq" && f.Op != "ne") {
+			return "", unsupported
+		}
+		if col.kind == scimExists {
+			if f.Op == "ne" {
+				return "NOT " + fmt.Sprintf(col.expr, "= "+param(value)), nil
+			}
+			return fmt.Sprintf(col.expr, "= "+param(value)), nil
+		}
+		return col.expr + " " + sqlOps[f.Op] + " " + param(value), nil
+	case scimBool:
+		value, ok := f.Value.(bool)
+		if !ok || (f.Op != "eq" && f.Op != "ne") {
+			return "", unsupported
+		}
+		return "((" + col.expr + ") " + sqlOps[f.Op] + " " + param(value) + ")", nil
+	case scimTime:
+		value, ok := f.Value.(string)
+		if !ok || sqlOps[f.Op] == "" {
+			return "", unsupported
+		}
+		return col.expr + " " + sqlOps[f.Op] + " " + param(value) + "::timestamptz", nil
+	}
+	return "", unsupported
+}
+
+// CreateScimToken stores the hash of a new token of the organization with
+// slug, creating the organization if it doesn't exist yet.
+func (r *UserRepo) CreateScimToken(ctx context.Context, slug, tokenHash, description string) (string, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO organizations (slug, name)
+	VALUES ($1, $1)
+	ON CONFLICT (slug) DO NOTHING
+	`, slug)
+	if err != nil {
+		return "", err
+	}
+
+	var id string
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO scim_tokens (organization_id, token_hash, description)
+	SELECT id, $2, $3 FROM organizations WHERE slug = $1
+	RETURNING id
+	`, slug, tokenHash, description).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	return id, tx.Commit()
+}
+
+func (r *UserRepo) RevokeScimToken(ctx context.Context, id string) error {
+	res, err := r.DB.ExecContext(ctx, `
+	UPDATE
+		scim_tokens
+	SET
+		revoked_at = current_timestamp
+	WHERE
+		id::text = $1 AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrScimNotFound
+	}
+	return nil
+}
+
+// AuthenticateScimToken finds the partner owning an unrevoked token and
+// records its use.
+func (r *UserRepo) AuthenticateScimToken(ctx context.Context, tokenHash string) (*pb.ScimPartner, error) {
+	partner := pb.ScimPartner{}
+	err := r.DB.QueryRowContext(ctx, `
+	UPDATE
+		scim_tokens t
+	SET
+		last_used_at = current_timestamp
+	FROM
+		organizations o
+	WHERE
+		t.token_hash = $1 AND t.revoked_at IS NULL AND o.id = t.organization_id
+	RETURNING
+		o.id, o.slug, t.id
+	`, tokenHash).Scan(&partner.OrganizationId, &partner.Organization, &partner.TokenId)
+	if err != nil {
+		return nil, err
+	}
+	return &partner, nil
+}
+
+const scimUserSelect = `
+	SELECT
+		u.id, s.external_id, s.user_name, u.full_name, u.email, u.created_at, u.updated_at
+	FROM
+		scim_users s
+	JOIN
+		users u ON u.id = s.user_id
+	WHERE
+		s.organization_id = $1 AND u.deleted_at = 0`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanScimUser(row scanner) (*pb.ScimUser, error) {
+	user := pb.ScimUser{Active: true}
+	err := row.Scan(&user.Id, &user.ExternalId, &user.UserName, &user.FullName, &user.Email, &user.Created, &user.LastModified)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ScimListUsers returns a page of the users an organization provisioned.
+// startIndex counts from 1 as in SCIM.
+func (r *UserRepo) ScimListUsers(ctx context.Context, orgID string, filter scim.Filter, startIndex, count int64) ([]*pb.ScimUser, int64, error) {
+	args := []interface{}{orgID}
+	where := ""
+	if filter != nil {
+		cond, err := scimWhere(filter, scimUserColumns, "", &args)
+		if err != nil {
+			return nil, 0, err
+		}
+		where = " AND " + cond
+	}
+
+	var total int64
+	err := r.DB.QueryRowContext(ctx, `
+	SELECT
+		count(*)
+	FROM
+		scim_users s
+	JOIN
+		users u ON u.id = s.user_id
+	WHERE
+		s.organization_id = $1 AND u.deleted_at = 0`+where, args...).Scan(&total)
+	if err != nil || count == 0 {
+		return nil, total, err
+	}
+
+	query := scimUserSelect + where + fmt.Sprintf(" ORDER BY u.created_at, u.id LIMIT %d OFFSET %d", count, startIndex-1)
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []*pb.ScimUser
+	for rows.Next() {
+		user, err := scanScimUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return users, total, r.loadScimUserGroups(ctx, users)
+}
+
+func (r *UserRepo) ScimGetUser(ctx context.Context, orgID, id string) (*pb.ScimUser, error) {
+	user, err := scanScimUser(r.DB.QueryRowContext(ctx, scimUserSelect+" AND u.id::text = $2", orgID, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrScimNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, r.loadScimUserGroups(ctx, []*pb.ScimUser{user})
+}
+
+func (r *UserRepo) loadScimUserGroups(ctx context.Context, users []*pb.ScimUser) error {
+	if len(users) == 0 {
+		return nil
+	}
+	byID := make(map[string]*pb.ScimUser, len(users))
+	ids := make([]string, 0, len(users))
+	for _, u := range users {
+		byID[u.Id] = u
+		ids = append(ids, u.Id)
+	}
+	rows, err := r.DB.QueryContext(ctx, `
+	SELECT
+		m.user_id, g.id, g.display_name
+	FROM
+		scim_group_members m
+	JOIN
+		scim_groups g ON g.id = m.group_id
+	WHERE
+		m.user_id::text = ANY($1)
+	ORDER BY
+		g.display_name
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID string
+		group := pb.ScimMember{}
+		if err := rows.Scan(&userID, &group.Value, &group.Display); err != nil {
+			return err
+		}
+		byID[userID].Groups = append(byID[userID].Groups, &group)
+	}
+	return rows.Err()
+}
+
+// ScimCreateUser provisions a user. A user the organization deprovisioned
+// earlier is brought back when the same email is provisioned again.
+func (r *UserRepo) ScimCreateUser(ctx context.Context, orgID string, user *pb.ScimUser, username, password string) (*pb.ScimUser, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRowContext(ctx, `
+	UPDATE
+		users
+	SET
+		deleted_at = 0,
+		full_name = $3,
+		updated_at = current_timestamp
+	WHERE
+		lower(email) = lower($2) AND organization_id = $1 AND deleted_at <> 0
+	RETURNING id
+	`, orgID, user.Email, user.FullName).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (
+			username, email, password, full_name, organization_id
+		)
+		VALUES (
+			$1, $2, $3, $4, $5
+		)
+		RETURNING id
+		`, username, user.Email, password, user.FullName, orgID).Scan(&id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO scim_users (user_id, organization_id, user_name, external_id)
+	VALUES ($1, $2, $3, $4)
+	`, id, orgID, user.UserName, user.ExternalId)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.ScimGetUser(ctx, orgID, id)
+}
+
+// ScimReplaceUser overwrites a provisioned user. When ifMatch is set the
+// user must not have changed since that last modification time. Setting
+// active to false deprovisions the user.
+func (r *UserRepo) ScimReplaceUser(ctx context.Context, orgID string, user *pb.ScimUser, ifMatch string) (*pb.ScimUser, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var lastModified string
+	err = tx.QueryRowContext(ctx, `
+	SELECT
+		u.updated_at
+	FROM
+		scim_users s
+	JOIN
+		users u ON u.id = s.user_id
+	WHERE
+		s.organization_id = $1 AND u.id::text = $2 AND u.deleted_at = 0
+	FOR UPDATE
+	`, orgID, user.Id).Scan(&lastModified)
+	if err == sql.ErrNoRows {
+		return nil, ErrScimNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ifMatch != "" && ifMatch != lastModified {
+		return nil, ErrScimVersionMismatch
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE
+		users
+	SET
+		full_name = $2,
+		email = $3,
+		updated_at = current_timestamp
+	WHERE
+		id = $1
+	`, user.Id, user.FullName, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+	UPDATE
+		scim_users
+	SET
+		user_name = $2,
+		external_id = $3
+	WHERE
+		user_id = $1
+	`, user.Id, user.UserName, user.ExternalId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.Active {
+		if err := deprovisionScimUser(ctx, tx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		res := pb.ScimUser{Id: user.Id, ExternalId: user.ExternalId, UserName: user.UserName, FullName: user.FullName, Email: user.Email}
+		return &res, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.ScimGetUser(ctx, orgID, user.Id)
+}
+
+// ScimDeleteUser deprovisions a user by soft-deleting the account.
+func (r *UserRepo) ScimDeleteUser(ctx context.Context, orgID, id string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRowContext(ctx, `
+	SELECT
+		s.user_id
+	FROM
+		scim_users s
+	JOIN
+		users u ON u.id = s.user_id
+	WHERE
+		s.organization_id = $1 AND u.id::text = $2 AND u.deleted_at = 0
+	FOR UPDATE
+	`, orgID, id).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrScimNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := deprovisionScimUser(ctx, tx, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deprovisionScimUser soft-deletes the user, revokes its refresh tokens and
+// forgets its SCIM identity and group memberships, so the partner may
+// provision it again later.
+func deprovisionScimUser(ctx context.Context, tx *sql.Tx, userID string) error {
+	queries := []string{
+		`UPDATE users SET deleted_at = date_part('epoch', current_timestamp)::INT, tokens_revoked_at = current_timestamp WHERE id = $1 AND deleted_at = 0`,
+		`DELETE FROM scim_group_members WHERE user_id = $1`,
+		`DELETE FROM scim_users WHERE user_id = $1`,
+	}
+	for _, q := range queries {
+		if _, err := tx.ExecContext(ctx, q, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const scimGroupSelect = `
+	SELECT
+		g.id, g.external_id, g.display_name, g.created_at, g.updated_at
+	FROM
+		scim_groups g
+	WHERE
+		g.organization_id = $1`
+
+func scanScimGroup(row scanner) (*pb.ScimGroup, error) {
+	group := pb.ScimGroup{}
+	err := row.Scan(&group.Id, &group.ExternalId, &group.DisplayName, &group.Created, &group.LastModified)
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (r *UserRepo) ScimListGroups(ctx context.Context, orgID string, filter scim.Filter, startIndex, count int64) ([]*pb.ScimGroup, int64, error) {
+	args := []interface{}{orgID}
+	where := ""
+	if filter != nil {
+		cond, err := scimWhere(filter, scimGroupColumns, "", &args)
+		if err != nil {
+			return nil, 0, err
+		}
+		where = " AND " + cond
+	}
+
+	var total int64
+	err := r.DB.QueryRowContext(ctx, `SELECT count(*) FROM scim_groups g WHERE g.organization_id = $1`+where, args...).Scan(&total)
+	if err != nil || count == 0 {
+		return nil, total, err
+	}
+
+	query := scimGroupSelect + where + fmt.Sprintf(" ORDER BY g.created_at, g.id LIMIT %d OFFSET %d", count, startIndex-1)
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var groups []*pb.ScimGroup
+	for rows.Next() {
+		group, err := scanScimGroup(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return groups, total, r.loadScimGroupMembers(ctx, groups)
+}
+
+func (r *UserRepo) ScimGetGroup(ctx context.Context, orgID, id string) (*pb.ScimGroup, error) {
+	group, err := scanScimGroup(r.DB.QueryRowContext(ctx, scimGroupSelect+" AND g.id::text = $2", orgID, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrScimNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return group, r.loadScimGroupMembers(ctx, []*pb.ScimGroup{group})
+}
+
+func (r *UserRepo) loadScimGroupMembers(ctx context.Context, groups []*pb.ScimGroup) error {
+	if len(groups) == 0 {
+		return nil
+	}
+	byID := make(map[string]*pb.ScimGroup, len(groups))
+	ids := make([]string, 0, len(groups))
+	for _, g := range groups {
+		byID[g.Id] = g
+		ids = append(ids, g.Id)
+	}
+	rows, err := r.DB.QueryContext(ctx, `
+	SELECT
+		m.group_id, u.id, s.user_name
+	FROM
+		scim_group_members m
+	JOIN
+		users u ON u.id = m.user_id
+	JOIN
+		scim_users s ON s.user_id = u.id
+	WHERE
+		m.group_id::text = ANY($1) AND u.deleted_at = 0
+	ORDER BY
+		s.user_name
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var groupID string
+		member := pb.ScimMember{}
+		if err := rows.Scan(&groupID, &member.Value, &member.Display); err != nil {
+			return err
+		}
+		byID[groupID].Members = append(byID[groupID].Members, &member)
+	}
+	return rows.Err()
+}
+
+func (r *UserRepo) ScimCreateGroup(ctx context.Context, orgID string, group *pb.ScimGroup) (*pb.ScimGroup, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO scim_groups (organization_id, display_name, external_id)
+	VALUES ($1, $2, $3)
+	RETURNING id
+	`, orgID, group.DisplayName, group.ExternalId).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	if err := setScimGroupMembers(ctx, tx, orgID, id, group.Members); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.ScimGetGroup(ctx, orgID, id)
+}
+
+// ScimReplaceGroup overwrites a group and its members, optionally only if it
+// is unchanged since ifMatch.
+func (r *UserRepo) ScimReplaceGroup(ctx context.Context, orgID string, group *pb.ScimGroup, ifMatch string) (*pb.ScimGroup, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var lastModified string
+	err = tx.QueryRowContext(ctx, `
+	SELECT
+		updated_at
+	FROM
+		scim_groups
+	WHERE
+		organization_id = $1 AND id::text = $2
+	FOR UPDATE
+	`, orgID, group.Id).Scan(&lastModified)
+	if err == sql.ErrNoRows {
+		return nil, ErrScimNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ifMatch != "" && ifMatch != lastModified {
+		return nil, ErrScimVersionMismatch
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE
+		scim_groups
+	SET
+		display_name = $2,
+		external_id = $3,
+		updated_at = current_timestamp
+	WHERE
+		id = $1
+	`, group.Id, group.DisplayName, group.ExternalId)
+	if err != nil {
+		return nil, err
+	}
+	if err := setScimGroupMembers(ctx, tx, orgID, group.Id, group.Members); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.ScimGetGroup(ctx, orgID, group.Id)
+}
+
+func (r *UserRepo) ScimDeleteGroup(ctx context.Context, orgID, id string) error {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM scim_groups WHERE organization_id = $1 AND id::text = $2`, orgID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrScimNotFound
+	}
+	return nil
+}
+
+// setScimGroupMembers replaces the members of a group. Every member has to
+// be an active user the organization provisioned.
+func setScimGroupMembers(ctx context.Context, tx *sql.Tx, orgID, groupID string, members []*pb.ScimMember) error {
+	ids := make([]string, 0, len(members))
+	seen := make(map[string]bool)
+	for _, m := range members {
+		if !seen[m.Value] {
+			seen[m.Value] = true
+			ids = append(ids, m.Value)
+		}
+	}
+
+	var valid int
+	err := tx.QueryRowContext(ctx, `
+	SELECT
+		count(*)
+	FROM
+		scim_users s
+	JOIN
+		users u ON u.id = s.user_id
+	WHERE
+		s.organization_id = $1 AND u.id::text = ANY($2) AND u.deleted_at = 0
+	`, orgID, pq.Array(ids)).Scan(&valid)
+	if err != nil {
+		return err
+	}
+	if valid != len(ids) {
+		return ErrScimInvalidMember
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM scim_group_members WHERE group_id = $1`, groupID); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO scim_group_members (group_id, user_id)
+	SELECT $1, u.id FROM users u WHERE u.id::text = ANY($2)
+	`, groupID, pq.Array(ids))
+	return err
+}
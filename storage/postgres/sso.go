@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	pb "auth/genproto/users"
+	"context"
+	"database/sql"
+)
+
+// EnsureOrganization returns the id of the organization with slug, creating
+// it the first time one of its users signs in.
+func (r *UserRepo) EnsureOrganization(ctx context.Context, slug, name string) (string, error) {
+	var id string
+	err := r.DB.QueryRowContext(ctx, `
+	INSERT INTO organizations (slug, name)
+	VALUES ($1, $2)
+	ON CONFLICT (slug) DO UPDATE SET
+		name = EXCLUDED.name
+	RETURNING id
+	`, slug, name).Scan(&id)
+	return id, err
+}
+
+// GetUserBySSOIdentity returns the user linked to subject at provider and
+// records the sign in. It returns sql.ErrNoRows for unknown subjects.
+func (r *UserRepo) GetUserBySSOIdentity(ctx context.Context, provider, subject string) (*pb.UserInfo, error) {
+	var userID string
+	err := r.DB.QueryRowContext(ctx, `
+	UPDATE
+		sso_identities s
+	SET
+		last_login_at = current_timestamp
+	FROM
+		users u
+	WHERE
+		s.provider = $1 AND s.subject = $2 AND u.id = s.user_id AND u.deleted_at = 0
+	RETURNING
+		s.user_id
+	`, provider, subject).Scan(&userID)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetUserByID(ctx, userID)
+}
+
+// LinkSSOIdentity links subject at provider to an existing user and moves
+// them into the organization of the provider.
+func (r *UserRepo) LinkSSOIdentity(ctx context.Context, provider, subject, userID, organizationID string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := linkSSOIdentity(ctx, tx, provider, subject, userID, organizationID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateSSOUser creates a user for a subject seen for the first time.
+func (r *UserRepo) CreateSSOUser(ctx context.Context, user *pb.UserInfo, provider, subject, organizationID string) (*pb.UserInfo, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res := pb.UserInfo{Username: user.Username, Email: user.Email, FullName: user.FullName}
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO users (
+		username, email, password, full_name
+	)
+	VALUES (
+		$1, $2, $3, $4
+	)
+	RETURNING id, role
+	`, user.Username, user.Email, user.Password, user.FullName).Scan(&res.Id, &res.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := linkSSOIdentity(ctx, tx, provider, subject, res.Id, organizationID); err != nil {
+		return nil, err
+	}
+	return &res, tx.Commit()
+}
+
+func linkSSOIdentity(ctx context.Context, tx *sql.Tx, provider, subject, userID, organizationID string) error {
+	_, err := tx.ExecContext(ctx, `
+	INSERT INTO sso_identities (provider, subject, user_id)
+	VALUES ($1, $2, $3)
+	`, provider, subject, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE
+		users
+	SET
+		organization_id = $2,
+		updated_at = current_timestamp
+	WHERE
+		id = $1
+	`, userID, organizationID)
+	return err
+}
+
+// UserOrganization returns the id of the organization of a user, or an empty
+// string for users outside any organization.
+func (r *UserRepo) UserOrganization(ctx context.Context, userID string) (string, error) {
+	var id sql.NullString
+	err := r.DB.QueryRowContext(ctx, `SELECT organization_id FROM users WHERE id = $1`, userID).Scan(&id)
+	return id.String, err
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 )
 
 type UserRepo struct {
@@ -27,7 +28,8 @@ func (r *UserRepo) GetUserByID(ctx context.Context, id string) (*pb.UserInfo, er
 		password,
 		full_name,
 		bio,
-		countries_visited
+		countries_visited,
+		role
 	FROM
 		users
 	WHERE
@@ -36,7 +38,7 @@ func (r *UserRepo) GetUserByID(ctx context.Context, id string) (*pb.UserInfo, er
 	row := r.DB.QueryRowContext(ctx, query, id)
 
 	var bio sql.NullString
-	err := row.Scan(&user.Username, &user.Email, &user.Password, &user.FullName, &bio, &user.CountriesVisited)
+	err := row.Scan(&user.Username, &user.Email, &user.Password, &user.FullName, &bio, &user.CountriesVisited, &user.Role)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("user not found")
@@ -107,24 +109,45 @@ func (r *UserRepo) CreateUser(ctx context.Context, req *pb.RegisterRequest) (*pb
 }
 
 func (r *UserRepo) GetUserByEmail(ctx context.Context, email string) (*pb.UserInfo, error) {
-	user := pb.UserInfo{Email: email}
+	return r.getUserBy(ctx, "email", email)
+}
 
-	query := `
+func (r *UserRepo) GetUserByUsername(ctx context.Context, username string) (*pb.UserInfo, error) {
+	return r.getUserBy(ctx, "username", username)
+}
+
+// GetUserByLogin resolves the identifier typed into the login form, which may
+// be either an email address or a username.
+func (r *UserRepo) GetUserByLogin(ctx context.Context, login string) (*pb.UserInfo, error) {
+	if strings.Contains(login, "@") {
+		return r.GetUserByEmail(ctx, login)
+	}
+	return r.GetUserByUsername(ctx, login)
+}
+
+// getUserBy matches column case-insensitively; the lower() unique indexes
+// guarantee at most one row.
+func (r *UserRepo) getUserBy(ctx context.Context, column, value string) (*pb.UserInfo, error) {
+	user := pb.UserInfo{}
+
+	query := fmt.Sprintf(`
 	SELECT id,
 	username,
+	email,
 	password,
 	full_name,
 	bio,
-	countries_visited
+	countries_visited,
+	role
 	from
 		users
 	where
-		email = $1 and deleted_at=0
-	`
-	row := r.DB.QueryRowContext(ctx, query, email)
+		lower(%s) = lower($1) and deleted_at=0
+	`, column)
+	row := r.DB.QueryRowContext(ctx, query, value)
 	var bio sql.NullString
 
-	err := row.Scan(&user.Id, &user.Username, &user.Password, &user.FullName, &bio, &user.CountriesVisited)
+	err := row.Scan(&user.Id, &user.Username, &user.Email, &user.Password, &user.FullName, &bio, &user.CountriesVisited, &user.Role)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, err
@@ -159,23 +182,29 @@ func (r *UserRepo) UpdateUser(ctx context.Context, req *pb.UpdateProfileRequest)
 		arr = append(arr, req.CountriesVisited)
 		n++
 	}
+	if len(req.Locale) > 0 {
+		query += fmt.Sprintf("locale = $%d, ", n)
+		arr = append(arr, req.Locale)
+		n++
+	}
 	query += fmt.Sprintf("updated_at=current_timestamp where id=$%d and deleted_at=0 ", n)
 	arr = append(arr, req.Id)
 
-	_, err := r.DB.Exec(query, arr...)
+	_, err := r.DB.ExecContext(ctx, query, arr...)
 	if err != nil {
 		return nil, err
 	}
 
 	var res pb.UpdateProfileResponse
-	err = r.DB.QueryRow(`SELECT id,
+	err = r.DB.QueryRowContext(ctx, `SELECT id,
 	username,
 	email,
 	full_name,
 	bio,
 	countries_visited,
-	updated_at
-	from users where id = $1 and deleted_at=0`, req.Id).Scan(&res.Id, &res.Username, &res.Email, &res.FullName, &res.Bio, &res.CountriesVisited, &res.UpdatedAt)
+	updated_at,
+	locale
+	from users where id = $1 and deleted_at=0`, req.Id).Scan(&res.Id, &res.Username, &res.Email, &res.FullName, &res.Bio, &res.CountriesVisited, &res.UpdatedAt, &res.Locale)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, err
@@ -193,7 +222,7 @@ func (r *UserRepo) GetUsers(ctx context.Context, req *pb.GetUsersRequest) (*pb.G
 	if req.Offset > 0 {
 		query += fmt.Sprintf("OFFSET %d ", req.Offset)
 	}
-	rows, err := r.DB.Query(query)
+	rows, err := r.DB.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -244,15 +273,6 @@ func (r *UserRepo) DeleteUser(ctx context.Context, id string) error {
 	return nil
 }
 
-func (r *UserRepo) UpdatePassword(ctx context.Context, req *pb.EmailRecoveryRequest) error {
-	query := `update users set password=$1 where id=$2`
-	_, err := r.DB.ExecContext(ctx, query, req.NewPassword, req.UserId)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
 func (r *UserRepo) GetUserActivity(ctx context.Context, userID string) (*pb.ActivityResponse, error) {
 	var activityResponse pb.ActivityResponse
 
@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"auth/config"
 	pb "auth/genproto/users"
 	"context"
 	"fmt"
@@ -8,8 +9,17 @@ import (
 	"testing"
 )
 
+func testConfig() config.PostgresConfig {
+	// Only the database settings are used.
+	cfg, err := config.Load([]string{"--jwt-allow-default-secrets", "true"})
+	if err != nil {
+		panic(err)
+	}
+	return cfg.Postgres
+}
+
 func TestCreateUser(t *testing.T) {
-	db, err := ConnectDB()
+	db, err := ConnectDB(testConfig())
 	if err != nil {
 		panic(err)
 	}
@@ -37,7 +47,7 @@ func TestCreateUser(t *testing.T) {
 }
 
 func TestGetUserByID(t *testing.T) {
-	db, err := ConnectDB()
+	db, err := ConnectDB(testConfig())
 	if err != nil {
 		panic(err)
 	}
@@ -54,6 +64,7 @@ func TestGetUserByID(t *testing.T) {
 		Username:         "test",
 		FullName:         "test",
 		CountriesVisited: 0,
+		Role:             "user",
 	}
 	if !reflect.DeepEqual(res, req) {
 		t.Errorf("GetUserByID returned %+v, want %+v", res, req)
@@ -61,7 +72,7 @@ func TestGetUserByID(t *testing.T) {
 }
 
 func TestGetUserProfile(t *testing.T) {
-	db, err := ConnectDB()
+	db, err := ConnectDB(testConfig())
 	if err != nil {
 		panic(err)
 	}
@@ -86,7 +97,7 @@ func TestGetUserProfile(t *testing.T) {
 }
 
 func TestGetUserByEmail(t *testing.T) {
-	db, err := ConnectDB()
+	db, err := ConnectDB(testConfig())
 	if err != nil {
 		panic(err)
 	}
@@ -103,6 +114,7 @@ func TestGetUserByEmail(t *testing.T) {
 		Username:         "test",
 		FullName:         "test",
 		CountriesVisited: 0,
+		Role:             "user",
 	}
 	if !reflect.DeepEqual(res, req) {
 		t.Errorf("GetUserByID returned %+v, want %+v", res, req)
@@ -110,7 +122,7 @@ func TestGetUserByEmail(t *testing.T) {
 }
 
 func TestUpdateUser(t *testing.T) {
-	db, err := ConnectDB()
+	db, err := ConnectDB(testConfig())
 	if err != nil {
 		panic(err)
 	}
@@ -139,7 +151,7 @@ func TestUpdateUser(t *testing.T) {
 }
 
 func TestDeleteUser(t *testing.T) {
-	db, err := ConnectDB()
+	db, err := ConnectDB(testConfig())
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,189 @@
+package postgres
+
+import (
+	pb "auth/genproto/users"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LastUsernameChange returns when the user last changed their username, or
+// the zero time if they never did.
+func (r *UserRepo) LastUsernameChange(ctx context.Context, userID string) (time.Time, error) {
+	var changedAt sql.NullTime
+	err := r.DB.QueryRowContext(ctx, `
+	SELECT
+		max(changed_at)
+	FROM
+		username_history
+	WHERE
+		user_id = $1
+	`, userID).Scan(&changedAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return changedAt.Time, nil
+}
+
+// UsernameReservedBy returns the user holding a reservation on a username
+// they gave up, or an empty string when it is free.
+func (r *UserRepo) UsernameReservedBy(ctx context.Context, username string) (string, error) {
+	var userID string
+	err := r.DB.QueryRowContext(ctx, `
+	SELECT
+		user_id
+	FROM
+		username_history
+	WHERE
+		lower(username) = lower($1) AND reserved_until > current_timestamp
+	ORDER BY
+		changed_at DESC
+	LIMIT 1
+	`, username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return userID, err
+}
+
+// Errors of ChangeUsername.
+var (
+	ErrUsernameChangeTooSoon = errors.New("username was changed too recently")
+	ErrUsernameReserved      = errors.New("username is reserved by another user")
+)
+
+// ChangeUsername renames the user and keeps the old name reserved for them
+// for reservation. It returns the old name, or ErrUsernameChangeTooSoon if
+// they renamed themselves less than cooldown ago and ErrUsernameReserved if
+// another user gave the name up recently.
+//
+// The user row is locked so that concurrent renames of the same user see
+// each other, and both names are locked so that a rename taking a name
+// waits for one giving it up.
+func (r *UserRepo) ChangeUsername(ctx context.Context, userID, username string, cooldown, reservation time.Duration) (string, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var old string
+	err = tx.QueryRowContext(ctx, `
+	SELECT
+		username
+	FROM
+		users
+	WHERE
+		id = $1 AND deleted_at = 0
+	FOR UPDATE
+	`, userID).Scan(&old)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	SELECT
+		pg_advisory_xact_lock(hashtext('username:' || name))
+	FROM
+		(SELECT DISTINCT lower(n) AS name FROM unnest(ARRAY[$1, $2]::TEXT[]) n ORDER BY name) names
+	`, old, username)
+	if err != nil {
+		return "", err
+	}
+
+	var tooSoon, reserved bool
+	err = tx.QueryRowContext(ctx, `
+	SELECT
+		COALESCE(max(changed_at) FILTER (WHERE user_id = $1) + make_interval(secs => $3) > current_timestamp, false),
+		COALESCE(bool_or(user_id <> $1 AND lower(username) = lower($2) AND reserved_until > current_timestamp), false)
+	FROM
+		username_history
+	WHERE
+		user_id = $1 OR lower(username) = lower($2)
+	`, userID, username, cooldown.Seconds()).Scan(&tooSoon, &reserved)
+	if err != nil {
+		return "", err
+	}
+	if tooSoon {
+		return "", ErrUsernameChangeTooSoon
+	}
+	if reserved {
+		return "", ErrUsernameReserved
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO username_history (user_id, username, reserved_until)
+	VALUES ($1, $2, current_timestamp + make_interval(secs => $3))
+	`, userID, old, reservation.Seconds())
+	if err != nil {
+		return "", err
+	}
+
+	// Taking back one of their own old names ends its reservation.
+	_, err = tx.ExecContext(ctx, `
+	UPDATE
+		username_history
+	SET
+		reserved_until = current_timestamp
+	WHERE
+		user_id = $1 AND lower(username) = lower($2) AND reserved_until > current_timestamp
+	`, userID, username)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE
+		users
+	SET
+		username = $2,
+		updated_at = current_timestamp
+	WHERE
+		id = $1
+	`, userID, username)
+	if err != nil {
+		return "", err
+	}
+
+	return old, tx.Commit()
+}
+
+// ResolveUsername finds the account currently using username or, failing
+// that, the account that gave it up within its reservation period. The
+// second result tells which of the two happened.
+func (r *UserRepo) ResolveUsername(ctx context.Context, username string) (*pb.Users, bool, error) {
+	user := pb.Users{}
+	err := r.DB.QueryRowContext(ctx, `
+	SELECT
+		id, username, full_name, countries_visited
+	FROM
+		users
+	WHERE
+		lower(username) = lower($1) AND deleted_at = 0
+	`, username).Scan(&user.Id, &user.Username, &user.FullName, &user.CountriesVisited)
+	if err == nil {
+		return &user, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, err
+	}
+
+	err = r.DB.QueryRowContext(ctx, `
+	SELECT
+		u.id, u.username, u.full_name, u.countries_visited
+	FROM
+		username_history h
+	JOIN
+		users u ON u.id = h.user_id
+	WHERE
+		lower(h.username) = lower($1) AND h.reserved_until > current_timestamp AND u.deleted_at = 0
+	ORDER BY
+		h.changed_at DESC
+	LIMIT 1
+	`, username).Scan(&user.Id, &user.Username, &user.FullName, &user.CountriesVisited)
+	if err != nil {
+		return nil, false, err
+	}
+	return &user, true, nil
+}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	pb "auth/genproto/users"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testUsername returns a username no other test run uses.
+func testUsername() string {
+	return "t" + strings.ReplaceAll(uuid.NewString(), "-", "")[:20]
+}
+
+func createTestUser(t *testing.T, r *UserRepo) (string, string) {
+	t.Helper()
+	username := testUsername()
+	res, err := r.CreateUser(context.Background(), &pb.RegisterRequest{Username: username, Email: username + "@example.com", Password: "x", FullName: username})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.Id, username
+}
+
+// TestChangeUsernameConcurrent checks that concurrent renames of a user
+// honour the cooldown: only one of them goes through.
+func TestChangeUsernameConcurrent(t *testing.T) {
+	ctx := context.Background()
+	r := NewUserRepository(testDB(t))
+	userID, _ := createTestUser(t, r)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		renamed int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.ChangeUsername(ctx, userID, testUsername(), time.Hour, time.Hour)
+			if err != nil && !errors.Is(err, ErrUsernameChangeTooSoon) {
+				t.Error(err)
+				return
+			}
+			if err == nil {
+				mu.Lock()
+				renamed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if renamed != 1 {
+		t.Errorf("%d renames went through, want 1", renamed)
+	}
+}
+
+// TestChangeUsernameReserved checks that a name given up stays with its
+// former owner, who may take it back.
+func TestChangeUsernameReserved(t *testing.T) {
+	ctx := context.Background()
+	r := NewUserRepository(testDB(t))
+	alice, name := createTestUser(t, r)
+	bob, _ := createTestUser(t, r)
+
+	if _, err := r.ChangeUsername(ctx, alice, testUsername(), 0, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ChangeUsername(ctx, bob, strings.ToUpper(name), 0, time.Hour); !errors.Is(err, ErrUsernameReserved) {
+		t.Errorf("taking a reserved name = %v, want ErrUsernameReserved", err)
+	}
+	if _, err := r.ChangeUsername(ctx, alice, name, 0, time.Hour); err != nil {
+		t.Errorf("taking back an own name = %v", err)
+	}
+}